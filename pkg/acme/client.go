@@ -21,9 +21,13 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
 	"reflect"
 	"strings"
 
@@ -43,6 +47,17 @@ var (
 
 // NewClient ...
 func NewClient(logger types.Logger, resolver ClientResolver, account *Account) (Client, error) {
+	client, err := newClient(logger, resolver, account)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.ensureAccount(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func newClient(logger types.Logger, resolver ClientResolver, account *Account) (*client, error) {
 	key, err := resolver.GetKey()
 	if err != nil {
 		return nil, err
@@ -52,7 +67,7 @@ func NewClient(logger types.Logger, resolver ClientResolver, account *Account) (
 	for i, email := range emails {
 		contact[i] = "mailto:" + email
 	}
-	client := &client{
+	return &client{
 		client: &acme.Client{
 			DirectoryURL: account.Endpoint + "/directory",
 			Key:          key,
@@ -64,11 +79,7 @@ func NewClient(logger types.Logger, resolver ClientResolver, account *Account) (
 		logger:      logger,
 		resolver:    resolver,
 		termsAgreed: account.TermsAgreed,
-	}
-	if err := client.ensureAccount(); err != nil {
-		return nil, err
-	}
-	return client, nil
+	}, nil
 }
 
 // Account ...
@@ -78,6 +89,57 @@ type Account struct {
 	TermsAgreed bool
 }
 
+// TransportConfig has the settings of the HTTP transport used to connect to
+// the acme server. ProxyURL overrides the proxy configured via environment
+// variables, and RootCAs overrides the system's root CAs, e.g. to connect to
+// a private acme server. The zero value uses the default transport.
+type TransportConfig struct {
+	ProxyURL string
+	RootCAs  *x509.CertPool
+}
+
+// NewTransportConfig creates the transport settings from a proxy url and a
+// file with the PEM encoded root CAs. Both are optional.
+func NewTransportConfig(proxyURL, rootCAsFile string) (TransportConfig, error) {
+	transport := TransportConfig{ProxyURL: proxyURL}
+	if proxyURL != "" {
+		if _, err := url.Parse(proxyURL); err != nil {
+			return transport, fmt.Errorf("invalid proxy url '%s': %w", proxyURL, err)
+		}
+	}
+	if rootCAsFile != "" {
+		data, err := os.ReadFile(rootCAsFile)
+		if err != nil {
+			return transport, fmt.Errorf("error reading root CAs: %w", err)
+		}
+		transport.RootCAs = x509.NewCertPool()
+		if !transport.RootCAs.AppendCertsFromPEM(data) {
+			return transport, fmt.Errorf("no certificate found in root CAs file '%s'", rootCAsFile)
+		}
+	}
+	return transport, nil
+}
+
+// httpClient returns the HTTP client configured by the transport settings,
+// or nil if the default one should be used.
+func (t *TransportConfig) httpClient() (*http.Client, error) {
+	if t.ProxyURL == "" && t.RootCAs == nil {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t.ProxyURL != "" {
+		proxyURL, err := url.Parse(t.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url '%s': %w", t.ProxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if t.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: t.RootCAs}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
 // ClientResolver ...
 type ClientResolver interface {
 	GetKey() (crypto.Signer, error)
@@ -91,6 +153,7 @@ type Client interface {
 
 type client struct {
 	client      *acme.Client
+	accountURL  string
 	contact     []string
 	ctx         context.Context
 	endpoint    string
@@ -99,22 +162,30 @@ type client struct {
 	termsAgreed bool
 }
 
+func (c *client) keyThumbprint() (string, error) {
+	return acme.JWKThumbprint(c.client.Key.Public())
+}
+
 func (c *client) ensureAccount() error {
-	if acct, err := c.client.GetAccount(c.ctx); err != nil {
+	acct, err := c.client.GetAccount(c.ctx)
+	if err != nil {
 		acmeErr, ok := err.(*acme.Error)
-		if ok && acmeErr.Type == acmeErrAcctDoesNotExist {
-			_, err = c.client.CreateAccount(c.ctx, &acme.Account{
-				Contact:     c.contact,
-				TermsAgreed: c.termsAgreed,
-			})
-			if err != nil {
-				return err
-			}
-			c.logger.Info("acme: terms agreed, new account created on %s", c.endpoint)
-		} else {
+		if !ok || acmeErr.Type != acmeErrAcctDoesNotExist {
 			return err
 		}
-	} else if !reflect.DeepEqual(acct.Contact, c.contact) {
+		acct, err = c.client.CreateAccount(c.ctx, &acme.Account{
+			Contact:     c.contact,
+			TermsAgreed: c.termsAgreed,
+		})
+		if err != nil {
+			return err
+		}
+		c.accountURL = acct.URL
+		c.logger.Info("acme: terms agreed, new account created on %s", c.endpoint)
+		return nil
+	}
+	c.accountURL = acct.URL
+	if !reflect.DeepEqual(acct.Contact, c.contact) {
 		c.logger.InfoV(2, "acme: changing contact from %+v to %+v", acct.Contact, c.contact)
 		acct.Contact = c.contact
 		if _, err := c.client.UpdateAccount(c.ctx, acct); err == nil {
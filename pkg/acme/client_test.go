@@ -20,8 +20,13 @@ import (
 	"crypto"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,6 +58,92 @@ const (
 	wwwpublic = ``
 )
 
+func TestTransportConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	tempdir := t.TempDir()
+	rootCAs := filepath.Join(tempdir, "ca.pem")
+	pemCrt := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(rootCAs, pemCrt, 0644); err != nil {
+		t.Fatalf("error writing root CAs: %v", err)
+	}
+	invalidCAs := filepath.Join(tempdir, "invalid.pem")
+	if err := os.WriteFile(invalidCAs, []byte("invalid"), 0644); err != nil {
+		t.Fatalf("error writing root CAs: %v", err)
+	}
+
+	testCases := []struct {
+		proxyURL    string
+		rootCAsFile string
+		expProxy    string
+		expError    string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			proxyURL: "http://proxy.local:3128",
+			expProxy: "http://proxy.local:3128",
+		},
+		// 2
+		{
+			rootCAsFile: rootCAs,
+		},
+		// 3
+		{
+			proxyURL: "http://[::1",
+			expError: "invalid proxy url 'http://[::1'",
+		},
+		// 4
+		{
+			rootCAsFile: filepath.Join(tempdir, "missing.pem"),
+			expError:    "error reading root CAs",
+		},
+		// 5
+		{
+			rootCAsFile: invalidCAs,
+			expError:    "no certificate found in root CAs file '" + invalidCAs + "'",
+		},
+	}
+	for i, test := range testCases {
+		transport, err := NewTransportConfig(test.proxyURL, test.rootCAsFile)
+		if test.expError != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.expError) {
+				t.Errorf("expected error '%s' on %d, but was '%v'", test.expError, i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error on %d: %v", i, err)
+			continue
+		}
+		httpClient, err := transport.httpClient()
+		if err != nil {
+			t.Errorf("unexpected error building client on %d: %v", i, err)
+			continue
+		}
+		if test.proxyURL == "" && test.rootCAsFile == "" {
+			if httpClient != nil {
+				t.Errorf("expected default client on %d", i)
+			}
+			continue
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		proxy, _ := httpClient.Transport.(*http.Transport).Proxy(req)
+		if proxy != nil && proxy.String() != test.expProxy || proxy == nil && test.expProxy != "" {
+			t.Errorf("expected proxy '%s' on %d, but was '%v'", test.expProxy, i, proxy)
+		}
+		if test.rootCAsFile != "" {
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Errorf("expected server trusted on %d, but was: %v", i, err)
+			} else {
+				resp.Body.Close()
+			}
+		}
+	}
+}
+
 func TestSign(t *testing.T) {
 	if clientkey == "" || email == "" || domain == "" {
 		return
@@ -19,6 +19,7 @@ package acme
 import (
 	"crypto/x509"
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 	"time"
@@ -38,7 +39,9 @@ func NewSigner(logger types.Logger, cache Cache, metrics types.Metrics) Signer {
 // Signer ...
 type Signer interface {
 	AcmeAccount(endpoint, emails string, termsAgreed bool)
+	AcmeAccountStore(path string)
 	AcmeConfig(expiring time.Duration)
+	AcmeTransport(transport TransportConfig)
 	HasAccount() bool
 	Notify(item interface{}) error
 }
@@ -62,13 +65,15 @@ type TLSSecret struct {
 }
 
 type signer struct {
-	logger      types.Logger
-	cache       Cache
-	metrics     types.Metrics
-	account     Account
-	client      Client
-	expiring    time.Duration
-	verifyCount int
+	logger       types.Logger
+	cache        Cache
+	metrics      types.Metrics
+	account      Account
+	accountStore string
+	transport    TransportConfig
+	client       Client
+	expiring     time.Duration
+	verifyCount  int
 }
 
 func (s *signer) AcmeAccount(endpoint, emails string, termsAgreed bool) {
@@ -91,7 +96,7 @@ func (s *signer) AcmeAccount(endpoint, emails string, termsAgreed bool) {
 		return
 	}
 	s.logger.Info("loading account %+v", account)
-	client, err := NewClient(s.logger, s.cache, &account)
+	client, err := s.newClient(&account)
 	if err != nil {
 		s.logger.Warn("error creating the acme client: %v", err)
 		return
@@ -100,10 +105,75 @@ func (s *signer) AcmeAccount(endpoint, emails string, termsAgreed bool) {
 	s.client = client
 }
 
+// newClient creates a new acme client. The account state is restored from
+// the account store, if configured and if it matches the account and its
+// key, skipping the account lookup, creation or update on the acme server.
+// The account URL is then fetched only by the first authenticated request.
+func (s *signer) newClient(account *Account) (Client, error) {
+	httpClient, err := s.transport.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient(s.logger, s.cache, account)
+	if err != nil {
+		return nil, err
+	}
+	client.client.HTTPClient = httpClient
+	if s.accountStore == "" {
+		if err := client.ensureAccount(); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+	thumbprint, err := client.keyThumbprint()
+	if err != nil {
+		return nil, err
+	}
+	state, err := readAccountState(s.accountStore)
+	if err != nil && !os.IsNotExist(err) {
+		s.logger.Warn("acme: error reading account state from %s: %v", s.accountStore, err)
+	}
+	if state != nil && state.matches(account, thumbprint) {
+		client.accountURL = state.URL
+		s.logger.Info("acme: client account restored from %s", s.accountStore)
+		return client, nil
+	}
+	if err := client.ensureAccount(); err != nil {
+		return nil, err
+	}
+	state = &AccountState{
+		Endpoint:      account.Endpoint,
+		Emails:        account.Emails,
+		TermsAgreed:   account.TermsAgreed,
+		URL:           client.accountURL,
+		KeyThumbprint: thumbprint,
+	}
+	if err := writeAccountState(s.accountStore, state); err != nil {
+		s.logger.Warn("acme: error saving account state to %s: %v", s.accountStore, err)
+	}
+	return client, nil
+}
+
+func (s *signer) AcmeAccountStore(path string) {
+	s.accountStore = path
+}
+
 func (s *signer) AcmeConfig(expiring time.Duration) {
 	s.expiring = expiring
 }
 
+// AcmeTransport configures the HTTP transport used to connect to the acme
+// server. The acme client is recreated on the next AcmeAccount() call if the
+// transport changes.
+func (s *signer) AcmeTransport(transport TransportConfig) {
+	if s.transport.ProxyURL == transport.ProxyURL && s.transport.RootCAs.Equal(transport.RootCAs) {
+		return
+	}
+	s.transport = transport
+	s.account = Account{}
+	s.client = nil
+}
+
 func (s *signer) HasAccount() bool {
 	return s.client != nil
 }
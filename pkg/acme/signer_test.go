@@ -18,12 +18,19 @@ package acme
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme/x/acme"
+
 	types_helper "github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
 )
 
@@ -102,6 +109,115 @@ INFO acme: new certificate issued: id=1 secret=s1 domain(s)=other.s3.dev.local p
 	}
 }
 
+func TestAccountStore(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	thumbprint, _ := acme.JWKThumbprint(key.Public())
+	account := Account{
+		Endpoint:    "https://acme-v2.local",
+		Emails:      "admin@d1.local",
+		TermsAgreed: true,
+	}
+	testCases := []struct {
+		state   AccountState
+		matches bool
+	}{
+		// 0
+		{
+			state: AccountState{
+				Endpoint:      "https://acme-v2.local",
+				Emails:        "admin@d1.local",
+				TermsAgreed:   true,
+				URL:           "https://acme-v2.local/acct/1",
+				KeyThumbprint: thumbprint,
+			},
+			matches: true,
+		},
+		// 1
+		{
+			state: AccountState{
+				Endpoint:      "https://acme-v2.local",
+				Emails:        "admin@d2.local",
+				TermsAgreed:   true,
+				URL:           "https://acme-v2.local/acct/1",
+				KeyThumbprint: thumbprint,
+			},
+		},
+		// 2
+		{
+			state: AccountState{
+				Endpoint:      "https://acme-v2.local",
+				Emails:        "admin@d1.local",
+				TermsAgreed:   true,
+				URL:           "https://acme-v2.local/acct/1",
+				KeyThumbprint: "other",
+			},
+		},
+		// 3
+		{
+			state: AccountState{
+				Endpoint:      "https://acme-v2.local",
+				Emails:        "admin@d1.local",
+				TermsAgreed:   true,
+				KeyThumbprint: thumbprint,
+			},
+		},
+	}
+	for i, test := range testCases {
+		if matches := test.state.matches(&account, thumbprint); matches != test.matches {
+			t.Errorf("test %d expected matches=%t, but was %t", i, test.matches, matches)
+		}
+	}
+
+	c := setup(t)
+	defer c.teardown()
+	tempdir := t.TempDir()
+	store := filepath.Join(tempdir, "account.json")
+	if err := writeAccountState(store, &testCases[0].state); err != nil {
+		t.Fatalf("error writing account state: %v", err)
+	}
+	state, err := readAccountState(store)
+	if err != nil || *state != testCases[0].state {
+		t.Errorf("expected to read %+v, but was %+v, err=%v", testCases[0].state, state, err)
+	}
+	if _, err := os.Stat(store + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected temp file removed, but was err=%v", err)
+	}
+
+	c.cache.key = key
+	signer := NewSigner(c.logger, c.cache, c.metrics).(*signer)
+	signer.AcmeAccountStore(store)
+	signer.AcmeAccount(account.Endpoint, account.Emails, account.TermsAgreed)
+	if !signer.HasAccount() {
+		t.Errorf("expected account restored from the store")
+	}
+	if url := signer.client.(*client).accountURL; url != "https://acme-v2.local/acct/1" {
+		t.Errorf("expected restored account url, but was '%s'", url)
+	}
+	c.logger.CompareLogging(`
+INFO loading account {Emails:admin@d1.local Endpoint:https://acme-v2.local TermsAgreed:true}
+INFO acme: client account restored from ` + store)
+}
+
+func TestAcmeTransport(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	signer := c.newSigner()
+	signer.account = Account{Endpoint: "https://acme-v2.local"}
+
+	signer.AcmeTransport(TransportConfig{})
+	if !signer.HasAccount() {
+		t.Errorf("expected the client preserved if the transport doesn't change")
+	}
+
+	signer.AcmeTransport(TransportConfig{ProxyURL: "http://proxy.local:3128"})
+	if signer.HasAccount() || signer.account != (Account{}) {
+		t.Errorf("expected the client recreated if the transport changes")
+	}
+}
+
 func setup(t *testing.T) *config {
 	return &config{
 		t: t,
@@ -137,11 +253,12 @@ func (c *clientMock) Sign(domains []string, preferredChain string) (crt, key []b
 }
 
 type cache struct {
+	key       crypto.Signer
 	tlsSecret map[string]*TLSSecret
 }
 
 func (c *cache) GetKey() (crypto.Signer, error) {
-	return nil, nil
+	return c.key, nil
 }
 
 func (c *cache) SetToken(domain string, uri, token string) error {
@@ -0,0 +1,65 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acme
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// AccountState is the persisted state of an acme account. The private key
+// isn't persisted, it is still read from its secret, only its thumbprint is
+// used to identify if the state belongs to the current key.
+type AccountState struct {
+	Endpoint      string `json:"endpoint"`
+	Emails        string `json:"emails"`
+	TermsAgreed   bool   `json:"termsAgreed"`
+	URL           string `json:"url"`
+	KeyThumbprint string `json:"keyThumbprint"`
+}
+
+func (s *AccountState) matches(account *Account, thumbprint string) bool {
+	return s.URL != "" &&
+		s.Endpoint == account.Endpoint &&
+		s.Emails == account.Emails &&
+		s.TermsAgreed == account.TermsAgreed &&
+		s.KeyThumbprint == thumbprint
+}
+
+func readAccountState(path string) (*AccountState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &AccountState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func writeAccountState(path string, state *AccountState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
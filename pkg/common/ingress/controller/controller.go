@@ -19,6 +19,7 @@ package controller
 import (
 	"crypto/x509"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -54,9 +55,12 @@ type GenericController struct {
 
 // Configuration contains all the settings required by an Ingress controller
 type Configuration struct {
-	Client       types.Client
-	MasterWorker bool
-	MasterSocket string
+	Client              types.Client
+	MasterWorker        bool
+	MasterSocket        string
+	SocketTimeout       time.Duration
+	SeparateStatsSocket bool
+	RequireAdminSocket  bool
 
 	RateLimitUpdate  float32
 	ReloadInterval   time.Duration
@@ -72,10 +76,23 @@ type Configuration struct {
 	WatchNamespace           string
 	ConfigMapName            string
 
-	ReloadStrategy    string
-	MaxOldConfigFiles int
-	ValidateConfig    bool
-	LocalFSPrefix     string
+	ReloadStrategy         string
+	ReloadStrategyFallback []string
+	ReloadScript           string
+	ReloadTimeout          time.Duration
+	WorkerDrainTimeout     time.Duration
+	ServerStateFileMode    os.FileMode
+	ServerStateFileChown   bool
+	TemplatesDir           string
+	HAProxyBinary          string
+	MaxOldConfigFiles      int
+	MaxOldConfigAge        time.Duration
+	CompressOldConfigFiles bool
+	ValidateConfig         bool
+	ValidateBeforeReload   bool
+	ValidateCertFiles      bool
+	ValidateChangedFiles   bool
+	LocalFSPrefix          string
 
 	ForceNamespaceIsolation bool
 	WaitBeforeShutdown      int
@@ -85,14 +102,20 @@ type Configuration struct {
 	DisableConfigKeywords   string
 	AnnPrefix               []string
 
-	AcmeServer              bool
-	AcmeCheckPeriod         time.Duration
-	AcmeFailInitialDuration time.Duration
-	AcmeFailMaxDuration     time.Duration
-	AcmeElectionID          string
-	AcmeSecretKeyName       string
-	AcmeTokenConfigmapName  string
-	AcmeTrackTLSAnn         bool
+	AcmeServer               bool
+	AcmeCheckPeriod          time.Duration
+	AcmeCheckJitter          time.Duration
+	AcmeNonLeaderWarnTimeout time.Duration
+	AcmeOrderBy              string
+	AcmeFailInitialDuration  time.Duration
+	AcmeFailMaxDuration      time.Duration
+	AcmeElectionID           string
+	AcmeSecretKeyName        string
+	AcmeTokenConfigmapName   string
+	AcmeTrackTLSAnn          bool
+	AcmeAccountStore         string
+	AcmeProxyURL             string
+	AcmeRootCAsFile          string
 
 	BucketsResponseTime []float64
 
@@ -103,6 +126,7 @@ type Configuration struct {
 	StatsCollectProcPeriod time.Duration
 	PublishService         string
 	TrackOldInstances      bool
+	ReloadEvents           bool
 	Backend                ingress.Controller
 
 	UpdateStatus           bool
@@ -110,8 +134,22 @@ type Configuration struct {
 	ElectionID             string
 	UpdateStatusOnShutdown bool
 
-	BackendShards   int
-	SortEndpointsBy string
+	BackendShards                int
+	BackendShardBy               string
+	BackendMapShards             int
+	MaxDynamicUpdateCmds         int
+	DynamicMapUpdates            bool
+	DynamicOnly                  bool
+	EndpointDrainPeriod          time.Duration
+	LogChangesJSON               bool
+	LogItemListThreshold         int
+	LogLevels                    string
+	OldWorkersWarnThreshold      int
+	ReloadQueueWarnThreshold     int
+	ConfigSizeWarnThreshold      int
+	ExternalReloadConfirmTimeout time.Duration
+	ExternalReloadRetries        int
+	SortEndpointsBy              string
 }
 
 // newIngressController creates an Ingress controller
@@ -3,11 +3,14 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -26,6 +29,8 @@ import (
 
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/ingress"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/common/k8s"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 )
 
 // NewIngressController returns a configured Ingress controller
@@ -64,11 +69,64 @@ kubernetes.io/ingress.class annotation if both are defined and conflicting.`)
 		reloadStrategy = flags.String("reload-strategy", "reusesocket",
 			`Name of the reload strategy. Options are: native or reusesocket`)
 
+		reloadStrategyFallback = flags.String("reload-strategy-fallback", "",
+			`Comma-separated list of reload strategies that should be tried, in order,
+if the embedded haproxy fails to reload using the reload strategy. Options are:
+native or reusesocket. Default value is empty, which does not retry a failed
+reload`)
+
+		reloadTimeout = flags.Duration("reload-timeout", 0,
+			`Maximum time to wait for the embedded haproxy reload script to finish. The
+script is killed and the reload fails if it takes longer. Default value 0 waits
+until the script finishes.`)
+
+		workerDrainTimeout = flags.Duration("worker-drain-timeout", 0,
+			`Maximum time old haproxy workers have to finish handling requests after a
+reload. Overrides the timeout-stop global config, and is also used by the
+embedded reload script to terminate old workers. Default value 0 uses
+timeout-stop.`)
+
+		serverStateFileMode = flags.String("server-state-file-mode", "0644",
+			`Octal file mode of the servers state file, persisted before reloads if
+load-server-state is enabled.`)
+
+		serverStateFileChown = flags.Bool("server-state-file-chown", false,
+			`Defines if the owner and the group of the servers state file should be
+changed to the haproxy user and group, configured by the username and groupname
+or the use-haproxy-user global config keys. Changing the owner requires the
+controller to run as root.`)
+
 		maxOldConfigFiles = flags.Int("max-old-config-files", 0,
 			`Maximum number of old HAProxy timestamped config files to retain. Older files
 are cleaned up. A value <= 0 indicates only a single non-timestamped config
 file will be retained.`)
 
+		maxOldConfigAge = flags.Duration("max-old-config-age", 0,
+			`Maximum age of old HAProxy timestamped config files. Older files are cleaned
+up, even if --max-old-config-files wasn't reached. Default value 0 means no age
+limit.`)
+
+		compressOldConfigFiles = flags.Bool("compress-old-config-files", false,
+			`Defines if old HAProxy timestamped config files should be gzip compressed. The
+current config file is always written uncompressed. Used only if
+--max-old-config-files or --max-old-config-age is configured.`)
+
+		validateBeforeReload = flags.Bool("validate-before-reload", false,
+			`Define if the resulting configuration files should be validated before a full
+reload. HAProxy is not reloaded, and the configuration update is counted in the
+'haproxyingress_updates_reload_blocked_total' metric if validation fails.`)
+
+		validateCertFiles = flags.Bool("validate-cert-files", false,
+			`Define if the certificate, CA and CRL files referenced by the hosts should be
+checked before a full reload. HAProxy is not reloaded, and the configuration update
+is counted in the 'haproxyingress_updates_reload_blocked_total' metric if a file is
+missing or cannot be read.`)
+
+		validateChangedFiles = flags.Bool("validate-changed-files", false,
+			`Validates only the main configuration file and the backend shards changed since
+the last successful validation, instead of the whole configuration directory.
+Only used if --backend-shards is configured.`)
+
 		validateConfig = flags.Bool("validate-config", false,
 			`Define if the resulting configuration files should be validated when a dynamic
 update was applied. Default value is false, which means the validation will
@@ -101,6 +159,32 @@ processes.`)
 			`Defines the master CLI unix socket of an external HAProxy running in
 master-worker mode. Defaults to use the embedded HAProxy if not declared.`)
 
+		socketTimeout = flags.Duration("socket-timeout", 5*time.Second,
+			`Time a command sent to the haproxy master or admin socket has to send the
+command and read its response, before failing with a timeout.`)
+
+		requireAdminSocket = flags.Bool("require-admin-socket", false,
+			`Fails the readiness probe if the haproxy admin socket does not respond after
+the first successful reload. A warning is logged by default.`)
+
+		separateStatsSocket = flags.Bool("separate-stats-socket", false,
+			`Configures a distinct haproxy socket used by read only commands, like the idle
+metric collection and the servers state retrieval, so they don't contend with
+the dynamic updates sent to the admin socket.`)
+
+		haproxyBinary = flags.String("haproxy-binary", "haproxy",
+			`Name or path of the haproxy binary used to start the embedded haproxy in
+master-worker mode and to validate the configuration files. A name without a
+slash is searched in the PATH.`)
+
+		reloadScript = flags.String("reload-script", "",
+			`Path of the script used to start and reload the embedded haproxy in daemon
+mode. Defaults to the haproxy-reload.sh script distributed in the image.`)
+
+		templatesDir = flags.String("templates-dir", "",
+			`Base directory of the haproxy, map, modsecurity and responses templates.
+Defaults to the templates distributed in the image.`)
+
 		configMap = flags.String("configmap", "",
 			`Name of the ConfigMap that contains the custom configuration to use`)
 
@@ -111,6 +195,21 @@ Let's Encrypt or other ACME implementations.`)
 		acmeCheckPeriod = flags.Duration("acme-check-period", 24*time.Hour,
 			`Time between checks of invalid or expiring certificates`)
 
+		acmeCheckJitter = flags.Duration("acme-check-jitter", 0,
+			`Maximum random delay applied by the acme leader on every periodic check, before
+adding the certificates to the work queue. Spreads the load of controllers whose
+checks are aligned in the acme server. Default value 0 does not delay the checks`)
+
+		acmeNonLeaderWarnTimeout = flags.Duration("acme-non-leader-warn-timeout", 0,
+			`Time a controller instance that is not the acme leader skips the acme changes
+before logging them as a warning, so a stalled leader election is noticed. Default
+value 0 does not log the skipped changes as a warning`)
+
+		acmeOrderBy = flags.String("acme-order-by", "name",
+			`Order of the certificates added to the acme work queue on every check. Options
+are: name, sorted by the certificate name, or expiry, the certificates that expire
+first are processed first`)
+
 		acmeElectionID = flags.String("acme-election-id", "acme-leader",
 			`Prefix of the election ID used to choose the acme leader`)
 
@@ -131,6 +230,18 @@ same namespace of the controller pod`)
 used to answer the acme challenges. If a namespace is not provided, the secret
 will be created in the same namespace of the controller pod`)
 
+		acmeAccountStore = flags.String("acme-account-store", "",
+			`File used to persist the acme account state, restored on startup so the account
+isn't looked up on the acme server again. Default value doesn't persist the state.`)
+
+		acmeProxyURL = flags.String("acme-proxy-url", "",
+			`URL of the HTTP proxy used to connect to the acme server. Default value uses the
+proxy configured via HTTPS_PROXY and NO_PROXY environment variables, if any.`)
+
+		acmeRootCAsFile = flags.String("acme-root-cas-file", "",
+			`File with PEM encoded CA certificates used to verify the acme server, e.g. a
+private acme server. Default value uses the system's root CAs.`)
+
 		acmeTrackTLSAnn = flags.Bool("acme-track-tls-annotation", false,
 			`Enable tracking of ingress objects annotated with 'kubernetes.io/tls-acme'`)
 
@@ -239,6 +350,75 @@ IP/hostname when the controller is being stopped.`)
 		backendShards = flags.Int("backend-shards", 0,
 			`Defines how much files should be used to configure the haproxy backends`)
 
+		backendShardBy = flags.String("backend-shard-by", "backend",
+			`Key used to distribute the backends among the backend shards. Options are:
+backend, every backend is distributed by its own name, or namespace, the backends
+of the same namespace are grouped into the same shard. Used only if
+--backend-shards is configured`)
+
+		backendMapShards = flags.Int("backend-map-shards", 0,
+			`Number of goroutines used to build and write the backend maps concurrently.
+Zero or one, the default value, writes the maps serially.`)
+
+		endpointDrainPeriod = flags.Duration("endpoint-drain-period", 0,
+			`Time removed endpoints are kept in drain state, finishing in-flight requests,
+before being disabled. Only used in backends with dynamic scaling enabled.
+Default value 0 disables endpoints right away.`)
+
+		logChangesJSON = flags.Bool("log-changes-json", false,
+			`Logs the summary of the hosts and backends changed on every configuration
+update as a JSON object, instead of the human readable form.`)
+
+		logItemListThreshold = flags.Int("log-item-list-threshold", 100,
+			`Number of changed hosts or backends from which only the amount is logged on
+every configuration update, instead of the list of names. Not used by
+--log-changes-json.`)
+
+		logLevels = flags.String("log-levels", "",
+			`Comma separated list of subsystem=level pairs, overriding the global verbosity
+of the log messages of a subsystem, e.g. acme=3,reload=0. Supported subsystems
+are acme, reload and update.`)
+
+		maxDynamicUpdateCmds = flags.Int("max-dynamic-update-commands", 0,
+			`Maximum number of commands sent to the haproxy admin socket on a single
+dynamic update. A full reload is made instead if more commands are needed.
+Zero, the default value, means unlimited.`)
+
+		dynamicMapUpdates = flags.Bool("dynamic-map-updates", false,
+			`Applies changes restricted to the content of the haproxy maps, like hosts and
+paths added to or removed from existing backends, via the haproxy admin socket
+instead of reloading haproxy.`)
+
+		dynamicOnly = flags.Bool("dynamic-only", false,
+			`Never writes haproxy config files or reloads haproxy, changes are only applied
+via the haproxy admin socket. Changes that need a reload are logged and ignored.
+haproxy should be started and reloaded outside of the controller.`)
+
+		oldWorkersWarnThreshold = flags.Int("old-workers-warn-threshold", 0,
+			`Logs a warning if the number of old haproxy workers still running after a
+reload of an external haproxy is greater than this value. Zero, the default
+value, disables the warning.`)
+
+		reloadQueueWarnThreshold = flags.Int("reload-queue-warn-threshold", 0,
+			`Logs a warning if the number of configuration updates waiting for an enqueued
+haproxy reload is greater than this value. Only used if --reload-interval is
+configured. Zero, the default value, disables the warning.`)
+
+		configSizeWarnThreshold = flags.Int("config-size-warn-threshold", 0,
+			`Logs a warning if the size in bytes of the main haproxy configuration file is
+greater than this value. Zero, the default value, disables the warning.`)
+
+		externalReloadConfirmTimeout = flags.Duration("external-reload-confirm-timeout", 0,
+			`Maximum time to wait for a new haproxy worker to be listed by the master CLI
+after a reload of an external haproxy. The reload is considered failed if a new
+worker is not listed in time. Zero, the default value, disables the
+confirmation.`)
+
+		externalReloadRetries = flags.Int("external-reload-retries", 0,
+			`Number of times the reload command is sent again to the master CLI of an
+external haproxy if the master socket fails, e.g. while busy with a former
+reload. Zero, the default value, does not retry.`)
+
 		sortBackends = flags.Bool("sort-backends", false,
 			`Defines if backend's endpoints should be sorted by name. This option has less
 precedence than --sort-endpoints-by if both are declared.`)
@@ -246,14 +426,20 @@ precedence than --sort-endpoints-by if both are declared.`)
 		sortEndpointsBy = flags.String("sort-endpoints-by", "",
 			`Defines how to sort backend's endpoints. Allowed values are: 'endpoint' - same
 k8s endpoint order (default); 'name' - server/endpoint name;
-'ip' - server/endpoint IP and port; 'random' - shuffle endpoints on every
-haproxy reload`)
+'ip' - server/endpoint IP and port; 'stable' - a hash of backend and endpoint,
+consistent across reloads and controller instances; 'preserve' - keep the order
+of the current endpoints, adding new ones at the end; 'random' - shuffle endpoints
+on every haproxy reload; 'none' - neither sort nor shuffle endpoints`)
 
 		trackOldInstances = flags.Bool("track-old-instances", false,
 			`Creates an internal list of connections to old HAProxy instances. These
 connections are used to read or send data to stopping instances, which is
 usually serving long lived connections like TCP services or websockets.`)
 
+		reloadEvents = flags.Bool("reload-events", false,
+			`Records Kubernetes events in the controller pod on haproxy reloads, failed
+reloads and failed configuration validations.`)
+
 		useNodeInternalIP = flags.Bool("report-node-internal-ip-address", false,
 			`Defines if the nodes IP address to be returned in the ingress status should be
 the internal instead of the external IP address`)
@@ -332,12 +518,56 @@ tracked.`)
 		klog.Info("running embedded haproxy, mode is daemon")
 	}
 
+	if *masterSocket == "" {
+		if _, err := exec.LookPath(*haproxyBinary); err != nil {
+			klog.Fatalf("invalid haproxy binary: %v", err)
+		}
+		if *reloadScript != "" {
+			if _, err := exec.LookPath(*reloadScript); err != nil {
+				klog.Fatalf("invalid reload script: %v", err)
+			}
+		} else if !masterWorkerCfg {
+			// same default used by the haproxy instance, see CreateInstance()
+			defaultScript := "/haproxy-reload.sh"
+			if *localFSPrefix != "" {
+				defaultScript = "rootfs" + defaultScript
+			}
+			if _, err := exec.LookPath(defaultScript); err != nil {
+				klog.Fatalf("invalid default reload script, use --reload-script to configure another one: %v", err)
+			}
+		}
+	}
+
+	if *templatesDir != "" {
+		if info, err := os.Stat(*templatesDir); err != nil {
+			klog.Fatalf("invalid templates dir: %v", err)
+		} else if !info.IsDir() {
+			klog.Fatalf("invalid templates dir: %s is not a directory", *templatesDir)
+		}
+	}
+
 	if !(*reloadStrategy == "native" || *reloadStrategy == "reusesocket" || *reloadStrategy == "multibinder") {
 		klog.Fatalf("Unsupported reload strategy: %v", *reloadStrategy)
 	}
 	if *reloadStrategy == "multibinder" {
 		klog.Warningf("multibinder is deprecated, using reusesocket strategy instead. update your deployment configuration")
 	}
+	var reloadStrategyFallbackList []string
+	for _, strategy := range strings.Split(*reloadStrategyFallback, ",") {
+		strategy = strings.TrimSpace(strategy)
+		if strategy == "" {
+			continue
+		}
+		if strategy != "native" && strategy != "reusesocket" {
+			klog.Fatalf("Unsupported reload strategy fallback: %v", strategy)
+		}
+		reloadStrategyFallbackList = append(reloadStrategyFallbackList, strategy)
+	}
+
+	serverStateFileModeValue, err := strconv.ParseUint(*serverStateFileMode, 8, 32)
+	if err != nil || os.FileMode(serverStateFileModeValue)&^os.ModePerm != 0 {
+		klog.Fatalf("Invalid server state file mode: %v", *serverStateFileMode)
+	}
 
 	kubeClient, err := createApiserverClient(*apiserverHost, *kubeConfigFile, *disableAPIWarnings)
 	if err != nil {
@@ -473,60 +703,97 @@ tracked.`)
 			sortEndpoints = "endpoint"
 		}
 	}
-	if !stringInSlice(sortEndpoints, []string{"ep", "endpoint", "ip", "name", "random"}) {
+	if err := hatypes.ValidateSortEndpointsBy(sortEndpoints); err != nil {
 		klog.Fatalf("Unsupported --sort-endpoint-by option: %s", sortEndpoints)
 	}
 
 	config := &Configuration{
-		UpdateStatus:             *updateStatus,
-		ElectionID:               *electionID,
-		Client:                   kubeClient,
-		MasterWorker:             masterWorkerCfg,
-		MasterSocket:             *masterSocket,
-		AcmeServer:               *acmeServer,
-		AcmeCheckPeriod:          *acmeCheckPeriod,
-		AcmeElectionID:           *acmeElectionID,
-		AcmeFailInitialDuration:  *acmeFailInitialDuration,
-		AcmeFailMaxDuration:      *acmeFailMaxDuration,
-		AcmeSecretKeyName:        *acmeSecretKeyName,
-		AcmeTokenConfigmapName:   *acmeTokenConfigmapName,
-		AcmeTrackTLSAnn:          *acmeTrackTLSAnn,
-		BucketsResponseTime:      *bucketsResponseTime,
-		RateLimitUpdate:          *rateLimitUpdate,
-		ReloadInterval:           *reloadInterval,
-		ResyncPeriod:             *resyncPeriod,
-		WaitBeforeUpdate:         *waitBeforeUpdate,
-		DefaultService:           *defaultSvc,
-		IngressClass:             *ingressClass,
-		IngressClassPrecedence:   *ingressClassPrecedence,
-		ControllerName:           controllerName,
-		WatchIngressWithoutClass: *watchIngressWithoutClass,
-		WatchGateway:             *watchGateway,
-		WatchNamespace:           *watchNamespace,
-		ConfigMapName:            *configMap,
-		ReloadStrategy:           *reloadStrategy,
-		MaxOldConfigFiles:        *maxOldConfigFiles,
-		ValidateConfig:           *validateConfig,
-		LocalFSPrefix:            *localFSPrefix,
-		TCPConfigMapName:         *tcpConfigMapName,
-		AnnPrefix:                annPrefixList,
-		DefaultSSLCertificate:    *defSSLCertificate,
-		VerifyHostname:           *verifyHostname,
-		DefaultHealthzURL:        *defHealthzURL,
-		StatsCollectProcPeriod:   *statsCollectProcPeriod,
-		PublishService:           *publishSvc,
-		Backend:                  backend,
-		ForceNamespaceIsolation:  *forceIsolation,
-		WaitBeforeShutdown:       *waitBeforeShutdown,
-		AllowCrossNamespace:      *allowCrossNamespace,
-		DisablePodList:           *disablePodList,
-		DisableExternalName:      *disableExternalName,
-		DisableConfigKeywords:    *disableConfigKeywords,
-		TrackOldInstances:        *trackOldInstances,
-		UpdateStatusOnShutdown:   *updateStatusOnShutdown,
-		BackendShards:            *backendShards,
-		SortEndpointsBy:          sortEndpoints,
-		UseNodeInternalIP:        *useNodeInternalIP,
+		UpdateStatus:                 *updateStatus,
+		ElectionID:                   *electionID,
+		Client:                       kubeClient,
+		MasterWorker:                 masterWorkerCfg,
+		MasterSocket:                 *masterSocket,
+		SocketTimeout:                *socketTimeout,
+		SeparateStatsSocket:          *separateStatsSocket,
+		RequireAdminSocket:           *requireAdminSocket,
+		AcmeServer:                   *acmeServer,
+		AcmeCheckPeriod:              *acmeCheckPeriod,
+		AcmeCheckJitter:              *acmeCheckJitter,
+		AcmeNonLeaderWarnTimeout:     *acmeNonLeaderWarnTimeout,
+		AcmeOrderBy:                  *acmeOrderBy,
+		AcmeElectionID:               *acmeElectionID,
+		AcmeFailInitialDuration:      *acmeFailInitialDuration,
+		AcmeFailMaxDuration:          *acmeFailMaxDuration,
+		AcmeSecretKeyName:            *acmeSecretKeyName,
+		AcmeTokenConfigmapName:       *acmeTokenConfigmapName,
+		AcmeTrackTLSAnn:              *acmeTrackTLSAnn,
+		AcmeAccountStore:             *acmeAccountStore,
+		AcmeProxyURL:                 *acmeProxyURL,
+		AcmeRootCAsFile:              *acmeRootCAsFile,
+		BucketsResponseTime:          *bucketsResponseTime,
+		RateLimitUpdate:              *rateLimitUpdate,
+		ReloadInterval:               *reloadInterval,
+		ResyncPeriod:                 *resyncPeriod,
+		WaitBeforeUpdate:             *waitBeforeUpdate,
+		DefaultService:               *defaultSvc,
+		IngressClass:                 *ingressClass,
+		IngressClassPrecedence:       *ingressClassPrecedence,
+		ControllerName:               controllerName,
+		WatchIngressWithoutClass:     *watchIngressWithoutClass,
+		WatchGateway:                 *watchGateway,
+		WatchNamespace:               *watchNamespace,
+		ConfigMapName:                *configMap,
+		ReloadStrategy:               *reloadStrategy,
+		ReloadStrategyFallback:       reloadStrategyFallbackList,
+		ReloadTimeout:                *reloadTimeout,
+		WorkerDrainTimeout:           *workerDrainTimeout,
+		ServerStateFileMode:          os.FileMode(serverStateFileModeValue),
+		ServerStateFileChown:         *serverStateFileChown,
+		ReloadScript:                 *reloadScript,
+		TemplatesDir:                 *templatesDir,
+		HAProxyBinary:                *haproxyBinary,
+		MaxOldConfigFiles:            *maxOldConfigFiles,
+		MaxOldConfigAge:              *maxOldConfigAge,
+		CompressOldConfigFiles:       *compressOldConfigFiles,
+		ValidateConfig:               *validateConfig,
+		ValidateBeforeReload:         *validateBeforeReload,
+		ValidateCertFiles:            *validateCertFiles,
+		ValidateChangedFiles:         *validateChangedFiles,
+		LocalFSPrefix:                *localFSPrefix,
+		TCPConfigMapName:             *tcpConfigMapName,
+		AnnPrefix:                    annPrefixList,
+		DefaultSSLCertificate:        *defSSLCertificate,
+		VerifyHostname:               *verifyHostname,
+		DefaultHealthzURL:            *defHealthzURL,
+		StatsCollectProcPeriod:       *statsCollectProcPeriod,
+		PublishService:               *publishSvc,
+		Backend:                      backend,
+		ForceNamespaceIsolation:      *forceIsolation,
+		WaitBeforeShutdown:           *waitBeforeShutdown,
+		AllowCrossNamespace:          *allowCrossNamespace,
+		DisablePodList:               *disablePodList,
+		DisableExternalName:          *disableExternalName,
+		DisableConfigKeywords:        *disableConfigKeywords,
+		TrackOldInstances:            *trackOldInstances,
+		ReloadEvents:                 *reloadEvents,
+		UpdateStatusOnShutdown:       *updateStatusOnShutdown,
+		BackendShards:                *backendShards,
+		BackendShardBy:               *backendShardBy,
+		BackendMapShards:             *backendMapShards,
+		MaxDynamicUpdateCmds:         *maxDynamicUpdateCmds,
+		DynamicMapUpdates:            *dynamicMapUpdates,
+		DynamicOnly:                  *dynamicOnly,
+		EndpointDrainPeriod:          *endpointDrainPeriod,
+		LogChangesJSON:               *logChangesJSON,
+		LogItemListThreshold:         *logItemListThreshold,
+		LogLevels:                    *logLevels,
+		OldWorkersWarnThreshold:      *oldWorkersWarnThreshold,
+		ReloadQueueWarnThreshold:     *reloadQueueWarnThreshold,
+		ConfigSizeWarnThreshold:      *configSizeWarnThreshold,
+		ExternalReloadConfirmTimeout: *externalReloadConfirmTimeout,
+		ExternalReloadRetries:        *externalReloadRetries,
+		SortEndpointsBy:              sortEndpoints,
+		UseNodeInternalIP:            *useNodeInternalIP,
 	}
 
 	ic := newIngressController(config)
@@ -542,6 +809,11 @@ func registerHandlers(enableProfiling bool, port int, ic *GenericController) {
 		healthz.PingHealthz,
 		ic.cfg.Backend,
 	)
+	// expose readiness endpoint (/readyz), failing while haproxy isn't
+	// started or is failing to reload
+	healthz.InstallReadyzHandler(mux,
+		healthz.NamedCheck("haproxy", ic.cfg.Backend.Ready),
+	)
 
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -553,7 +825,14 @@ func registerHandlers(enableProfiling bool, port int, ic *GenericController) {
 		var out string
 		count, err := ic.cfg.Backend.AcmeCheck()
 		if err != nil {
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			switch {
+			case errors.Is(err, haproxy.ErrNotStarted):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case errors.Is(err, haproxy.ErrNotLeader):
+				w.WriteHeader(http.StatusConflict)
+			default:
+				w.WriteHeader(http.StatusUnprocessableEntity)
+			}
 			out = fmt.Sprintf("Error starting the certificate check: %v.\nSee further information in the controller log.\n", err)
 		} else {
 			w.WriteHeader(http.StatusOK)
@@ -566,6 +845,62 @@ func registerHandlers(enableProfiling bool, port int, ic *GenericController) {
 		w.Write([]byte(out))
 	})
 
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var out string
+		if err := ic.cfg.Backend.ForceReload(); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			out = fmt.Sprintf("Error reloading haproxy: %v.\nSee further information in the controller log.\n", err)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			out = "HAProxy reload requested. See the result in the controller log.\n"
+		}
+		w.Write([]byte(out))
+	})
+
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var out string
+		if err := ic.cfg.Backend.Pause(); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			out = fmt.Sprintf("Error pausing haproxy updates: %v.\n", err)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			out = "HAProxy updates paused.\n"
+		}
+		w.Write([]byte(out))
+	})
+
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var out string
+		if err := ic.cfg.Backend.Resume(); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			out = fmt.Sprintf("Error resuming haproxy updates: %v.\n", err)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			out = "HAProxy updates resumed. See the result in the controller log.\n"
+		}
+		w.Write([]byte(out))
+	})
+
+	mux.HandleFunc("/paused", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		b, _ := json.Marshal(struct {
+			Paused bool `json:"paused"`
+		}{ic.cfg.Backend.Paused()})
+		w.Write(b)
+	})
+
 	mux.HandleFunc("/build", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		b, _ := json.Marshal(ic.Info())
@@ -18,6 +18,7 @@ package ingress
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/spf13/pflag"
 	apiv1 "k8s.io/api/core/v1"
@@ -51,6 +52,16 @@ type Controller interface {
 	Info() *BackendInfo
 	// AcmeCheck starts a certificate missing/expiring/outdated check
 	AcmeCheck() (int, error)
+	// ForceReload rewrites the configuration and fully reloads the proxy
+	ForceReload() error
+	// Pause stops applying configuration changes to the proxy
+	Pause() error
+	// Resume applies the changes made while paused and resumes the updates
+	Resume() error
+	// Paused returns true if the updates are paused
+	Paused() bool
+	// Ready returns an error if the proxy isn't ready to receive requests
+	Ready(*http.Request) error
 	// ConfigureFlags allow to configure more flags before the parsing of
 	// command line arguments
 	ConfigureFlags(*pflag.FlagSet)
@@ -67,6 +67,7 @@ type k8scache struct {
 	tcpConfigMapKey        string
 	acmeSecretKeyName      string
 	acmeTokenConfigmapName string
+	recorder               record.EventRecorder
 	//
 	changed convtypes.ChangedObjects
 	//
@@ -126,6 +127,7 @@ func createCache(
 		tcpConfigMapKey:        tcpConfigMapName,
 		acmeSecretKeyName:      acmeSecretKeyName,
 		acmeTokenConfigmapName: acmeTokenConfigmapName,
+		recorder:               recorder,
 		stateMutex:             sync.RWMutex{},
 		updateQueue:            updateQueue,
 		waitBeforeUpdate:       cfg.WaitBeforeUpdate,
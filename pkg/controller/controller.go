@@ -50,6 +50,7 @@ type HAProxyController struct {
 	metrics          *metrics
 	tracker          convtypes.Tracker
 	stopCh           chan struct{}
+	started          chan struct{}
 	writeModelMutex  sync.Mutex
 	ingressQueue     utils.Queue
 	acmeQueue        utils.Queue
@@ -66,7 +67,9 @@ type HAProxyController struct {
 
 // NewHAProxyController constructor
 func NewHAProxyController() *HAProxyController {
-	return &HAProxyController{}
+	return &HAProxyController{
+		started: make(chan struct{}),
+	}
 }
 
 // Info provides controller name and repository infos
@@ -85,6 +88,7 @@ func (hc *HAProxyController) Start() {
 	hc.configController()
 	hc.startServices()
 	hc.logger.Info("HAProxy Ingress successfully initialized")
+	close(hc.started)
 	//
 	<-hc.stopCh
 	//
@@ -104,7 +108,13 @@ func (hc *HAProxyController) configController() {
 	}
 	hc.cache = createCache(hc.logger, hc.controller, hc.tracker, hc.dynamicConfig, hc.ingressQueue)
 	var acmeSigner acme.Signer
+	var acmeTransport acme.TransportConfig
 	if hc.cfg.AcmeServer {
+		var err error
+		acmeTransport, err = acme.NewTransportConfig(hc.cfg.AcmeProxyURL, hc.cfg.AcmeRootCAsFile)
+		if err != nil {
+			klog.Fatalf("invalid acme transport config: %v", err)
+		}
 		electorID := fmt.Sprintf("%s-%s", hc.cfg.AcmeElectionID, hc.cfg.IngressClass)
 		hc.leaderelector = NewLeaderElector(electorID, hc.logger, hc.cache, hc)
 		acmeSigner = acme.NewSigner(hc.logger, hc.cache, hc.metrics)
@@ -122,56 +132,115 @@ func (hc *HAProxyController) configController() {
 	if masterSocket == "" && hc.cfg.MasterWorker {
 		masterSocket = ingress.DefaultVarRunDirectory + "/master.sock"
 	}
+	var eventRecorder types.EventRecorder
+	if hc.cfg.ReloadEvents {
+		namespace, podname, err := hc.cache.GetIngressPodName()
+		if err != nil {
+			klog.Fatalf("cannot record reload events: %v", err)
+		}
+		eventRecorder = newPodEventRecorder(hc.cache.recorder, namespace, podname)
+	}
+	var statsSocket string
+	if hc.cfg.SeparateStatsSocket {
+		statsSocket = ingress.DefaultVarRunDirectory + "/stats.sock"
+	}
 	var rootFSPrefix string
 	if hc.cfg.LocalFSPrefix != "" {
 		rootFSPrefix = "rootfs"
 	}
+	logLevels, err := haproxy.ParseLogLevels(hc.cfg.LogLevels)
+	if err != nil {
+		klog.Fatalf("invalid --log-levels: %v", err)
+	}
 	instanceOptions := haproxy.InstanceOptions{
-		RootFSPrefix:      rootFSPrefix,
-		LocalFSPrefix:     hc.cfg.LocalFSPrefix,
-		HAProxyCfgDir:     hc.cfg.LocalFSPrefix + "/etc/haproxy",
-		HAProxyMapsDir:    ingress.DefaultMapsDirectory,
-		IsMasterWorker:    hc.cfg.MasterWorker,
-		IsExternal:        hc.cfg.MasterSocket != "",
-		MasterSocket:      masterSocket,
-		AdminSocket:       ingress.DefaultVarRunDirectory + "/admin.sock",
-		AcmeSocket:        ingress.DefaultVarRunDirectory + "/acme.sock",
-		BackendShards:     hc.cfg.BackendShards,
-		AcmeSigner:        acmeSigner,
-		AcmeQueue:         hc.acmeQueue,
-		ReloadQueue:       hc.reloadQueue,
-		LeaderElector:     hc.leaderelector,
-		Metrics:           hc.metrics,
-		ReloadStrategy:    hc.cfg.ReloadStrategy,
-		MaxOldConfigFiles: hc.cfg.MaxOldConfigFiles,
-		SortEndpointsBy:   hc.cfg.SortEndpointsBy,
-		StopCh:            hc.stopCh,
-		TrackInstances:    hc.cfg.TrackOldInstances,
-		ValidateConfig:    hc.cfg.ValidateConfig,
+		RootFSPrefix:                 rootFSPrefix,
+		LocalFSPrefix:                hc.cfg.LocalFSPrefix,
+		HAProxyCfgDir:                hc.cfg.LocalFSPrefix + "/etc/haproxy",
+		HAProxyMapsDir:               ingress.DefaultMapsDirectory,
+		IsMasterWorker:               hc.cfg.MasterWorker,
+		IsExternal:                   hc.cfg.MasterSocket != "",
+		MasterSocket:                 masterSocket,
+		SocketTimeout:                hc.cfg.SocketTimeout,
+		AdminSocket:                  ingress.DefaultVarRunDirectory + "/admin.sock",
+		StatsSocket:                  statsSocket,
+		RequireAdminSocket:           hc.cfg.RequireAdminSocket,
+		AcmeSocket:                   ingress.DefaultVarRunDirectory + "/acme.sock",
+		BackendShards:                hc.cfg.BackendShards,
+		ShardBy:                      hc.cfg.BackendShardBy,
+		BackendMapShards:             hc.cfg.BackendMapShards,
+		AcmeSigner:                   acmeSigner,
+		AcmeAccountStore:             hc.cfg.AcmeAccountStore,
+		AcmeTransport:                acmeTransport,
+		AcmeQueue:                    hc.acmeQueue,
+		AcmeCheckJitter:              hc.cfg.AcmeCheckJitter,
+		AcmeNonLeaderWarnTimeout:     hc.cfg.AcmeNonLeaderWarnTimeout,
+		AcmeOrderBy:                  hc.cfg.AcmeOrderBy,
+		ReloadQueue:                  hc.reloadQueue,
+		UpdateQueue:                  hc.ingressQueue,
+		LeaderElector:                hc.leaderelector,
+		Metrics:                      hc.metrics,
+		ReloadStrategy:               hc.cfg.ReloadStrategy,
+		ReloadStrategyFallback:       hc.cfg.ReloadStrategyFallback,
+		ReloadScript:                 hc.cfg.ReloadScript,
+		ReloadTimeout:                hc.cfg.ReloadTimeout,
+		ServerStateFileMode:          hc.cfg.ServerStateFileMode,
+		ServerStateFileChown:         hc.cfg.ServerStateFileChown,
+		WorkerDrainTimeout:           hc.cfg.WorkerDrainTimeout,
+		HAProxyBinary:                hc.cfg.HAProxyBinary,
+		MinReloadInterval:            hc.cfg.ReloadInterval,
+		MaxOldConfigFiles:            hc.cfg.MaxOldConfigFiles,
+		MaxOldConfigAge:              hc.cfg.MaxOldConfigAge,
+		CompressOldConfigFiles:       hc.cfg.CompressOldConfigFiles,
+		MaxDynamicCommandsPerCycle:   hc.cfg.MaxDynamicUpdateCmds,
+		DynamicMapUpdates:            hc.cfg.DynamicMapUpdates,
+		DynamicOnly:                  hc.cfg.DynamicOnly,
+		EndpointDrainPeriod:          hc.cfg.EndpointDrainPeriod,
+		LogChangesJSON:               hc.cfg.LogChangesJSON,
+		LogItemListThreshold:         hc.cfg.LogItemListThreshold,
+		LogLevels:                    logLevels,
+		ExternalReloadConfirmTimeout: hc.cfg.ExternalReloadConfirmTimeout,
+		ExternalReloadRetries:        hc.cfg.ExternalReloadRetries,
+		OldWorkersWarnThreshold:      hc.cfg.OldWorkersWarnThreshold,
+		ReloadQueueWarnThreshold:     hc.cfg.ReloadQueueWarnThreshold,
+		ConfigSizeWarnThreshold:      hc.cfg.ConfigSizeWarnThreshold,
+		SortEndpointsBy:              hc.cfg.SortEndpointsBy,
+		TemplatesDir:                 hc.cfg.TemplatesDir,
+		StopCh:                       hc.stopCh,
+		TrackInstances:               hc.cfg.TrackOldInstances,
+		EventRecorder:                eventRecorder,
+		ValidateConfig:               hc.cfg.ValidateConfig,
+		ValidateBeforeReload:         hc.cfg.ValidateBeforeReload,
+		ValidateCertFiles:            hc.cfg.ValidateCertFiles,
+		ValidateChangedFiles:         hc.cfg.ValidateChangedFiles,
+	}
+	if err := instanceOptions.Validate(); err != nil {
+		klog.Fatalf("invalid haproxy instance options: %v", err)
 	}
 	hc.instance = haproxy.CreateInstance(hc.logger, instanceOptions)
 	if err := hc.instance.ParseTemplates(); err != nil {
 		klog.Fatalf("error creating HAProxy instance: %v", err)
 	}
 	hc.converterOptions = &convtypes.ConverterOptions{
-		Logger:           hc.logger,
-		Cache:            hc.cache,
-		Tracker:          hc.tracker,
-		DynamicConfig:    hc.dynamicConfig,
-		LocalFSPrefix:    hc.cfg.LocalFSPrefix,
-		IsExternal:       instanceOptions.IsExternal,
-		MasterSocket:     instanceOptions.MasterSocket,
-		AdminSocket:      instanceOptions.AdminSocket,
-		AcmeSocket:       instanceOptions.AcmeSocket,
-		AnnotationPrefix: hc.cfg.AnnPrefix,
-		DefaultBackend:   hc.cfg.DefaultService,
-		DefaultCrtSecret: hc.cfg.DefaultSSLCertificate,
-		FakeCrtFile:      hc.createFakeCrtFile(),
-		FakeCAFile:       hc.createFakeCAFile(),
-		DisableKeywords:  utils.Split(hc.cfg.DisableConfigKeywords, ","),
-		AcmeTrackTLSAnn:  hc.cfg.AcmeTrackTLSAnn,
-		TrackInstances:   hc.cfg.TrackOldInstances,
-		HasGateway:       hc.cache.hasGateway(),
+		Logger:             hc.logger,
+		Cache:              hc.cache,
+		Tracker:            hc.tracker,
+		DynamicConfig:      hc.dynamicConfig,
+		LocalFSPrefix:      hc.cfg.LocalFSPrefix,
+		IsExternal:         instanceOptions.IsExternal,
+		MasterSocket:       instanceOptions.MasterSocket,
+		AdminSocket:        instanceOptions.AdminSocket,
+		StatsSocket:        instanceOptions.StatsSocket,
+		AcmeSocket:         instanceOptions.AcmeSocket,
+		AnnotationPrefix:   hc.cfg.AnnPrefix,
+		DefaultBackend:     hc.cfg.DefaultService,
+		DefaultCrtSecret:   hc.cfg.DefaultSSLCertificate,
+		FakeCrtFile:        hc.createFakeCrtFile(),
+		FakeCAFile:         hc.createFakeCAFile(),
+		DisableKeywords:    utils.Split(hc.cfg.DisableConfigKeywords, ","),
+		AcmeTrackTLSAnn:    hc.cfg.AcmeTrackTLSAnn,
+		TrackInstances:     hc.cfg.TrackOldInstances,
+		HasGateway:         hc.cache.hasGateway(),
+		WorkerDrainTimeout: instanceOptions.WorkerDrainTimeout,
 	}
 }
 
@@ -197,14 +266,22 @@ func (hc *HAProxyController) startServices() {
 		}
 		go hc.acmeQueue.Run()
 		go wait.JitterUntil(func() {
-			_, _ = hc.acmeCheck("periodic check")
+			_, _ = hc.acmeCheck(haproxy.AcmeCheckPeriodic)
 		}, hc.cfg.AcmeCheckPeriod, 0, false, hc.stopCh)
 	}
 	hc.controller.StartAsync()
 }
 
+// haproxyShutdownTimeout is how long stopServices() waits the haproxy
+// instance to stop, in addition to the worker drain timeout.
+const haproxyShutdownTimeout = 30 * time.Second
+
 func (hc *HAProxyController) stopServices() {
-	hc.instance.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), haproxyShutdownTimeout+hc.cfg.WorkerDrainTimeout)
+	defer cancel()
+	if err := hc.instance.Shutdown(ctx); err != nil {
+		hc.logger.Error("error shutting down haproxy instance: %v", err)
+	}
 	hc.ingressQueue.ShutDown()
 	if hc.reloadQueue != nil {
 		hc.reloadQueue.ShutDown()
@@ -271,6 +348,24 @@ func (hc *HAProxyController) Stop() error {
 	return err
 }
 
+// Started is closed when the controller finishes its initialization, so
+// callers running concurrently with Start() can use its services
+func (hc *HAProxyController) Started() <-chan struct{} {
+	return hc.started
+}
+
+// ReloadTemplates parses the templates again and schedules a haproxy update
+func (hc *HAProxyController) ReloadTemplates() error {
+	if hc.instance == nil {
+		return fmt.Errorf("controller wasn't started yet")
+	}
+	if err := hc.instance.ReloadTemplates(); err != nil {
+		return err
+	}
+	hc.ingressQueue.Notify()
+	return nil
+}
+
 // GetIngressList ...
 // implements oldcontroller.NewCtrlIntf
 func (hc *HAProxyController) GetIngressList() ([]*networking.Ingress, error) {
@@ -304,6 +399,17 @@ func (hc *HAProxyController) Check(_ *http.Request) error {
 	return nil
 }
 
+// Ready returns an error if haproxy wasn't started yet or is failing to reload
+func (hc *HAProxyController) Ready(_ *http.Request) error {
+	if hc.instance == nil {
+		return fmt.Errorf("controller wasn't started yet")
+	}
+	if healthy, reason := hc.instance.Healthy(); !healthy {
+		return fmt.Errorf("%s", reason)
+	}
+	return nil
+}
+
 // UpdateIngressStatus custom callback used to update the status in an Ingress rule
 // If the function returns nil the standard functions will be executed.
 func (hc *HAProxyController) UpdateIngressStatus(*networking.Ingress) []api.LoadBalancerIngress {
@@ -352,6 +458,58 @@ func (hc *HAProxyController) acmeCheck(source string) (int, error) {
 	return hc.instance.AcmeCheck(source)
 }
 
+// ForceReload rewrites the configuration and fully reloads haproxy
+func (hc *HAProxyController) ForceReload() error {
+	if hc.instance == nil {
+		return fmt.Errorf("controller wasn't started yet")
+	}
+	hc.writeModelMutex.Lock()
+	defer hc.writeModelMutex.Unlock()
+
+	hc.reloadCount++
+	hc.logger.Info("starting forced haproxy reload id=%d", hc.reloadCount)
+	timer := utils.NewTimer(hc.metrics.ControllerProcTime)
+
+	last := hc.instance.LastReload()
+	hc.instance.ForceReload(timer)
+	if hc.instance.LastReload().Timestamp.Equal(last.Timestamp) {
+		// the reload was enqueued, or skipped and the instance logged the reason
+		hc.logger.Info("forced haproxy reload id=%d did not run synchronously: %s", hc.reloadCount, timer.AsString("total"))
+		return nil
+	}
+	hc.logger.Info("finish forced haproxy reload id=%d: %s", hc.reloadCount, timer.AsString("total"))
+	return nil
+}
+
+// Pause stops applying configuration changes to haproxy, which keeps running
+// with the last applied configuration
+func (hc *HAProxyController) Pause() error {
+	if hc.instance == nil {
+		return fmt.Errorf("controller wasn't started yet")
+	}
+	hc.instance.Pause()
+	return nil
+}
+
+// Resume applies the configuration changes made while paused, and resumes
+// the haproxy updates
+func (hc *HAProxyController) Resume() error {
+	if hc.instance == nil {
+		return fmt.Errorf("controller wasn't started yet")
+	}
+	hc.writeModelMutex.Lock()
+	defer hc.writeModelMutex.Unlock()
+
+	timer := utils.NewTimer(hc.metrics.ControllerProcTime)
+	hc.instance.Resume(timer)
+	return nil
+}
+
+// Paused returns true if the haproxy updates are paused
+func (hc *HAProxyController) Paused() bool {
+	return hc.instance != nil && hc.instance.Paused()
+}
+
 func (hc *HAProxyController) reloadHAProxy(item interface{}) {
 	hc.writeModelMutex.Lock()
 	defer hc.writeModelMutex.Unlock()
@@ -361,5 +519,5 @@ func (hc *HAProxyController) reloadHAProxy(item interface{}) {
 	timer := utils.NewTimer(hc.metrics.ControllerProcTime)
 
 	hc.instance.Reload(timer)
-	hc.logger.Info("finish haproxy reload id=%d: %s", hc.reloadCount, timer.AsString("total"))
+	hc.logger.Info("finish haproxy reload id=%d reason=%s: %s", hc.reloadCount, hc.instance.LastReload().Reason, timer.AsString("total"))
 }
@@ -0,0 +1,46 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	api "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// podEventRecorder records events in the controller pod, so they are listed
+// by `kubectl describe` of the pod. It reuses the recorder of the cache,
+// so events share the same broadcaster and sink.
+type podEventRecorder struct {
+	recorder record.EventRecorder
+	pod      *api.ObjectReference
+}
+
+func newPodEventRecorder(recorder record.EventRecorder, namespace, podname string) *podEventRecorder {
+	return &podEventRecorder{
+		recorder: recorder,
+		pod: &api.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  namespace,
+			Name:       podname,
+		},
+	}
+}
+
+func (r *podEventRecorder) Event(eventtype, reason, message string) {
+	r.recorder.Event(r.pod, eventtype, reason, message)
+}
@@ -20,17 +20,28 @@ import (
 	"fmt"
 
 	"k8s.io/klog/v2"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
 type logger struct {
-	depth int
+	depth  int
+	fields map[string]interface{}
 }
 
 func (l *logger) build(msg string, args []interface{}) string {
-	if len(args) == 0 {
-		return msg
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return msg + utils.FormatLogFields(l.fields)
+}
+
+func (l *logger) WithFields(fields map[string]interface{}) types.Logger {
+	return &logger{
+		depth:  l.depth,
+		fields: utils.MergeLogFields(l.fields, fields),
 	}
-	return fmt.Sprintf(msg, args...)
 }
 
 func (l *logger) InfoV(v int, msg string, args ...interface{}) {
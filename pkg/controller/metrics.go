@@ -18,21 +18,45 @@ package controller
 
 import (
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
 type metrics struct {
-	responseTime       *prometheus.HistogramVec
-	ctlProcTimeSum     *prometheus.CounterVec
-	ctlProcCount       *prometheus.CounterVec
-	procSecondsCounter *prometheus.CounterVec
-	updatesCounter     *prometheus.CounterVec
-	updateSuccessGauge *prometheus.GaugeVec
-	certExpireGauge    *prometheus.GaugeVec
-	certSigningCounter *prometheus.CounterVec
-	lastTrack          time.Time
+	responseTime            *prometheus.HistogramVec
+	ctlProcTimeSum          *prometheus.CounterVec
+	ctlProcCount            *prometheus.CounterVec
+	phaseTime               *prometheus.HistogramVec
+	procSecondsCounter      *prometheus.CounterVec
+	updatesCounter          *prometheus.CounterVec
+	dynLimitedCounter       *prometheus.CounterVec
+	reloadBlocked           *prometheus.CounterVec
+	updateSuccessGauge      *prometheus.GaugeVec
+	changedShards           *prometheus.HistogramVec
+	cfgFilesCounter         *prometheus.CounterVec
+	cfgBytesCounter         *prometheus.CounterVec
+	cfgRotateErrorCounter   *prometheus.CounterVec
+	cfgSizeGauge            *prometheus.GaugeVec
+	mapsSizeGauge           *prometheus.GaugeVec
+	oldWorkersGauge         *prometheus.GaugeVec
+	reloadQueueGauge        *prometheus.GaugeVec
+	reloadFailingGauge      *prometheus.GaugeVec
+	lastApplyGauge          *prometheus.GaugeVec
+	srvStateCounter         *prometheus.CounterVec
+	reloadScriptCounter     *prometheus.CounterVec
+	reloadFallbackCounter   *prometheus.CounterVec
+	socketsNotReusedCounter *prometheus.CounterVec
+	reloadTime              *prometheus.HistogramVec
+	certExpireGauge         *certExpireCollector
+	certCountGauge          *prometheus.GaugeVec
+	certNextExpGauge        *prometheus.GaugeVec
+	acmeLeaderGauge         *prometheus.GaugeVec
+	certSigningCounter      *prometheus.CounterVec
+	lastTrack               time.Time
 }
 
 func createMetrics(bucketsResponseTime []float64) *metrics {
@@ -63,6 +87,15 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{"task"},
 		),
+		phaseTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "haproxy_update_phase_seconds",
+				Help:      "Time in seconds spent on each phase of a haproxy configuration update",
+				Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+			},
+			[]string{"phase"},
+		),
 		procSecondsCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: namespace,
@@ -79,6 +112,22 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{"status"},
 		),
+		dynLimitedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "updates_dynamic_limited_total",
+				Help:      "Cumulative number of dynamic updates that fell back to a full reload due to the max number of commands per update.",
+			},
+			[]string{},
+		),
+		reloadBlocked: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "updates_reload_blocked_total",
+				Help:      "Cumulative number of haproxy reloads skipped due to a configuration that failed the validation.",
+			},
+			[]string{},
+		),
 		updateSuccessGauge: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
@@ -87,13 +136,160 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 			},
 			[]string{},
 		),
-		certExpireGauge: prometheus.NewGaugeVec(
+		changedShards: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "backend_shards_changed",
+				Help:      "Number of backend shards changed and rewritten on every configuration update.",
+				Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+			},
+			[]string{},
+		),
+		cfgFilesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "config_files_written_total",
+				Help:      "Cumulative number of haproxy configuration files written on configuration updates.",
+			},
+			[]string{},
+		),
+		cfgBytesCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "config_bytes_written_total",
+				Help:      "Cumulative number of bytes written in haproxy configuration files on configuration updates.",
+			},
+			[]string{},
+		),
+		cfgRotateErrorCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "config_rotate_errors_total",
+				Help:      "Cumulative number of failures rotating the old haproxy configuration files. The new configuration is written despite of the failure.",
+			},
+			[]string{},
+		),
+		cfgSizeGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "config_bytes",
+				Help:      "Size in bytes of the last written main haproxy configuration file.",
+			},
+			[]string{},
+		),
+		mapsSizeGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "maps_bytes",
+				Help:      "Sum of the sizes in bytes of the haproxy map files in use, written by the controller.",
+			},
+			[]string{},
+		),
+		oldWorkersGauge: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace: namespace,
-				Name:      "cert_expire_date_epoch",
-				Help:      "The SSL certificate expiration date in unix epoch time.",
+				Name:      "haproxy_old_workers",
+				Help:      "Number of old haproxy workers still running after the last reload of an external haproxy.",
+			},
+			[]string{},
+		),
+		reloadQueueGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "reload_queue_depth",
+				Help:      "Number of configuration updates waiting for an enqueued haproxy reload.",
+			},
+			[]string{},
+		),
+		reloadFailingGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "reload_failing_seconds",
+				Help:      "Time in seconds haproxy is failing to reload or to validate its configuration, zero if the last attempt succeeded.",
+			},
+			[]string{},
+		),
+		lastApplyGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "last_successful_apply_timestamp_seconds",
+				Help:      "Unix timestamp of the last configuration update fully applied to haproxy, either dynamically or via a successful reload.",
+			},
+			[]string{},
+		),
+		srvStateCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "server_state_persist_total",
+				Help:      "Cumulative number of attempts to persist the servers state before a haproxy reload.",
+			},
+			[]string{"success"},
+		),
+		reloadScriptCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "reload_script_issues_total",
+				Help:      "Cumulative number of reload script executions that succeeded with warnings, or failed.",
 			},
-			[]string{"domain", "cn"},
+			[]string{"severity"},
+		),
+		reloadFallbackCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "reload_strategy_fallback_total",
+				Help:      "Cumulative number of reloads retried with a fallback reload strategy, labeled by the fallback strategy.",
+			},
+			[]string{"strategy"},
+		),
+		socketsNotReusedCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "reload_sockets_not_reused_total",
+				Help:      "Cumulative number of reloads whose new haproxy worker could not reuse the listening sockets of the old worker.",
+			},
+			[]string{},
+		),
+		reloadTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "reload_duration_seconds",
+				Help:      "Time in seconds spent reloading haproxy, labeled by the haproxy mode, the reload strategy and the reload result.",
+				Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+			[]string{"mode", "strategy", "success"},
+		),
+		certExpireGauge: &certExpireCollector{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "", "cert_expire_date_epoch"),
+				"The SSL certificate expiration date in unix epoch time.",
+				append([]string{"domain", "cn"}, types.CertExpireLabels...),
+				nil,
+			),
+			certs: map[certExpireKey]certExpireValue{},
+		},
+		certCountGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "cert_managed_count",
+				Help:      "Number of distinct SSL certificates used by the configured hosts.",
+			},
+			[]string{},
+		),
+		certNextExpGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "cert_next_expire_date_epoch",
+				Help:      "The soonest SSL certificate expiration date among all the configured hosts in unix epoch time.",
+			},
+			[]string{},
+		),
+		acmeLeaderGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "acme_leader",
+				Help:      "Whether this controller instance is the acme leader, only the leader signs certificates.",
+			},
+			[]string{},
 		),
 		certSigningCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -107,10 +303,31 @@ func createMetrics(bucketsResponseTime []float64) *metrics {
 	prometheus.MustRegister(metrics.responseTime)
 	prometheus.MustRegister(metrics.ctlProcTimeSum)
 	prometheus.MustRegister(metrics.ctlProcCount)
+	prometheus.MustRegister(metrics.phaseTime)
 	prometheus.MustRegister(metrics.procSecondsCounter)
 	prometheus.MustRegister(metrics.updatesCounter)
+	prometheus.MustRegister(metrics.dynLimitedCounter)
+	prometheus.MustRegister(metrics.reloadBlocked)
 	prometheus.MustRegister(metrics.updateSuccessGauge)
+	prometheus.MustRegister(metrics.changedShards)
+	prometheus.MustRegister(metrics.cfgFilesCounter)
+	prometheus.MustRegister(metrics.cfgBytesCounter)
+	prometheus.MustRegister(metrics.cfgRotateErrorCounter)
+	prometheus.MustRegister(metrics.cfgSizeGauge)
+	prometheus.MustRegister(metrics.mapsSizeGauge)
+	prometheus.MustRegister(metrics.oldWorkersGauge)
+	prometheus.MustRegister(metrics.reloadQueueGauge)
+	prometheus.MustRegister(metrics.reloadFailingGauge)
+	prometheus.MustRegister(metrics.lastApplyGauge)
+	prometheus.MustRegister(metrics.srvStateCounter)
+	prometheus.MustRegister(metrics.reloadScriptCounter)
+	prometheus.MustRegister(metrics.reloadFallbackCounter)
+	prometheus.MustRegister(metrics.socketsNotReusedCounter)
+	prometheus.MustRegister(metrics.reloadTime)
 	prometheus.MustRegister(metrics.certExpireGauge)
+	prometheus.MustRegister(metrics.certCountGauge)
+	prometheus.MustRegister(metrics.certNextExpGauge)
+	prometheus.MustRegister(metrics.acmeLeaderGauge)
 	prometheus.MustRegister(metrics.certSigningCounter)
 	return metrics
 }
@@ -127,11 +344,19 @@ func (m *metrics) HAProxySetSSLCertResponseTime(duration time.Duration) {
 	m.responseTime.WithLabelValues("set_ssl_cert").Observe(duration.Seconds())
 }
 
+func (m *metrics) HAProxySetMapResponseTime(duration time.Duration) {
+	m.responseTime.WithLabelValues("set_map").Observe(duration.Seconds())
+}
+
 func (m *metrics) ControllerProcTime(task string, duration time.Duration) {
 	m.ctlProcTimeSum.WithLabelValues(task).Add(duration.Seconds())
 	m.ctlProcCount.WithLabelValues(task).Inc()
 }
 
+func (m *metrics) ObservePhase(name string, duration time.Duration) {
+	m.phaseTime.WithLabelValues(name).Observe(duration.Seconds())
+}
+
 func (m *metrics) AddIdleFactor(idle int) {
 	now := time.Now()
 	if m.lastTrack.IsZero() {
@@ -155,21 +380,107 @@ func (m *metrics) IncUpdateFull() {
 	m.updatesCounter.WithLabelValues("full").Inc()
 }
 
+func (m *metrics) IncUpdateDynamicLimited() {
+	m.dynLimitedCounter.WithLabelValues().Inc()
+}
+
+func (m *metrics) IncUpdateReloadBlocked() {
+	m.reloadBlocked.WithLabelValues().Inc()
+}
+
 func (m *metrics) UpdateSuccessful(success bool) {
 	value := map[bool]float64{false: 0, true: 1}
 	m.updateSuccessGauge.WithLabelValues().Set(value[success])
 }
 
-func (m *metrics) SetCertExpireDate(domain, cn string, notAfter *time.Time) {
-	if notAfter == nil {
-		m.certExpireGauge.DeleteLabelValues(domain, cn)
+func (m *metrics) AddChangedShards(n int) {
+	m.changedShards.WithLabelValues().Observe(float64(n))
+}
+
+func (m *metrics) AddConfigFilesWritten(files, bytes int) {
+	m.cfgFilesCounter.WithLabelValues().Add(float64(files))
+	m.cfgBytesCounter.WithLabelValues().Add(float64(bytes))
+}
+
+func (m *metrics) IncConfigRotateError() {
+	m.cfgRotateErrorCounter.WithLabelValues().Inc()
+}
+
+func (m *metrics) SetConfigBytes(bytes int) {
+	m.cfgSizeGauge.WithLabelValues().Set(float64(bytes))
+}
+
+func (m *metrics) SetMapsBytes(bytes int) {
+	m.mapsSizeGauge.WithLabelValues().Set(float64(bytes))
+}
+
+func (m *metrics) SetOldWorkers(n int) {
+	m.oldWorkersGauge.WithLabelValues().Set(float64(n))
+}
+
+func (m *metrics) SetReloadQueueDepth(n int) {
+	m.reloadQueueGauge.WithLabelValues().Set(float64(n))
+}
+
+func (m *metrics) SetReloadFailingSeconds(seconds float64) {
+	m.reloadFailingGauge.WithLabelValues().Set(seconds)
+}
+
+func (m *metrics) SetLastSuccessfulApply(t time.Time) {
+	m.lastApplyGauge.WithLabelValues().Set(float64(t.UnixNano()) / 1e9)
+}
+
+func (m *metrics) IncServerStatePersistSuccess() {
+	m.srvStateCounter.WithLabelValues("true").Inc()
+}
+
+func (m *metrics) IncServerStatePersistError() {
+	m.srvStateCounter.WithLabelValues("false").Inc()
+}
+
+func (m *metrics) IncReloadScriptWarning() {
+	m.reloadScriptCounter.WithLabelValues("warning").Inc()
+}
+
+func (m *metrics) IncReloadScriptError() {
+	m.reloadScriptCounter.WithLabelValues("error").Inc()
+}
+
+func (m *metrics) IncReloadStrategyFallback(strategy string) {
+	m.reloadFallbackCounter.WithLabelValues(strategy).Inc()
+}
+
+func (m *metrics) IncReloadSocketsNotReused() {
+	m.socketsNotReusedCounter.WithLabelValues().Inc()
+}
+
+func (m *metrics) ObserveReload(mode, strategy string, success bool, duration time.Duration) {
+	m.reloadTime.WithLabelValues(mode, strategy, strconv.FormatBool(success)).Observe(duration.Seconds())
+}
+
+func (m *metrics) SetCertExpireDate(domain, cn string, labels map[string]string, notAfter *time.Time) {
+	m.certExpireGauge.set(domain, cn, labels, notAfter)
+}
+
+func (m *metrics) ReplaceCertExpire(certs []types.CertExpire) {
+	m.certExpireGauge.replace(certs)
+}
+
+func (m *metrics) SetManagedCertCount(n int) {
+	m.certCountGauge.WithLabelValues().Set(float64(n))
+}
+
+func (m *metrics) SetNextCertExpiry(notAfter time.Time) {
+	if notAfter.IsZero() {
+		m.certNextExpGauge.Reset()
 		return
 	}
-	m.certExpireGauge.WithLabelValues(domain, cn).Set(float64(notAfter.Unix()))
+	m.certNextExpGauge.WithLabelValues().Set(float64(notAfter.Unix()))
 }
 
-func (m *metrics) ClearCertExpire() {
-	m.certExpireGauge.Reset()
+func (m *metrics) SetAcmeLeaderStatus(leader bool) {
+	value := map[bool]float64{false: 0, true: 1}
+	m.acmeLeaderGauge.WithLabelValues().Set(value[leader])
 }
 
 func (m *metrics) IncCertSigningMissing(domains string, success bool) {
@@ -183,3 +494,64 @@ func (m *metrics) IncCertSigningExpiring(domains string, success bool) {
 func (m *metrics) IncCertSigningOutdated(domains string, success bool) {
 	m.certSigningCounter.WithLabelValues(domains, "outdated", strconv.FormatBool(success)).Inc()
 }
+
+type certExpireKey struct {
+	domain string
+	cn     string
+}
+
+type certExpireValue struct {
+	notAfter time.Time
+	labels   []string
+}
+
+func newCertExpireValue(labels map[string]string, notAfter time.Time) certExpireValue {
+	values := make([]string, len(types.CertExpireLabels))
+	for i, label := range types.CertExpireLabels {
+		values[i] = labels[label]
+	}
+	return certExpireValue{notAfter: notAfter, labels: values}
+}
+
+// certExpireCollector exports the expiration date of the certificates. A
+// custom collector is used instead of a GaugeVec so the whole set can be
+// replaced at once, and a scrape never sees a partially populated set.
+type certExpireCollector struct {
+	desc  *prometheus.Desc
+	mutex sync.Mutex
+	certs map[certExpireKey]certExpireValue
+}
+
+func (c *certExpireCollector) set(domain, cn string, labels map[string]string, notAfter *time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := certExpireKey{domain: domain, cn: cn}
+	if notAfter == nil {
+		delete(c.certs, key)
+		return
+	}
+	c.certs[key] = newCertExpireValue(labels, *notAfter)
+}
+
+func (c *certExpireCollector) replace(certs []types.CertExpire) {
+	newCerts := make(map[certExpireKey]certExpireValue, len(certs))
+	for _, cert := range certs {
+		newCerts[certExpireKey{domain: cert.Domain, cn: cert.CN}] = newCertExpireValue(cert.Labels, cert.NotAfter)
+	}
+	c.mutex.Lock()
+	c.certs = newCerts
+	c.mutex.Unlock()
+}
+
+func (c *certExpireCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *certExpireCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, value := range c.certs {
+		labels := append([]string{key.domain, key.cn}, value.labels...)
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(value.notAfter.Unix()), labels...)
+	}
+}
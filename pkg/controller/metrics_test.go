@@ -0,0 +1,62 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+func TestCertExpireCollector(t *testing.T) {
+	c := &certExpireCollector{
+		desc:  prometheus.NewDesc("cert_expire_date_epoch", "help", []string{"domain", "cn", "namespace", "ingress"}, nil),
+		certs: map[certExpireKey]certExpireValue{},
+	}
+	notAfter1 := time.Unix(1000, 0)
+	notAfter2 := time.Unix(2000, 0)
+	c.set("d1.local", "d1", nil, &notAfter1)
+	c.set("d2.local", "d2", map[string]string{"namespace": "team1", "ingress": "app", "other": "ignored"}, &notAfter2)
+	c.set("d1.local", "d1", nil, nil)
+	expected := `
+# HELP cert_expire_date_epoch help
+# TYPE cert_expire_date_epoch gauge
+cert_expire_date_epoch{cn="d2",domain="d2.local",ingress="app",namespace="team1"} 2000
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics after set: %v", err)
+	}
+
+	c.replace([]types.CertExpire{
+		{Domain: "d3.local", CN: "d3", NotAfter: notAfter1},
+		{Domain: "d4.local", CN: "d4", Labels: map[string]string{"namespace": "team2"}, NotAfter: notAfter2},
+	})
+	expected = `
+# HELP cert_expire_date_epoch help
+# TYPE cert_expire_date_epoch gauge
+cert_expire_date_epoch{cn="d3",domain="d3.local",ingress="",namespace=""} 1000
+cert_expire_date_epoch{cn="d4",domain="d4.local",ingress="",namespace="team2"} 2000
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics after replace: %v", err)
+	}
+}
@@ -473,6 +473,9 @@ func (c *converter) applyCertRef(source *Source, listener *gatewayv1alpha2.Liste
 		host.TLS.TLSCommonName = crtFile.CommonName
 		host.TLS.TLSFilename = crtFile.Filename
 		host.TLS.TLSHash = crtFile.SHA1Hash
+		host.TLS.Labels = map[string]string{
+			types.CertExpireLabelNamespace: source.namespace,
+		}
 	}
 }
 
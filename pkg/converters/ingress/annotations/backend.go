@@ -900,13 +900,13 @@ func (c *updater) buildBackendSourceAddressIntf(d *backData) {
 				if ip == nil {
 					ip, _, _ = net.ParseCIDR(addr.String())
 				}
-				if ip != nil && len(ip.To4()) == net.IPv4len {
-					// currently only IPv4
+				if ip != nil && (ip.To4() != nil || ip.IsGlobalUnicast()) {
+					// IPv6 link-local addresses need a zone and are skipped
 					newIPs = append(newIPs, ip)
 				}
 			}
 			if newIPs == nil {
-				c.logger.Warn("network interface '%s' not found or does not have any IPv4 address", ifname)
+				c.logger.Warn("network interface '%s' not found or does not have any IP address", ifname)
 			}
 			sourceIPs = append(sourceIPs, newIPs...)
 		}
@@ -1003,6 +1003,17 @@ func (c *updater) buildBackendWAF(d *backData) {
 		path.WAF.Mode = mode
 		path.WAF.FailClosed = wafFailClosed
 	}
+	if !d.backend.HasModsec() {
+		return
+	}
+	wafGroup := d.mapper.Get(ingtypes.BackWAFGroup)
+	if group := wafGroup.Value; group != "" {
+		if c.haproxy.Global().ModSecurity.FindGroup(group) == nil {
+			c.logger.Warn("ignoring unknown modsecurity group '%s' on %s, using the default endpoints instead", group, wafGroup.Source)
+			return
+		}
+		d.backend.WAFGroup = group
+	}
 }
 
 func (c *updater) buildBackendWhitelistHTTP(d *backData) {
@@ -2425,9 +2425,10 @@ func TestSourceAddrIntf(t *testing.T) {
 	ip4 := addr{"192.168.0.4"}
 	ip5 := addr{"192.168.0.5fail"}
 	ip6 := addr{"fa00::6"}
+	ip7 := addr{"fe80::7/64"}
 	host1 := map[string][]net.Addr{
 		"eth0": {ip2, ip3},
-		"en0":  {ip4, ip5, ip6},
+		"en0":  {ip4, ip5, ip6, ip7},
 	}
 	host2 := map[string][]net.Addr{
 		"eth0": {ip2},
@@ -2442,14 +2443,14 @@ func TestSourceAddrIntf(t *testing.T) {
 		{
 			ifs:    host1,
 			source: "eth0,en0",
-			expIPs: []string{"192.168.0.2", "192.168.0.3", "192.168.0.4"},
+			expIPs: []string{"192.168.0.2", "192.168.0.3", "192.168.0.4", "fa00::6"},
 		},
 		// 1
 		{
 			ifs:     host2,
 			source:  "eth0,en0",
 			expIPs:  []string{"192.168.0.2"},
-			logging: `WARN network interface 'en0' not found or does not have any IPv4 address`,
+			logging: `WARN network interface 'en0' not found or does not have any IP address`,
 		},
 	}
 	for i, test := range testCases {
@@ -2761,6 +2762,65 @@ func TestWAF(t *testing.T) {
 	}
 }
 
+func TestWAFGroup(t *testing.T) {
+	testCase := []struct {
+		waf      string
+		group    string
+		expected string
+		logging  string
+	}{
+		// 0
+		{
+			waf:      "modsecurity",
+			expected: "",
+		},
+		// 1
+		{
+			waf:      "modsecurity",
+			group:    "strict",
+			expected: "strict",
+		},
+		// 2
+		{
+			waf:      "",
+			group:    "strict",
+			expected: "",
+		},
+		// 3
+		{
+			waf:      "modsecurity",
+			group:    "relaxed",
+			expected: "",
+			logging:  "WARN ignoring unknown modsecurity group 'relaxed' on ingress 'default/ing1', using the default endpoints instead",
+		},
+	}
+	source := &Source{
+		Namespace: "default",
+		Name:      "ing1",
+		Type:      "ingress",
+	}
+	for i, test := range testCase {
+		c := setup(t)
+		c.haproxy.Global().ModSecurity.Groups = []*hatypes.ModSecurityGroup{
+			{Name: "strict", Endpoints: []string{"10.0.0.1:12345"}},
+		}
+		ann := map[string]map[string]string{
+			"/": {},
+		}
+		if test.waf != "" {
+			ann["/"][ingtypes.BackWAF] = test.waf
+		}
+		if test.group != "" {
+			ann["/"][ingtypes.BackWAFGroup] = test.group
+		}
+		d := c.createBackendMappingData("default/app", source, map[string]string{ingtypes.BackWAFMode: "deny"}, ann, []string{})
+		c.createUpdater().buildBackendWAF(d)
+		c.compareObjects("WAF group", i, d.backend.WAFGroup, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestWhitelistHTTP(t *testing.T) {
 	testCases := []struct {
 		paths       []string
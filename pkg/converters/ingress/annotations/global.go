@@ -99,7 +99,7 @@ func (c *updater) buildGlobalCloseSessions(d *globalData) {
 		c.logger.Warn("ignoring close-sessions-duration config: tracking old instances is disabled")
 		return
 	}
-	timeoutCfg := d.mapper.Get(ingtypes.GlobalTimeoutStop).Value
+	timeoutCfg := c.timeoutStop(d)
 	if timeoutCfg == "" {
 		c.logger.Warn("ignoring close-sessions-duration config: timeout-stop need to be configured")
 		return
@@ -256,6 +256,15 @@ func (c *updater) buildGlobalSyslog(d *globalData) {
 	d.global.Syslog.TCPLogFormat = d.mapper.Get(ingtypes.GlobalTCPLogFormat).Value
 }
 
+// timeoutStop returns the configured timeout-stop, or the worker drain
+// timeout from the command-line which has precedence if configured.
+func (c *updater) timeoutStop(d *globalData) string {
+	if drain := c.options.WorkerDrainTimeout; drain > 0 {
+		return fmt.Sprintf("%dms", drain.Milliseconds())
+	}
+	return d.mapper.Get(ingtypes.GlobalTimeoutStop).Value
+}
+
 func (c *updater) buildGlobalTimeout(d *globalData) {
 	d.global.Timeout.Client = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutClient))
 	d.global.Timeout.ClientFin = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutClientFin))
@@ -265,7 +274,11 @@ func (c *updater) buildGlobalTimeout(d *globalData) {
 	d.global.Timeout.Queue = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutQueue))
 	d.global.Timeout.Server = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutServer))
 	d.global.Timeout.ServerFin = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutServerFin))
-	d.global.Timeout.Stop = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutStop))
+	if c.options.WorkerDrainTimeout > 0 {
+		d.global.Timeout.Stop = c.timeoutStop(d)
+	} else {
+		d.global.Timeout.Stop = c.validateTime(d.mapper.Get(ingtypes.GlobalTimeoutStop))
+	}
 	d.global.Timeout.Tunnel = c.validateTime(d.mapper.Get(ingtypes.BackTimeoutTunnel))
 	if timeoutStop, err := time.ParseDuration(d.global.Timeout.Stop); err == nil {
 		d.global.TimeoutStopDuration = timeoutStop
@@ -345,6 +358,41 @@ func (c *updater) buildGlobalModSecurity(d *globalData) {
 	d.global.ModSecurity.Timeout.Processing = c.validateTime(d.mapper.Get(ingtypes.GlobalModsecurityTimeoutProcessing))
 	d.global.ModSecurity.Timeout.Server = c.validateTime(d.mapper.Get(ingtypes.GlobalModsecurityTimeoutServer))
 	d.global.ModSecurity.Args = utils.Split(d.mapper.Get(ingtypes.GlobalModsecurityArgs).Value, " ")
+	c.buildGlobalModSecurityGroups(d)
+}
+
+var modsecGroupRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+func (c *updater) buildGlobalModSecurityGroups(d *globalData) {
+	groups := d.mapper.Get(ingtypes.GlobalModsecurityGroups).Value
+	for _, group := range utils.LineToSlice(groups) {
+		if group == "" {
+			continue
+		}
+		groupData := strings.Split(group, "=")
+		if len(groupData) != 2 {
+			c.logger.Warn("ignoring misconfigured modsecurity group: %s", group)
+			continue
+		}
+		name := strings.TrimSpace(groupData[0])
+		if !modsecGroupRegex.MatchString(name) {
+			c.logger.Warn("ignoring modsecurity group with invalid name: %s", name)
+			continue
+		}
+		if d.global.ModSecurity.FindGroup(name) != nil {
+			c.logger.Warn("ignoring duplicated modsecurity group: %s", name)
+			continue
+		}
+		endpoints := utils.Split(strings.TrimSpace(groupData[1]), ",")
+		if len(endpoints) == 0 {
+			c.logger.Warn("ignoring modsecurity group without endpoints: %s", name)
+			continue
+		}
+		d.global.ModSecurity.Groups = append(d.global.ModSecurity.Groups, &hatypes.ModSecurityGroup{
+			Name:      name,
+			Endpoints: endpoints,
+		})
+	}
 }
 
 func (c *updater) buildGlobalDNS(d *globalData) {
@@ -156,6 +156,7 @@ func TestCloseSessions(t *testing.T) {
 	testCases := []struct {
 		annDuration string
 		annStop     string
+		drain       time.Duration
 		expDuration time.Duration
 		untrack     bool
 		logging     string
@@ -216,6 +217,19 @@ func TestCloseSessions(t *testing.T) {
 			annStop:     "10m",
 			expDuration: 30 * time.Second,
 		},
+		// 10
+		{
+			annDuration: "50%",
+			drain:       2 * time.Minute,
+			expDuration: time.Minute,
+		},
+		// 11
+		{
+			annDuration: "5m",
+			annStop:     "10m",
+			drain:       2 * time.Minute,
+			logging:     `WARN ignoring invalid close-sessions-duration config: close-sessions-duration should be lower than timeout-stop`,
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -227,6 +241,7 @@ func TestCloseSessions(t *testing.T) {
 		if !test.untrack {
 			u.options.TrackInstances = true
 		}
+		u.options.WorkerDrainTimeout = test.drain
 		u.buildGlobalCloseSessions(d)
 		c.compareObjects("close sessions duration", i, d.global.CloseSessionsDuration, test.expDuration)
 		c.logger.CompareLogging(test.logging)
@@ -234,6 +249,49 @@ func TestCloseSessions(t *testing.T) {
 	}
 }
 
+func TestTimeoutStop(t *testing.T) {
+	testCases := []struct {
+		annStop     string
+		drain       time.Duration
+		expStop     string
+		expDuration time.Duration
+	}{
+		// 0
+		{},
+		// 1
+		{
+			annStop:     "10m",
+			expStop:     "10m",
+			expDuration: 10 * time.Minute,
+		},
+		// 2
+		{
+			drain:       90 * time.Second,
+			expStop:     "90000ms",
+			expDuration: 90 * time.Second,
+		},
+		// 3
+		{
+			annStop:     "10m",
+			drain:       30 * time.Second,
+			expStop:     "30000ms",
+			expDuration: 30 * time.Second,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(map[string]string{
+			ingtypes.GlobalTimeoutStop: test.annStop,
+		})
+		u := c.createUpdater()
+		u.options.WorkerDrainTimeout = test.drain
+		u.buildGlobalTimeout(d)
+		c.compareObjects("timeout stop", i, d.global.Timeout.Stop, test.expStop)
+		c.compareObjects("timeout stop duration", i, d.global.TimeoutStopDuration, test.expDuration)
+		c.teardown()
+	}
+}
+
 func TestCustomConfigProxy(t *testing.T) {
 	testCases := []struct {
 		config   string
@@ -368,6 +426,69 @@ func TestModSecurity(t *testing.T) {
 	}
 }
 
+func TestModSecurityGroups(t *testing.T) {
+	testCases := []struct {
+		groups   string
+		expected []*hatypes.ModSecurityGroup
+		logging  string
+	}{
+		// 0
+		{
+			groups:   "",
+			expected: nil,
+		},
+		// 1
+		{
+			groups: "strict=10.0.0.1:12345",
+			expected: []*hatypes.ModSecurityGroup{
+				{Name: "strict", Endpoints: []string{"10.0.0.1:12345"}},
+			},
+		},
+		// 2
+		{
+			groups: "strict=10.0.0.1:12345, 10.0.0.2:12345\nrelaxed=10.0.1.1:12345",
+			expected: []*hatypes.ModSecurityGroup{
+				{Name: "strict", Endpoints: []string{"10.0.0.1:12345", "10.0.0.2:12345"}},
+				{Name: "relaxed", Endpoints: []string{"10.0.1.1:12345"}},
+			},
+		},
+		// 3
+		{
+			groups:   "strict",
+			expected: nil,
+			logging:  "WARN ignoring misconfigured modsecurity group: strict",
+		},
+		// 4
+		{
+			groups:   "Strict/1=10.0.0.1:12345",
+			expected: nil,
+			logging:  "WARN ignoring modsecurity group with invalid name: Strict/1",
+		},
+		// 5
+		{
+			groups:   "strict=",
+			expected: nil,
+			logging:  "WARN ignoring modsecurity group without endpoints: strict",
+		},
+		// 6
+		{
+			groups: "strict=10.0.0.1:12345\nstrict=10.0.0.2:12345",
+			expected: []*hatypes.ModSecurityGroup{
+				{Name: "strict", Endpoints: []string{"10.0.0.1:12345"}},
+			},
+			logging: "WARN ignoring duplicated modsecurity group: strict",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		d := c.createGlobalData(map[string]string{ingtypes.GlobalModsecurityGroups: test.groups})
+		c.createUpdater().buildGlobalModSecurity(d)
+		c.compareObjects("modsecurity groups", i, d.global.ModSecurity.Groups, test.expected)
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
 func TestDNS(t *testing.T) {
 	testCases := []struct {
 		config   map[string]string
@@ -149,6 +149,7 @@ func (c *updater) UpdateGlobalConfig(haproxyConfig haproxy.Config, mapper *Mappe
 		mapper:   mapper,
 	}
 	d.global.AdminSocket = c.options.AdminSocket
+	d.global.StatsSocket = c.options.StatsSocket
 	d.global.LocalFSPrefix = c.options.LocalFSPrefix
 	d.global.MaxConn = mapper.Get(ingtypes.GlobalMaxConnections).Int()
 	d.global.DefaultBackendRedir = mapper.Get(ingtypes.GlobalDefaultBackendRedirect).String()
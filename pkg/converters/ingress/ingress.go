@@ -460,6 +460,10 @@ func (c *converter) syncIngressHTTP(source *annotations.Source, ing *networking.
 				host.TLS.TLSHash = tlsPath.SHA1Hash
 				host.TLS.TLSCommonName = tlsPath.CommonName
 				host.TLS.TLSNotAfter = tlsPath.NotAfter
+				host.TLS.Labels = map[string]string{
+					types.CertExpireLabelNamespace: ing.Namespace,
+					types.CertExpireLabelIngress:   ing.Name,
+				}
 			} else if host.TLS.TLSHash != tlsPath.SHA1Hash {
 				msg := fmt.Sprintf("TLS of host '%s' was already assigned", host.Hostname)
 				if tls.SecretName != "" {
@@ -182,6 +182,7 @@ const (
 	BackUseResolver            = "use-resolver"
 	BackWAF                    = "waf"
 	BackWAFFailClosed          = "waf-fail-closed"
+	BackWAFGroup               = "waf-group"
 	BackWAFMode                = "waf-mode"
 	BackWhitelistSourceRange   = "whitelist-source-range"
 )
@@ -94,6 +94,7 @@ const (
 	GlobalMaxConnections               = "max-connections"
 	GlobalModsecurityArgs              = "modsecurity-args"
 	GlobalModsecurityEndpoints         = "modsecurity-endpoints"
+	GlobalModsecurityGroups            = "modsecurity-groups"
 	GlobalModsecurityTimeoutConnect    = "modsecurity-timeout-connect"
 	GlobalModsecurityTimeoutHello      = "modsecurity-timeout-hello"
 	GlobalModsecurityTimeoutIdle       = "modsecurity-timeout-idle"
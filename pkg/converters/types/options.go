@@ -17,30 +17,34 @@ limitations under the License.
 package types
 
 import (
+	"time"
+
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
 // ConverterOptions ...
 type ConverterOptions struct {
-	Logger           types.Logger
-	Cache            Cache
-	Tracker          Tracker
-	DynamicConfig    *DynamicConfig
-	LocalFSPrefix    string
-	IsExternal       bool
-	MasterSocket     string
-	AdminSocket      string
-	AcmeSocket       string
-	DefaultConfig    func() map[string]string
-	DefaultBackend   string
-	DefaultCrtSecret string
-	FakeCrtFile      CrtFile
-	FakeCAFile       CrtFile
-	AnnotationPrefix []string
-	DisableKeywords  []string
-	AcmeTrackTLSAnn  bool
-	TrackInstances   bool
-	HasGateway       bool
+	Logger             types.Logger
+	Cache              Cache
+	Tracker            Tracker
+	DynamicConfig      *DynamicConfig
+	LocalFSPrefix      string
+	IsExternal         bool
+	MasterSocket       string
+	AdminSocket        string
+	StatsSocket        string
+	AcmeSocket         string
+	DefaultConfig      func() map[string]string
+	DefaultBackend     string
+	DefaultCrtSecret   string
+	FakeCrtFile        CrtFile
+	FakeCAFile         CrtFile
+	AnnotationPrefix   []string
+	DisableKeywords    []string
+	AcmeTrackTLSAnn    bool
+	TrackInstances     bool
+	HasGateway         bool
+	WorkerDrainTimeout time.Duration
 }
 
 // DynamicConfig ...
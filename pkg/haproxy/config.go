@@ -18,8 +18,11 @@ package haproxy
 
 import (
 	"fmt"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/jinzhu/copier"
 
@@ -41,11 +44,65 @@ type Config interface {
 	Hosts() *hatypes.Hosts
 	Backends() *hatypes.Backends
 	Userlists() *hatypes.Userlists
+	Diff() ConfigDiff
+	PendingDiff() PendingDiff
+	PendingChanges() bool
+	Stats() ConfigStats
+	MapsBytes() int
+	ValidateCertFiles() []error
 	Clear()
 	Shrink()
 	Commit()
 }
 
+// ConfigDiff lists hosts, backends and tcp services (configmap based)
+// that changed since the last commit. Changed items are the ones found
+// in both the added and the removed trackers, and only the current
+// (new) instance is listed. All slices are sorted by name.
+type ConfigDiff struct {
+	HostsAdded         []*hatypes.Host
+	HostsRemoved       []*hatypes.Host
+	HostsChanged       []*hatypes.Host
+	BackendsAdded      []*hatypes.Backend
+	BackendsRemoved    []*hatypes.Backend
+	BackendsChanged    []*hatypes.Backend
+	TCPServicesAdded   []*hatypes.TCPBackend
+	TCPServicesRemoved []*hatypes.TCPBackend
+	TCPServicesChanged []*hatypes.TCPBackend
+}
+
+// PendingDiff lists the changes made in the configuration since the last
+// commit. Hosts and backends reparsed without changing their content are not
+// listed, even if the config wasn't shrunk yet. Configurations without a
+// tracker per item only report if they changed.
+type PendingDiff struct {
+	ConfigDiff
+	GlobalChanged          bool
+	FrontendChanged        bool
+	UserlistsChanged       bool
+	TCPServicePortsChanged bool
+}
+
+// HasChanges returns true if the diff has at least one change.
+func (d *PendingDiff) HasChanges() bool {
+	return d.GlobalChanged || d.FrontendChanged || d.UserlistsChanged || d.TCPServicePortsChanged ||
+		len(d.HostsAdded) > 0 || len(d.HostsRemoved) > 0 || len(d.HostsChanged) > 0 ||
+		len(d.BackendsAdded) > 0 || len(d.BackendsRemoved) > 0 || len(d.BackendsChanged) > 0 ||
+		len(d.TCPServicesAdded) > 0 || len(d.TCPServicesRemoved) > 0 || len(d.TCPServicesChanged) > 0
+}
+
+// ConfigStats has the number of items found in the configuration,
+// including the ones not committed yet. MapEntries counts the entries
+// of the maps built on the last map writing.
+type ConfigStats struct {
+	Hosts       int
+	Backends    int
+	Endpoints   int
+	TCPBackends int
+	TCPServices int
+	MapEntries  int
+}
+
 type config struct {
 	// external state, non haproxy data
 	options  options
@@ -59,28 +116,44 @@ type config struct {
 	tcpbackends *hatypes.TCPBackends
 	tcpservices *hatypes.TCPServices
 	userlists   *hatypes.Userlists
+	maps        *mapTracker
+	mapSizes    *mapSizes
+	// prefixes of the map files fully rewritten since the last commit,
+	// see mapTracker.commit()
+	mapsRewritten []string
 }
 
 type options struct {
 	mapsTemplate *template.Config
 	mapsDir      string
 	shardCount   int
+	shardBy      string
+	mapShards    int
+	trackMaps    bool
+	skipMapFiles bool
 }
 
 func createConfig(options options) *config {
-	if options.mapsTemplate == nil {
+	if options.skipMapFiles {
+		// a nil template only tracks the maps, see writeMapItems()
+		options.mapsTemplate = nil
+	} else if options.mapsTemplate == nil {
 		options.mapsTemplate = template.CreateConfig()
 	}
+	backends := hatypes.CreateBackends(options.shardCount)
+	backends.SetShardBy(options.shardBy)
 	return &config{
 		options:     options,
 		acmeData:    &hatypes.AcmeData{},
 		global:      &hatypes.Global{},
 		frontend:    &hatypes.Frontend{},
 		hosts:       hatypes.CreateHosts(),
-		backends:    hatypes.CreateBackends(options.shardCount),
+		backends:    backends,
 		tcpbackends: hatypes.CreateTCPBackends(),
 		tcpservices: hatypes.CreateTCPServices(),
 		userlists:   hatypes.CreateUserlists(),
+		maps:        newMapTracker(options.trackMaps),
+		mapSizes:    newMapSizes(),
 	}
 }
 
@@ -150,6 +223,7 @@ func (c *config) WriteTCPServicesMaps() error {
 		return nil
 	}
 	mapBuilder := hatypes.CreateMaps(c.global.MatchOrder)
+	c.mapsRewritten = append(c.mapsRewritten, c.options.mapsDir+"/_tcp_")
 	for _, tcpPort := range c.tcpservices.Items() {
 		sniMap := mapBuilder.AddMap(fmt.Sprintf("%s/_tcp_sni_%d.map", c.options.mapsDir, tcpPort.Port()))
 		for _, tcpHost := range tcpPort.BuildSortedItems() {
@@ -157,7 +231,7 @@ func (c *config) WriteTCPServicesMaps() error {
 		}
 		tcpPort.SNIMap = sniMap
 	}
-	err := writeMaps(mapBuilder, c.options.mapsTemplate)
+	err := writeMaps(mapBuilder, c.options.mapsTemplate, c.maps, c.mapSizes)
 	return err
 }
 
@@ -173,6 +247,7 @@ func (c *config) WriteFrontendMaps() error {
 	}
 	mapBuilder := hatypes.CreateMaps(c.global.MatchOrder)
 	mapsDir := c.options.mapsDir
+	c.mapsRewritten = append(c.mapsRewritten, mapsDir+"/_front_")
 	fmaps := &hatypes.FrontendMaps{
 		HTTPHostMap:  mapBuilder.AddMap(mapsDir + "/_front_http_host.map"),
 		HTTPSHostMap: mapBuilder.AddMap(mapsDir + "/_front_https_host.map"),
@@ -320,10 +395,14 @@ func (c *config) WriteFrontendMaps() error {
 			crtListItems = append(crtListItems, &hatypes.HostsMapEntry{Key: crtListEntry})
 		}
 	}
-	if err := c.options.mapsTemplate.WriteOutput(crtListItems, c.frontend.CrtListFile); err != nil {
-		return err
+	if tmpl := c.options.mapsTemplate; tmpl != nil {
+		if err := tmpl.WriteOutput(crtListItems, c.frontend.CrtListFile); err != nil {
+			return err
+		}
+		c.mapSizes.set(c.frontend.CrtListFile, tmpl.LastWriteStats().Bytes)
 	}
-	if err := writeMaps(mapBuilder, c.options.mapsTemplate); err != nil {
+	c.maps.track(c.frontend.CrtListFile, "", crtListItems)
+	if err := writeMaps(mapBuilder, c.options.mapsTemplate, c.maps, c.mapSizes); err != nil {
 		return err
 	}
 	c.frontend.Maps = fmaps
@@ -341,7 +420,11 @@ func (c *config) WriteBackendMaps() error {
 		return nil
 	}
 	mapBuilder := hatypes.CreateMaps(c.global.MatchOrder)
+	for _, backend := range c.backends.ItemsDel() {
+		c.mapsRewritten = append(c.mapsRewritten, c.options.mapsDir+"/_back_"+backend.ID+"_")
+	}
 	for _, backend := range c.backends.ItemsAdd() {
+		c.mapsRewritten = append(c.mapsRewritten, c.options.mapsDir+"/_back_"+backend.ID+"_")
 		if backend.NeedACL() {
 			mapsPrefix := c.options.mapsDir + "/_back_" + backend.ID
 			pathsMap := mapBuilder.AddMap(mapsPrefix + "_idpath.map")
@@ -367,21 +450,230 @@ func (c *config) WriteBackendMaps() error {
 			backend.PathsDefaultHostMap = pathsDefaultHostMap
 		}
 	}
-	return writeMaps(mapBuilder, c.options.mapsTemplate)
+	return writeMapsSharded(mapBuilder, c.options.mapsTemplate, c.maps, c.mapSizes, c.options.mapShards)
 }
 
-func writeMaps(maps *hatypes.HostsMaps, template *template.Config) error {
-	for _, hmap := range maps.Items {
+func writeMaps(maps *hatypes.HostsMaps, template *template.Config, tracker *mapTracker, sizes *mapSizes) error {
+	return writeMapItems(maps.Items, template, tracker, sizes)
+}
+
+// writeMapsSharded distributes the maps between shards goroutines. Every
+// map has its own files, so maps can be built and written concurrently, and
+// the haproxy config references the very same files of the serial version.
+func writeMapsSharded(maps *hatypes.HostsMaps, template *template.Config, tracker *mapTracker, sizes *mapSizes, shards int) error {
+	if shards > len(maps.Items) {
+		shards = len(maps.Items)
+	}
+	if shards <= 1 {
+		return writeMaps(maps, template, tracker, sizes)
+	}
+	errs := make([]error, shards)
+	var wg sync.WaitGroup
+	wg.Add(shards)
+	for i := 0; i < shards; i++ {
+		var items []*hatypes.HostsMap
+		for j := i; j < len(maps.Items); j += shards {
+			items = append(items, maps.Items[j])
+		}
+		go func(i int, items []*hatypes.HostsMap) {
+			defer wg.Done()
+			tmpl := template
+			if tmpl != nil {
+				tmpl = tmpl.Clone()
+			}
+			errs[i] = writeMapItems(items, tmpl, tracker, sizes)
+		}(i, items)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMapItems writes the map files and tracks their content. A nil template
+// doesn't write the files, so map changes are only tracked, e.g. if map files
+// are read only and changes are applied via the runtime api.
+func writeMapItems(items []*hatypes.HostsMap, template *template.Config, tracker *mapTracker, sizes *mapSizes) error {
+	for _, hmap := range items {
 		for _, matchFile := range hmap.MatchFiles() {
 			filename := matchFile.Filename()
-			if err := template.WriteOutput(matchFile.Values(), filename); err != nil {
-				return err
+			if template != nil {
+				if err := template.WriteOutput(matchFile.Values(), filename); err != nil {
+					return err
+				}
+				sizes.set(filename, template.LastWriteStats().Bytes)
 			}
+			tracker.track(filename, matchFile.Method(), matchFile.Values())
 		}
 	}
 	return nil
 }
 
+// mapSizes keeps the size of every map file in use. Map files that aren't
+// written anymore, e.g. from removed backends, are dropped on commit, see
+// mapTracker.commit(). Map files are concurrently written by
+// writeMapsSharded(), so all the access to the sizes is synchronized. A nil
+// mapSizes is valid and doesn't track anything.
+type mapSizes struct {
+	mutex sync.Mutex
+	files map[string]int
+}
+
+func newMapSizes() *mapSizes {
+	return &mapSizes{
+		files: map[string]int{},
+	}
+}
+
+func (s *mapSizes) set(filename string, bytes int) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.files[filename] = bytes
+}
+
+func (s *mapSizes) forget(filenames ...string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, filename := range filenames {
+		delete(s.files, filename)
+	}
+}
+
+func (s *mapSizes) total() int {
+	if s == nil {
+		return 0
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var total int
+	for _, bytes := range s.files {
+		total += bytes
+	}
+	return total
+}
+
+// mapTracker keeps the map files written so far. If content is true, the
+// content of the files and the changes made since the last commit are kept
+// as well, so map changes can be applied via the runtime api. Map files are
+// concurrently written by writeMapsSharded(), so all the access to the
+// tracker is synchronized. A nil tracker is valid and doesn't track anything.
+type mapTracker struct {
+	mutex   sync.Mutex
+	content bool
+	files   map[string][]mapEntry
+	written map[string]bool
+	changes []*mapChange
+}
+
+type mapEntry struct {
+	key   string
+	value string
+}
+
+// mapChange has the old and the new content of a map file. method is the
+// match method of the map, and it's empty if the file isn't a map, e.g. a
+// crt list. added is true if the file wasn't written before.
+type mapChange struct {
+	filename string
+	method   string
+	added    bool
+	old      []mapEntry
+	cur      []mapEntry
+}
+
+func newMapTracker(content bool) *mapTracker {
+	return &mapTracker{
+		content: content,
+		files:   map[string][]mapEntry{},
+		written: map[string]bool{},
+	}
+}
+
+func (t *mapTracker) track(filename, method string, entries []*hatypes.HostsMapEntry) {
+	if t == nil {
+		return
+	}
+	if !t.content {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.files[filename] = nil
+		t.written[filename] = true
+		return
+	}
+	cur := make([]mapEntry, len(entries))
+	for i, entry := range entries {
+		cur[i] = mapEntry{key: entry.Key, value: entry.Value}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.written[filename] = true
+	old, found := t.files[filename]
+	if found && reflect.DeepEqual(old, cur) {
+		return
+	}
+	t.files[filename] = cur
+	t.changes = append(t.changes, &mapChange{
+		filename: filename,
+		method:   method,
+		added:    !found,
+		old:      old,
+		cur:      cur,
+	})
+}
+
+// getChanges returns the map files changed since the last commit, sorted
+// by the file name.
+func (t *mapTracker) getChanges() []*mapChange {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	changes := make([]*mapChange, len(t.changes))
+	copy(changes, t.changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].filename < changes[j].filename
+	})
+	return changes
+}
+
+// commit clears the changes made so far, and removes the files that weren't
+// written since the last commit, but whose prefix was fully rewritten, e.g.
+// map files of removed backends. The name of the removed files is returned.
+func (t *mapTracker) commit(rewritten []string) []string {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var removed []string
+	for filename := range t.files {
+		if t.written[filename] {
+			continue
+		}
+		for _, prefix := range rewritten {
+			if strings.HasPrefix(filename, prefix) {
+				delete(t.files, filename)
+				removed = append(removed, filename)
+				break
+			}
+		}
+	}
+	sort.Strings(removed)
+	t.changes = nil
+	t.written = map[string]bool{}
+	return removed
+}
+
 func (c *config) AcmeData() *hatypes.AcmeData {
 	return c.acmeData
 }
@@ -410,6 +702,157 @@ func (c *config) Userlists() *hatypes.Userlists {
 	return c.userlists
 }
 
+// Diff builds a ConfigDiff from the add/del tracking of the model. Call
+// after Shrink() in order to remove from the diff items that were
+// reparsed but didn't change.
+func (c *config) Diff() ConfigDiff {
+	return c.buildDiff(false)
+}
+
+// PendingDiff lists the changes that the next commit would apply. It does
+// not change the config state, so it can be called at any time by the
+// goroutine that changes the config, e.g. before Shrink() and Commit().
+func (c *config) PendingDiff() PendingDiff {
+	return PendingDiff{
+		ConfigDiff:             c.buildDiff(true),
+		GlobalChanged:          !reflect.DeepEqual(c.globalOld, c.global),
+		FrontendChanged:        c.frontend.Changed(),
+		UserlistsChanged:       c.userlists.Changed(),
+		TCPServicePortsChanged: c.tcpservices.Changed(),
+	}
+}
+
+// PendingChanges returns true if the config has changes not committed yet.
+func (c *config) PendingChanges() bool {
+	diff := c.PendingDiff()
+	return diff.HasChanges()
+}
+
+// buildDiff builds the ConfigDiff. skipUnchanged compares the content of
+// hosts and backends found in both the added and the removed trackers,
+// skipping the ones that Shrink() would remove.
+func (c *config) buildDiff(skipUnchanged bool) ConfigDiff {
+	var diff ConfigDiff
+	hostsAdd := c.hosts.ItemsAdd()
+	hostsDel := c.hosts.ItemsDel()
+	for name, host := range hostsAdd {
+		if old, found := hostsDel[name]; found {
+			if !skipUnchanged || !reflect.DeepEqual(old, host) {
+				diff.HostsChanged = append(diff.HostsChanged, host)
+			}
+		} else {
+			diff.HostsAdded = append(diff.HostsAdded, host)
+		}
+	}
+	for name, host := range hostsDel {
+		if _, found := hostsAdd[name]; !found {
+			diff.HostsRemoved = append(diff.HostsRemoved, host)
+		}
+	}
+	backsAdd := c.backends.ItemsAdd()
+	backsDel := c.backends.ItemsDel()
+	for id, back := range backsAdd {
+		if old, found := backsDel[id]; found {
+			if !skipUnchanged || !reflect.DeepEqual(old, back) {
+				diff.BackendsChanged = append(diff.BackendsChanged, back)
+			}
+		} else {
+			diff.BackendsAdded = append(diff.BackendsAdded, back)
+		}
+	}
+	for id, back := range backsDel {
+		if _, found := backsAdd[id]; !found {
+			diff.BackendsRemoved = append(diff.BackendsRemoved, back)
+		}
+	}
+	tcpAdd := c.tcpbackends.ItemsAdd()
+	tcpDel := c.tcpbackends.ItemsDel()
+	for port, tcp := range tcpAdd {
+		if old, found := tcpDel[port]; found {
+			// tcp backends doesn't shrink, so need to compare here
+			if !reflect.DeepEqual(old, tcp) {
+				diff.TCPServicesChanged = append(diff.TCPServicesChanged, tcp)
+			}
+		} else {
+			diff.TCPServicesAdded = append(diff.TCPServicesAdded, tcp)
+		}
+	}
+	for port, tcp := range tcpDel {
+		if _, found := tcpAdd[port]; !found {
+			diff.TCPServicesRemoved = append(diff.TCPServicesRemoved, tcp)
+		}
+	}
+	for _, hosts := range [][]*hatypes.Host{diff.HostsAdded, diff.HostsRemoved, diff.HostsChanged} {
+		sort.Slice(hosts, func(i, j int) bool {
+			return hosts[i].Hostname < hosts[j].Hostname
+		})
+	}
+	for _, backs := range [][]*hatypes.Backend{diff.BackendsAdded, diff.BackendsRemoved, diff.BackendsChanged} {
+		sort.Slice(backs, func(i, j int) bool {
+			return backs[i].ID < backs[j].ID
+		})
+	}
+	for _, tcps := range [][]*hatypes.TCPBackend{diff.TCPServicesAdded, diff.TCPServicesRemoved, diff.TCPServicesChanged} {
+		sort.Slice(tcps, func(i, j int) bool {
+			return tcps[i].Port < tcps[j].Port
+		})
+	}
+	return diff
+}
+
+// Stats counts the configuration items without changing its state, so it
+// can be safely called at any time, e.g. just after a Commit().
+func (c *config) Stats() ConfigStats {
+	stats := ConfigStats{
+		Hosts:       len(c.hosts.Items()),
+		Backends:    len(c.backends.Items()),
+		TCPBackends: c.tcpbackends.Len(),
+		TCPServices: len(c.tcpservices.Items()),
+	}
+	for _, hmap := range c.frontend.Maps.Items() {
+		stats.MapEntries += hmap.Len()
+	}
+	for _, backend := range c.backends.Items() {
+		stats.Endpoints += len(backend.Endpoints)
+		stats.MapEntries += backend.PathsMap.Len() + backend.PathsDefaultHostMap.Len()
+	}
+	for _, tcpPort := range c.tcpservices.Items() {
+		stats.MapEntries += tcpPort.SNIMap.Len()
+	}
+	return stats
+}
+
+// ValidateCertFiles checks if the certificate, CA and CRL files referenced by
+// the hosts exist and are readable. Files shared by more than one host are
+// checked and reported just once, referencing the first host by name.
+func (c *config) ValidateCertFiles() []error {
+	var errs []error
+	checked := map[string]bool{}
+	check := func(hostname, kind, filename string) {
+		if filename == "" || checked[filename] {
+			return
+		}
+		checked[filename] = true
+		f, err := os.Open(filename)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s file of host '%s' is not readable: %w", kind, hostname, err))
+			return
+		}
+		_ = f.Close()
+	}
+	for _, host := range c.hosts.BuildSortedItems() {
+		check(host.Hostname, "certificate", host.TLS.TLSFilename)
+		check(host.Hostname, "CA", host.TLS.CAFilename)
+		check(host.Hostname, "CRL", host.TLS.CRLFilename)
+	}
+	return errs
+}
+
+// MapsBytes returns the sum of the sizes of all the map files in use.
+func (c *config) MapsBytes() int {
+	return c.mapSizes.total()
+}
+
 func (c *config) Clear() {
 	config := createConfig(c.options)
 	*c = *config
@@ -436,6 +879,18 @@ func (c *config) Commit() {
 	c.tcpservices.Commit()
 	c.userlists.Commit()
 	c.acmeData.Storages().Commit()
+	removed := c.maps.commit(c.mapsRewritten)
+	c.mapsRewritten = nil
+	c.mapSizes.forget(removed...)
+	if tmpl := c.options.mapsTemplate; tmpl != nil {
+		tmpl.ForgetOutputs(removed...)
+	}
+}
+
+// modsecChanged returns true if the ModSecurity config, the only global
+// config used by the modsecurity template, changed since the last commit.
+func (c *config) modsecChanged() bool {
+	return c.globalOld == nil || !reflect.DeepEqual(c.globalOld.ModSecurity, c.global.ModSecurity)
 }
 
 func (c *config) hasCommittedData() bool {
@@ -17,7 +17,15 @@ limitations under the License.
 package haproxy
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/template"
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 )
 
 func TestEmptyFrontend(t *testing.T) {
@@ -85,3 +93,334 @@ func TestClear(t *testing.T) {
 		t.Error("expected len(backends) == 0")
 	}
 }
+
+func TestConfigDiff(t *testing.T) {
+	c := createConfig(options{})
+	c.Hosts().AcquireHost("h1.local")
+	c.Hosts().AcquireHost("h2.local")
+	c.Backends().AcquireBackend("default", "app1", "8080")
+	c.Backends().AcquireBackend("default", "app2", "8080")
+	c.TCPBackends().Acquire("default/tcp1", 7001)
+	diff := c.Diff()
+	if len(diff.HostsAdded) != 2 || diff.HostsAdded[0].Hostname != "h1.local" || diff.HostsAdded[1].Hostname != "h2.local" {
+		t.Errorf("expected added hosts h1.local and h2.local, but was %v", diff.HostsAdded)
+	}
+	if len(diff.BackendsAdded) != 2 || diff.BackendsAdded[0].ID != "default_app1_8080" {
+		t.Errorf("expected added backends app1 and app2, but was %v", diff.BackendsAdded)
+	}
+	if len(diff.TCPServicesAdded) != 1 || diff.TCPServicesAdded[0].Port != 7001 {
+		t.Errorf("expected added tcp service 7001, but was %v", diff.TCPServicesAdded)
+	}
+	c.Commit()
+
+	c.Hosts().RemoveAll([]string{"h1.local", "h2.local"})
+	c.Hosts().AcquireHost("h2.local").RootRedirect = "/app"
+	c.Hosts().AcquireHost("h3.local")
+	c.Backends().RemoveAll([]string{"default_app1_8080"})
+	c.TCPBackends().RemoveAll()
+	c.TCPBackends().Acquire("default/tcp1", 7001)
+	c.Shrink()
+	diff = c.Diff()
+	if len(diff.HostsAdded) != 1 || diff.HostsAdded[0].Hostname != "h3.local" {
+		t.Errorf("expected added host h3.local, but was %v", diff.HostsAdded)
+	}
+	if len(diff.HostsRemoved) != 1 || diff.HostsRemoved[0].Hostname != "h1.local" {
+		t.Errorf("expected removed host h1.local, but was %v", diff.HostsRemoved)
+	}
+	if len(diff.HostsChanged) != 1 || diff.HostsChanged[0].Hostname != "h2.local" {
+		t.Errorf("expected changed host h2.local, but was %v", diff.HostsChanged)
+	}
+	if len(diff.BackendsAdded) != 0 || len(diff.BackendsChanged) != 0 {
+		t.Errorf("expected no added or changed backends, but was %v and %v", diff.BackendsAdded, diff.BackendsChanged)
+	}
+	if len(diff.BackendsRemoved) != 1 || diff.BackendsRemoved[0].ID != "default_app1_8080" {
+		t.Errorf("expected removed backend app1, but was %v", diff.BackendsRemoved)
+	}
+	if len(diff.TCPServicesAdded) != 0 || len(diff.TCPServicesRemoved) != 0 || len(diff.TCPServicesChanged) != 0 {
+		t.Errorf("expected no tcp services changes, but was %v", diff)
+	}
+}
+
+func TestConfigPendingDiff(t *testing.T) {
+	c := createConfig(options{})
+	if !c.PendingChanges() {
+		t.Errorf("expected pending changes before the first commit")
+	}
+	c.Hosts().AcquireHost("h1.local")
+	c.Hosts().AcquireHost("h2.local")
+	c.Backends().AcquireBackend("default", "app1", "8080")
+	c.Commit()
+	if diff := c.PendingDiff(); c.PendingChanges() || diff.HasChanges() {
+		t.Errorf("expected no pending changes after a commit, but was %+v", diff)
+	}
+
+	// reparsed without changes, not shrunk yet
+	c.Hosts().RemoveAll([]string{"h1.local", "h2.local"})
+	c.Hosts().AcquireHost("h1.local")
+	c.Hosts().AcquireHost("h2.local").RootRedirect = "/app"
+	c.Backends().RemoveAll([]string{"default_app1_8080"})
+	c.Backends().AcquireBackend("default", "app1", "8080")
+	diff := c.PendingDiff()
+	if len(diff.HostsChanged) != 1 || diff.HostsChanged[0].Hostname != "h2.local" {
+		t.Errorf("expected changed host h2.local, but was %v", diff.HostsChanged)
+	}
+	if len(diff.BackendsChanged) != 0 {
+		t.Errorf("expected no changed backends, but was %v", diff.BackendsChanged)
+	}
+	if diff.GlobalChanged || diff.FrontendChanged || diff.UserlistsChanged || diff.TCPServicePortsChanged {
+		t.Errorf("expected only hosts changed, but was %+v", diff)
+	}
+	if len(c.Hosts().ItemsAdd()) != 2 {
+		t.Errorf("expected pending diff not changing the config state, but was %v", c.Hosts().ItemsAdd())
+	}
+
+	c.Shrink()
+	c.Commit()
+	c.Global().MaxConn = 1000
+	if diff := c.PendingDiff(); !diff.GlobalChanged || !c.PendingChanges() {
+		t.Errorf("expected changed globals, but was %+v", diff)
+	}
+}
+
+func TestConfigStats(t *testing.T) {
+	c := createConfig(options{})
+	if stats := c.Stats(); stats != (ConfigStats{}) {
+		t.Errorf("expected empty stats, but was %+v", stats)
+	}
+	c.Hosts().AcquireHost("h1.local")
+	c.Hosts().AcquireHost("h2.local")
+	b1 := c.Backends().AcquireBackend("default", "app1", "8080")
+	b1.AcquireEndpoint("172.17.0.11", 8080, "")
+	b1.AcquireEndpoint("172.17.0.12", 8080, "")
+	b2 := c.Backends().AcquireBackend("default", "app2", "8080")
+	b2.AcquireEndpoint("172.17.0.21", 8080, "")
+	c.TCPBackends().Acquire("default/tcp1", 7001)
+	c.TCPServices().AcquireTCPService("tcp.local:7002")
+	maps := hatypes.CreateMaps([]hatypes.MatchType{hatypes.MatchExact})
+	c.frontend.Maps = &hatypes.FrontendMaps{HTTPHostMap: maps.AddMap("/tmp/_front_http_host.map")}
+	c.frontend.Maps.HTTPHostMap.AddHostnameMapping("h1.local", "default_app1_8080")
+	c.frontend.Maps.HTTPHostMap.AddHostnameMapping("h2.local", "default_app2_8080")
+	b1.PathsMap = maps.AddMap("/tmp/_back_default_app1_8080_idpath.map")
+	b1.PathsMap.AddHostnameMapping("h1.local", "path01")
+	c.Commit()
+	expected := ConfigStats{
+		Hosts:       2,
+		Backends:    2,
+		Endpoints:   3,
+		TCPBackends: 1,
+		TCPServices: 1,
+		MapEntries:  3,
+	}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("expected %+v, but was %+v", expected, stats)
+	}
+	if diff := c.Diff(); len(diff.HostsAdded) != 0 || len(diff.BackendsAdded) != 0 {
+		t.Errorf("expected stats not changing the committed state, but diff was %+v", diff)
+	}
+}
+
+func TestValidateCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	crt := filepath.Join(dir, "crt.pem")
+	ca := filepath.Join(dir, "ca.pem")
+	missing := filepath.Join(dir, "missing.pem")
+	for _, file := range []string{crt, ca} {
+		if err := os.WriteFile(file, []byte("-----"), 0o600); err != nil {
+			t.Fatalf("error writing %s: %v", file, err)
+		}
+	}
+	c := createConfig(options{})
+	if errs := c.ValidateCertFiles(); len(errs) > 0 {
+		t.Errorf("expected no errors without hosts, but was %v", errs)
+	}
+	h1 := c.Hosts().AcquireHost("h1.local")
+	h1.TLS.TLSFilename = crt
+	h1.TLS.CAFilename = ca
+	c.Hosts().AcquireHost("h2.local")
+	if errs := c.ValidateCertFiles(); len(errs) > 0 {
+		t.Errorf("expected no errors with existing files, but was %v", errs)
+	}
+	for _, hostname := range []string{"h4.local", "h3.local"} {
+		h := c.Hosts().AcquireHost(hostname)
+		h.TLS.TLSFilename = missing
+		h.TLS.CRLFilename = missing + ".crl"
+	}
+	var actual []string
+	for _, err := range c.ValidateCertFiles() {
+		actual = append(actual, strings.ReplaceAll(err.Error(), dir, "<dir>"))
+	}
+	expected := []string{
+		"certificate file of host 'h3.local' is not readable: open <dir>/missing.pem: no such file or directory",
+		"CRL file of host 'h3.local' is not readable: open <dir>/missing.pem.crl: no such file or directory",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors %v, but was %v", expected, actual)
+	}
+}
+
+func TestWriteMapsSharded(t *testing.T) {
+	tmpl := template.CreateConfig()
+	if err := tmpl.NewTemplate("map.tmpl", "../../rootfs/etc/templates/map/map.tmpl", "", 0, 2048); err != nil {
+		t.Fatalf("error parsing map.tmpl: %v", err)
+	}
+	for _, shards := range []int{0, 1, 3, 20} {
+		tempdir, err := os.MkdirTemp("", "")
+		if err != nil {
+			t.Fatalf("error creating tempdir: %v", err)
+		}
+		maps := hatypes.CreateMaps([]hatypes.MatchType{hatypes.MatchExact})
+		for i := 0; i < 10; i++ {
+			hmap := maps.AddMap(fmt.Sprintf("%s/_back_%02d.map", tempdir, i))
+			hmap.AddHostnameMapping(fmt.Sprintf("d%d.local", i), fmt.Sprintf("backend_%02d", i))
+		}
+		sizes := newMapSizes()
+		if err := writeMapsSharded(maps, tmpl, nil, sizes, shards); err != nil {
+			t.Errorf("error writing maps with %d shards: %v", shards, err)
+		}
+		var bytes int
+		for i := 0; i < 10; i++ {
+			content, err := os.ReadFile(fmt.Sprintf("%s/_back_%02d__exact.map", tempdir, i))
+			if err != nil {
+				t.Errorf("error reading map %d with %d shards: %v", i, shards, err)
+				continue
+			}
+			bytes += len(content)
+			var actual string
+			for _, line := range strings.Split(string(content), "\n") {
+				if line != "" && !strings.HasPrefix(line, "#") {
+					actual = line
+				}
+			}
+			expected := fmt.Sprintf("d%d.local backend_%02d", i, i)
+			if actual != expected {
+				t.Errorf("map %d with %d shards differs - expected: '%s', actual: '%s'", i, shards, expected, actual)
+			}
+		}
+		if total := sizes.total(); total != bytes {
+			t.Errorf("expected %d map bytes with %d shards, but was %d", bytes, shards, total)
+		}
+		os.RemoveAll(tempdir)
+	}
+}
+
+func TestWriteMapsChanged(t *testing.T) {
+	tmpl := template.CreateConfig()
+	if err := tmpl.NewTemplate("map.tmpl", "../../rootfs/etc/templates/map/map.tmpl", "", 0, 2048); err != nil {
+		t.Fatalf("error parsing map.tmpl: %v", err)
+	}
+	tempdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		t.Fatalf("error creating tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+	c := createConfig(options{mapsTemplate: tmpl, mapsDir: tempdir})
+	c.global.MatchOrder = hatypes.DefaultMatchOrder
+	b := c.backends.AcquireBackend("default", "app", "8080")
+	c.hosts.AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	_, tcpHost := c.tcpservices.AcquireTCPService("d1.local:7001")
+	tcpHost.Backend = hatypes.BackendID{Namespace: "default", Name: "app", Port: "7001"}
+
+	writeMaps := func() []string {
+		for _, write := range []func() error{c.WriteTCPServicesMaps, c.WriteFrontendMaps, c.WriteBackendMaps} {
+			if err := write(); err != nil {
+				t.Fatalf("error writing maps: %v", err)
+			}
+		}
+		c.Commit()
+		entries, err := os.ReadDir(tempdir)
+		if err != nil {
+			t.Fatalf("error reading maps dir: %v", err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+			os.Remove(filepath.Join(tempdir, entry.Name()))
+		}
+		return names
+	}
+	hasMap := func(names []string, prefix string) bool {
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 0: everything is written on the first run
+	names := writeMaps()
+	if !hasMap(names, "_tcp_sni_7001") || !hasMap(names, "_front_") {
+		t.Errorf("expected tcp and frontend maps on the first write, but was %v", names)
+	}
+
+	// 1: nothing changed, nothing is written
+	if names := writeMaps(); len(names) > 0 {
+		t.Errorf("expected no maps written without changes, but was %v", names)
+	}
+
+	// 2: only the tcp service changed
+	_, tcpHost = c.tcpservices.AcquireTCPService("d2.local:7001")
+	tcpHost.Backend = hatypes.BackendID{Namespace: "default", Name: "app", Port: "7001"}
+	names = writeMaps()
+	if !hasMap(names, "_tcp_sni_7001") || hasMap(names, "_front_") {
+		t.Errorf("expected only tcp maps written, but was %v", names)
+	}
+
+	// 3: only a host changed
+	c.hosts.AcquireHost("d2.local").AddPath(b, "/", hatypes.MatchBegin)
+	names = writeMaps()
+	if hasMap(names, "_tcp_sni_") || !hasMap(names, "_front_") {
+		t.Errorf("expected only frontend maps written, but was %v", names)
+	}
+
+	// 4: sizes of the maps of a removed tcp service are dropped
+	mapsBytes := c.MapsBytes()
+	c.tcpservices.RemoveAll([]string{"d1.local:7001", "d2.local:7001"})
+	writeMaps()
+	for filename := range c.mapSizes.files {
+		if strings.Contains(filename, "_tcp_sni_") {
+			t.Errorf("expected tcp map sizes dropped, but found %s", filename)
+		}
+	}
+	if c.MapsBytes() >= mapsBytes {
+		t.Errorf("expected maps bytes decreasing from %d, but was %d", mapsBytes, c.MapsBytes())
+	}
+}
+
+func TestMapTrackerCommit(t *testing.T) {
+	for _, content := range []bool{false, true} {
+		tracker := newMapTracker(content)
+		entries := []*hatypes.HostsMapEntry{{Key: "d1.local", Value: "d1_app_8080"}}
+		for _, filename := range []string{"/maps/_back_d1_app_8080_idpath.map", "/maps/_back_d2_app_8080_idpath.map", "/maps/_front_http_host.map"} {
+			tracker.track(filename, "", entries)
+		}
+		if removed := tracker.commit([]string{"/maps/_back_d1_app_8080_", "/maps/_front_"}); len(removed) > 0 {
+			t.Errorf("expected no file removed if all of them were written, but was %v", removed)
+		}
+
+		// d1 and d2 weren't written, but only d1 was rewritten
+		tracker.track("/maps/_front_http_host.map", "", entries)
+		removed := tracker.commit([]string{"/maps/_back_d1_app_8080_", "/maps/_front_"})
+		if fmt.Sprint(removed) != "[/maps/_back_d1_app_8080_idpath.map]" {
+			t.Errorf("expected only d1 map removed with content %t, but was %v", content, removed)
+		}
+		var files []string
+		for filename := range tracker.files {
+			files = append(files, filename)
+		}
+		sort.Strings(files)
+		if fmt.Sprint(files) != "[/maps/_back_d2_app_8080_idpath.map /maps/_front_http_host.map]" {
+			t.Errorf("expected d2 and frontend maps tracked with content %t, but was %v", content, files)
+		}
+
+		// a removed file is tracked as a new one
+		tracker.track("/maps/_back_d1_app_8080_idpath.map", "", entries)
+		changes := tracker.getChanges()
+		if content && (len(changes) != 1 || !changes[0].added) {
+			t.Errorf("expected d1 map added, but was %+v", changes)
+		}
+		if !content && len(changes) > 0 {
+			t.Errorf("expected no change tracked without content, but was %+v", changes)
+		}
+	}
+}
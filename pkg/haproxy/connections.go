@@ -24,11 +24,13 @@ import (
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/socket"
 )
 
-func newConnections(masterSock, adminSock string) *connections {
+func newConnections(masterSock, adminSock, statsSock string, timeout time.Duration) *connections {
 	return &connections{
 		mutex:      sync.Mutex{},
 		masterSock: masterSock,
 		adminSock:  adminSock,
+		statsSock:  statsSock,
+		timeout:    timeout,
 	}
 }
 
@@ -36,8 +38,11 @@ type connections struct {
 	mutex        sync.Mutex
 	masterSock   string
 	adminSock    string
+	statsSock    string
+	timeout      time.Duration
 	oldInstances []socket.HAProxySocket
 	admin        socket.HAProxySocket
+	stats        socket.HAProxySocket
 	master       socket.HAProxySocket
 	dynUpdate    socket.HAProxySocket
 	idleChk      socket.HAProxySocket
@@ -47,7 +52,7 @@ func (c *connections) TrackCurrentInstance(timeoutStopDur, closeSessDur time.Dur
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.shrinkConns()
-	sock := socket.NewSocketConcurrent(c.adminSock, true)
+	sock := socket.NewSocketConcurrent(c.adminSock, true, c.timeout)
 	sock.Unlistening()
 	c.oldInstances = append(c.oldInstances, sock)
 
@@ -81,6 +86,18 @@ func (c *connections) OldInstancesCount() int {
 	return len(c.oldInstances)
 }
 
+// CloseAll closes the connections to the current instance. Connections
+// to old instances are closed by their own schedule.
+func (c *connections) CloseAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, sock := range []socket.HAProxySocket{c.admin, c.stats, c.master, c.dynUpdate, c.idleChk} {
+		if sock != nil {
+			sock.Close()
+		}
+	}
+}
+
 func (c *connections) shrinkConns() {
 	i := 0
 	for j, old := range c.oldInstances {
@@ -129,14 +146,27 @@ func shutdownSessionsSync(sock socket.HAProxySocket, duration time.Duration) {
 
 func (c *connections) Admin() socket.HAProxySocket {
 	if c.admin == nil {
-		c.admin = socket.NewSocket(c.adminSock, false)
+		c.admin = socket.NewSocket(c.adminSock, false, c.timeout)
 	}
 	return c.admin
 }
 
+// Stats is used by read only commands, so they don't contend with the
+// dynamic updates. Falls back to the admin socket if a stats socket
+// wasn't configured.
+func (c *connections) Stats() socket.HAProxySocket {
+	if c.statsSock == "" {
+		return c.Admin()
+	}
+	if c.stats == nil {
+		c.stats = socket.NewSocket(c.statsSock, false, c.timeout)
+	}
+	return c.stats
+}
+
 func (c *connections) Master() socket.HAProxySocket {
 	if c.master == nil {
-		c.master = socket.NewSocket(c.masterSock, false)
+		c.master = socket.NewSocket(c.masterSock, false, c.timeout)
 	}
 	return c.master
 }
@@ -145,14 +175,18 @@ func (c *connections) DynUpdate() socket.HAProxySocket {
 	if c.dynUpdate == nil {
 		// using a non persistent connection (keep alive false)
 		// to ensure that the current instance will be used
-		c.dynUpdate = socket.NewSocket(c.adminSock, false)
+		c.dynUpdate = socket.NewSocket(c.adminSock, false, c.timeout)
 	}
 	return c.dynUpdate
 }
 
 func (c *connections) IdleChk() socket.HAProxySocket {
 	if c.idleChk == nil {
-		c.idleChk = socket.NewSocket(c.adminSock, false)
+		sock := c.adminSock
+		if c.statsSock != "" {
+			sock = c.statsSock
+		}
+		c.idleChk = socket.NewSocket(sock, false, c.timeout)
 	}
 	return c.idleChk
 }
@@ -0,0 +1,185 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+// dataplaneConfig follows the structured configuration of the HAProxy Data
+// Plane API: frontends with their binds, and backends with their servers.
+// Only the attributes the controller manages are exported.
+type dataplaneConfig struct {
+	Frontends []*dataplaneFrontend `json:"frontends"`
+	Backends  []*dataplaneBackend  `json:"backends"`
+}
+
+type dataplaneFrontend struct {
+	Name           string           `json:"name"`
+	Mode           string           `json:"mode"`
+	DefaultBackend string           `json:"default_backend,omitempty"`
+	Binds          []*dataplaneBind `json:"binds"`
+}
+
+type dataplaneBind struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Port    *int   `json:"port,omitempty"`
+	SSL     bool   `json:"ssl,omitempty"`
+	CrtList string `json:"crt_list,omitempty"`
+}
+
+type dataplaneBackend struct {
+	Name    string             `json:"name"`
+	Mode    string             `json:"mode"`
+	Balance *dataplaneBalance  `json:"balance,omitempty"`
+	Servers []*dataplaneServer `json:"servers"`
+}
+
+type dataplaneBalance struct {
+	Algorithm string `json:"algorithm"`
+}
+
+type dataplaneServer struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Port        int    `json:"port"`
+	Weight      int    `json:"weight"`
+	Maintenance string `json:"maintenance,omitempty"`
+}
+
+// ExportDataplane exports the configuration of the last update as a HAProxy
+// Data Plane API structured configuration, in the JSON format. The export is
+// read only and does not change the instance state.
+func (i *instance) ExportDataplane() ([]byte, error) {
+	snapshot := i.snapshot.Load()
+	if snapshot == nil {
+		return nil, fmt.Errorf("haproxy configuration wasn't updated yet")
+	}
+	return json.MarshalIndent(snapshot.dataplane, "", "  ")
+}
+
+func buildDataplaneConfig(config Config) *dataplaneConfig {
+	global := config.Global()
+	defaultBackend := "_error404"
+	if backend := config.Backends().DefaultBackend; backend != nil {
+		defaultBackend = backend.ID
+	}
+	out := &dataplaneConfig{
+		Frontends: []*dataplaneFrontend{},
+		Backends:  []*dataplaneBackend{},
+	}
+
+	httpFront := &dataplaneFrontend{
+		Name:           "_front_http",
+		Mode:           "http",
+		DefaultBackend: defaultBackend,
+		Binds:          []*dataplaneBind{},
+	}
+	if global.Bind.HTTPBind != "" && !global.Bind.ShareHTTPPort() {
+		httpFront.Binds = append(httpFront.Binds, newDataplaneBind("_front_http", global.Bind.HTTPBind))
+	}
+	if global.Bind.FrontingBind != "" {
+		httpFront.Binds = append(httpFront.Binds, newDataplaneBind("_front_http_fronting", global.Bind.FrontingBind))
+	}
+	out.Frontends = append(out.Frontends, httpFront)
+
+	if frontend := config.Frontend(); frontend != nil && frontend.Name != "" {
+		httpsFront := &dataplaneFrontend{
+			Name:           frontend.Name,
+			Mode:           "http",
+			DefaultBackend: defaultBackend,
+			Binds:          []*dataplaneBind{},
+		}
+		if frontend.BindSocket != "" {
+			bind := newDataplaneBind(frontend.Name, frontend.BindSocket)
+			bind.SSL = true
+			bind.CrtList = frontend.CrtListFile
+			httpsFront.Binds = append(httpsFront.Binds, bind)
+		}
+		out.Frontends = append(out.Frontends, httpsFront)
+	}
+
+	items := config.Backends().Items()
+	backends := make([]*hatypes.Backend, 0, len(items))
+	for _, backend := range items {
+		backends = append(backends, backend)
+	}
+	sort.Slice(backends, func(i, j int) bool {
+		return backends[i].ID < backends[j].ID
+	})
+	for _, backend := range backends {
+		out.Backends = append(out.Backends, newDataplaneBackend(backend))
+	}
+	return out
+}
+
+// newDataplaneBind splits address in the address and port attributes of a
+// Data Plane API bind. Addresses without a port, like unix sockets, are
+// exported as is.
+func newDataplaneBind(name, address string) *dataplaneBind {
+	bind := &dataplaneBind{
+		Name:    name,
+		Address: address,
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			if host == "" {
+				host = "*"
+			}
+			bind.Address = host
+			bind.Port = &p
+		}
+	}
+	return bind
+}
+
+func newDataplaneBackend(backend *hatypes.Backend) *dataplaneBackend {
+	mode := "http"
+	if backend.ModeTCP {
+		mode = "tcp"
+	}
+	out := &dataplaneBackend{
+		Name:    backend.ID,
+		Mode:    mode,
+		Servers: make([]*dataplaneServer, 0, len(backend.Endpoints)),
+	}
+	// algorithm arguments, e.g. `uri whole`, aren't part of the algorithm
+	if algorithm := strings.Fields(backend.BalanceAlgorithm); len(algorithm) > 0 {
+		out.Balance = &dataplaneBalance{Algorithm: algorithm[0]}
+	}
+	for _, ep := range backend.Endpoints {
+		server := &dataplaneServer{
+			Name:    ep.Name,
+			Address: ep.IP,
+			Port:    ep.Port,
+			Weight:  ep.Weight,
+		}
+		if !ep.Enabled {
+			server.Maintenance = "enabled"
+		}
+		out.Servers = append(out.Servers, server)
+	}
+	return out
+}
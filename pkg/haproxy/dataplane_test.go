@@ -0,0 +1,131 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+func TestInstanceExportDataplane(t *testing.T) {
+	port := func(p int) *int { return &p }
+	testCases := []struct {
+		config      func(c *testConfig)
+		expBackends []*dataplaneBackend
+		expDefault  string
+	}{
+		// 0
+		{
+			config:      func(c *testConfig) {},
+			expBackends: []*dataplaneBackend{},
+			expDefault:  "_error404",
+		},
+		// 1
+		{
+			config: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+				b.BalanceAlgorithm = "uri whole"
+				b.Endpoints = []*hatypes.Endpoint{endpointS1, {Name: "srv002", IP: "127.0.0.1", Port: 1023}}
+				c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+			},
+			expBackends: []*dataplaneBackend{
+				{
+					Name:    "d1_app_8080",
+					Mode:    "http",
+					Balance: &dataplaneBalance{Algorithm: "uri"},
+					Servers: []*dataplaneServer{
+						{Name: "s1", Address: "172.17.0.11", Port: 8080, Weight: 100},
+						{Name: "srv002", Address: "127.0.0.1", Port: 1023, Maintenance: "enabled"},
+					},
+				},
+			},
+			expDefault: "_error404",
+		},
+		// 2
+		{
+			config: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("d2", "app", "8080")
+				b.ModeTCP = true
+				b.Endpoints = []*hatypes.Endpoint{endpointS21}
+				c.config.Hosts().AcquireHost("d2.local").AddPath(b, "/", hatypes.MatchBegin)
+				def := c.config.Backends().AcquireBackend("default", "default-backend", "8080")
+				def.Endpoints = []*hatypes.Endpoint{endpointS0}
+				c.config.Backends().DefaultBackend = def
+			},
+			expBackends: []*dataplaneBackend{
+				{
+					Name: "d2_app_8080",
+					Mode: "tcp",
+					Servers: []*dataplaneServer{
+						{Name: "s21", Address: "172.17.0.121", Port: 8080, Weight: 100},
+					},
+				},
+				{
+					Name: "default_default-backend_8080",
+					Mode: "http",
+					Servers: []*dataplaneServer{
+						{Name: "s0", Address: "172.17.0.99", Port: 8080, Weight: 100},
+					},
+				},
+			},
+			expDefault: "default_default-backend_8080",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		test.config(c)
+		c.Update()
+		out, err := c.instance.ExportDataplane()
+		if err != nil {
+			t.Errorf("%d: error exporting dataplane config: %v", i, err)
+		}
+		var actual *dataplaneConfig
+		if err := json.Unmarshal(out, &actual); err != nil {
+			t.Errorf("%d: error parsing dataplane config: %v", i, err)
+		}
+		expected := &dataplaneConfig{
+			Frontends: []*dataplaneFrontend{
+				{
+					Name:           "_front_http",
+					Mode:           "http",
+					DefaultBackend: test.expDefault,
+					Binds: []*dataplaneBind{
+						{Name: "_front_http", Address: "*", Port: port(80)},
+					},
+				},
+				{
+					Name:           "_front_https",
+					Mode:           "http",
+					DefaultBackend: test.expDefault,
+					Binds: []*dataplaneBind{
+						{Name: "_front_https", Address: "*", Port: port(443), SSL: true, CrtList: c.tempdir + "/_front_bind_crt.list"},
+					},
+				},
+			},
+			Backends: test.expBackends,
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			e, _ := json.Marshal(expected)
+			t.Errorf("%d: dataplane config differs:\nexpected: %s\nactual:   %s", i, e, out)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
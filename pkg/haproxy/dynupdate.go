@@ -31,11 +31,29 @@ import (
 )
 
 type dynUpdater struct {
-	logger  types.Logger
-	config  *config
-	socket  socket.HAProxySocket
-	cmdCnt  int
-	metrics types.Metrics
+	logger      types.Logger
+	config      *config
+	socket      socket.HAProxySocket
+	cmdCnt      int
+	maxCmds     int
+	cmdLimited  bool
+	mapsOnly    bool
+	drainPeriod time.Duration
+	draining    map[string]time.Time
+	metrics     types.Metrics
+	clock       types.Clock
+	reasons     []BackendReloadReason
+}
+
+// BackendReloadReason describes why the change of a backend couldn't be
+// dynamically applied, requiring a haproxy reload.
+type BackendReloadReason struct {
+	Backend string
+	Reason  string
+}
+
+func (r BackendReloadReason) String() string {
+	return r.Backend + " (" + r.Reason + ")"
 }
 
 type hostPair struct {
@@ -55,15 +73,57 @@ type epPair struct {
 
 func (i *instance) newDynUpdater() *dynUpdater {
 	return &dynUpdater{
-		logger:  i.logger,
+		logger:  i.loggerFor(LogSubsystemUpdate),
 		config:  i.config.(*config),
 		socket:  i.conns.DynUpdate(),
+		maxCmds: i.options.MaxDynamicCommandsPerCycle,
 		metrics: i.metrics,
+		clock:   i.options.Clock,
+		//
+		drainPeriod: i.options.EndpointDrainPeriod,
+		draining:    i.draining,
 	}
 }
 
+// ReloadReasons lists, sorted by backend name, the backends whose changes
+// couldn't be dynamically applied on the last update.
+func (d *dynUpdater) ReloadReasons() []BackendReloadReason {
+	sort.Slice(d.reasons, func(i, j int) bool {
+		return d.reasons[i].Backend < d.reasons[j].Backend
+	})
+	return d.reasons
+}
+
+func (d *dynUpdater) reloadReason(backend, reason string, args ...interface{}) {
+	d.reasons = append(d.reasons, BackendReloadReason{Backend: backend, Reason: fmt.Sprintf(reason, args...)})
+}
+
+// changedFields lists the exported fields of two structs of the same type
+// whose values differ.
+func changedFields(old, cur interface{}) []string {
+	oldValue := reflect.Indirect(reflect.ValueOf(old))
+	curValue := reflect.Indirect(reflect.ValueOf(cur))
+	var fields []string
+	for i := 0; i < curValue.NumField(); i++ {
+		field := curValue.Type().Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), curValue.Field(i).Interface()) {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
 func (d *dynUpdater) update() bool {
+	drainedOK := d.disableDrainedEndpoints()
 	updated := d.config.hasCommittedData() && d.checkConfigChange()
+	if updated && !drainedOK {
+		d.logger.InfoV(2, "need to reload, drained endpoints couldn't be disabled")
+		updated = false
+	}
 	if !updated {
 		// Need to reload, time to adjust empty slots according to config
 		d.alignSlots()
@@ -94,12 +154,20 @@ func (d *dynUpdater) checkConfigChange() bool {
 	if d.config.userlists.Changed() {
 		diff = append(diff, "userlists")
 	}
+	// hosts and backends might still be updated via map updates if their
+	// paths are the only change, see updateMaps()
+	d.mapsOnly = len(diff) == 0
 	if !d.frontendUpdated() {
 		diff = append(diff, "hosts")
 	}
 	if !d.backendUpdated() {
 		diff = append(diff, "backends")
 	}
+	if d.cmdLimited {
+		d.logger.Info("need to reload, dynamic update needs more than %d commands", d.maxCmds)
+		d.metrics.IncUpdateDynamicLimited()
+		return false
+	}
 	if len(diff) > 0 {
 		d.logger.InfoV(2, "need to reload due to config changes: %v", diff)
 		return false
@@ -151,6 +219,8 @@ func (d *dynUpdater) backendUpdated() bool {
 		back, found := backends[id]
 		if !found {
 			d.logger.InfoV(2, "added backend '%s'", id)
+			d.reloadReason(backend.ID, "added backend")
+			d.mapsOnly = false
 			updated = false
 		} else {
 			back.cur = backend
@@ -184,11 +254,16 @@ func (d *dynUpdater) checkHostPair(pair *hostPair) bool {
 	if !reflect.DeepEqual(&oldHostCopy, curHost) {
 		d.logger.InfoV(2, "diff outside server certificate of host '%s'", curHost.Hostname)
 		updated = false
+		oldHostCopy.Paths = curHost.Paths
+		if !reflect.DeepEqual(&oldHostCopy, curHost) {
+			d.mapsOnly = false
+		}
 	}
 
 	if curHost.TLS.HasTLS() && oldHost.TLS.TLSHash != curHost.TLS.TLSHash &&
 		oldHost.TLS.TLSFilename == curHost.TLS.TLSFilename &&
 		!d.execUpdateCert(curHost.Hostname, curHost.TLS.TLSFilename) {
+		d.mapsOnly = false
 		updated = false
 	}
 
@@ -211,14 +286,27 @@ func (d *dynUpdater) checkBackendPair(pair *backendPair) bool {
 	oldBackCopy.ID = curBack.ID
 	oldBackCopy.Dynamic = curBack.Dynamic
 	oldBackCopy.Endpoints = curBack.Endpoints
-	if !reflect.DeepEqual(&oldBackCopy, curBack) {
+	diffOutsideEndpoints := !reflect.DeepEqual(&oldBackCopy, curBack)
+	if diffOutsideEndpoints {
 		d.logger.InfoV(2, "diff outside endpoints of backend '%s'", curBack.ID)
+		if fields := changedFields(&oldBackCopy, curBack); len(fields) > 0 {
+			d.reloadReason(curBack.ID, "changed %s", strings.Join(fields, ", "))
+		} else {
+			d.reloadReason(curBack.ID, "changed internal state")
+		}
 		updated = false
+		oldBackCopy.CopyPathsFrom(curBack)
+		if !reflect.DeepEqual(&oldBackCopy, curBack) {
+			d.mapsOnly = false
+		}
 	}
 
 	// can decrease endpoints, cannot increase
 	if len(oldBack.Endpoints) < len(curBack.Endpoints) {
 		d.logger.InfoV(2, "added endpoints on backend '%s'", curBack.ID)
+		if updated {
+			d.reloadReason(curBack.ID, "added endpoints without empty slots")
+		}
 		// cannot continue -- missing empty slots in the backend
 		return false
 	}
@@ -240,6 +328,7 @@ func (d *dynUpdater) checkBackendPair(pair *backendPair) bool {
 	if !curBack.Dynamic.DynUpdate {
 		if updated && !reflect.DeepEqual(oldBack.Endpoints, curBack.Endpoints) {
 			d.logger.InfoV(2, "backend '%s' changed and its dynamic-scaling is 'false'", curBack.ID)
+			d.reloadReason(curBack.ID, "changed endpoints with dynamic-scaling disabled")
 			return false
 		}
 		return updated
@@ -270,17 +359,35 @@ func (d *dynUpdater) checkBackendPair(pair *backendPair) bool {
 		}
 	}
 
+	// Removed endpoints are drained before being disabled if a drain period
+	// is configured. Draining endpoints keep their slots, so drain is only
+	// used if the added endpoints fit in the empty slots.
+	drain := d.drainPeriod > 0 && len(added) <= len(empty)
+
 	// Try to dynamically remove/update/add endpoints.
 	// Targets being used here only to have predictable results (tests).
 	// Endpoint.Label != "" means use-server of blue/green config, need reload
 	sort.Strings(targets)
 	for _, target := range targets {
 		pair := endpoints[target]
-		if pair.cur == nil && len(added) > 0 {
+		if pair.cur == nil && len(added) > 0 && !drain {
 			pair.cur = added[0]
 			pair.cur.Name = pair.old.Name
 			added = added[1:]
 		}
+		if pair.cur != nil {
+			// the slot is either used by the same target, which was added back,
+			// or by a new one, so it doesn't need to be drained anymore
+			delete(d.draining, curBack.ID+"/"+pair.old.Name)
+		}
+		if pair.cur == nil && drain && !d.drained(curBack.ID, pair.old) {
+			// still draining, the endpoint should be kept with weight 0 until
+			// the drain period expires, so its slot isn't reused
+			draining := *pair.old
+			draining.Weight = 0
+			curBack.Endpoints = append(curBack.Endpoints, &draining)
+			continue
+		}
 		if pair.cur == nil {
 			if !d.execDisableEndpoint(curBack.ID, pair.old) || pair.old.Label != "" {
 				updated = false
@@ -307,9 +414,94 @@ func (d *dynUpdater) checkBackendPair(pair *backendPair) bool {
 		curBack.AddEmptyEndpoint().Name = empty[i].Name
 	}
 
+	if !updated && !diffOutsideEndpoints {
+		d.reloadReason(curBack.ID, "endpoints couldn't be dynamically updated")
+	}
 	return updated
 }
 
+// drained returns true if the endpoint was already drained for the configured
+// period, starting the drain if it wasn't started yet. An endpoint that fails
+// to start draining is considered drained, so it is disabled right away.
+func (d *dynUpdater) drained(backname string, ep *hatypes.Endpoint) bool {
+	key := backname + "/" + ep.Name
+	since, found := d.draining[key]
+	if !found {
+		if !d.execDrainEndpoint(backname, ep) {
+			return true
+		}
+		since = d.clock.Now()
+		d.draining[key] = since
+	}
+	if d.clock.Now().Sub(since) < d.drainPeriod {
+		return false
+	}
+	delete(d.draining, key)
+	return true
+}
+
+// disableDrainedEndpoints disables the endpoints whose drain period expired,
+// from backends that didn't change in this update, converting their slots to
+// empty ones. Endpoints of changed backends are checked by backendUpdated().
+// Returns false if an endpoint couldn't be disabled, so a reload is needed.
+func (d *dynUpdater) disableDrainedEndpoints() bool {
+	keys := make([]string, 0, len(d.draining))
+	for key := range d.draining {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	backends := d.config.backends
+	ok := true
+	for _, key := range keys {
+		since := d.draining[key]
+		sep := strings.LastIndex(key, "/")
+		backname, server := key[:sep], key[sep+1:]
+		if _, changed := backends.ItemsAdd()[backname]; changed {
+			continue
+		}
+		backend := backends.Items()[backname]
+		var ep *hatypes.Endpoint
+		var pos int
+		if backend != nil {
+			for i, e := range backend.Endpoints {
+				if e.Name == server {
+					ep, pos = e, i
+					break
+				}
+			}
+		}
+		if ep == nil || ep.IsEmpty() {
+			// backend or endpoint slot doesn't exist anymore
+			delete(d.draining, key)
+			continue
+		}
+		if d.clock.Now().Sub(since) < d.drainPeriod {
+			continue
+		}
+		if !d.execDisableEndpoint(backname, ep) {
+			d.reloadReason(backname, "drained endpoint couldn't be disabled")
+			ok = false
+		}
+		backend.Endpoints = append(backend.Endpoints[:pos], backend.Endpoints[pos+1:]...)
+		backend.AddEmptyEndpoint().Name = server
+		backends.BackendChanged(backend)
+		delete(d.draining, key)
+	}
+	return ok
+}
+
+// nextDrainExpiry returns the time the first draining endpoint should be
+// disabled, and false if no endpoint is draining.
+func nextDrainExpiry(draining map[string]time.Time, drainPeriod time.Duration) (next time.Time, found bool) {
+	for _, since := range draining {
+		if expiry := since.Add(drainPeriod); !found || expiry.Before(next) {
+			next = expiry
+			found = true
+		}
+	}
+	return next, found
+}
+
 func (d *dynUpdater) checkEndpointPair(backend *hatypes.Backend, pair *epPair) bool {
 	oldEPCopy := *pair.old
 	// SourceIP is lazily updated via FillSourceIPs() after dynupdate run
@@ -379,6 +571,112 @@ func (d *dynUpdater) alignSlots() {
 	}
 }
 
+// updateMaps applies the changes of the map files via the runtime api,
+// so hosts and backends whose only change are their paths don't need a
+// reload. Should only be called if the haproxy config files didn't change,
+// so all the pending changes are restricted to the map files. Returns false,
+// and nothing is sent, if any of the changes cannot be dynamically applied.
+func (d *dynUpdater) updateMaps() bool {
+	if !d.mapsOnly || d.cmdLimited || d.config.maps == nil {
+		return false
+	}
+	var cmd []string
+	for _, change := range d.config.maps.getChanges() {
+		mapCmd, ok := buildMapCmd(change)
+		if !ok {
+			d.logger.InfoV(2, "need to reload, map file '%s' cannot be dynamically updated", change.filename)
+			return false
+		}
+		cmd = append(cmd, mapCmd...)
+	}
+	if len(cmd) == 0 {
+		return true
+	}
+	if !d.checkCmdLimit(cmd) {
+		d.logger.Info("need to reload, dynamic update needs more than %d commands", d.maxCmds)
+		d.metrics.IncUpdateDynamicLimited()
+		return false
+	}
+	msg, err := d.execCommand(d.metrics.HAProxySetMapResponseTime, cmd)
+	if err != nil {
+		d.logger.Error("error updating maps: %v", err)
+		return false
+	}
+	for i, m := range msg {
+		if !cmdResponseOK("map", m) {
+			d.logger.Warn("unrecognized response updating map, command '%s': %s", cmd[i], m)
+			return false
+		}
+	}
+	d.logger.InfoV(2, "updated map files using %d command(s)", len(cmd))
+	return true
+}
+
+// buildMapCmd builds the runtime api commands that change a map file from
+// its old to its new content. Entries of exact match maps are indexed, so
+// new entries can be added to them. The order of the entries matters on
+// all the other match types, so only changes and removals are supported.
+// Returns false if the change cannot be dynamically applied.
+func buildMapCmd(change *mapChange) ([]string, bool) {
+	if change.added || change.method == "" || !strings.HasSuffix(change.filename, ".map") {
+		return nil, false
+	}
+	oldValues, ok := mapValues(change.old)
+	if !ok {
+		return nil, false
+	}
+	curValues, ok := mapValues(change.cur)
+	if !ok {
+		return nil, false
+	}
+	var cmd, delCmd, keep []string
+	for _, entry := range change.old {
+		value, found := curValues[entry.key]
+		if !found {
+			delCmd = append(delCmd, fmt.Sprintf("del map %s %s", change.filename, entry.key))
+		} else {
+			keep = append(keep, entry.key)
+			if value != entry.value {
+				cmd = append(cmd, fmt.Sprintf("set map %s %s %s", change.filename, entry.key, value))
+			}
+		}
+	}
+	var curKeys []string
+	for _, entry := range change.cur {
+		if _, found := oldValues[entry.key]; !found {
+			if change.method != "str" {
+				return nil, false
+			}
+			cmd = append(cmd, fmt.Sprintf("add map %s %s %s", change.filename, entry.key, entry.value))
+		} else {
+			curKeys = append(curKeys, entry.key)
+		}
+	}
+	if change.method != "str" && !reflect.DeepEqual(keep, curKeys) {
+		// remaining entries changed their order
+		return nil, false
+	}
+	return append(delCmd, cmd...), true
+}
+
+// mapValues indexes the entries of a map file by their keys. Returns false
+// if a key is duplicated, or if a key or a value cannot be safely sent as
+// an argument of a runtime api command.
+func mapValues(entries []mapEntry) (map[string]string, bool) {
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if _, found := values[entry.key]; found || !validMapArg(entry.key) || !validMapArg(entry.value) {
+			return nil, false
+		}
+		values[entry.key] = entry.value
+	}
+	return values, true
+}
+
+func validMapArg(arg string) bool {
+	return arg != "" && !strings.ContainsAny(arg, " \t\n;\\")
+}
+
 var readFile = os.ReadFile
 
 func (d *dynUpdater) execUpdateCert(hostname, filename string) bool {
@@ -395,6 +693,9 @@ func (d *dynUpdater) execUpdateCert(hostname, filename string) bool {
 		fmt.Sprintf("set ssl cert %s <<\n%s\n", filename, payloadStr),
 		fmt.Sprintf("commit ssl cert %s", filename),
 	}
+	if !d.checkCmdLimit(cmd) {
+		return false
+	}
 	msg, err := d.execCommand(d.metrics.HAProxySetSSLCertResponseTime, cmd)
 	if err != nil {
 		d.logger.Error("error updating certificate for %s: %v", hostname, err)
@@ -421,6 +722,9 @@ func (d *dynUpdater) execDisableEndpoint(backname string, ep *hatypes.Endpoint)
 		server + "addr 127.0.0.1 port 1023",
 		server + "weight 0",
 	}
+	if !d.checkCmdLimit(cmd) {
+		return false
+	}
 	msg, err := d.execCommand(d.metrics.HAProxySetServerResponseTime, cmd)
 	if err != nil {
 		d.logger.Error("error disabling endpoint %s/%s: %v", backname, ep.Name, err)
@@ -439,6 +743,33 @@ func (d *dynUpdater) execDisableEndpoint(backname string, ep *hatypes.Endpoint)
 	return true
 }
 
+func (d *dynUpdater) execDrainEndpoint(backname string, ep *hatypes.Endpoint) bool {
+	server := fmt.Sprintf("set server %s/%s ", backname, ep.Name)
+	cmd := []string{
+		server + "state drain",
+		server + "weight 0",
+	}
+	if !d.checkCmdLimit(cmd) {
+		return false
+	}
+	msg, err := d.execCommand(d.metrics.HAProxySetServerResponseTime, cmd)
+	if err != nil {
+		d.logger.Error("error draining endpoint %s/%s: %v", backname, ep.Name, err)
+		return false
+	}
+	for _, m := range msg {
+		if m != "" {
+			if !cmdResponseOK("set server", m) {
+				d.logger.Warn("unrecognized response draining endpoint %s/%s: %s", backname, ep.Name, m)
+				return false
+			}
+			d.logger.InfoV(2, "response from server: %s", m)
+		}
+	}
+	d.logger.InfoV(2, "draining endpoint '%s' on backend/server '%s/%s'", ep.Target, backname, ep.Name)
+	return true
+}
+
 func (d *dynUpdater) execEnableEndpoint(backname string, oldEP, curEP *hatypes.Endpoint) bool {
 	state := map[bool]string{true: "ready", false: "drain"}[curEP.Weight > 0]
 	server := fmt.Sprintf("set server %s/%s ", backname, curEP.Name)
@@ -447,6 +778,9 @@ func (d *dynUpdater) execEnableEndpoint(backname string, oldEP, curEP *hatypes.E
 		server + "state " + state,
 		server + "weight " + strconv.Itoa(curEP.Weight),
 	}
+	if !d.checkCmdLimit(cmd) {
+		return false
+	}
 	msg, err := d.execCommand(d.metrics.HAProxySetServerResponseTime, cmd)
 	if err != nil {
 		d.logger.Error("error adding/updating endpoint %s/%s: %v", backname, curEP.Name, err)
@@ -467,6 +801,15 @@ func (d *dynUpdater) execEnableEndpoint(backname string, oldEP, curEP *hatypes.E
 	return true
 }
 
+// checkCmdLimit returns false if cmd cannot be sent due to the max number
+// of commands per update cycle. A full reload should be made instead.
+func (d *dynUpdater) checkCmdLimit(cmd []string) bool {
+	if d.maxCmds > 0 && d.cmdCnt+len(cmd) > d.maxCmds {
+		d.cmdLimited = true
+	}
+	return !d.cmdLimited
+}
+
 func (d *dynUpdater) execCommand(observer func(duration time.Duration), cmd []string) ([]string, error) {
 	msg, err := d.socket.Send(observer, cmd...)
 	d.cmdCnt = d.cmdCnt + len(cmd)
@@ -479,6 +822,8 @@ func cmdResponseOK(cmd, response string) bool {
 		return response == "" || strings.HasPrefix(response, "IP changed from ") || strings.HasPrefix(response, "no need to change ")
 	case "commit ssl cert":
 		return strings.Contains(response, "Success")
+	case "map":
+		return response == ""
 	default:
 		panic(fmt.Errorf("invalid cmd: %s", cmd))
 	}
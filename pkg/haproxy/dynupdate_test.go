@@ -999,6 +999,106 @@ INFO-V(2) removed host 'domain2.local'
 INFO-V(2) need to reload due to config changes: [hosts]
 `,
 		},
+		// 35
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+				b.AcquireEndpoint("172.17.0.4", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				c.instance.options.MaxDynamicCommandsPerCycle = 3
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.4", 8080, "")
+			},
+			expected: []string{
+				"srv003:172.17.0.4:8080:1",
+				"srv001:127.0.0.1:1023:1",
+				"srv002:127.0.0.1:1023:1",
+			},
+			dynamic: false,
+			cmd: `
+set server default_app_8080/srv001 state maint
+set server default_app_8080/srv001 addr 127.0.0.1 port 1023
+set server default_app_8080/srv001 weight 0
+`,
+			logging: `
+INFO-V(2) disabled endpoint '172.17.0.2:8080' on backend/server 'default_app_8080/srv001'
+INFO need to reload, dynamic update needs more than 3 commands
+`,
+		},
+		// 36
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				c.instance.options.EndpointDrainPeriod = time.Minute
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			expected: []string{
+				"srv002:172.17.0.3:8080:1",
+				"srv001:172.17.0.2:8080:0",
+			},
+			dynamic: true,
+			cmd: `
+set server default_app_8080/srv001 state drain
+set server default_app_8080/srv001 weight 0
+`,
+			logging: `INFO-V(2) draining endpoint '172.17.0.2:8080' on backend/server 'default_app_8080/srv001'`,
+		},
+		// 37
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "").Weight = 0
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				c.instance.options.EndpointDrainPeriod = time.Minute
+				c.instance.draining["default_app_8080/srv001"] = time.Now().Add(-30 * time.Second)
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			expected: []string{
+				"srv002:172.17.0.3:8080:1",
+				"srv001:172.17.0.2:8080:0",
+			},
+			dynamic: true,
+		},
+		// 38
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "").Weight = 0
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				c.instance.options.EndpointDrainPeriod = time.Minute
+				c.instance.draining["default_app_8080/srv001"] = time.Now().Add(-2 * time.Minute)
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			expected: []string{
+				"srv002:172.17.0.3:8080:1",
+				"srv001:127.0.0.1:1023:1",
+			},
+			dynamic: true,
+			cmd: `
+set server default_app_8080/srv001 state maint
+set server default_app_8080/srv001 addr 127.0.0.1 port 1023
+set server default_app_8080/srv001 weight 0
+`,
+			logging: `INFO-V(2) disabled endpoint '172.17.0.2:8080' on backend/server 'default_app_8080/srv001'`,
+		},
 	}
 	readFile = func(filename string) ([]byte, error) {
 		return []byte("<content>"), nil
@@ -1049,6 +1149,220 @@ INFO-V(2) need to reload due to config changes: [hosts]
 	}
 }
 
+func TestDynUpdateReloadReasons(t *testing.T) {
+	testCases := []struct {
+		doconfig1 func(c *testConfig)
+		doconfig2 func(c *testConfig)
+		expected  []BackendReloadReason
+	}{
+		// 0
+		{
+			doconfig1: func(c *testConfig) {
+				c.config.Backends().AcquireBackend("default", "app", "8080")
+			},
+			doconfig2: func(c *testConfig) {
+				c.config.Backends().AcquireBackend("default", "app", "8080")
+			},
+		},
+		// 1
+		{
+			doconfig2: func(c *testConfig) {
+				c.config.Backends().AcquireBackend("default", "app2", "8080")
+				c.config.Backends().AcquireBackend("default", "app1", "8080")
+			},
+			expected: []BackendReloadReason{
+				{Backend: "default_app1_8080", Reason: "added backend"},
+				{Backend: "default_app2_8080", Reason: "added backend"},
+			},
+		},
+		// 2
+		{
+			doconfig1: func(c *testConfig) {
+				c.config.Backends().AcquireBackend("default", "app", "8080").BalanceAlgorithm = "roundrobin"
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.BalanceAlgorithm = "leastconn"
+				b.ModeTCP = true
+			},
+			expected: []BackendReloadReason{
+				{Backend: "default_app_8080", Reason: "changed BalanceAlgorithm, ModeTCP"},
+			},
+		},
+		// 3
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			expected: []BackendReloadReason{
+				{Backend: "default_app_8080", Reason: "added endpoints without empty slots"},
+			},
+		},
+		// 4
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.3", 8080, "")
+			},
+			expected: []BackendReloadReason{
+				{Backend: "default_app_8080", Reason: "changed endpoints with dynamic-scaling disabled"},
+			},
+		},
+		// 5
+		{
+			doconfig1: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.AcquireEndpoint("172.17.0.2", 8080, "")
+			},
+			doconfig2: func(c *testConfig) {
+				b := c.config.Backends().AcquireBackend("default", "app", "8080")
+				b.Dynamic.DynUpdate = true
+				b.AcquireEndpoint("172.17.0.3", 8080, "").Label = "green"
+			},
+			expected: []BackendReloadReason{
+				{Backend: "default_app_8080", Reason: "endpoints couldn't be dynamically updated"},
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		if test.doconfig1 != nil {
+			test.doconfig1(c)
+		}
+		c.instance.config.Commit()
+		backendIDs := []string{}
+		for _, backend := range c.config.Backends().Items() {
+			backendIDs = append(backendIDs, backend.ID)
+		}
+		c.config.Backends().RemoveAll(backendIDs)
+		if test.doconfig2 != nil {
+			test.doconfig2(c)
+		}
+		dynUpdater := c.instance.newDynUpdater()
+		dynUpdater.socket = &clientMock{}
+		dynUpdater.update()
+		if actual := dynUpdater.ReloadReasons(); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("reload reasons differ on %d - expected: %v - actual: %v", i, test.expected, actual)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func TestBuildMapCmd(t *testing.T) {
+	entries := func(keyvalues ...string) []mapEntry {
+		var entries []mapEntry
+		for i := 0; i < len(keyvalues); i += 2 {
+			entries = append(entries, mapEntry{key: keyvalues[i], value: keyvalues[i+1]})
+		}
+		return entries
+	}
+	testCases := []struct {
+		change   mapChange
+		expected []string
+		ok       bool
+	}{
+		// 0
+		{
+			change: mapChange{
+				method: "str",
+				old:    entries("d1.local#/", "b1", "d2.local#/", "b2"),
+				cur:    entries("d1.local#/", "b3", "d3.local#/", "b2"),
+			},
+			expected: []string{
+				"del map h.map d2.local#/",
+				"set map h.map d1.local#/ b3",
+				"add map h.map d3.local#/ b2",
+			},
+			ok: true,
+		},
+		// 1
+		{
+			change: mapChange{
+				method: "beg",
+				old:    entries("d1.local#/app", "b1", "d1.local#/", "b2", "d2.local#/", "b3"),
+				cur:    entries("d1.local#/app", "b4", "d2.local#/", "b3"),
+			},
+			expected: []string{
+				"del map h.map d1.local#/",
+				"set map h.map d1.local#/app b4",
+			},
+			ok: true,
+		},
+		// 2
+		{
+			change: mapChange{
+				method: "beg",
+				old:    entries("d1.local#/", "b1"),
+				cur:    entries("d1.local#/app", "b2", "d1.local#/", "b1"),
+			},
+		},
+		// 3
+		{
+			change: mapChange{
+				method: "reg",
+				old:    entries("^d1", "b1", "^d2", "b2"),
+				cur:    entries("^d2", "b2", "^d1", "b1"),
+			},
+		},
+		// 4
+		{
+			change: mapChange{
+				method: "str",
+				added:  true,
+				cur:    entries("d1.local#/", "b1"),
+			},
+		},
+		// 5
+		{
+			change: mapChange{
+				filename: "crt.list",
+				old:      entries("/tmp/d1.pem d1.local", ""),
+				cur:      entries("/tmp/d2.pem d2.local", ""),
+			},
+		},
+		// 6
+		{
+			change: mapChange{
+				method: "str",
+				old:    entries("d1.local#/", "b1"),
+				cur:    entries("d1.local#/", "b1", "d1.local#/", "b2"),
+			},
+		},
+		// 7
+		{
+			change: mapChange{
+				method: "str",
+				old:    entries("d1.local#/", "b1"),
+				cur:    entries("d1.local#/", "b1", "d2.local#/", "b2;b3"),
+			},
+		},
+	}
+	for i, test := range testCases {
+		if test.change.filename == "" {
+			test.change.filename = "h.map"
+		}
+		cmd, ok := buildMapCmd(&test.change)
+		if ok != test.ok {
+			t.Errorf("expected ok as '%t' on %d, but was '%t'", test.ok, i, ok)
+		}
+		if !reflect.DeepEqual(cmd, test.expected) {
+			t.Errorf("cmd differs on %d -- expected: %v -- actual: %v", i, test.expected, cmd)
+		}
+	}
+}
+
 type clientMock struct {
 	cmd       string
 	cmdOutput []string
@@ -17,14 +17,22 @@ limitations under the License.
 package haproxy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -39,50 +47,259 @@ import (
 
 // InstanceOptions ...
 type InstanceOptions struct {
-	AcmeSigner        acme.Signer
-	AcmeQueue         utils.Queue
-	RootFSPrefix      string
-	LocalFSPrefix     string
-	BackendShards     int
-	HAProxyCfgDir     string
-	HAProxyMapsDir    string
-	LeaderElector     types.LeaderElector
-	IsMasterWorker    bool
-	IsExternal        bool
-	MasterSocket      string
-	AdminSocket       string
-	AcmeSocket        string
-	MaxOldConfigFiles int
-	Metrics           types.Metrics
-	ReloadQueue       utils.Queue
-	ReloadStrategy    string
-	SortEndpointsBy   string
-	StopCh            chan struct{}
-	TrackInstances    bool
-	ValidateConfig    bool
+	AcmeSigner                   acme.Signer
+	AcmeAccountStore             string
+	AcmeTransport                acme.TransportConfig
+	AcmeQueue                    utils.Queue
+	AcmeCheckJitter              time.Duration
+	AcmeOrderBy                  string
+	AcmeNonLeaderWarnTimeout     time.Duration
+	RootFSPrefix                 string
+	LocalFSPrefix                string
+	BackendShards                int
+	BackendMapShards             int
+	HAProxyCfgDir                string
+	HAProxyMapsDir               string
+	LeaderElector                types.LeaderElector
+	IsMasterWorker               bool
+	IsExternal                   bool
+	MasterSocket                 string
+	AdminSocket                  string
+	StatsSocket                  string
+	AcmeSocket                   string
+	SocketTimeout                time.Duration
+	MaxOldConfigFiles            int
+	MaxOldConfigAge              time.Duration
+	CompressOldConfigFiles       bool
+	OldWorkersWarnThreshold      int
+	ReloadQueueWarnThreshold     int
+	ConfigSizeWarnThreshold      int
+	ExternalReloadConfirmTimeout time.Duration
+	ExternalPollInterval         time.Duration
+	ExternalReloadRetries        int
+	MaxDynamicCommandsPerCycle   int
+	DynamicMapUpdates            bool
+	EndpointDrainPeriod          time.Duration
+	Filesystem                   template.Filesystem
+	Clock                        types.Clock
+	LogChangesJSON               bool
+	LogItemListThreshold         int
+	LogLevels                    map[string]int
+	Metrics                      types.Metrics
+	ReloadQueue                  utils.Queue
+	UpdateQueue                  utils.Queue
+	ReloadStrategy               string
+	ReloadStrategyFallback       []string
+	ReloadScript                 string
+	ReloadTimeout                time.Duration
+	ServerStateFileMode          os.FileMode
+	ServerStateFileChown         bool
+	HAProxyBinary                string
+	MinReloadInterval            time.Duration
+	OnReload                     func(success bool, mode string, duration time.Duration)
+	OnPreReload                  func() error
+	OnCertExpiring               func(host, commonName string, notAfter time.Time)
+	CertExpiringThreshold        time.Duration
+	PreReloadTimeout             time.Duration
+	RequireAdminSocket           bool
+	DynamicOnly                  bool
+	WorkerDrainTimeout           time.Duration
+	EventRecorder                types.EventRecorder
+	SortEndpointsBy              string
+	ShardBy                      string
+	TemplatesDir                 string
+	Templates                    map[string]TemplateSpec
+	StopCh                       chan struct{}
+	TrackInstances               bool
+	ValidateConfig               bool
+	ValidateBeforeReload         bool
+	ValidateCertFiles            bool
+	ValidateChangedFiles         bool
+	// ConfigPostProcessor, if assigned, receives the rendered content of the
+	// main cfg and of every backend shard, and returns the content that should
+	// be written instead. It runs on every write, so it should be fast, and it
+	// should be deterministic, otherwise unchanged configs would be seen as
+	// changed, leading to needless reloads. An error aborts the write.
+	ConfigPostProcessor func([]byte) ([]byte, error)
+	// InitialConfig, if assigned, is called once with the config created by
+	// the first Config() call, so tests can start from a known, optionally
+	// committed, configuration. Not used by the controller.
+	InitialConfig func(cfg Config)
 	// TODO Fake is used to skip real haproxy calls. Use a mock instead.
 	fake bool
 }
 
+// maxBackendShards is the highest number of backend shards. Every shard is
+// a distinct haproxy config file.
+const maxBackendShards = 10000
+
+// Validate ...
+func (o *InstanceOptions) Validate() error {
+	if o.BackendShards < 0 || o.BackendShards > maxBackendShards {
+		return fmt.Errorf("invalid backend shards: %d, should be between 0 and %d", o.BackendShards, maxBackendShards)
+	}
+	if o.BackendMapShards < 0 {
+		return fmt.Errorf("invalid backend map shards: %d, should not be negative", o.BackendMapShards)
+	}
+	if o.ExternalReloadRetries < 0 {
+		return fmt.Errorf("invalid external reload retries: %d, should not be negative", o.ExternalReloadRetries)
+	}
+	if err := validateLogLevels(o.LogLevels); err != nil {
+		return err
+	}
+	if o.ShardBy != "" {
+		if err := hatypes.ValidateShardBy(o.ShardBy); err != nil {
+			return err
+		}
+	}
+	if o.SortEndpointsBy != "" {
+		if err := hatypes.ValidateSortEndpointsBy(o.SortEndpointsBy); err != nil {
+			return err
+		}
+	}
+	if o.AcmeNonLeaderWarnTimeout < 0 {
+		return fmt.Errorf("invalid acme non leader warn timeout: %s, should not be negative", o.AcmeNonLeaderWarnTimeout)
+	}
+	if o.AcmeOrderBy != "" && o.AcmeOrderBy != AcmeOrderByName && o.AcmeOrderBy != AcmeOrderByExpiry {
+		return fmt.Errorf("invalid acme order: '%s', should be %s or %s", o.AcmeOrderBy, AcmeOrderByName, AcmeOrderByExpiry)
+	}
+	for _, strategy := range o.ReloadStrategyFallback {
+		if strategy != "native" && strategy != "reusesocket" {
+			return fmt.Errorf("invalid reload strategy fallback: '%s', should be native or reusesocket", strategy)
+		}
+	}
+	if o.ServerStateFileMode&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid server state file mode: %#o, should only have permission bits", uint32(o.ServerStateFileMode))
+	}
+	if o.HAProxyMapsDir != "" && !o.DynamicOnly && (o.Filesystem == nil || o.Filesystem == template.OSFilesystem) {
+		if err := checkWritableDir(o.HAProxyMapsDir); err != nil {
+			return fmt.Errorf("invalid maps dir: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkWritableDir creates dir if it does not exist, and checks if new files
+// can be created on it. Map files are written on every configuration update,
+// so a misconfigured maps dir should be reported on startup.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create dir '%s': %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".check-")
+	if err != nil {
+		return fmt.Errorf("dir '%s' is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return nil
+}
+
 // Instance ...
 type Instance interface {
 	AcmeCheck(source string) (int, error)
+	AcmeStorages() []hatypes.AcmeStorage
+	RemoveAcmeStorage(name string) error
 	ParseTemplates() error
+	ReloadTemplates() error
 	Config() Config
 	CalcIdleMetric()
 	Update(timer *utils.Timer)
+	Pause()
+	Resume(timer *utils.Timer)
+	Paused() bool
 	Reload(timer *utils.Timer)
-	Shutdown()
+	ForceReload(timer *utils.Timer)
+	LastReload() ReloadInfo
+	LastUpdate() UpdateResult
+	RenderedConfig() ([]byte, error)
+	ExportDataplane() ([]byte, error)
+	ConfigStats() ConfigStats
+	ValidateConfig(cfg []byte) error
+	Healthy() (bool, string)
+	HAProxyVersion() string
+	Shutdown(ctx context.Context) error
+	Procs() ([]ProcInfo, error)
+}
+
+// ReloadInfo ...
+type ReloadInfo struct {
+	Timestamp time.Time
+	Success   bool
+	Reason    string
+	Duration  time.Duration
+}
+
+// Reasons of a haproxy reload, see ReloadInfo.Reason
+const (
+	ReloadReasonFirstRun         = "first run"
+	ReloadReasonConfigChanged    = "config changed"
+	ReloadReasonTemplatesChanged = "templates changed"
+	ReloadReasonForced           = "forced"
+	ReloadReasonRequested        = "requested"
+)
+
+// UpdateResult is the outcome of the last configuration update.
+type UpdateResult string
+
+// Outcomes of a configuration update, see Instance.LastUpdate()
+const (
+	UpdateNoop    UpdateResult = "noop"
+	UpdateDynamic UpdateResult = "dynamic"
+	UpdateReload  UpdateResult = "reload"
+)
+
+// ProcInfo ...
+type ProcInfo struct {
+	Type    string
+	PID     int
+	Old     bool
+	Reloads int
+	Uptime  string
+	Version string
 }
 
 // CreateInstance ...
 func CreateInstance(logger types.Logger, options InstanceOptions) Instance {
-	return &instance{
+	if options.HAProxyBinary == "" {
+		options.HAProxyBinary = "haproxy"
+	}
+	if options.TemplatesDir == "" {
+		options.TemplatesDir = options.RootFSPrefix + "/etc/templates"
+	}
+	if options.ReloadScript == "" {
+		options.ReloadScript = options.RootFSPrefix + "/haproxy-reload.sh"
+	}
+	if options.Filesystem == nil {
+		options.Filesystem = template.OSFilesystem
+	}
+	if options.Clock == nil {
+		options.Clock = utils.RealClock
+	}
+	if options.Metrics == nil {
+		options.Metrics = utils.NoopMetrics
+	}
+	if options.LogItemListThreshold <= 0 {
+		options.LogItemListThreshold = maxChangedNames
+	}
+	if options.ServerStateFileMode == 0 {
+		options.ServerStateFileMode = 0o644
+	}
+	if options.ExternalPollInterval <= 0 {
+		options.ExternalPollInterval = defaultExternalPollInterval
+	}
+	i := &instance{
+		// haproxy is started and reloaded outside of the controller
+		up:       options.DynamicOnly,
 		waitProc: make(chan struct{}),
-		logger:   logger,
-		options:  &options,
-		conns:    newConnections(options.MasterSocket, options.AdminSocket),
-		metrics:  options.Metrics,
+		draining: map[string]time.Time{},
+		acmeJitter: func(max time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(max)))
+		},
+		logger:  logger,
+		options: &options,
+		conns:   newConnections(options.MasterSocket, options.AdminSocket, options.StatsSocket, options.SocketTimeout),
+		metrics: options.Metrics,
 		//
 		haproxyTmpl:     template.CreateConfig(),
 		mapsTmpl:        template.CreateConfig(),
@@ -90,17 +307,91 @@ func CreateInstance(logger types.Logger, options InstanceOptions) Instance {
 		haResponseTmpl:  template.CreateConfig(),
 		luaResponseTmpl: template.CreateConfig(),
 	}
+	for _, tmpl := range []*template.Config{i.haproxyTmpl, i.mapsTmpl, i.modsecTmpl, i.haResponseTmpl, i.luaResponseTmpl} {
+		tmpl.SetFilesystem(options.Filesystem)
+		tmpl.SetClock(options.Clock)
+	}
+	i.haproxyTmpl.SetPostProcessor(options.ConfigPostProcessor)
+	if options.ReloadQueue == nil && options.MinReloadInterval > 0 {
+		// a reload queue wasn't provided by the caller, so the instance
+		// owns one which coalesces reloads requested during the cooldown
+		i.options.ReloadQueue = utils.NewRateLimitingQueue(float32(1/options.MinReloadInterval.Seconds()), i.reloadQueued)
+		i.ownReloadQueue = true
+		go i.options.ReloadQueue.Run()
+	}
+	if options.Filesystem == template.OSFilesystem {
+		i.checkFilesystems()
+	}
+	return i
+}
+
+// checkFilesystems warns if maps and config files are written in distinct
+// filesystems. Config and map files are renamed into place after written,
+// which is only atomic if the temporary and the final files share the same
+// filesystem, and a reload should read all of them in the same state.
+func (i *instance) checkFilesystems() {
+	cfgDir := i.options.HAProxyCfgDir
+	mapsDir := i.options.HAProxyMapsDir
+	if cfgDir == "" || mapsDir == "" {
+		return
+	}
+	var cfgStat, mapsStat syscall.Stat_t
+	if err := syscall.Stat(cfgDir, &cfgStat); err != nil {
+		return
+	}
+	if err := syscall.Stat(mapsDir, &mapsStat); err != nil {
+		return
+	}
+	if cfgStat.Dev != mapsStat.Dev {
+		i.logger.Warn("config dir '%s' and maps dir '%s' are in distinct filesystems, haproxy might read config and maps files in distinct states during a reload", cfgDir, mapsDir)
+	}
 }
 
 type instance struct {
-	up          bool
-	waitProc    chan struct{}
-	failedSince *time.Time
-	logger      types.Logger
-	options     *InstanceOptions
-	config      Config
-	conns       *connections
-	metrics     types.Metrics
+	acmeJitter       func(max time.Duration) time.Duration
+	acmeSkippedSince *time.Time
+	up               bool
+	mutex            sync.Mutex
+	reloadEvent      *reloadEvent
+	shuttingDown     bool
+	templatesChanged bool
+	forceReload      bool
+	reloadReason     string
+	reloadStrategy   string
+	lastReload       ReloadInfo
+	lastUpdate       UpdateResult
+	lastReloadMutex  sync.Mutex
+	draining         map[string]time.Time
+	drainExpiry      time.Time
+	hostCerts        map[string]hostCert
+	certsNotified    map[string]time.Time
+	certsExpiring    []certExpiring
+	acmeRemoved      map[string]bool
+	acmeDelayed      sync.WaitGroup
+	ownReloadQueue   bool
+	reloadPending    int
+	events           []instanceEvent
+	waitProc         chan struct{}
+	failedSince      *time.Time
+	adminSocketOK    bool
+	adminSocketErr   error
+	checkShards      map[int]bool
+	modsecWritten    bool
+	cfgSizeExceeded  bool
+	modsecGroupFiles map[string]bool
+	paused           bool
+	pausedChanges    bool
+	haproxyVersion   string
+	localVersion     string
+	rendered         renderedConfig
+	snapshot         atomic.Pointer[configSnapshot]
+	snapshotStale    bool
+	healthMutex      sync.Mutex
+	logger           types.Logger
+	options          *InstanceOptions
+	config           Config
+	conns            *connections
+	metrics          types.Metrics
 	//
 	haproxyTmpl     *template.Config
 	mapsTmpl        *template.Config
@@ -109,40 +400,193 @@ type instance struct {
 	luaResponseTmpl *template.Config
 }
 
+// Orders of the certificates added to the acme work queue by AcmeCheck, see
+// InstanceOptions.AcmeOrderBy. Certificates are sorted by name by default.
+const (
+	AcmeOrderByName   = "name"
+	AcmeOrderByExpiry = "expiry"
+)
+
+// AcmeCheckPeriodic is the source of the periodic AcmeCheck calls. Only
+// periodic checks are delayed by AcmeCheckJitter.
+const AcmeCheckPeriodic = "periodic check"
+
+// Errors returned by AcmeCheck and RemoveAcmeStorage, so callers can
+// distinguish a request that should be retried later, sent to another
+// controller instance, or that would never succeed.
+var (
+	ErrNotStarted          = errors.New("controller wasn't started yet")
+	ErrAcmeNotConfigured   = errors.New("Acme queue wasn't configured")
+	ErrNotLeader           = errors.New("controller instance is not the acme leader")
+	ErrAcmeStorageNotFound = errors.New("acme storage not found")
+)
+
 func (i *instance) AcmeCheck(source string) (int, error) {
 	var count int
-	if !i.up {
-		return count, fmt.Errorf("controller wasn't started yet")
+	i.healthMutex.Lock()
+	up := i.up
+	i.healthMutex.Unlock()
+	if !up {
+		return count, ErrNotStarted
 	}
 	if i.options.AcmeQueue == nil {
-		return count, fmt.Errorf("Acme queue wasn't configured")
-	}
-	hasAccount := i.acmeEnsureConfig(i.config.AcmeData())
+		return count, ErrAcmeNotConfigured
+	}
+	// AcmeCheck runs concurrently with the update, so the acme config is
+	// copied under the instance lock, and the account is ensured without it
+	i.mutex.Lock()
+	acmeConfig := *i.config.AcmeData()
+	i.mutex.Unlock()
+	hasAccount := i.acmeEnsureConfig(&acmeConfig)
 	if !hasAccount {
 		return count, fmt.Errorf("Cannot create or retrieve the acme client account")
 	}
 	le := i.options.LeaderElector
 	if !le.IsLeader() {
-		msg := fmt.Sprintf("skipping acme periodic check, leader is %s", le.LeaderName())
-		i.logger.Info(msg)
-		return count, fmt.Errorf(msg)
+		i.logger.Info("skipping acme periodic check, leader is %s", le.LeaderName())
+		return count, fmt.Errorf("%w, leader is %s", ErrNotLeader, le.LeaderName())
 	}
 	i.logger.Info("starting certificate check (%s)", source)
-	for _, storage := range i.config.AcmeData().Storages().BuildAcmeStorages() {
-		i.acmeAddStorage(storage)
-		count++
-	}
+	i.mutex.Lock()
+	storages := i.acmeSkipRemoved(i.acmeSortedStorages())
+	i.mutex.Unlock()
+	count = len(storages)
 	if count == 0 {
 		i.logger.Info("certificate list is empty")
-	} else {
-		i.logger.Info("finish adding %d certificate(s) to the work queue", count)
+		return count, nil
+	}
+	if source == AcmeCheckPeriodic && i.options.AcmeCheckJitter > 0 {
+		// a random delay spreads the load of controllers whose periodic
+		// checks are aligned, e.g. started at the same time, in the acme server
+		delay := i.acmeJitter(i.options.AcmeCheckJitter)
+		i.logger.Info("delaying %d certificate(s) by %s before adding to the work queue", count, delay.Truncate(time.Second))
+		after := i.options.Clock.After(delay)
+		i.acmeDelayed.Add(1)
+		go func() {
+			defer i.acmeDelayed.Done()
+			select {
+			case <-after:
+			case <-i.options.StopCh:
+				return
+			}
+			// leadership might be lost during the delay
+			if !le.IsLeader() {
+				i.logger.Info("skipping delayed certificate check, leader is %s", le.LeaderName())
+				return
+			}
+			i.acmeAddStorages(storages)
+		}()
+		return count, nil
 	}
+	i.acmeAddStorages(storages)
 	return count, nil
 }
 
+// acmeSortedStorages lists the acme storages sorted by name, or by the
+// nearest expiry date of the certificates currently used by their domains if
+// AcmeOrderBy is expiry. Domains without a certificate are the most urgent
+// ones and are listed first. Should be called with the instance lock held.
+func (i *instance) acmeSortedStorages() []string {
+	list := i.config.AcmeData().Storages().BuildAcmeStorageList()
+	if i.options.AcmeOrderBy == AcmeOrderByExpiry {
+		hosts := i.config.Hosts()
+		expiry := make(map[string]time.Time, len(list))
+		for _, storage := range list {
+			var notAfter time.Time
+			for j, domain := range storage.Domains {
+				var domainNotAfter time.Time
+				if host := hosts.FindHost(domain); host != nil {
+					domainNotAfter = host.TLS.TLSNotAfter
+				}
+				if j == 0 || domainNotAfter.Before(notAfter) {
+					notAfter = domainNotAfter
+				}
+			}
+			expiry[storage.Name] = notAfter
+		}
+		sort.SliceStable(list, func(j, k int) bool {
+			return expiry[list[j].Name].Before(expiry[list[k].Name])
+		})
+	}
+	storages := make([]string, len(list))
+	for j, storage := range list {
+		storages[j] = storage.String()
+	}
+	return storages
+}
+
+// acmeSkipRemoved removes from the list the storages that RemoveAcmeStorage
+// removed from the work queue since the last check, so they aren't enqueued
+// again right away. They are enqueued on the following checks, if still in use.
+// Should be called with the instance lock held.
+func (i *instance) acmeSkipRemoved(storages []string) []string {
+	removed := i.acmeRemoved
+	i.acmeRemoved = nil
+	if len(removed) == 0 {
+		return storages
+	}
+	filtered := make([]string, 0, len(storages))
+	for _, storage := range storages {
+		name := strings.SplitN(storage, ",", 2)[0]
+		if removed[name] {
+			i.logger.Info("skipping certificate removed from the work queue: storage=%s", name)
+			continue
+		}
+		filtered = append(filtered, storage)
+	}
+	return filtered
+}
+
+func (i *instance) acmeAddStorages(storages []string) {
+	for _, storage := range storages {
+		i.acmeAddStorage(storage)
+	}
+	i.logger.Info("finish adding %d certificate(s) to the work queue", len(storages))
+}
+
+// AcmeStorages returns the acme storages of the last update.
+func (i *instance) AcmeStorages() []hatypes.AcmeStorage {
+	if snapshot := i.snapshot.Load(); snapshot != nil {
+		return snapshot.acmeStorages
+	}
+	return nil
+}
+
+// RemoveAcmeStorage removes a storage from the acme work queue. The storage
+// is skipped by the next acme check, and enqueued again on the following ones
+// if it's still in use.
+func (i *instance) RemoveAcmeStorage(name string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if !i.up {
+		return ErrNotStarted
+	}
+	if i.options.AcmeQueue == nil {
+		return ErrAcmeNotConfigured
+	}
+	le := i.options.LeaderElector
+	if !le.IsLeader() {
+		return fmt.Errorf("%w, leader is %s", ErrNotLeader, le.LeaderName())
+	}
+	for _, storage := range i.config.AcmeData().Storages().BuildCommittedStorages() {
+		if storage.Name == name {
+			i.logger.Info("removing certificate from the work queue: storage=%s", name)
+			i.acmeRemoveStorage(storage.String())
+			if i.acmeRemoved == nil {
+				i.acmeRemoved = map[string]bool{}
+			}
+			i.acmeRemoved[name] = true
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrAcmeStorageNotFound, name)
+}
+
 func (i *instance) acmeEnsureConfig(acmeConfig *hatypes.AcmeData) bool {
 	signer := i.options.AcmeSigner
+	signer.AcmeAccountStore(i.options.AcmeAccountStore)
 	signer.AcmeConfig(acmeConfig.Expiring)
+	signer.AcmeTransport(i.options.AcmeTransport)
 	signer.AcmeAccount(acmeConfig.Endpoint, acmeConfig.Emails, acmeConfig.TermsAgreed)
 	return signer.HasAccount()
 }
@@ -154,7 +598,7 @@ func (i *instance) acmeAddStorage(storage string) {
 		name := items[0]
 		prefChain := items[1]
 		domains := strings.Join(items[2:], ",")
-		i.logger.InfoV(3, "enqueue certificate for processing: storage=%s domain(s)=%s preferred-chain=%s", name, domains, prefChain)
+		i.loggerFor(LogSubsystemAcme).InfoV(3, "enqueue certificate for processing: storage=%s domain(s)=%s preferred-chain=%s", name, domains, prefChain)
 	}
 	i.options.AcmeQueue.Add(storage)
 }
@@ -163,57 +607,118 @@ func (i *instance) acmeRemoveStorage(storage string) {
 	i.options.AcmeQueue.Remove(storage)
 }
 
-func (i *instance) ParseTemplates() error {
-	i.haproxyTmpl.ClearTemplates()
-	i.mapsTmpl.ClearTemplates()
-	i.modsecTmpl.ClearTemplates()
-	i.haResponseTmpl.ClearTemplates()
-	i.luaResponseTmpl.ClearTemplates()
-	templatesDir := i.options.RootFSPrefix + "/etc/templates"
-	if err := i.modsecTmpl.NewTemplate(
-		"modsecurity.tmpl",
-		templatesDir+"/modsecurity/modsecurity.tmpl",
-		i.options.HAProxyCfgDir+"/spoe-modsecurity.conf",
-		0,
-		1024,
-	); err != nil {
-		return err
+// TemplateSpec ...
+type TemplateSpec struct {
+	Source     string
+	Output     string
+	BufferSize int
+}
+
+func (i *instance) templateSpec(name string, spec TemplateSpec) TemplateSpec {
+	custom := i.options.Templates[name]
+	if custom.Source != "" {
+		spec.Source = custom.Source
 	}
-	if err := i.haproxyTmpl.NewTemplate(
-		"haproxy.tmpl",
-		templatesDir+"/haproxy/haproxy.tmpl",
-		i.options.HAProxyCfgDir+"/haproxy.cfg",
-		i.options.MaxOldConfigFiles,
-		16384,
-	); err != nil {
-		return err
+	if custom.Output != "" {
+		spec.Output = custom.Output
 	}
-	if err := i.mapsTmpl.NewTemplate(
-		"map.tmpl",
-		templatesDir+"/map/map.tmpl",
-		"",
-		0,
-		2048,
-	); err != nil {
-		return err
+	if custom.BufferSize > 0 {
+		spec.BufferSize = custom.BufferSize
 	}
-	if err := i.haResponseTmpl.NewTemplate(
-		"response.http.tmpl",
-		templatesDir+"/responses/response.http.tmpl",
-		"",
-		0,
-		2048,
-	); err != nil {
+	return spec
+}
+
+func (i *instance) ParseTemplates() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.parseTemplates()
+}
+
+// ReloadTemplates parses the templates again, making them active only if all
+// of them are successfully parsed. The configuration files are rewritten and
+// haproxy reloaded in the next update.
+func (i *instance) ReloadTemplates() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if err := i.parseTemplates(); err != nil {
 		return err
 	}
-	if err := i.luaResponseTmpl.NewTemplate(
-		"responses.lua.tmpl",
-		templatesDir+"/responses/responses.lua.tmpl",
-		i.options.HAProxyCfgDir+"/lua/responses.lua",
-		0,
-		2048,
-	); err != nil {
-		return err
+	i.templatesChanged = true
+	i.logger.Info("templates successfully reloaded")
+	return nil
+}
+
+// parseTemplates parses all the templates into new template configs, only
+// replacing the current ones if all of them succeed.
+func (i *instance) parseTemplates() error {
+	templatesDir := i.options.TemplatesDir
+	templates := []struct {
+		tmpl     *template.Config
+		name     string
+		spec     TemplateSpec
+		rotate   int
+		maxAge   time.Duration
+		compress bool
+	}{
+		{
+			tmpl: i.modsecTmpl,
+			name: "modsecurity.tmpl",
+			spec: TemplateSpec{
+				Source:     templatesDir + "/modsecurity/modsecurity.tmpl",
+				Output:     i.options.HAProxyCfgDir + "/spoe-modsecurity.conf",
+				BufferSize: 1024,
+			},
+		},
+		{
+			tmpl: i.haproxyTmpl,
+			name: "haproxy.tmpl",
+			spec: TemplateSpec{
+				Source:     templatesDir + "/haproxy/haproxy.tmpl",
+				Output:     i.options.HAProxyCfgDir + "/haproxy.cfg",
+				BufferSize: 16384,
+			},
+			rotate:   i.options.MaxOldConfigFiles,
+			maxAge:   i.options.MaxOldConfigAge,
+			compress: i.options.CompressOldConfigFiles,
+		},
+		{
+			tmpl: i.mapsTmpl,
+			name: "map.tmpl",
+			spec: TemplateSpec{
+				Source:     templatesDir + "/map/map.tmpl",
+				BufferSize: 2048,
+			},
+		},
+		{
+			tmpl: i.haResponseTmpl,
+			name: "response.http.tmpl",
+			spec: TemplateSpec{
+				Source:     templatesDir + "/responses/response.http.tmpl",
+				BufferSize: 2048,
+			},
+		},
+		{
+			tmpl: i.luaResponseTmpl,
+			name: "responses.lua.tmpl",
+			spec: TemplateSpec{
+				Source:     templatesDir + "/responses/responses.lua.tmpl",
+				Output:     i.options.HAProxyCfgDir + "/lua/responses.lua",
+				BufferSize: 2048,
+			},
+		},
+	}
+	parsed := make([]*template.Config, len(templates))
+	for j, t := range templates {
+		spec := i.templateSpec(t.name, t.spec)
+		parsed[j] = template.CreateConfig()
+		if err := parsed[j].NewTemplate(t.name, spec.Source, spec.Output, t.rotate, spec.BufferSize); err != nil {
+			return err
+		}
+		parsed[j].SetRotateMaxAge(t.maxAge)
+		parsed[j].SetRotateCompress(t.compress)
+	}
+	for j, t := range templates {
+		t.tmpl.ReplaceTemplates(parsed[j])
 	}
 	return nil
 }
@@ -224,13 +729,20 @@ func (i *instance) Config() Config {
 			mapsTemplate: i.mapsTmpl,
 			mapsDir:      i.options.HAProxyMapsDir,
 			shardCount:   i.options.BackendShards,
+			shardBy:      i.options.ShardBy,
+			mapShards:    i.options.BackendMapShards,
+			trackMaps:    i.options.DynamicMapUpdates,
+			skipMapFiles: i.options.DynamicOnly,
 		})
+		if i.options.InitialConfig != nil {
+			i.options.InitialConfig(config)
+		}
 		i.config = config
 	}
 	return i.config
 }
 
-var idleRegex = regexp.MustCompile(`Idle_pct: ([0-9]+)`)
+var idleRegex = regexp.MustCompile(`(?m)^\s*Idle_pct\s*:\s*([0-9]+)\s*$`)
 
 func (i *instance) CalcIdleMetric() {
 	if !i.up {
@@ -241,21 +753,188 @@ func (i *instance) CalcIdleMetric() {
 		i.logger.Error("error reading admin socket: %v", err)
 		return
 	}
-	idleStr := idleRegex.FindStringSubmatch(msg[0])
-	if len(idleStr) < 2 {
-		i.logger.Error("cannot find Idle_pct field in the show info socket command")
+	idle, err := parseIdlePct(msg)
+	if err != nil {
+		i.logger.Error("%v", err)
 		return
 	}
-	idle, err := strconv.Atoi(idleStr[1])
+	i.metrics.AddIdleFactor(idle)
+}
+
+// parseIdlePct reads the Idle_pct field from the response lines of a
+// show info command.
+func parseIdlePct(msg []string) (int, error) {
+	for _, m := range msg {
+		idleStr := idleRegex.FindStringSubmatch(m)
+		if len(idleStr) < 2 {
+			continue
+		}
+		idle, err := strconv.Atoi(idleStr[1])
+		if err != nil {
+			return 0, fmt.Errorf("Idle_pct has an invalid integer: %s", idleStr[1])
+		}
+		return idle, nil
+	}
+	return 0, fmt.Errorf("cannot find Idle_pct field in the show info socket command")
+}
+
+var showInfoRegex = regexp.MustCompile(`(?m)^(Pid|Uptime|Version): (.*)$`)
+
+// Procs lists the haproxy processes. Master and workers are read from the
+// master CLI in the master-worker mode, embedded or external. A single
+// worker, read from the admin socket, is returned in the daemon mode.
+func (i *instance) Procs() ([]ProcInfo, error) {
+	if i.options.MasterSocket != "" {
+		return i.procsMaster()
+	}
+	return i.procsDaemon()
+}
+
+func (i *instance) procsMaster() ([]ProcInfo, error) {
+	sock := socket.NewSocket(i.options.MasterSocket, false, i.options.SocketTimeout)
+	defer sock.Close()
+	procTable, err := socket.ReadHAProxyProcs(sock)
 	if err != nil {
-		i.logger.Error("Idle_pct has an invalid integer: %s", idleStr[1])
+		return nil, fmt.Errorf("error reading procs from master socket '%s': %w", i.options.MasterSocket, err)
+	}
+	newProcInfo := func(proc socket.Proc, old bool) ProcInfo {
+		return ProcInfo{
+			Type:    proc.Type,
+			PID:     proc.PID,
+			Old:     old,
+			Reloads: proc.Reloads,
+			Uptime:  proc.Uptime,
+			Version: proc.Version,
+		}
 	}
-	i.metrics.AddIdleFactor(idle)
+	procs := make([]ProcInfo, 0, 1+len(procTable.Workers)+len(procTable.OldWorkers))
+	procs = append(procs, newProcInfo(procTable.Master, false))
+	for _, proc := range procTable.Workers {
+		procs = append(procs, newProcInfo(proc, false))
+	}
+	for _, proc := range procTable.OldWorkers {
+		procs = append(procs, newProcInfo(proc, true))
+	}
+	return procs, nil
+}
+
+func (i *instance) procsDaemon() ([]ProcInfo, error) {
+	sock := socket.NewSocket(i.options.AdminSocket, false, i.options.SocketTimeout)
+	defer sock.Close()
+	msg, err := sock.Send(nil, "show info")
+	if err != nil {
+		return nil, fmt.Errorf("error reading info from admin socket '%s': %w", i.options.AdminSocket, err)
+	}
+	if len(msg) == 0 {
+		return nil, fmt.Errorf("empty response reading info from admin socket '%s'", i.options.AdminSocket)
+	}
+	proc := ProcInfo{Type: "worker"}
+	for _, match := range showInfoRegex.FindAllStringSubmatch(msg[0], -1) {
+		value := strings.TrimSpace(match[2])
+		switch match[1] {
+		case "Pid":
+			proc.PID, _ = strconv.Atoi(value)
+		case "Uptime":
+			proc.Uptime = value
+		case "Version":
+			proc.Version = value
+		}
+	}
+	return []ProcInfo{proc}, nil
 }
 
 func (i *instance) Update(timer *utils.Timer) {
+	i.update(timer)
+	i.notifyReload()
+}
+
+func (i *instance) update(timer *utils.Timer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.shuttingDown {
+		i.logger.Warn("skipping haproxy update, instance is shutting down")
+		return
+	}
+	if i.Paused() {
+		// changes are kept in the config until the next update, see Resume()
+		i.logger.Info("skipping haproxy update, updates are paused")
+		i.pausedChanges = true
+		return
+	}
 	i.acmeUpdate()
 	i.haproxyUpdate(timer)
+	i.scheduleDrainExpiry()
+}
+
+// scheduleDrainExpiry notifies the UpdateQueue when the first draining
+// endpoint should be disabled. The endpoint might belong to a backend that
+// doesn't change anymore, so an update is requested even without changes.
+func (i *instance) scheduleDrainExpiry() {
+	if i.options.UpdateQueue == nil {
+		return
+	}
+	next, found := nextDrainExpiry(i.draining, i.options.EndpointDrainPeriod)
+	if !found || (!i.drainExpiry.IsZero() && !next.Before(i.drainExpiry)) {
+		// nothing draining, or an update was already scheduled on time
+		return
+	}
+	i.drainExpiry = next
+	wait := next.Sub(i.options.Clock.Now())
+	go func() {
+		select {
+		case <-i.options.Clock.After(wait):
+		case <-i.options.StopCh:
+			return
+		}
+		i.mutex.Lock()
+		if i.drainExpiry.Equal(next) {
+			i.drainExpiry = time.Time{}
+		}
+		i.mutex.Unlock()
+		i.loggerFor(LogSubsystemUpdate).InfoV(2, "endpoint drain period expired, requesting an update")
+		i.options.UpdateQueue.Notify()
+	}()
+}
+
+// Pause makes Update a no-op, so haproxy keeps running with the last applied
+// configuration. Changes made in the config while paused are applied by a
+// single update when Resume is called.
+func (i *instance) Pause() {
+	i.healthMutex.Lock()
+	defer i.healthMutex.Unlock()
+	if !i.paused {
+		i.paused = true
+		i.logger.Info("haproxy updates paused")
+	}
+}
+
+// Resume resumes the updates paused by Pause, applying the changes made in
+// the config while paused, if any.
+func (i *instance) Resume(timer *utils.Timer) {
+	i.healthMutex.Lock()
+	paused := i.paused
+	i.paused = false
+	i.healthMutex.Unlock()
+	if !paused {
+		return
+	}
+	i.mutex.Lock()
+	pending := i.pausedChanges
+	i.pausedChanges = false
+	i.mutex.Unlock()
+	if !pending {
+		i.logger.Info("haproxy updates resumed, no update was requested while paused")
+		return
+	}
+	i.logger.Info("haproxy updates resumed, applying the changes made while paused")
+	i.Update(timer)
+}
+
+// Paused returns true if the updates are paused, see Pause.
+func (i *instance) Paused() bool {
+	i.healthMutex.Lock()
+	defer i.healthMutex.Unlock()
+	return i.paused
 }
 
 func (i *instance) acmeUpdate() {
@@ -264,7 +943,10 @@ func (i *instance) acmeUpdate() {
 	}
 	storages := i.config.AcmeData().Storages()
 	le := i.options.LeaderElector
-	if le.IsLeader() {
+	leader := le.IsLeader()
+	i.metrics.SetAcmeLeaderStatus(leader)
+	if leader {
+		i.acmeSkippedSince = nil
 		hasAccount := i.acmeEnsureConfig(i.config.AcmeData())
 		if !hasAccount {
 			return
@@ -276,8 +958,26 @@ func (i *instance) acmeUpdate() {
 			i.acmeRemoveStorage(del)
 		}
 	} else if storages.Updated() {
-		i.logger.InfoV(2, "skipping acme update check, leader is %s", le.LeaderName())
+		i.acmeSkipUpdate(le.LeaderName())
+	}
+}
+
+// acmeSkipUpdate logs that the acme changes were skipped by a non leader
+// instance. The message is logged as a warning if the instance is skipping
+// the changes for more than AcmeNonLeaderWarnTimeout, since the acme work
+// would be stalled if no other instance is leading.
+func (i *instance) acmeSkipUpdate(leaderName string) {
+	now := i.options.Clock.Now()
+	if i.acmeSkippedSince == nil {
+		i.acmeSkippedSince = &now
+	}
+	timeout := i.options.AcmeNonLeaderWarnTimeout
+	if skipping := now.Sub(*i.acmeSkippedSince); timeout > 0 && skipping >= timeout {
+		i.logger.Warn("skipping acme update check for %s, leader is %s; check the leader election if certificates are not being signed",
+			skipping.Truncate(time.Second), leaderName)
+		return
 	}
+	i.loggerFor(LogSubsystemAcme).InfoV(2, "skipping acme update check, leader is %s", leaderName)
 }
 
 func (i *instance) haproxyUpdate(timer *utils.Timer) {
@@ -285,56 +985,131 @@ func (i *instance) haproxyUpdate(timer *utils.Timer) {
 	if i.config == nil {
 		return
 	}
+	// refreshing the failing time, it is only changed by reload attempts
+	i.healthMutex.Lock()
+	i.setReloadFailing()
+	i.healthMutex.Unlock()
 	//
 	// this should be taken into account when refactoring this func:
 	//   - dynUpdater might change config state, so it should be called before templates.Write()
 	//   - i.metrics.IncUpdate<Status>() should be called always, but only once
 	//   - i.updateSuccessful(<bool>) should be called only if haproxy is reloaded or cfg is validated
+	//   - i.setLastSuccessfulApply() should be called only if the whole update was applied to haproxy
 	//
-	defer i.config.Commit()
+	// changes are committed and published in the snapshot in the end of the update, except
+	// the ones that need a reload in dynamic only mode, see skipCommit. Such changes are
+	// kept pending, so the next updates are compared with the config haproxy is running.
+	skipCommit := false
+	defer func() {
+		if !skipCommit {
+			// pending changes are lost after the commit, so they are checked first
+			publish := i.snapshotStale || i.config.PendingChanges() || i.config.AcmeData().Storages().Updated()
+			i.config.Commit()
+			if publish || i.snapshot.Load() == nil {
+				i.publishSnapshot()
+			}
+		}
+	}()
 	i.config.SyncConfig()
 	i.config.Shrink()
 	if err := i.config.WriteTCPServicesMaps(); err != nil {
 		i.logger.Error("error building tcp services maps: %v", err)
 		i.metrics.IncUpdateNoop()
+		i.setLastUpdate(UpdateNoop)
 		return
 	}
 	if err := i.config.WriteFrontendMaps(); err != nil {
 		i.logger.Error("error building frontend maps: %v", err)
 		i.metrics.IncUpdateNoop()
+		i.setLastUpdate(UpdateNoop)
 		return
 	}
 	if err := i.config.WriteBackendMaps(); err != nil {
 		i.logger.Error("error building backend maps: %v", err)
 		i.metrics.IncUpdateNoop()
+		i.setLastUpdate(UpdateNoop)
 		return
 	}
-	timer.Tick("write_maps")
+	i.metrics.SetMapsBytes(i.config.MapsBytes())
+	i.tickPhase(timer, "write_maps")
 	if !i.options.fake {
 		// TODO update tests and remove `if !fake` above
 		i.logChanged()
 	}
 	updater := i.newDynUpdater()
-	updated := updater.update()
-	if i.options.SortEndpointsBy != "random" {
+	forced := i.forceReload
+	templatesChanged := i.templatesChanged
+	var updated bool
+	if i.forceReload {
+		i.loggerFor(LogSubsystemReload).InfoV(2, "need to reload, a full reload was requested")
+		updater.alignSlots()
+	} else {
+		updated = updater.update()
+		if reasons := updater.ReloadReasons(); len(reasons) > 0 {
+			i.logReloadReasons(reasons)
+		}
+		if updated && i.templatesChanged {
+			i.loggerFor(LogSubsystemReload).InfoV(2, "need to reload due to template changes")
+			updater.alignSlots()
+			updated = false
+		}
+	}
+	switch i.options.SortEndpointsBy {
+	case hatypes.SortEndpointsByNone:
+		// neither sort nor shuffle, endpoints are used in the order they were added
+	case hatypes.SortEndpointsByRandom:
+		if !updated {
+			// Only shuffle if need to reload
+			i.config.Backends().ShuffleAllEndpoints()
+			i.tickPhase(timer, "shuffle_endpoints")
+		}
+	default:
 		i.config.Backends().SortChangedEndpoints(i.options.SortEndpointsBy)
-	} else if !updated {
-		// Only shuffle if need to reload
-		i.config.Backends().ShuffleAllEndpoints()
-		timer.Tick("shuffle_endpoints")
 	}
-	i.config.Backends().FillSourceIPs()
-	if !updated || updater.cmdCnt > 0 {
+	if missing := i.config.Backends().FillSourceIPs(); len(missing) > 0 {
+		i.loggerFor(LogSubsystemUpdate).InfoV(2, "missing source IP of the same address family, using the default source of endpoint(s): %s",
+			joinTruncated(missing, maxMissingSourceIPs))
+	}
+	var cfgChanged bool
+	if !i.options.DynamicOnly && (!updated || updater.cmdCnt > 0) {
 		// only need to rewrite config files if:
 		//   - !updated           - there are changes that cannot be dynamically applied
 		//   - updater.cmdCnt > 0 - there are changes that was dynamically applied
-		err := i.writeConfig()
-		timer.Tick("write_config")
+		info, err := i.writeConfig()
+		i.tickPhase(timer, "write_config")
 		if err != nil {
 			i.logger.Error("error writing configuration: %v", err)
 			i.metrics.IncUpdateNoop()
+			i.setLastUpdate(UpdateNoop)
 			return
 		}
+		i.metrics.AddConfigFilesWritten(info.files, info.bytes)
+		if len(info.shards) > 0 {
+			strshards := make([]string, len(info.shards))
+			for n, j := range info.shards {
+				strshards[n] = shardNumber(j, i.options.BackendShards)
+			}
+			i.loggerFor(LogSubsystemUpdate).InfoV(2, "updated main cfg and %d backend file(s): %v; %d file(s) and %d bytes written",
+				len(strshards), strshards, info.files, info.bytes)
+		}
+		if templatesChanged {
+			// unchanged shards weren't rewritten with the new templates
+			i.checkShards = nil
+		} else if i.checkShards != nil {
+			for _, j := range info.shards {
+				i.checkShards[j] = true
+			}
+		}
+		i.templatesChanged = false
+		i.forceReload = false
+		cfgChanged = info.changed > 0
+	}
+	if !updated && !cfgChanged && !forced && !templatesChanged && i.options.DynamicMapUpdates {
+		// config files didn't change, so pending changes are restricted to the
+		// map files. A healthy haproxy has the last written maps in memory.
+		if healthy, _ := i.Healthy(); healthy {
+			updated = updater.updateMaps()
+		}
 	}
 	i.updateCertExpiring()
 	defer func() {
@@ -344,130 +1119,791 @@ func (i *instance) haproxyUpdate(timer *utils.Timer) {
 	}()
 	if updated {
 		if updater.cmdCnt > 0 {
-			if i.options.ValidateConfig {
-				var err error
-				if err = i.check(); err != nil {
-					i.logger.Error("error validating config file:\n%v", err)
+			valid := true
+			if i.options.ValidateConfig && !i.options.DynamicOnly {
+				err := i.check()
+				i.tickPhase(timer, "validate_cfg")
+				if errors.Is(err, errValidationNotSupported) {
+					i.logger.Warn("skipping config validation: %v", err)
+				} else {
+					if err != nil {
+						summary := validationSummary(err)
+						i.logger.Error("error validating config file:\n%s", summary)
+						i.recordEvent(types.EventTypeWarning, "ValidationFailed", "error validating config file:\n%s", summary)
+						valid = false
+					}
+					i.updateSuccessful(err == nil)
 				}
-				timer.Tick("validate_cfg")
-				i.updateSuccessful(err == nil)
 			}
-			i.logger.Info("haproxy updated without needing to reload. Commands sent: %d", updater.cmdCnt)
+			i.logger.WithFields(map[string]interface{}{
+				"command_count": updater.cmdCnt,
+			}).Info("haproxy updated without needing to reload. Commands sent: %d", updater.cmdCnt)
 			i.metrics.IncUpdateDynamic()
+			i.setLastUpdate(UpdateDynamic)
+			if valid {
+				i.setLastSuccessfulApply()
+			}
 		} else {
 			i.logger.Info("old and new configurations match")
 			i.metrics.IncUpdateNoop()
+			i.setLastUpdate(UpdateNoop)
+			if i.failedSince == nil && i.reloadPending == 0 {
+				// haproxy is only up to date if it isn't missing a failed or an enqueued reload
+				i.setLastSuccessfulApply()
+			}
+		}
+		return
+	}
+	if i.options.DynamicOnly {
+		if !i.config.(*config).hasCommittedData() {
+			// haproxy was started outside of the controller, and is expected to
+			// be running the same configuration the controller would generate.
+			i.logger.Info("dynamic only mode, assuming haproxy is running the current configuration")
+			i.metrics.IncUpdateNoop()
+			i.setLastUpdate(UpdateNoop)
+			return
 		}
+		// changes that need a reload aren't committed, so the next updates are
+		// still compared with the config haproxy is running.
+		i.logger.Warn("skipping haproxy reload, changes that cannot be dynamically applied are kept pending in dynamic only mode")
+		skipCommit = true
+		i.forceReload = false
+		i.templatesChanged = false
+		i.metrics.IncUpdateReloadBlocked()
+		i.metrics.IncUpdateNoop()
+		i.setLastUpdate(UpdateNoop)
 		return
 	}
+	if i.options.ValidateCertFiles {
+		if errs := i.config.ValidateCertFiles(); len(errs) > 0 {
+			// haproxy would fail to start with missing certificate files, so
+			// the reload is skipped and forced on the next update, like a
+			// failed config validation.
+			summary := certFilesSummary(errs)
+			i.logger.Error("error validating certificate files, skipping haproxy reload:\n%s", summary)
+			i.recordEvent(types.EventTypeWarning, "ValidationFailed", "error validating certificate files, skipping haproxy reload:\n%s", summary)
+			i.forceReload = true
+			i.updateSuccessful(false)
+			i.metrics.IncUpdateReloadBlocked()
+			i.metrics.IncUpdateNoop()
+			i.setLastUpdate(UpdateNoop)
+			return
+		}
+		i.tickPhase(timer, "validate_cert_files")
+	}
+	if i.options.ValidateBeforeReload {
+		err := i.check()
+		i.tickPhase(timer, "validate_cfg")
+		if errors.Is(err, errValidationNotSupported) {
+			i.logger.Warn("skipping config validation: %v", err)
+		} else if err != nil {
+			// a full reload is still pending, and should be forced on the next
+			// update even if the next changes can be dynamically applied.
+			summary := validationSummary(err)
+			i.logger.Error("error validating config file, skipping haproxy reload:\n%s", summary)
+			i.recordEvent(types.EventTypeWarning, "ValidationFailed", "error validating config file, skipping haproxy reload:\n%s", summary)
+			i.forceReload = true
+			i.updateSuccessful(false)
+			i.metrics.IncUpdateReloadBlocked()
+			i.metrics.IncUpdateNoop()
+			i.setLastUpdate(UpdateNoop)
+			return
+		}
+	}
+	if i.reloadReason == "" {
+		if !i.up {
+			i.reloadReason = ReloadReasonFirstRun
+		} else if forced {
+			i.reloadReason = ReloadReasonForced
+		} else if templatesChanged {
+			i.reloadReason = ReloadReasonTemplatesChanged
+		} else {
+			i.reloadReason = ReloadReasonConfigChanged
+		}
+	}
+	i.setLastUpdate(UpdateReload)
 	if i.options.ReloadQueue != nil {
 		i.options.ReloadQueue.Notify()
-		i.logger.InfoV(2, "haproxy reload enqueued")
+		// the queue deduplicates notifications, so the reason is kept in the
+		// instance and consumed by the enqueued reload, see reload()
+		i.loggerFor(LogSubsystemReload).InfoV(2, "haproxy reload enqueued, reason: %s", i.reloadReason)
+		i.trackReloadPending()
 	} else {
-		i.Reload(timer)
+		i.reload(timer)
+	}
+}
+
+// trackReloadPending counts the configuration updates waiting for the
+// enqueued reload. A growing number means that haproxy cannot be reloaded
+// as fast as the configuration changes.
+func (i *instance) trackReloadPending() {
+	i.reloadPending++
+	i.metrics.SetReloadQueueDepth(i.reloadPending)
+	threshold := i.options.ReloadQueueWarnThreshold
+	if threshold > 0 && i.reloadPending > threshold {
+		i.logger.Warn("%d configuration updates are waiting for the enqueued haproxy reload, threshold is %d", i.reloadPending, threshold)
+	}
+}
+
+// tickPhase registers a haproxy update phase in the timer, and
+// exports its duration as a metric.
+func (i *instance) tickPhase(timer *utils.Timer, phase string) {
+	i.metrics.ObservePhase(phase, timer.Tick(phase))
+}
+
+// LastReload returns information about the last haproxy reload. A zero
+// ReloadInfo is returned if haproxy wasn't reloaded yet.
+func (i *instance) LastReload() ReloadInfo {
+	i.lastReloadMutex.Lock()
+	defer i.lastReloadMutex.Unlock()
+	return i.lastReload
+}
+
+// LastUpdate returns the outcome of the last configuration update: noop if
+// nothing changed or the update failed before applying the changes, dynamic
+// if the changes were applied without a reload, or reload if a reload was
+// made or enqueued. An empty UpdateResult is returned if no update was made.
+func (i *instance) LastUpdate() UpdateResult {
+	i.lastReloadMutex.Lock()
+	defer i.lastReloadMutex.Unlock()
+	return i.lastUpdate
+}
+
+func (i *instance) setLastUpdate(result UpdateResult) {
+	i.lastReloadMutex.Lock()
+	i.lastUpdate = result
+	i.lastReloadMutex.Unlock()
+}
+
+// Healthy returns false and the reason if haproxy wasn't started yet, or if
+// it is failing to reload since the last successful one.
+func (i *instance) Healthy() (bool, string) {
+	i.healthMutex.Lock()
+	defer i.healthMutex.Unlock()
+	if !i.up {
+		return false, "haproxy wasn't started yet"
+	}
+	if i.failedSince != nil {
+		return false, fmt.Sprintf("haproxy failing to reload for %s, since %s",
+			i.options.Clock.Now().Sub(*i.failedSince).Truncate(time.Second), i.failedSince.Format("2006-01-02 15:04:05 -0700 MST"))
+	}
+	if i.adminSocketErr != nil {
+		return false, fmt.Sprintf("haproxy admin socket is not responding: %v", i.adminSocketErr)
 	}
+	return true, ""
+}
+
+// ForceReload rewrites the configuration files from the current state and
+// reloads haproxy, even if the changes could be dynamically applied.
+func (i *instance) ForceReload(timer *utils.Timer) {
+	i.lockedForceReload(timer)
+	i.notifyReload()
+}
+
+func (i *instance) lockedForceReload(timer *utils.Timer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.shuttingDown {
+		i.logger.Warn("skipping haproxy reload, instance is shutting down")
+		return
+	}
+	if i.options.DynamicOnly {
+		i.logger.Warn("skipping haproxy reload, instance is in dynamic only mode")
+		return
+	}
+	if i.Paused() {
+		// a forced reload would also apply the changes made while paused
+		i.logger.Warn("skipping haproxy reload, updates are paused")
+		return
+	}
+	i.forceReload = true
+	i.haproxyUpdate(timer)
 }
 
 func (i *instance) Reload(timer *utils.Timer) {
+	i.waitReloadInterval()
+	i.lockedReload(timer)
+	i.notifyReload()
+}
+
+// waitReloadInterval waits until MinReloadInterval has elapsed since the
+// start of the last reload. Reloads requested via the reload queue the
+// instance owns are already throttled, but a queue provided by the caller
+// might not be. The instance isn't locked, so updates that can be
+// dynamically applied are not delayed.
+func (i *instance) waitReloadInterval() {
+	interval := i.options.MinReloadInterval
+	if interval <= 0 {
+		return
+	}
+	i.lastReloadMutex.Lock()
+	last := i.lastReload.Timestamp
+	i.lastReloadMutex.Unlock()
+	if last.IsZero() {
+		return
+	}
+	wait := interval - i.options.Clock.Now().Sub(last)
+	if wait <= 0 {
+		return
+	}
+	i.logger.InfoV(2, "waiting %s before reloading haproxy due to the min reload interval", wait)
+	select {
+	case <-i.options.StopCh:
+	case <-i.options.Clock.After(wait):
+	}
+}
+
+func (i *instance) lockedReload(timer *utils.Timer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.shuttingDown {
+		i.logger.Warn("skipping haproxy reload, instance is shutting down")
+		return
+	}
+	if i.options.DynamicOnly {
+		i.logger.Warn("skipping haproxy reload, instance is in dynamic only mode")
+		return
+	}
+	i.reload(timer)
+}
+
+type reloadEvent struct {
+	success  bool
+	mode     string
+	duration time.Duration
+}
+
+type instanceEvent struct {
+	eventtype string
+	reason    string
+	message   string
+}
+
+// recordEvent enqueues an event to the EventRecorder, if configured. Events
+// are recorded by notifyReload(), out of the update and reload paths.
+func (i *instance) recordEvent(eventtype, reason, message string, args ...interface{}) {
+	if i.options.EventRecorder == nil {
+		return
+	}
+	i.events = append(i.events, instanceEvent{
+		eventtype: eventtype,
+		reason:    reason,
+		message:   fmt.Sprintf(message, args...),
+	})
+}
+
+// notifyReload records the pending events, calls the OnCertExpiring hook for
+// the certificates that crossed the expiring threshold, and calls the OnReload
+// hook if a reload happened. It should be called without holding the instance
+// lock.
+func (i *instance) notifyReload() {
+	i.mutex.Lock()
+	event := i.reloadEvent
+	i.reloadEvent = nil
+	events := i.events
+	i.events = nil
+	certs := i.certsExpiring
+	i.certsExpiring = nil
+	i.mutex.Unlock()
+	for _, e := range events {
+		i.options.EventRecorder.Event(e.eventtype, e.reason, e.message)
+	}
+	for _, cert := range certs {
+		i.notifyCertExpiring(cert)
+	}
+	if event == nil || i.options.OnReload == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			i.logger.Error("panic calling the reload hook: %v", r)
+		}
+	}()
+	i.options.OnReload(event.success, event.mode, event.duration)
+}
+
+func (i *instance) notifyCertExpiring(cert certExpiring) {
+	defer func() {
+		if r := recover(); r != nil {
+			i.logger.Error("panic calling the cert expiring hook: %v", r)
+		}
+	}()
+	i.options.OnCertExpiring(cert.host, cert.commonName, cert.notAfter)
+}
+
+func (i *instance) reloadMode() string {
+	if i.options.IsExternal {
+		return "external"
+	} else if i.options.IsMasterWorker {
+		return "embedded master-worker"
+	}
+	return "embedded daemon"
+}
+
+// metricsReloadMode is the haproxy mode used in the reload metrics labels,
+// either embedded or external.
+func (i *instance) metricsReloadMode() string {
+	if i.options.IsExternal {
+		return "external"
+	}
+	return "embedded"
+}
+
+func (i *instance) reloadQueued(item interface{}) {
+	timer := utils.NewTimer(i.metrics.ControllerProcTime)
+	i.Reload(timer)
+	i.logger.Info("finish enqueued haproxy reload, reason: %s: %s", i.LastReload().Reason, timer.AsString("total"))
+}
+
+// defaultPreReloadTimeout is the time the OnPreReload hook has to finish if
+// PreReloadTimeout isn't configured.
+const defaultPreReloadTimeout = 30 * time.Second
+
+// preReload calls the OnPreReload hook, if configured. A hook that panics or
+// doesn't finish in PreReloadTimeout is handled as failed, the hook itself
+// cannot be cancelled though.
+func (i *instance) preReload() error {
+	if i.options.OnPreReload == nil {
+		return nil
+	}
+	timeout := i.options.PreReloadTimeout
+	if timeout <= 0 {
+		timeout = defaultPreReloadTimeout
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic calling the pre reload hook: %v", r)
+			}
+		}()
+		done <- i.options.OnPreReload()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-i.options.Clock.After(timeout):
+		return fmt.Errorf("pre reload hook timed out after %s", timeout)
+	}
+}
+
+func (i *instance) reload(timer *utils.Timer) {
+	if err := i.preReload(); err != nil {
+		// the reload is still pending, and should be forced on the next
+		// update even if the next changes can be dynamically applied.
+		i.logger.Error("error calling the pre reload hook, skipping haproxy reload: %v", err)
+		i.forceReload = true
+		i.updateSuccessful(false)
+		i.metrics.IncUpdateNoop()
+		i.setLastUpdate(UpdateNoop)
+		return
+	}
+	i.tickPhase(timer, "pre_reload")
 	i.metrics.IncUpdateFull()
 	if i.options.TrackInstances {
 		timeoutStopDur := i.config.Global().TimeoutStopDuration
 		closeSessDur := i.config.Global().CloseSessionsDuration
 		i.conns.TrackCurrentInstance(timeoutStopDur, closeSessDur)
 	}
+	reason := i.reloadReason
+	if reason == "" {
+		reason = ReloadReasonRequested
+	}
+	i.reloadReason = ""
+	if i.reloadPending > 0 {
+		i.reloadPending = 0
+		i.metrics.SetReloadQueueDepth(0)
+	}
+	i.reloadStrategy = i.options.ReloadStrategy
+	start := i.options.Clock.Now()
 	err := i.reloadHAProxy()
-	timer.Tick("reload_haproxy")
+	i.tickPhase(timer, "reload_haproxy")
+	duration := i.options.Clock.Now().Sub(start)
+	i.metrics.ObserveReload(i.metricsReloadMode(), i.reloadStrategy, err == nil, duration)
+	i.reloadEvent = &reloadEvent{
+		success:  err == nil,
+		mode:     i.reloadMode(),
+		duration: duration,
+	}
+	i.lastReloadMutex.Lock()
+	i.lastReload = ReloadInfo{
+		Timestamp: start,
+		Success:   err == nil,
+		Reason:    reason,
+		Duration:  duration,
+	}
+	i.lastReloadMutex.Unlock()
+	logger := i.logger.WithFields(map[string]interface{}{
+		"reload_reason": reason,
+	})
 	if err != nil {
-		i.logger.Error("error reloading server: %v", err)
+		logger.Error("error reloading server: %v", err)
+		i.recordEvent(types.EventTypeWarning, "ReloadFailed", "error reloading haproxy (%s): %v", i.reloadMode(), err)
 		i.updateSuccessful(false)
 		if i.options.TrackInstances {
 			i.conns.ReleaseLastInstance()
 		}
 		return
 	}
+	i.healthMutex.Lock()
 	i.up = true
+	i.healthMutex.Unlock()
 	i.updateSuccessful(true)
-	message := "haproxy successfully reloaded"
-	if i.options.IsExternal {
-		message += " (external)"
-	} else if i.options.IsMasterWorker {
-		message += " (embedded master-worker)"
-	} else {
-		message += " (embedded daemon)"
-	}
+	i.setLastSuccessfulApply()
+	i.recordEvent(types.EventTypeNormal, "Reloaded", "haproxy reloaded (%s) in %s, reason: %s", i.reloadMode(), duration.Truncate(time.Millisecond), reason)
+	message := "haproxy successfully reloaded (" + i.reloadMode() + ")"
 	if i.options.TrackInstances {
-		message += "; tracked instance(s): " + strconv.Itoa(i.conns.OldInstancesCount())
+		count := i.conns.OldInstancesCount()
+		message += "; tracked instance(s): " + strconv.Itoa(count)
+		logger = logger.WithFields(map[string]interface{}{"tracked_instances": count})
+	}
+	logger.Info(message)
+	if !i.adminSocketOK && !i.options.fake {
+		i.checkAdminSocket()
+	}
+	if !i.options.fake && (i.options.IsExternal || i.HAProxyVersion() == "") {
+		i.detectHAProxyVersion()
 	}
-	i.logger.Info(message)
 }
 
-func (i *instance) Shutdown() {
+// checkAdminSocket sends a `show info` to the admin socket after the first
+// successful reload, so a misconfigured socket is reported on startup instead
+// of via failing dynamic updates. A failing socket is checked again on the
+// next successful reloads, and, if RequireAdminSocket is configured, fails
+// the readiness until it responds.
+func (i *instance) checkAdminSocket() {
+	_, err := i.conns.Admin().Send(nil, "show info")
+	i.adminSocketOK = err == nil
+	if err != nil {
+		if i.options.RequireAdminSocket {
+			i.logger.Error("haproxy admin socket is not responding, failing readiness: %v", err)
+		} else {
+			i.logger.Warn("haproxy admin socket is not responding, dynamic updates and metrics will fail: %v", err)
+			err = nil
+		}
+	}
+	i.healthMutex.Lock()
+	i.adminSocketErr = err
+	i.healthMutex.Unlock()
+}
+
+// Shutdown waits for a running update to finish, and rejects new ones.
+// Embedded haproxy is also stopped if its lifecycle is controlled by
+// HAProxy Ingress. ctx limits the time waiting for all of that.
+func (i *instance) Shutdown(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		i.mutex.Lock()
+		i.shuttingDown = true
+		i.mutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting the current update to finish: %w", ctx.Err())
+	}
+	if i.ownReloadQueue {
+		i.options.ReloadQueue.ShutDown()
+	}
+	defer i.conns.CloseAll()
 	if !i.up || i.options.IsExternal {
 		// lifecycle isn't controlled by HAProxy Ingress
-		return
+		return nil
+	}
+	if i.options.fake {
+		i.logger.Info("(test) shutdown was skipped")
+		return nil
 	}
 	if i.options.IsMasterWorker {
-		<-i.waitProc
+		if i.config.Global().LoadServerState {
+			if err := i.persistServersState(); err != nil {
+				i.logger.Warn("failed to persist servers state before shutdown: %v", err)
+				i.metrics.IncServerStatePersistError()
+			} else {
+				i.metrics.IncServerStatePersistSuccess()
+			}
+		}
+		select {
+		case <-i.waitProc:
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting haproxy to stop: %w", ctx.Err())
+		}
+		return nil
+	}
+	i.logger.Info("shutting down embedded haproxy")
+	out, err := exec.CommandContext(
+		ctx,
+		i.options.RootFSPrefix+"/haproxy-shutdown.sh",
+		i.options.LocalFSPrefix,
+	).CombinedOutput()
+	outstr := string(out)
+	if outstr != "" {
+		i.logger.Warn("output from the shutdown process: %v", outstr)
+	}
+	if err != nil {
+		return fmt.Errorf("error shutting down haproxy: %w", err)
+	}
+	return nil
+}
+
+// maxChangedNames is the max number of host or backend names logged
+// on every configuration update, and the default LogItemListThreshold.
+const maxChangedNames = 100
+
+// changeList ...
+type changeList struct {
+	Added     int      `json:"added"`
+	Removed   int      `json:"removed"`
+	Changed   int      `json:"changed"`
+	Names     []string `json:"names"`
+	Truncated bool     `json:"truncated"`
+}
+
+// changeSummary ...
+type changeSummary struct {
+	Hosts    changeList `json:"hosts"`
+	Backends changeList `json:"backends"`
+}
+
+func newChangeList(added, removed, changed int, names []string) changeList {
+	sort.Strings(names)
+	return changeList{
+		Added:   added,
+		Removed: removed,
+		Changed: changed,
+		Names:   names,
+	}
+}
+
+func (l *changeList) truncate() {
+	if len(l.Names) > maxChangedNames {
+		l.Names = l.Names[:maxChangedNames]
+		l.Truncated = true
+	}
+}
+
+func buildChangeSummary(diff ConfigDiff) changeSummary {
+	hosts := make([]string, 0, len(diff.HostsAdded)+len(diff.HostsChanged)+len(diff.HostsRemoved))
+	for _, list := range [][]*hatypes.Host{diff.HostsAdded, diff.HostsChanged, diff.HostsRemoved} {
+		for _, host := range list {
+			hosts = append(hosts, host.Hostname)
+		}
+	}
+	backs := make([]string, 0, len(diff.BackendsAdded)+len(diff.BackendsChanged)+len(diff.BackendsRemoved))
+	for _, list := range [][]*hatypes.Backend{diff.BackendsAdded, diff.BackendsChanged, diff.BackendsRemoved} {
+		for _, back := range list {
+			backs = append(backs, back.ID)
+		}
+	}
+	return changeSummary{
+		Hosts:    newChangeList(len(diff.HostsAdded), len(diff.HostsRemoved), len(diff.HostsChanged), hosts),
+		Backends: newChangeList(len(diff.BackendsAdded), len(diff.BackendsRemoved), len(diff.BackendsChanged), backs),
+	}
+}
+
+// maxCertFileErrors is the max number of certificate file errors logged when
+// ValidateCertFiles fails.
+const maxCertFileErrors = 10
+
+func certFilesSummary(errs []error) string {
+	n := len(errs)
+	if n > maxCertFileErrors {
+		errs = errs[:maxCertFileErrors]
+	}
+	lines := make([]string, len(errs))
+	for j, err := range errs {
+		lines[j] = err.Error()
+	}
+	if n > maxCertFileErrors {
+		lines = append(lines, fmt.Sprintf("... and %d more", n-maxCertFileErrors))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// maxReloadReasons is the max number of backends logged with the reason of
+// not being dynamically updated.
+const maxReloadReasons = 10
+
+// maxMissingSourceIPs is the max number of endpoints logged without a
+// source IP of the same address family.
+const maxMissingSourceIPs = 10
+
+func (i *instance) logReloadReasons(reasons []BackendReloadReason) {
+	strreasons := make([]string, len(reasons))
+	for j, reason := range reasons {
+		strreasons[j] = reason.String()
+	}
+	i.loggerFor(LogSubsystemReload).InfoV(2, "backend(s) not dynamically updated: %s",
+		joinTruncated(strreasons, maxReloadReasons))
+}
+
+// joinTruncated joins up to max items, adding the number of the
+// remaining ones.
+func joinTruncated(items []string, max int) string {
+	if len(items) <= max {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:max], ", "), len(items)-max)
+}
+
+func (i *instance) logChanged() {
+	summary := buildChangeSummary(i.config.Diff())
+	if i.options.LogChangesJSON {
+		summary.Hosts.truncate()
+		summary.Backends.truncate()
+		out, err := json.Marshal(summary)
+		if err != nil {
+			i.logger.Error("error encoding change summary: %v", err)
+			return
+		}
+		i.loggerFor(LogSubsystemUpdate).InfoV(2, "update summary: %s", out)
 		return
 	}
-	i.logger.Info("shutting down embedded haproxy")
-	out, err := exec.Command(
-		i.options.RootFSPrefix+"/haproxy-shutdown.sh",
-		i.options.LocalFSPrefix,
-	).CombinedOutput()
-	outstr := string(out)
-	if outstr != "" {
-		i.logger.Warn("output from the shutdown process: %v", outstr)
+	threshold := i.options.LogItemListThreshold
+	logger := i.loggerFor(LogSubsystemUpdate)
+	hosts := summary.Hosts
+	if hostsAdd := hosts.Added + hosts.Changed; hostsAdd < threshold {
+		logger.WithFields(map[string]interface{}{"host_count": len(hosts.Names)}).
+			InfoV(2, "updating %d host(s): %v", len(hosts.Names), hosts.Names)
+	} else {
+		logger.WithFields(map[string]interface{}{"host_count": hostsAdd}).
+			InfoV(2, "updating %d hosts", hostsAdd)
+	}
+	backs := summary.Backends
+	if backsAdd := backs.Added + backs.Changed; backsAdd < threshold {
+		logger.WithFields(map[string]interface{}{"backend_count": len(backs.Names)}).
+			InfoV(2, "updating %d backend(s): %v", len(backs.Names), backs.Names)
+	} else {
+		logger.WithFields(map[string]interface{}{"backend_count": backsAdd}).
+			InfoV(2, "updating %d backends", backsAdd)
+	}
+}
+
+// haproxyTemplateData is the root type of the haproxy template. A single
+// template is used to generate all haproxy cfg files of a multi-file
+// configuration, and it behaves accordingly to the filled/ignored
+// attributes: the main cfg fills .Cfg, backend shards fill .Global and
+// .Backends.
+type haproxyTemplateData struct {
+	Cfg      Config
+	Global   *hatypes.Global
+	Backends []*hatypes.Backend
+}
+
+// modsecTemplateData is the data passed to the modsecurity template. Group
+// is nil when rendering the default SPOE config, which uses the global
+// ModSecurity endpoints.
+type modsecTemplateData struct {
+	Config
+	Group *hatypes.ModSecurityGroup
+}
+
+// RenderedConfig returns the haproxy configuration rendered by the last
+// update from the committed config, without rendering it again or reading
+// the files. Backend shards, if configured, are appended to the main cfg in
+// the same order haproxy reads them, and empty shards are skipped. Maps
+// aren't included.
+func (i *instance) RenderedConfig() ([]byte, error) {
+	snapshot := i.snapshot.Load()
+	if snapshot == nil || snapshot.rendered == nil {
+		return nil, fmt.Errorf("haproxy configuration wasn't rendered yet")
+	}
+	return snapshot.rendered, nil
+}
+
+// validateConfigTimeout is the time the haproxy binary has to validate the
+// configuration on ValidateConfig, it is killed otherwise.
+var validateConfigTimeout = 30 * time.Second
+
+// ValidateConfig validates cfg using the configured haproxy binary. cfg
+// is written to a temporary file which is removed afterwards, so neither
+// the live configuration nor the instance state is used or changed.
+// Configuration errors are returned as a *ValidationError.
+func (i *instance) ValidateConfig(cfg []byte) error {
+	f, err := os.CreateTemp("", "haproxy-validate-*.cfg")
+	if err != nil {
+		return fmt.Errorf("error creating temporary config file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(cfg)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("error writing temporary config file: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), validateConfigTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, i.options.HAProxyBinary, "-c", "-f", f.Name()).CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("config validation timed out after %s", validateConfigTimeout)
 	}
 	if err != nil {
-		i.logger.Error("error shutting down haproxy: %v", err)
+		if len(out) == 0 {
+			return err
+		}
+		return newValidationError(string(out))
 	}
+	return nil
 }
 
-func (i *instance) logChanged() {
-	hostsAdd := i.config.Hosts().ItemsAdd()
-	if len(hostsAdd) < 100 {
-		hostsDel := i.config.Hosts().ItemsDel()
-		hosts := make([]string, 0, len(hostsAdd))
-		for host := range hostsAdd {
-			hosts = append(hosts, host)
-		}
-		for host := range hostsDel {
-			if _, found := hostsAdd[host]; !found {
-				hosts = append(hosts, host)
-			}
-		}
-		sort.Strings(hosts)
-		i.logger.InfoV(2, "updating %d host(s): %v", len(hosts), hosts)
-	} else {
-		i.logger.InfoV(2, "updating %d hosts", len(hostsAdd))
-	}
-	backsAdd := i.config.Backends().ItemsAdd()
-	if len(backsAdd) < 100 {
-		backsDel := i.config.Backends().ItemsDel()
-		backs := make([]string, 0, len(backsAdd))
-		for back := range backsAdd {
-			backs = append(backs, back)
-		}
-		for back := range backsDel {
-			if _, found := backsAdd[back]; !found {
-				backs = append(backs, back)
-			}
-		}
-		sort.Strings(backs)
-		i.logger.InfoV(2, "updating %d backend(s): %v", len(backs), backs)
-	} else {
-		i.logger.InfoV(2, "updating %d backends", len(backsAdd))
-	}
+// writeConfigInfo has the number of files and bytes written by writeConfig,
+// as well as the backend shards that were rewritten.
+type writeConfigInfo struct {
+	files   int
+	bytes   int
+	changed int
+	shards  []int
 }
 
-func (i *instance) writeConfig() (err error) {
+func (i *instance) writeConfig() (info writeConfigInfo, err error) {
+	addStats := func(tmpl *template.Config) {
+		stats := tmpl.LastWriteStats()
+		info.files += stats.Files
+		info.bytes += stats.Bytes
+		info.changed += stats.Changed
+		for _, err := range tmpl.LastRotateErrors() {
+			i.logger.Warn("error rotating old config files, the new config was written: %v", err)
+			i.metrics.IncConfigRotateError()
+		}
+	}
 	//
-	// modsec template execution
+	// modsec template execution, skipped if neither the modsec config nor
+	// the templates changed since the last successful execution
 	//
-	err = i.modsecTmpl.Write(i.config)
-	if err != nil {
-		return err
+	if !i.modsecWritten || i.templatesChanged || i.config.(*config).modsecChanged() {
+		i.modsecWritten = false
+		err = i.modsecTmpl.Write(modsecTemplateData{Config: i.config})
+		if err != nil {
+			return info, err
+		}
+		addStats(i.modsecTmpl)
+		groupFiles := make(map[string]bool, len(i.config.Global().ModSecurity.Groups))
+		for _, group := range i.config.Global().ModSecurity.Groups {
+			output := fmt.Sprintf("%s/spoe-modsecurity-%s.conf", i.options.HAProxyCfgDir, group.Name)
+			err = i.modsecTmpl.WriteOutput(modsecTemplateData{Config: i.config, Group: group}, output)
+			if err != nil {
+				return info, err
+			}
+			addStats(i.modsecTmpl)
+			groupFiles[output] = true
+		}
+		// removing the SPOE config of the groups that don't exist anymore,
+		// files that cannot be removed are tracked and tried again later
+		for output := range i.modsecGroupFiles {
+			if groupFiles[output] {
+				continue
+			}
+			if err := i.options.Filesystem.Remove(output); err != nil && !os.IsNotExist(err) {
+				i.logger.Warn("error removing modsecurity config of a removed group: %v", err)
+				groupFiles[output] = true
+			} else {
+				i.modsecTmpl.ForgetOutputs(output)
+			}
+		}
+		i.modsecGroupFiles = groupFiles
+		i.modsecWritten = true
 	}
 	//
 	// custom responses template execution, raw HTTP HAProxy based
@@ -476,109 +1912,438 @@ func (i *instance) writeConfig() (err error) {
 		err = i.haResponseTmpl.WriteOutput(
 			response, fmt.Sprintf("%s/errorfiles/%s.http", i.options.HAProxyCfgDir, response.Name))
 		if err != nil {
-			return err
+			return info, err
 		}
+		addStats(i.haResponseTmpl)
 	}
 	//
 	// custom responses template execution, Lua script based
 	//
 	err = i.luaResponseTmpl.Write(i.config.Global().CustomHTTPLuaResponses)
 	if err != nil {
-		return err
+		return info, err
 	}
+	addStats(i.luaResponseTmpl)
 	//
 	// haproxy template execution
 	//
-	//   a single template is used to generate all haproxy cfg files
-	//   of a multi-file configuration. `datatype` is the root type
-	//   that the template recognizes, which will behave accordingly
-	//   to the filled/ignored attributes.
-	//
-	type datatype struct {
-		Cfg      Config
-		Global   *hatypes.Global
-		Backends []*hatypes.Backend
-	}
 	// main cfg -- fills the .Cfg attribute
-	err = i.haproxyTmpl.Write(datatype{Cfg: i.config})
+	err = i.haproxyTmpl.Write(haproxyTemplateData{Cfg: i.config})
 	if err != nil {
-		return err
+		return info, err
 	}
+	addStats(i.haproxyTmpl)
+	i.checkConfigSize(i.haproxyTmpl.LastWriteStats().Bytes)
+	i.rendered.main = i.haproxyTmpl.LastOutput()
+	i.snapshotStale = true
 	// backend shards -- fills the .Global and .Backends attributes
 	if i.options.BackendShards > 0 {
 		shards := i.config.Backends().ChangedShards()
-		if len(shards) > 0 {
-			strshards := make([]string, len(shards))
-			for n, j := range shards {
-				str := fmt.Sprintf("%03d", j)
-				configFile := filepath.Join(i.options.HAProxyCfgDir, "haproxy5-backend"+str+".cfg")
-				if err = i.haproxyTmpl.WriteOutput(datatype{
-					Global:   i.config.Global(),
-					Backends: i.config.Backends().BuildSortedShard(j),
-				}, configFile); err != nil {
-					return err
-				}
-				strshards[n] = str
+		i.metrics.AddChangedShards(len(shards))
+		for _, j := range shards {
+			configFile := filepath.Join(i.options.HAProxyCfgDir, fmt.Sprintf("haproxy5-backend%s.cfg", shardNumber(j, i.options.BackendShards)))
+			backends := i.config.Backends().BuildSortedShard(j)
+			if err = i.haproxyTmpl.WriteOutput(haproxyTemplateData{
+				Global:   i.config.Global(),
+				Backends: backends,
+			}, configFile); err != nil {
+				return info, err
+			}
+			addStats(i.haproxyTmpl)
+			if len(backends) > 0 {
+				i.rendered.setShard(j, i.haproxyTmpl.LastOutput())
+			} else {
+				i.rendered.setShard(j, nil)
 			}
-			i.logger.InfoV(2, "updated main cfg and %d backend file(s): %v", len(strshards), strshards)
+			info.shards = append(info.shards, j)
 		}
 	}
-	return err
+	return info, nil
+}
+
+// checkConfigSize exports the size of the main cfg, and warns when it crosses
+// ConfigSizeWarnThreshold. The warning is logged again only after the size
+// goes back below the threshold. Large config files slow down reloads and
+// validations, and backend shards move the backends to distinct files.
+func (i *instance) checkConfigSize(bytes int) {
+	i.metrics.SetConfigBytes(bytes)
+	threshold := i.options.ConfigSizeWarnThreshold
+	exceeded := threshold > 0 && bytes > threshold
+	warn := exceeded && !i.cfgSizeExceeded
+	i.cfgSizeExceeded = exceeded
+	if !warn {
+		return
+	}
+	hint := "consider configuring backend shards"
+	if i.options.BackendShards > 0 {
+		hint = "consider increasing the number of backend shards"
+	}
+	i.logger.Warn("haproxy config file has %d bytes, threshold is %d, %s", bytes, threshold, hint)
+}
+
+// shardNumber formats the index of a backend shard with at least three
+// digits, and as much digits as needed by the highest index, so the names
+// of all the shard files have the same length.
+func shardNumber(shard, shards int) string {
+	width := len(strconv.Itoa(shards - 1))
+	if width < 3 {
+		width = 3
+	}
+	return fmt.Sprintf("%0*d", width, shard)
 }
 
 func (i *instance) updateSuccessful(success bool) {
+	i.healthMutex.Lock()
+	defer i.healthMutex.Unlock()
 	if success {
 		i.failedSince = nil
 	} else if i.failedSince == nil {
-		now := time.Now()
+		now := i.options.Clock.Now()
 		i.failedSince = &now
 	}
 	i.metrics.UpdateSuccessful(success)
+	i.setReloadFailing()
+}
+
+// setLastSuccessfulApply exports the time of the last configuration update
+// that was fully applied to haproxy. Differently from the reload failing time,
+// it does not move if the update pipeline fails before haproxy is updated,
+// e.g. on map or config file write errors.
+func (i *instance) setLastSuccessfulApply() {
+	i.metrics.SetLastSuccessfulApply(i.options.Clock.Now())
+}
+
+// setReloadFailing exports for how long haproxy is failing to reload. Should
+// be called with healthMutex held.
+func (i *instance) setReloadFailing() {
+	var failing time.Duration
+	if i.failedSince != nil {
+		failing = i.options.Clock.Now().Sub(*i.failedSince)
+	}
+	i.metrics.SetReloadFailingSeconds(failing.Seconds())
+}
+
+// hostCert is the certificate used by a host, tracked by updateCertExpiring
+// in order to build the aggregated certificate metrics.
+type hostCert struct {
+	hash       string
+	commonName string
+	notAfter   time.Time
 }
 
 func (i *instance) updateCertExpiring() {
 	hostsAdd := i.config.Hosts().ItemsAdd()
 	hostsDel := i.config.Hosts().ItemsDel()
-	if !i.config.Hosts().HasCommit() {
-		// TODO the time between this reset and finishing to repopulate the gauge would lead
-		// to incomplete data scraped by Prometheus. This however happens only when a full parsing
-		// happens - edit globals, edit default crt, invalid data coming from lister events
-		i.metrics.ClearCertExpire()
-	}
-	for hostname, oldHost := range hostsDel {
-		if oldHost.TLS.HasTLS() {
-			curHost, found := hostsAdd[hostname]
-			if !found || oldHost.TLS.TLSCommonName != curHost.TLS.TLSCommonName {
-				i.metrics.SetCertExpireDate(hostname, oldHost.TLS.TLSCommonName, nil)
+	if !i.config.Hosts().HasCommit() || i.hostCerts == nil {
+		// full parsing - edit globals, edit default crt, invalid data coming from lister
+		// events. The whole set is replaced at once, so a scrape never sees it incomplete
+		i.hostCerts = map[string]hostCert{}
+		var certs []types.CertExpire
+		for hostname, curHost := range hostsAdd {
+			if curHost.TLS.HasTLS() {
+				i.hostCerts[hostname] = hostCert{hash: curHost.TLS.TLSHash, commonName: curHost.TLS.TLSCommonName, notAfter: curHost.TLS.TLSNotAfter}
+				certs = append(certs, types.CertExpire{
+					Domain:   hostname,
+					CN:       curHost.TLS.TLSCommonName,
+					Labels:   curHost.TLS.Labels,
+					NotAfter: curHost.TLS.TLSNotAfter,
+				})
 			}
 		}
-	}
-	for hostname, curHost := range hostsAdd {
-		if curHost.TLS.HasTLS() {
-			oldHost, found := hostsDel[hostname]
-			if !found || oldHost.TLS.TLSCommonName != curHost.TLS.TLSCommonName || oldHost.TLS.TLSNotAfter != curHost.TLS.TLSNotAfter {
-				i.metrics.SetCertExpireDate(hostname, curHost.TLS.TLSCommonName, &curHost.TLS.TLSNotAfter)
+		i.metrics.ReplaceCertExpire(certs)
+	} else {
+		for hostname, oldHost := range hostsDel {
+			delete(i.hostCerts, hostname)
+			if oldHost.TLS.HasTLS() {
+				curHost, found := hostsAdd[hostname]
+				if !found || oldHost.TLS.TLSCommonName != curHost.TLS.TLSCommonName {
+					i.metrics.SetCertExpireDate(hostname, oldHost.TLS.TLSCommonName, nil, nil)
+				}
+			}
+		}
+		for hostname, curHost := range hostsAdd {
+			if curHost.TLS.HasTLS() {
+				i.hostCerts[hostname] = hostCert{hash: curHost.TLS.TLSHash, commonName: curHost.TLS.TLSCommonName, notAfter: curHost.TLS.TLSNotAfter}
+				oldHost, found := hostsDel[hostname]
+				if !found || oldHost.TLS.TLSCommonName != curHost.TLS.TLSCommonName || oldHost.TLS.TLSNotAfter != curHost.TLS.TLSNotAfter ||
+					!reflect.DeepEqual(oldHost.TLS.Labels, curHost.TLS.Labels) {
+					i.metrics.SetCertExpireDate(hostname, curHost.TLS.TLSCommonName, curHost.TLS.Labels, &curHost.TLS.TLSNotAfter)
+				}
 			}
 		}
 	}
+	count, nextExpiry := i.certsSummary()
+	i.metrics.SetManagedCertCount(count)
+	i.metrics.SetNextCertExpiry(nextExpiry)
+	i.checkCertsExpiring()
+}
+
+// defaultCertExpiringThreshold is the time before the certificate expiration
+// that the OnCertExpiring hook is called, if CertExpiringThreshold isn't
+// configured.
+const defaultCertExpiringThreshold = 30 * 24 * time.Hour
+
+// certExpiring is a certificate that crossed the expiring threshold, waiting
+// to be notified to the OnCertExpiring hook.
+type certExpiring struct {
+	host       string
+	commonName string
+	notAfter   time.Time
+}
+
+// checkCertsExpiring enqueues the certificates that crossed the expiring
+// threshold, which are notified by notifyReload(). A certificate is notified
+// just once, a new certificate of the same host is notified again when it
+// also crosses the threshold.
+func (i *instance) checkCertsExpiring() {
+	if i.options.OnCertExpiring == nil {
+		return
+	}
+	threshold := i.options.CertExpiringThreshold
+	if threshold <= 0 {
+		threshold = defaultCertExpiringThreshold
+	}
+	limit := i.options.Clock.Now().Add(threshold)
+	notified := make(map[string]time.Time, len(i.certsNotified))
+	var certs []certExpiring
+	for hostname, cert := range i.hostCerts {
+		if cert.notAfter.IsZero() || cert.notAfter.After(limit) {
+			continue
+		}
+		if notAfter, found := i.certsNotified[hostname]; !found || !notAfter.Equal(cert.notAfter) {
+			certs = append(certs, certExpiring{
+				host:       hostname,
+				commonName: cert.commonName,
+				notAfter:   cert.notAfter,
+			})
+		}
+		notified[hostname] = cert.notAfter
+	}
+	sort.Slice(certs, func(j, k int) bool {
+		return certs[j].host < certs[k].host
+	})
+	i.certsNotified = notified
+	i.certsExpiring = append(i.certsExpiring, certs...)
 }
 
+// certsSummary returns the number of distinct certificates used by the hosts,
+// and the soonest expiration date among them.
+func (i *instance) certsSummary() (count int, nextExpiry time.Time) {
+	certs := make(map[string]struct{}, len(i.hostCerts))
+	for _, cert := range i.hostCerts {
+		certs[cert.hash] = struct{}{}
+		if nextExpiry.IsZero() || cert.notAfter.Before(nextExpiry) {
+			nextExpiry = cert.notAfter
+		}
+	}
+	return len(certs), nextExpiry
+}
+
+var errValidationNotSupported = errors.New("config validation is not supported")
+
 func (i *instance) check() error {
 	if i.options.fake {
 		i.logger.Info("(test) check was skipped")
 		return nil
 	}
+	var err error
 	if i.options.IsExternal {
-		// TODO check config on remote haproxy
+		err = i.checkExternal()
 	} else {
-		// TODO Move all magic strings to a single place
-		out, err := exec.Command("haproxy", "-c", "-f", i.options.HAProxyCfgDir).CombinedOutput()
-		outstr := string(out)
+		err = i.checkLocal()
+	}
+	if err == nil {
+		i.checkShards = map[int]bool{}
+	}
+	return err
+}
+
+func (i *instance) checkLocal() error {
+	files, err := i.checkFiles()
+	if err != nil {
+		return err
+	}
+	args := []string{"-c"}
+	if len(files) == 0 {
+		args = append(args, "-f", i.options.HAProxyCfgDir)
+	}
+	for _, file := range files {
+		args = append(args, "-f", file)
+	}
+	out, err := exec.Command(i.options.HAProxyBinary, args...).CombinedOutput()
+	if err != nil {
+		return newValidationError(string(out))
+	}
+	return nil
+}
+
+var backendRefRegex = regexp.MustCompile(`(?m)^\s*(?:use_backend|default_backend)\s+([^\s%]+)`)
+
+// checkFiles lists the config files that should be validated if
+// ValidateChangedFiles is enabled: the main cfg, the backend shards changed
+// since the last successful validation, and the shards with backends that
+// the main cfg references by name. An empty list means that the whole
+// config dir should be validated.
+func (i *instance) checkFiles() ([]string, error) {
+	if !i.options.ValidateChangedFiles || i.options.BackendShards == 0 || i.checkShards == nil {
+		return nil, nil
+	}
+	shards := make(map[int]bool, len(i.checkShards))
+	for j := range i.checkShards {
+		shards[j] = true
+	}
+	mainCfg := filepath.Join(i.options.HAProxyCfgDir, "haproxy.cfg")
+	cfg, err := i.options.Filesystem.ReadFile(mainCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error reading main cfg: %w", err)
+	}
+	for _, ref := range backendRefRegex.FindAllStringSubmatch(string(cfg), -1) {
+		if j, found := i.config.Backends().BackendShard(ref[1]); found {
+			shards[j] = true
+		}
+	}
+	if len(shards) >= i.options.BackendShards {
+		return nil, nil
+	}
+	files := []string{mainCfg}
+	for j := 0; j < i.options.BackendShards; j++ {
+		if !shards[j] {
+			continue
+		}
+		shardFile := filepath.Join(i.options.HAProxyCfgDir, fmt.Sprintf("haproxy5-backend%s.cfg", shardNumber(j, i.options.BackendShards)))
+		if _, err := i.options.Filesystem.Stat(shardFile); err == nil {
+			files = append(files, shardFile)
+		}
+	}
+	return files, nil
+}
+
+var (
+	localVersionRegex   = regexp.MustCompile(`version ([0-9]+\.[0-9]+[^ \n]*)`)
+	versionNumbersRegex = regexp.MustCompile(`^([0-9]+)\.([0-9]+)`)
+)
+
+// HAProxyVersion returns the version of the running haproxy, e.g. 2.6.12,
+// or an empty string if the version wasn't detected yet. The version is
+// detected after the first successful reload, and is used to skip features
+// that the running haproxy does not support. The version of an external
+// haproxy is refreshed after every successful reload, since it can be
+// upgraded independently of the controller.
+func (i *instance) HAProxyVersion() string {
+	i.healthMutex.Lock()
+	defer i.healthMutex.Unlock()
+	return i.haproxyVersion
+}
+
+// detectHAProxyVersion reads the haproxy version from the master CLI if
+// haproxy is external, or from the haproxy binary if it is embedded. A
+// failure is logged and the detection is tried again on the next reload.
+func (i *instance) detectHAProxyVersion() {
+	version, err := i.readHAProxyVersion()
+	current := i.HAProxyVersion()
+	if err != nil {
+		if current == "" {
+			i.logger.Warn("cannot detect the haproxy version, version dependent features are enabled: %v", err)
+		} else {
+			i.logger.Warn("cannot refresh the haproxy version, using %s: %v", current, err)
+		}
+		return
+	}
+	if version == current {
+		return
+	}
+	i.healthMutex.Lock()
+	i.haproxyVersion = version
+	i.healthMutex.Unlock()
+	i.loggerFor(LogSubsystemReload).InfoV(2, "haproxy version: %s", version)
+}
+
+func (i *instance) readHAProxyVersion() (string, error) {
+	if i.options.IsExternal {
+		procs, err := socket.HAProxyProcs(i.conns.Master())
 		if err != nil {
-			return fmt.Errorf(outstr)
+			return "", fmt.Errorf("error reading external haproxy version: %w", err)
+		}
+		if procs.Master.Version == "" {
+			return "", fmt.Errorf("external haproxy master did not report its version")
 		}
+		return procs.Master.Version, nil
 	}
-	return nil
+	return i.localHAProxyVersion()
+}
+
+// localHAProxyVersion reads the version of the local haproxy binary. The
+// binary doesn't change while the controller is running, so it is read
+// just once.
+func (i *instance) localHAProxyVersion() (string, error) {
+	if i.localVersion != "" {
+		return i.localVersion, nil
+	}
+	out, err := exec.Command(i.options.HAProxyBinary, "-v").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot read the local haproxy version: %w", err)
+	}
+	match := localVersionRegex.FindStringSubmatch(string(out))
+	if len(match) < 2 {
+		return "", fmt.Errorf("cannot find the version in the haproxy -v output: %s", strings.TrimSpace(string(out)))
+	}
+	i.localVersion = match[1]
+	return i.localVersion, nil
+}
+
+// haproxyVersionAtLeast returns true if the running haproxy version is
+// major.minor or newer. An unknown version returns true as well, so haproxy
+// itself reports an unsupported feature.
+func (i *instance) haproxyVersionAtLeast(major, minor int) bool {
+	version := i.HAProxyVersion()
+	if version == "" {
+		return true
+	}
+	return versionAtLeast(version, major, minor)
+}
+
+// versionAtLeast returns true if version, e.g. 2.6.12, is major.minor or
+// newer. Versions that cannot be parsed return false.
+func versionAtLeast(version string, major, minor int) bool {
+	match := versionNumbersRegex.FindStringSubmatch(version)
+	if len(match) < 3 {
+		return false
+	}
+	vmajor, _ := strconv.Atoi(match[1])
+	vminor, _ := strconv.Atoi(match[2])
+	return vmajor > major || (vmajor == major && vminor >= minor)
+}
+
+// checkExternal validates the configuration files using the local haproxy
+// binary, since the master CLI doesn't have a command to validate a
+// configuration. The validation only happens if the local and the external
+// haproxy share the same major.minor version, errValidationNotSupported is
+// returned otherwise.
+func (i *instance) checkExternal() error {
+	if i.HAProxyVersion() == "" {
+		// validation before the first reload
+		i.detectHAProxyVersion()
+	}
+	extVersion := i.HAProxyVersion()
+	if extVersion == "" {
+		return fmt.Errorf("%w: external haproxy version is unknown", errValidationNotSupported)
+	}
+	localVersion, err := i.localHAProxyVersion()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errValidationNotSupported, err)
+	}
+	if !sameMajorMinor(extVersion, localVersion) {
+		return fmt.Errorf("%w: external haproxy version '%s' does not match the local version '%s'",
+			errValidationNotSupported, extVersion, localVersion)
+	}
+	return i.checkLocal()
+}
+
+// sameMajorMinor returns true if both versions, e.g. 2.6.12 and 2.6.1, share
+// the same major.minor. Versions that cannot be parsed return false.
+func sameMajorMinor(v1, v2 string) bool {
+	m1 := versionNumbersRegex.FindString(v1)
+	return m1 != "" && m1 == versionNumbersRegex.FindString(v2)
 }
 
 func (i *instance) reloadHAProxy() error {
@@ -594,24 +2359,134 @@ func (i *instance) reloadHAProxy() error {
 	return i.reloadEmbeddedDaemon()
 }
 
+// errReloadCancelled is returned by the reload script if the controller is
+// stopping, in which case a fallback reload strategy should not be tried.
+var errReloadCancelled = errors.New("reload script cancelled, controller is stopping")
+
+// reloadEmbeddedDaemon reloads haproxy with ReloadStrategy, retrying with
+// the strategies of ReloadStrategyFallback, in order, while the reload
+// fails. Every attempt has its own ReloadTimeout.
 func (i *instance) reloadEmbeddedDaemon() error {
+	strategies := []string{i.options.ReloadStrategy}
+	tried := map[string]bool{i.options.ReloadStrategy: true}
+	for _, strategy := range i.options.ReloadStrategyFallback {
+		if !tried[strategy] {
+			strategies = append(strategies, strategy)
+			tried[strategy] = true
+		}
+	}
+	var err error
+	for j, strategy := range strategies {
+		if j > 0 {
+			i.logger.Warn("haproxy reload failed using the %s reload strategy, falling back to %s: %v", strategies[j-1], strategy, err)
+			i.metrics.IncReloadStrategyFallback(strategy)
+		}
+		i.reloadStrategy = strategy
+		err = i.reloadEmbeddedStrategy(strategy)
+		if err == nil || errors.Is(err, errReloadCancelled) {
+			return err
+		}
+	}
+	return err
+}
+
+func (i *instance) reloadEmbeddedStrategy(strategy string) error {
 	state := "0"
 	if i.config.Global().LoadServerState {
 		state = "1"
 	}
-	// TODO Move all magic strings to a single place
-	out, err := exec.Command(
-		i.options.RootFSPrefix+"/haproxy-reload.sh",
-		i.options.ReloadStrategy,
+	// old workers still running after the drain timeout are stopped by the
+	// reload script, since the hard-stop-after of the old workers' config
+	// would not apply a just changed drain timeout.
+	drain := "0"
+	if i.options.WorkerDrainTimeout > 0 {
+		drain = strconv.FormatInt(int64((i.options.WorkerDrainTimeout+time.Second-1)/time.Second), 10)
+	}
+	ctx, cancel := i.reloadContext()
+	defer cancel()
+	cmd := exec.CommandContext(
+		ctx,
+		i.options.ReloadScript,
+		strategy,
 		i.options.HAProxyCfgDir,
 		i.options.LocalFSPrefix,
 		state,
-	).CombinedOutput()
-	outstr := string(out)
-	if len(outstr) > 0 {
-		i.logger.Warn("output from haproxy:\n%v", outstr)
+		drain,
+	)
+	type result struct {
+		out []byte
+		err error
 	}
-	return err
+	done := make(chan result, 1)
+	go func() {
+		out, err := cmd.CombinedOutput()
+		done <- result{out: out, err: err}
+	}()
+	select {
+	case r := <-done:
+		outstr := string(r.out)
+		if r.err != nil {
+			i.metrics.IncReloadScriptError()
+			if len(outstr) > 0 {
+				i.logger.Error("output from haproxy:\n%v", outstr)
+			}
+			return r.err
+		}
+		if hasReloadWarnings(outstr) {
+			i.metrics.IncReloadScriptWarning()
+			i.logger.Warn("output from haproxy:\n%v", outstr)
+		} else if len(outstr) > 0 {
+			i.logger.Info("output from haproxy:\n%v", outstr)
+		}
+		if strategy != "native" {
+			i.checkSocketReuse(outstr)
+		}
+		return nil
+	case <-ctx.Done():
+		// the script is killed by the context, but its output can still be
+		// held by child processes, so the output isn't waited here.
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			i.metrics.IncReloadScriptError()
+			return fmt.Errorf("reload script timed out after %s", i.options.ReloadTimeout)
+		}
+		return errReloadCancelled
+	}
+}
+
+// reloadWarningMarkers are the prefixes haproxy uses on messages that
+// should be reviewed, even if the reload succeeded.
+var reloadWarningMarkers = []string{"[WARNING]", "[ALERT]"}
+
+// hasReloadWarnings reports if the output of a successful reload script
+// has warnings, instead of only informational messages.
+func hasReloadWarnings(output string) bool {
+	for _, marker := range reloadWarningMarkers {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadContext returns the context used by the reload script, which is
+// cancelled either when ReloadTimeout expires, or when the controller is
+// stopping.
+func (i *instance) reloadContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if i.options.ReloadTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), i.options.ReloadTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	go func() {
+		select {
+		case <-i.options.StopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
 func (i *instance) reloadEmbeddedMasterWorker() error {
@@ -633,7 +2508,7 @@ func (i *instance) reloadEmbeddedMasterWorker() error {
 
 func (i *instance) startHAProxySync() {
 	cmd := exec.Command(
-		"haproxy",
+		i.options.HAProxyBinary,
 		"-W",
 		"-S", i.options.MasterSocket+",mode,600",
 		"-f", i.options.HAProxyCfgDir)
@@ -673,10 +2548,105 @@ func (i *instance) reloadExternal() error {
 			return err
 		}
 	}
+	var workers map[int]bool
+	confirm := i.options.ExternalReloadConfirmTimeout > 0
+	if confirm {
+		procs, err := socket.ReadHAProxyProcs(i.conns.Master())
+		if err != nil {
+			i.logger.Warn("cannot read procs before reload, new worker will not be confirmed: %v", err)
+			confirm = false
+		} else {
+			workers = workerPIDs(procs)
+		}
+	}
 	if err := i.reloadWorker(); err != nil {
 		return err
 	}
-	return i.waitWorker()
+	if err := i.waitWorker(); err != nil {
+		return err
+	}
+	if confirm {
+		if err := i.confirmNewWorker(i.conns.Master(), workers); err != nil {
+			return err
+		}
+	}
+	if i.options.ReloadStrategy != "native" && i.haproxyVersionAtLeast(2, 2) {
+		// startup logs are only available on the master CLI since haproxy 2.2,
+		// older versions have the check skipped.
+		out, err := i.conns.Master().Send(nil, "show startup-logs")
+		if err != nil {
+			i.loggerFor(LogSubsystemReload).InfoV(2, "cannot read haproxy startup logs, skipping socket reuse check: %v", err)
+		} else {
+			i.checkSocketReuse(strings.Join(out, "\n"))
+		}
+	}
+	return nil
+}
+
+// socketReuseFailureMarkers are the messages haproxy logs on startup if the
+// new worker could not receive the listening sockets from the old one. The
+// new worker binds the ports again, and connections might be dropped during
+// the reload.
+var socketReuseFailureMarkers = []string{
+	"Failed to connect to the old process socket",
+	"Failed to get the number of sockets to be transferred",
+	"Failed to get the sockets from the old process",
+}
+
+// checkSocketReuse warns if the haproxy startup output has a socket reuse
+// failure. Such failures do not fail the reload, so reloads would silently
+// drop connections.
+func (i *instance) checkSocketReuse(output string) {
+	for _, line := range strings.Split(output, "\n") {
+		for _, marker := range socketReuseFailureMarkers {
+			if strings.Contains(line, marker) {
+				i.logger.Warn("new haproxy worker did not reuse the listening sockets, connections might be dropped on reloads: %s", strings.TrimSpace(line))
+				i.metrics.IncReloadSocketsNotReused()
+				return
+			}
+		}
+	}
+}
+
+// defaultExternalPollInterval is the time between two attempts to confirm
+// that a new worker is running after a reload, if ExternalPollInterval isn't
+// configured, see confirmNewWorker().
+const defaultExternalPollInterval = 100 * time.Millisecond
+
+// confirmNewWorker polls the master CLI until a worker not listed in the
+// workers before the reload is running, or ExternalReloadConfirmTimeout
+// expires. A new worker is only listed by the master after it successfully
+// started, so the new configuration is being used to serve the traffic.
+func (i *instance) confirmNewWorker(masterSock socket.HAProxySocket, workers map[int]bool) error {
+	timeout := i.options.ExternalReloadConfirmTimeout
+	deadline := i.options.Clock.Now().Add(timeout)
+	for {
+		procs, err := socket.ReadHAProxyProcs(masterSock)
+		if err == nil {
+			for pid := range workerPIDs(procs) {
+				if !workers[pid] {
+					return nil
+				}
+			}
+		}
+		if i.options.Clock.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("new haproxy worker was not confirmed after %s: %w", timeout, err)
+			}
+			return fmt.Errorf("new haproxy worker was not confirmed after %s", timeout)
+		}
+		<-i.options.Clock.After(i.options.ExternalPollInterval)
+	}
+}
+
+func workerPIDs(procs *socket.ProcTable) map[int]bool {
+	pids := make(map[int]bool, len(procs.Workers))
+	for _, proc := range procs.Workers {
+		if proc.Type == "worker" {
+			pids[proc.PID] = true
+		}
+	}
+	return pids
 }
 
 func (i *instance) waitMaster() error {
@@ -697,7 +2667,7 @@ func (i *instance) waitMaster() error {
 			return err
 		case <-i.options.StopCh:
 			return fmt.Errorf("received sigterm")
-		case <-time.After(10 * time.Second):
+		case <-i.options.Clock.After(10 * time.Second):
 			i.logger.Info("... still waiting for the master socket '%s'", masterSock.Address())
 		}
 	}
@@ -706,13 +2676,51 @@ func (i *instance) waitMaster() error {
 func (i *instance) reloadWorker() error {
 	if i.config.Global().LoadServerState {
 		if err := i.persistServersState(); err != nil {
-			i.logger.Warn("failed to persist servers state before worker reload: %w", err)
+			i.logger.Warn("failed to persist servers state before worker reload: %v", err)
+			i.metrics.IncServerStatePersistError()
+		} else {
+			i.metrics.IncServerStatePersistSuccess()
 		}
 	}
-	if _, err := i.conns.Master().Send(nil, "reload"); err != nil {
-		return fmt.Errorf("error sending reload to master socket: %w", err)
+	return i.sendReload()
+}
+
+// Backoff of the first reload retry, doubled on every new attempt, see
+// InstanceOptions.ExternalReloadRetries.
+const (
+	externalReloadBackoff    = 100 * time.Millisecond
+	externalReloadMaxBackoff = 2 * time.Second
+)
+
+// sendReload sends the reload command to the master socket, retrying up to
+// ExternalReloadRetries times if the command wasn't sent, e.g. the master CLI
+// being busy with a former reload. Errors after the command was sent, like a
+// failure reading the response, aren't retried since haproxy might already be
+// reloading. A reload rejected by haproxy is not a socket error, and is
+// reported by waitWorker instead.
+func (i *instance) sendReload() error {
+	retries := i.options.ExternalReloadRetries
+	backoff := externalReloadBackoff
+	for attempt := 1; ; attempt++ {
+		_, err := i.conns.Master().Send(nil, "reload")
+		if err == nil {
+			return nil
+		}
+		var notSent *socket.NotSentError
+		if !errors.As(err, &notSent) || attempt > retries {
+			return fmt.Errorf("error sending reload to master socket: %w", err)
+		}
+		i.logger.Warn("error sending reload to master socket, retrying in %s (%d/%d): %v", backoff, attempt, retries, err)
+		select {
+		case <-i.options.StopCh:
+			return fmt.Errorf("error sending reload to master socket, retry cancelled: %w", err)
+		case <-i.options.Clock.After(backoff):
+		}
+		backoff *= 2
+		if backoff > externalReloadMaxBackoff {
+			backoff = externalReloadMaxBackoff
+		}
 	}
-	return nil
 }
 
 func (i *instance) waitWorker() error {
@@ -725,18 +2733,93 @@ func (i *instance) waitWorker() error {
 		// `out.Master.Failed > 0` => haproxy 2.5+
 		return fmt.Errorf("external haproxy was not successfully reloaded")
 	}
+	i.checkOldWorkers(out)
 	return nil
 }
 
+// checkOldWorkers tracks the number of old workers still running, usually
+// due to long lived connections that weren't closed after a reload.
+func (i *instance) checkOldWorkers(procs *socket.ProcTable) {
+	oldWorkers := 0
+	for _, proc := range procs.OldWorkers {
+		// `# programs` are listed after `# old workers` as well
+		if proc.Type == "worker" {
+			oldWorkers++
+		}
+	}
+	i.metrics.SetOldWorkers(oldWorkers)
+	threshold := i.options.OldWorkersWarnThreshold
+	if threshold > 0 && oldWorkers > threshold {
+		i.logger.Warn("%d old haproxy workers are still running, threshold is %d", oldWorkers, threshold)
+	}
+}
+
 func (i *instance) retrieveServersState() (string, error) {
-	state, err := i.conns.Admin().Send(nil, "show servers state")
+	state, err := i.conns.Stats().Send(nil, "show servers state")
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve servers state from external haproxy; %w", err)
 	}
+	if err := validateServersState(state[0]); err != nil {
+		return "", err
+	}
+	if missing := missingServersStateFields(state[0]); len(missing) > 0 {
+		i.logger.Warn("servers state from external haproxy is missing the fields %v, health check state of the servers won't be fully restored after the reload", missing)
+	}
 
 	return state[0], nil
 }
 
+// serversStateVersion is the format version of the servers state file that
+// haproxy is able to load. The version is declared in the first line of the
+// show servers state command output.
+const serversStateVersion = "1"
+
+// validateServersState checks the version header of the servers state, so a
+// state file that haproxy wouldn't load after the reload isn't persisted.
+func validateServersState(state string) error {
+	version, _, _ := strings.Cut(state, "\n")
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return fmt.Errorf("servers state from external haproxy does not have a version header")
+	}
+	if version != serversStateVersion {
+		return fmt.Errorf("unsupported servers state version '%s', expected version '%s'", version, serversStateVersion)
+	}
+	return nil
+}
+
+// serversStateCheckFields are the fields of the servers state used by haproxy
+// to restore the operational and health check state of the servers after a
+// reload. Servers are considered up until their first health check without
+// these fields.
+var serversStateCheckFields = []string{
+	"srv_op_state",
+	"srv_check_status",
+	"srv_check_result",
+	"srv_check_health",
+	"srv_check_state",
+	"srv_agent_state",
+}
+
+// missingServersStateFields returns the health check related fields missing
+// in the fields header of the servers state. The header is the commented
+// line just after the version header.
+func missingServersStateFields(state string) []string {
+	_, state, _ = strings.Cut(state, "\n")
+	header, _, _ := strings.Cut(state, "\n")
+	fields := map[string]bool{}
+	for _, field := range strings.Fields(strings.TrimPrefix(header, "#")) {
+		fields[field] = true
+	}
+	var missing []string
+	for _, field := range serversStateCheckFields {
+		if !fields[field] {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
 func (i *instance) persistServersState() error {
 	state, err := i.retrieveServersState()
 	if err != nil {
@@ -744,9 +2827,50 @@ func (i *instance) persistServersState() error {
 	}
 
 	stateFilePath := filepath.Join(i.config.Global().LocalFSPrefix, "/var/lib/haproxy/state-global")
-	if err := os.WriteFile(stateFilePath, []byte(state), 0o644); err != nil {
+	mode := i.options.ServerStateFileMode
+	if err := os.WriteFile(stateFilePath, []byte(state), mode); err != nil {
 		return fmt.Errorf("failed to persist servers state to file '%s': %w", stateFilePath, err)
 	}
+	// WriteFile only applies the mode, masked by the umask, when creating the file
+	if err := os.Chmod(stateFilePath, mode); err != nil {
+		return fmt.Errorf("failed to change the mode of the servers state file '%s': %w", stateFilePath, err)
+	}
+	if i.options.ServerStateFileChown {
+		security := i.config.Global().Security
+		if err := chownServersState(stateFilePath, security.Username, security.Groupname); err != nil {
+			// haproxy is still able to read the state if the mode allows,
+			// so the state is kept and the failure is just reported.
+			i.logger.Warn("cannot change the owner of the servers state file: %v", err)
+		}
+	}
 
 	return nil
 }
+
+// chownServersState changes the owner and the group of the servers state file
+// to the haproxy user and group. Empty names leave the related id unchanged.
+func chownServersState(stateFilePath, username, groupname string) error {
+	uid, gid := -1, -1
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return fmt.Errorf("invalid uid of user '%s': %w", username, err)
+		}
+	}
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return fmt.Errorf("invalid gid of group '%s': %w", groupname, err)
+		}
+	}
+	if uid < 0 && gid < 0 {
+		return nil
+	}
+	return os.Chown(stateFilePath, uid, gid)
+}
@@ -17,17 +17,26 @@ limitations under the License.
 package haproxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/user"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/kylelemons/godebug/diff"
 	yaml "gopkg.in/yaml.v2"
 
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/acme"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/socket"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/template"
 	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/types/helper_test"
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
@@ -1458,7 +1467,7 @@ backend _error404
 `)
 	c.logger.CompareLogging(`
 INFO (test) reload was skipped
-INFO haproxy successfully reloaded (external)`)
+INFO haproxy successfully reloaded (external) reload_reason="first run"`)
 }
 
 func TestPathIDsSplit(t *testing.T) {
@@ -4963,177 +4972,3594 @@ backend d1_app_8080
 	}
 }
 
+func TestModSecurityGroups(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b *hatypes.Backend
+
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	b.FindBackendPath(h.FindPath("/")[0].Link).WAF = hatypes.WAF{Module: "modsecurity", Mode: "detect"}
+
+	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS21}
+	b.WAFGroup = "strict"
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	b.FindBackendPath(h.FindPath("/")[0].Link).WAF = hatypes.WAF{Module: "modsecurity", Mode: "detect"}
+
+	globalModsec := &c.config.Global().ModSecurity
+	globalModsec.Endpoints = []string{"10.0.0.101:12345"}
+	globalModsec.Groups = []*hatypes.ModSecurityGroup{
+		{Name: "strict", Endpoints: []string{"10.0.1.101:12345", "10.0.1.102:12345"}},
+	}
+	globalModsec.Timeout.Connect = "1s"
+	globalModsec.Timeout.Server = "2s"
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    filter spoe engine modsecurity config /etc/haproxy/spoe-modsecurity.conf
+    server s1 172.17.0.11:8080 weight 100
+backend d2_app_8080
+    mode http
+    filter spoe engine modsecurity config /etc/haproxy/spoe-modsecurity-strict.conf
+    server s21 172.17.0.121:8080 weight 100
+<<backends-default>>
+<<frontends-default>>
+<<support>>
+backend spoe-modsecurity
+    mode tcp
+    timeout connect 1s
+    timeout server  2s
+    server modsec-spoa0 10.0.0.101:12345
+backend spoe-modsecurity-strict
+    mode tcp
+    timeout connect 1s
+    timeout server  2s
+    server modsec-spoa0 10.0.1.101:12345
+    server modsec-spoa1 10.0.1.102:12345`)
+	c.containsText("spoe-modsecurity.conf", c.readConfig(c.tempdir+"/spoe-modsecurity.conf"), `
+    use-backend  spoe-modsecurity
+`)
+	c.containsText("spoe-modsecurity-strict.conf", c.readConfig(c.tempdir+"/spoe-modsecurity-strict.conf"), `
+    use-backend  spoe-modsecurity-strict
+`)
+	c.logger.CompareLogging(defaultLogging)
+
+	// config files of removed groups are removed as well
+	globalModsec.Groups = []*hatypes.ModSecurityGroup{
+		{Name: "lenient", Endpoints: []string{"10.0.2.101:12345"}},
+	}
+	c.Update()
+	if _, err := os.Stat(c.tempdir + "/spoe-modsecurity-strict.conf"); !os.IsNotExist(err) {
+		t.Errorf("expected spoe-modsecurity-strict.conf removed, but stat returned: %v", err)
+	}
+	c.containsText("spoe-modsecurity-lenient.conf", c.readConfig(c.tempdir+"/spoe-modsecurity-lenient.conf"), `
+    use-backend  spoe-modsecurity-lenient
+`)
+	c.logger.Logging = []string{}
+}
+
+func TestModSecuritySkipUnchanged(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.conns.dynUpdate = &clientMock{cmdOutput: []string{""}}
+
+	modsecFile := filepath.Join(c.tempdir, "spoe-modsecurity.conf")
+	apply := func(weight int, hello string) {
+		c.config.Hosts().RemoveAll([]string{"d1.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.AcquireEndpoint("172.17.0.11", 8080, "").Weight = weight
+		h := c.config.Hosts().AcquireHost("d1.local")
+		h.AddPath(b, "/", hatypes.MatchBegin)
+		b.FindBackendPath(h.FindPath("/")[0].Link).WAF = hatypes.WAF{Module: "modsecurity", Mode: "detect"}
+		globalModsec := &c.config.Global().ModSecurity
+		globalModsec.Endpoints = []string{"10.0.0.101:12345"}
+		globalModsec.Timeout.Hello = hello
+		c.Update()
+	}
+	modsecWritten := func() bool {
+		_, err := os.Stat(modsecFile)
+		return err == nil
+	}
+
+	apply(1, "1s")
+	if !modsecWritten() {
+		t.Fatalf("expected modsec config written on the first update")
+	}
+
+	// endpoint weight is dynamically updated, modsec config didn't change
+	os.Remove(modsecFile)
+	apply(50, "1s")
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' after a weight change, but was '%s'", UpdateDynamic, result)
+	}
+	if modsecWritten() {
+		t.Errorf("expected modsec config skipped on an endpoint weight change")
+	}
+
+	apply(50, "2s")
+	if !modsecWritten() {
+		t.Errorf("expected modsec config written after a modsec config change")
+	}
+	c.containsText("spoe-modsecurity.conf", c.readConfig(modsecFile), `
+    timeout      hello       2s
+`)
+	c.logger.Logging = []string{}
+}
+
 func TestInstanceWildcardHostname(t *testing.T) {
 	c := setup(t)
 	defer c.teardown()
 
-	var h *hatypes.Host
+	var h *hatypes.Host
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.TLSHash = "0"
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h = c.config.Hosts().AcquireHost("*.app.d1.local")
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.TLSHash = "0"
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h = c.config.Hosts().AcquireHost("*.sub.d1.local")
+	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
+	h.TLS.TLSHash = "0"
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.CAFilename = "/var/haproxy/ssl/ca/d1.local.pem"
+	h.TLS.CAHash = "1"
+	h.TLS.CAVerifyOptional = true
+	h.TLS.CAErrorPage = "http://sub.d1.local/error.html"
+	for _, path := range b.Paths {
+		path.SSLRedirect = true
+	}
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+
+	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
+	h = c.config.Hosts().AcquireHost("*.d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.RootRedirect = "/app"
+	b.Endpoints = []*hatypes.Endpoint{endpointS21}
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    acl https-request ssl_fc
+    acl local-offload ssl_fc
+    http-request redirect scheme https if !https-request
+    http-request set-header X-SSL-Client-CN   %{+Q}[ssl_c_s_dn(cn)]
+    http-request set-header X-SSL-Client-DN   %{+Q}[ssl_c_s_dn]
+    http-request set-header X-SSL-Client-SHA1 %{+Q}[ssl_c_sha1,hex]
+    server s1 172.17.0.11:8080 weight 100
+backend d2_app_8080
+    mode http
+    server s21 172.17.0.121:8080 weight 100
+<<backends-default>>
+frontend _front_http
+    mode http
+    bind :80
+    <<set-req-base>>
+    http-request set-var(req.rootredir) var(req.host),map_reg(/etc/haproxy/maps/_front_redir_fromroot__regex.map)
+    http-request redirect location %[var(req.rootredir)] if { path / } { var(req.rootredir) -m found }
+    <<http-headers>>
+    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
+    http-request set-var(req.backend) var(req.base),map_reg(/etc/haproxy/maps/_front_http_host__regex.map) if !{ var(req.backend) -m found }
+    use_backend %[var(req.backend)] if { var(req.backend) -m found }
+    default_backend _error404
+frontend _front_https
+    mode http
+    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
+    <<set-req-base>>
+    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
+    http-request set-var(req.hostbackend) var(req.base),map_reg(/etc/haproxy/maps/_front_https_host__regex.map) if !{ var(req.hostbackend) -m found }
+    http-request set-var(req.rootredir) var(req.host),map_reg(/etc/haproxy/maps/_front_redir_fromroot__regex.map)
+    http-request redirect location %[var(req.rootredir)] if { path / } { var(req.rootredir) -m found }
+    <<https-headers>>
+    acl tls-has-crt ssl_c_used
+    acl tls-has-invalid-crt ssl_c_verify gt 0
+    acl tls-check-crt ssl_fc_sni -i -m reg -f /etc/haproxy/maps/_front_tls_auth__regex.list
+    http-request set-var(req.snibase) ssl_fc_sni,lower,concat(\#,req.path)
+    http-request set-var(req.snibackend) var(req.snibase),map_reg(/etc/haproxy/maps/_front_https_sni__regex.map)
+    http-request set-var(req.snibackend) var(req.base),map_reg(/etc/haproxy/maps/_front_https_sni__regex.map) if !{ var(req.snibackend) -m found } !tls-has-crt
+    http-request set-var(req.tls_invalidcrt_redir) ssl_fc_sni,lower,map_reg(/etc/haproxy/maps/_front_tls_invalidcrt_pages__regex.map,_internal) if tls-has-invalid-crt tls-check-crt
+    http-request redirect location %[var(req.tls_invalidcrt_redir)] code 303 if { var(req.tls_invalidcrt_redir) -m found } !{ var(req.tls_invalidcrt_redir) -m str _internal }
+    http-request use-service lua.send-421 if tls-has-crt { ssl_fc_has_sni } !{ ssl_fc_sni,strcmp(req.host) eq 0 }
+    http-request use-service lua.send-495 if { var(req.tls_invalidcrt_redir) -m str _internal }
+    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
+    use_backend %[var(req.snibackend)] if { var(req.snibackend) -m found }
+    default_backend _error404
+<<support>>
+`)
+
+	c.checkMap("_front_http_host__begin.map", `
+d1.local#/ d1_app_8080
+`)
+	c.checkMap("_front_http_host__regex.map", `
+^[^.]+\.app\.d1\.local#/ d1_app_8080
+^[^.]+\.sub\.d1\.local#/ d1_app_8080
+^[^.]+\.d2\.local#/ d2_app_8080
+`)
+	c.checkMap("_front_redir_fromroot__regex.map", `
+^[^.]+\.d2\.local$ /app
+`)
+	c.checkMap("_front_https_host__begin.map", `
+d1.local#/ d1_app_8080
+`)
+	c.checkMap("_front_https_host__regex.map", `
+^[^.]+\.app\.d1\.local#/ d1_app_8080
+^[^.]+\.d2\.local#/ d2_app_8080
+`)
+	c.checkMap("_front_redir_fromroot__regex.map", `
+^[^.]+\.d2\.local$ /app
+`)
+	c.checkMap("_front_https_sni__regex.map", `
+^[^.]+\.sub\.d1\.local#/ d1_app_8080
+`)
+	c.checkMap("_front_tls_auth__regex.list", `
+^[^.]+\.sub\.d1\.local$
+`)
+	c.checkMap("_front_tls_invalidcrt_pages__regex.map", `
+^[^.]+\.sub\.d1\.local$ http://sub.d1.local/error.html
+`)
+
+	c.logger.CompareLogging(defaultLogging)
+}
+
+func TestShards(t *testing.T) {
+	c := setupOptions(testOptions{
+		t:          t,
+		shardCount: 3,
+	})
+	defer c.teardown()
+
+	var h *hatypes.Host
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS21}
+	h = c.config.Hosts().AcquireHost("d2.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	b = c.config.Backends().AcquireBackend("d3", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS31}
+	h = c.config.Hosts().AcquireHost("d3.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	c.Update()
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+<<backends-default>>
+<<frontends-default>>
+<<support>>
+`)
+
+	c.checkConfigFile(`
+backend d2_app_8080
+    mode http
+    server s21 172.17.0.121:8080 weight 100
+`, "haproxy5-backend000.cfg")
+
+	c.checkConfigFile(`
+backend d1_app_8080
+    mode http
+    server s1 172.17.0.11:8080 weight 100
+backend d3_app_8080
+    mode http
+    server s31 172.17.0.131:8080 weight 100
+`, "haproxy5-backend002.cfg")
+
+	// the written bytes are the size of the files rendered by the templates
+	var bytes int64
+	for _, file := range []string{"haproxy.cfg", "haproxy5-backend000.cfg", "haproxy5-backend002.cfg", "responses.lua", "spoe-modsecurity.conf"} {
+		info, err := os.Stat(filepath.Join(c.tempdir, file))
+		if err != nil {
+			t.Fatalf("error reading written file: %v", err)
+		}
+		bytes += info.Size()
+	}
+	c.logger.CompareLogging(fmt.Sprintf(`
+INFO-V(2) updated main cfg and 2 backend file(s): [000 002]; 5 file(s) and %d bytes written`, bytes) + defaultLogging)
+}
+
+func TestInstanceReloadHook(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	var calls []string
+	c.instance.options.OnReload = func(success bool, mode string, duration time.Duration) {
+		calls = append(calls, fmt.Sprintf("success=%t mode=%s", success, mode))
+		panic("hook failure")
+	}
+	c.Update()
+	c.logger.CompareLogging(defaultLogging + `
+ERROR panic calling the reload hook: hook failure`)
+	expected := []string{"success=true mode=embedded daemon"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected hook calls %v, but was %v", expected, calls)
+	}
+
+	c.Update()
+	c.logger.CompareLogging(`
+INFO old and new configurations match`)
+	if len(calls) != 1 {
+		t.Errorf("expected hook not being called without a reload, but was called %d times", len(calls))
+	}
+}
+
+func TestInstanceOldWorkers(t *testing.T) {
+	testCases := []struct {
+		threshold  int
+		oldWorkers []socket.Proc
+		logging    string
+	}{
+		// 0
+		{
+			threshold: 0,
+			oldWorkers: []socket.Proc{
+				{Type: "worker", PID: 2},
+				{Type: "worker", PID: 3},
+			},
+		},
+		// 1
+		{
+			threshold: 2,
+			oldWorkers: []socket.Proc{
+				{Type: "worker", PID: 2},
+				{Type: "worker", PID: 3},
+				{Type: "program", PID: 4},
+			},
+		},
+		// 2
+		{
+			threshold: 1,
+			oldWorkers: []socket.Proc{
+				{Type: "worker", PID: 2},
+				{Type: "worker", PID: 3},
+			},
+			logging: `WARN 2 old haproxy workers are still running, threshold is 1`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		c.instance.options.OldWorkersWarnThreshold = test.threshold
+		c.instance.checkOldWorkers(&socket.ProcTable{OldWorkers: test.oldWorkers})
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceParseTemplates(t *testing.T) {
+	testCases := []struct {
+		templates map[string]TemplateSpec
+		expError  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			templates: map[string]TemplateSpec{
+				"haproxy.tmpl": {BufferSize: 1024},
+			},
+		},
+		// 2
+		{
+			templates: map[string]TemplateSpec{
+				"map.tmpl": {Source: "/tmp/haproxy-ingress/notfound/map.tmpl"},
+			},
+			expError: "cannot read template file: open /tmp/haproxy-ingress/notfound/map.tmpl: no such file or directory",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.options.TemplatesDir = "../../rootfs/etc/templates"
+		c.instance.options.Templates = test.templates
+		var errStr string
+		if err := c.instance.ParseTemplates(); err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.expError {
+			t.Errorf("error differs on %d - expected: '%s', actual: '%s'", i, test.expError, errStr)
+		}
+		c.teardown()
+	}
+}
+
+func TestInstanceReloadTemplates(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+
+	c.instance.options.TemplatesDir = "../../rootfs/etc/templates"
+	c.instance.options.Templates = map[string]TemplateSpec{
+		"haproxy.tmpl": {Source: "/tmp/haproxy-ingress/notfound/haproxy.tmpl"},
+	}
+	err := c.instance.ReloadTemplates()
+	if err == nil {
+		t.Errorf("expected error reloading templates")
+	}
+	c.Update()
+	c.logger.CompareLogging(`
+INFO old and new configurations match`)
+
+	c.instance.options.Templates = map[string]TemplateSpec{
+		"haproxy.tmpl": {Output: filepath.Join(c.tempdir, "haproxy.cfg")},
+	}
+	if err := os.Mkdir(filepath.Join(c.tempdir, "lua"), 0755); err != nil {
+		t.Errorf("error creating lua dir: %v", err)
+	}
+	err = c.instance.ReloadTemplates()
+	if err != nil {
+		t.Errorf("expected no error reloading templates, but was: %v", err)
+	}
+	c.Update()
+	c.logger.CompareLogging(`
+INFO templates successfully reloaded
+INFO-V(2) need to reload due to template changes
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="templates changed"`)
+
+	c.Update()
+	c.logger.CompareLogging(`
+INFO old and new configurations match`)
+}
+
+func TestInstanceHealthy(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	healthy, reason := c.instance.Healthy()
+	if healthy || reason != "haproxy wasn't started yet" {
+		t.Errorf("expected not healthy before the first reload, but was healthy=%t reason='%s'", healthy, reason)
+	}
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+	healthy, reason = c.instance.Healthy()
+	if !healthy || reason != "" {
+		t.Errorf("expected healthy after a reload, but was healthy=%t reason='%s'", healthy, reason)
+	}
+
+	c.instance.updateSuccessful(false)
+	failedSince := time.Now().Add(-90 * time.Second)
+	c.instance.failedSince = &failedSince
+	healthy, reason = c.instance.Healthy()
+	if healthy || !strings.HasPrefix(reason, "haproxy failing to reload for 1m30s, since ") {
+		t.Errorf("expected not healthy failing for 1m30s, but was healthy=%t reason='%s'", healthy, reason)
+	}
+
+	c.instance.updateSuccessful(true)
+	healthy, reason = c.instance.Healthy()
+	if !healthy || reason != "" {
+		t.Errorf("expected healthy after a successful update, but was healthy=%t reason='%s'", healthy, reason)
+	}
+}
+
+func TestInstanceCheckAdminSocket(t *testing.T) {
+	testCases := []struct {
+		require    bool
+		missing    bool
+		expLogging string
+		expReason  string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			require: true,
+		},
+		// 2
+		{
+			missing:    true,
+			expLogging: "WARN haproxy admin socket is not responding, dynamic updates and metrics will fail: ",
+		},
+		// 3
+		{
+			require:    true,
+			missing:    true,
+			expLogging: "ERROR haproxy admin socket is not responding, failing readiness: ",
+			expReason:  "haproxy admin socket is not responding: ",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.up = true
+		c.instance.options.RequireAdminSocket = test.require
+		if test.missing {
+			missingSock := filepath.Join(c.tempdir, "missing.sock")
+			c.instance.conns = newConnections("", missingSock, "", time.Second)
+		} else {
+			c.instance.conns.admin = &clientMock{}
+		}
+		c.instance.checkAdminSocket()
+		if c.instance.adminSocketOK == test.missing {
+			t.Errorf("%d: expected admin socket ok %t, but was %t", i, !test.missing, c.instance.adminSocketOK)
+		}
+		var logging string
+		if len(c.logger.Logging) > 0 {
+			logging = c.logger.Logging[0]
+		}
+		if !strings.HasPrefix(logging, test.expLogging) || (test.expLogging == "") != (logging == "") {
+			t.Errorf("%d: expected logging prefix '%s', but was '%s'", i, test.expLogging, logging)
+		}
+		healthy, reason := c.instance.Healthy()
+		if healthy != (test.expReason == "") || !strings.HasPrefix(reason, test.expReason) {
+			t.Errorf("%d: expected reason prefix '%s', but was healthy=%t reason='%s'", i, test.expReason, healthy, reason)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func TestParseIdlePct(t *testing.T) {
+	testCases := []struct {
+		msg      []string
+		expIdle  int
+		expError string
+	}{
+		// 0
+		{
+			msg: []string{`Name: HAProxy
+Version: 2.2.25
+Release_date: 2022/07/27
+Nbthread: 4
+Nbproc: 1
+Process_num: 1
+Pid: 123
+Uptime: 0d 0h01m15s
+Uptime_sec: 75
+Idle_pct: 98
+node: haproxy-ingress
+Stopping: 0
+`},
+			expIdle: 98,
+		},
+		// 1
+		{
+			msg: []string{`Name: HAProxy
+Version: 2.6.6-274d1a4
+Release_date: 2022/09/22
+Nbthread: 4
+Pid: 123
+Uptime: 0d 0h01m15s
+Uptime_sec: 75
+Memmax_MB: 0
+Run_queue: 1
+Idle_pct: 100
+node: haproxy-ingress
+Stopping: 0
+Jobs: 11
+Unstoppable Jobs: 1
+Listeners: 7
+`},
+			expIdle: 100,
+		},
+		// 2
+		{
+			msg:     []string{"Name: HAProxy\r\nPid: 123\r\nIdle_pct:  87 \r\nnode: haproxy-ingress\r\n"},
+			expIdle: 87,
+		},
+		// 3
+		{
+			msg: []string{
+				"Name: HAProxy\nVersion: 2.4.19\nPid: 123\n",
+				"Run_queue: 1\nIdle_pct: 42\nnode: haproxy-ingress\n",
+			},
+			expIdle: 42,
+		},
+		// 4
+		{
+			msg:      []string{"Name: HAProxy\nPid: 123\n"},
+			expError: "cannot find Idle_pct field in the show info socket command",
+		},
+		// 5
+		{
+			msg:      []string{},
+			expError: "cannot find Idle_pct field in the show info socket command",
+		},
+		// 6
+		{
+			msg:      []string{"Idle_pct: 99999999999999999999\n"},
+			expError: "Idle_pct has an invalid integer: 99999999999999999999",
+		},
+	}
+	for i, test := range testCases {
+		idle, err := parseIdlePct(test.msg)
+		var errStr string
+		if err != nil {
+			errStr = err.Error()
+		}
+		if idle != test.expIdle || errStr != test.expError {
+			t.Errorf("%d: expected idle=%d error='%s' but was idle=%d error='%s'", i, test.expIdle, test.expError, idle, errStr)
+		}
+	}
+}
+
+func TestInstanceValidateBeforeReload(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+
+	c.instance.options.ValidateBeforeReload = true
+	c.config.Hosts().AcquireHost("d2.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) added host 'd2.local'
+INFO-V(2) need to reload due to config changes: [hosts]
+INFO (test) check was skipped
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="config changed"`)
+
+	c.Update()
+	c.logger.CompareLogging(`
+INFO old and new configurations match`)
+
+	// failing validation skips the reload, which is forced on the next update
+	haproxy := filepath.Join(c.tempdir, "haproxy")
+	if err := os.WriteFile(haproxy, []byte("#!/bin/sh\necho \"[ALERT] parsing error\"\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("error writing script: %v", err)
+	}
+	c.instance.options.fake = false
+	c.instance.options.HAProxyBinary = haproxy
+	metrics := c.instance.metrics.(*helper_test.MetricsMock)
+	c.config.Hosts().AcquireHost("d3.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	if n := len(c.logger.Logging); n == 0 || !strings.HasPrefix(c.logger.Logging[n-1], "ERROR haproxy failed to reload, first occurrence at ") {
+		t.Errorf("expected a failing reload, but logging was: %v", c.logger.Logging)
+	} else {
+		c.logger.Logging = c.logger.Logging[:n-1]
+	}
+	c.logger.CompareLogging(`
+INFO-V(2) updating 1 host(s): [d3.local] host_count=1
+INFO-V(2) updating 0 backend(s): [] backend_count=0
+INFO-V(2) added host 'd3.local'
+INFO-V(2) need to reload due to config changes: [hosts]
+ERROR error validating config file, skipping haproxy reload:
+[ALERT] parsing error
+`)
+	if !c.instance.forceReload {
+		t.Errorf("expected a forced reload after a failed validation")
+	}
+	if metrics.ReloadBlocked != 1 {
+		t.Errorf("expected one blocked reload, but was %d", metrics.ReloadBlocked)
+	}
+	if result := c.instance.LastUpdate(); result != UpdateNoop {
+		t.Errorf("expected '%s' update with a failed validation, but was '%s'", UpdateNoop, result)
+	}
+
+	// the config is valid again, no new changes
+	c.instance.options.fake = true
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) need to reload, a full reload was requested
+INFO (test) check was skipped
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="forced"`)
+	if c.instance.forceReload {
+		t.Errorf("expected the forced reload to be consumed")
+	}
+	if result := c.instance.LastUpdate(); result != UpdateReload {
+		t.Errorf("expected '%s' update after fixing the config, but was '%s'", UpdateReload, result)
+	}
+}
+
+func TestInstanceValidateCertFiles(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	c.instance.options.ValidateCertFiles = true
+	crt := filepath.Join(c.tempdir, "crt.pem")
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h := c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	h.TLS.TLSFilename = crt
+	h.TLS.TLSHash = "1"
+	c.Update()
+	if n := len(c.logger.Logging); n == 0 || !strings.HasPrefix(c.logger.Logging[n-1], "ERROR haproxy failed to reload, first occurrence at ") {
+		t.Errorf("expected a failing reload, but logging was: %v", c.logger.Logging)
+	} else {
+		c.logger.Logging = c.logger.Logging[:n-1]
+	}
+	c.logger.CompareLogging(strings.ReplaceAll(`
+ERROR error validating certificate files, skipping haproxy reload:
+certificate file of host 'd1.local' is not readable: open <crt>: no such file or directory`, "<crt>", crt))
+	if result := c.instance.LastUpdate(); result != UpdateNoop {
+		t.Errorf("expected '%s' update with a missing certificate, but was '%s'", UpdateNoop, result)
+	}
+
+	// the reload is forced even without new changes
+	if err := os.WriteFile(crt, []byte("-----"), 0o600); err != nil {
+		t.Fatalf("error writing certificate: %v", err)
+	}
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) need to reload, a full reload was requested
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="first run"`)
+}
+
+func TestInstanceConfigPostProcessor(t *testing.T) {
+	var fail bool
+	c := setupOptions(testOptions{
+		t: t,
+		postProcessor: func(in []byte) ([]byte, error) {
+			if fail {
+				return nil, fmt.Errorf("invalid config")
+			}
+			return append(in, "# custom section\n"...), nil
+		},
+	})
+	defer c.teardown()
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+	cfg, _ := os.ReadFile(filepath.Join(c.tempdir, "haproxy.cfg"))
+	if !strings.HasSuffix(string(cfg), "\n# custom section\n") {
+		t.Errorf("expected post processed haproxy.cfg, but was:\n%s", string(cfg))
+	}
+
+	fail = true
+	c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+	b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	b.ModeTCP = true
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) diff outside endpoints of backend 'd1_app_8080'
+INFO-V(2) need to reload due to config changes: [backends]
+INFO-V(2) backend(s) not dynamically updated: d1_app_8080 (changed Paths, ModeTCP)
+ERROR error writing configuration: error post processing haproxy.tmpl: invalid config`)
+	if result := c.instance.LastUpdate(); result != UpdateNoop {
+		t.Errorf("expected '%s' update with a failing post processor, but was '%s'", UpdateNoop, result)
+	}
+}
+
+func TestMissingServersStateFields(t *testing.T) {
+	testCases := []struct {
+		state   string
+		missing []string
+	}{
+		// 0
+		{
+			state: `1
+# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port srvrecord srv_use_ssl srv_check_port srv_check_addr srv_agent_addr srv_agent_port
+3 default_app_8080 1 srv001 172.17.0.11 2 0 1 1 75 1 0 2 0 0 0 0 - 8080 - 0 0 - - 0
+`,
+		},
+		// 1
+		{
+			state:   "1\n# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state\n",
+			missing: []string{"srv_check_status", "srv_check_result", "srv_check_health", "srv_check_state", "srv_agent_state"},
+		},
+		// 2
+		{
+			state:   "1\n",
+			missing: serversStateCheckFields,
+		},
+	}
+	for i, test := range testCases {
+		missing := missingServersStateFields(test.state)
+		if !reflect.DeepEqual(missing, test.missing) {
+			t.Errorf("%d: expected missing fields %v but was %v", i, test.missing, missing)
+		}
+	}
+}
+
+func TestValidateServersState(t *testing.T) {
+	testCases := []struct {
+		state    string
+		expError string
+	}{
+		// 0
+		{
+			state: `1
+# be_id be_name srv_id srv_name srv_addr srv_op_state srv_admin_state srv_uweight srv_iweight srv_time_since_last_change srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state bk_f_forced_id srv_f_forced_id srv_fqdn srv_port srvrecord srv_use_ssl srv_check_port srv_check_addr srv_agent_addr srv_agent_port
+3 default_app_8080 1 srv001 172.17.0.11 2 0 1 1 75 1 0 2 0 0 0 0 - 8080 - 0 0 - - 0
+`,
+		},
+		// 1
+		{
+			state: "1\n# be_id be_name srv_id srv_name srv_addr\n",
+		},
+		// 2
+		{
+			state:    "",
+			expError: "servers state from external haproxy does not have a version header",
+		},
+		// 3
+		{
+			state:    "\n# be_id be_name srv_id srv_name srv_addr\n",
+			expError: "servers state from external haproxy does not have a version header",
+		},
+		// 4
+		{
+			state:    "2\n# be_id be_name srv_id srv_name srv_addr\n",
+			expError: "unsupported servers state version '2', expected version '1'",
+		},
+	}
+	for i, test := range testCases {
+		var errStr string
+		if err := validateServersState(test.state); err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.expError {
+			t.Errorf("%d: expected error '%s' but was '%s'", i, test.expError, errStr)
+		}
+	}
+}
+
+func TestInstanceOptionsShards(t *testing.T) {
+	testCases := []struct {
+		backendShards    int
+		backendMapShards int
+		expError         string
+	}{
+		// 0
+		{},
+		// 1
+		{
+			backendShards:    10000,
+			backendMapShards: 8,
+		},
+		// 2
+		{
+			backendShards: -1,
+			expError:      "invalid backend shards: -1, should be between 0 and 10000",
+		},
+		// 3
+		{
+			backendShards: 10001,
+			expError:      "invalid backend shards: 10001, should be between 0 and 10000",
+		},
+		// 4
+		{
+			backendMapShards: -1,
+			expError:         "invalid backend map shards: -1, should not be negative",
+		},
+	}
+	for i, test := range testCases {
+		options := InstanceOptions{
+			BackendShards:    test.backendShards,
+			BackendMapShards: test.backendMapShards,
+		}
+		var errMsg string
+		if err := options.Validate(); err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("expected error '%s' on %d, but was '%s'", test.expError, i, errMsg)
+		}
+	}
+}
+
+func TestShardNumber(t *testing.T) {
+	testCases := []struct {
+		shard    int
+		shards   int
+		expected string
+	}{
+		// 0
+		{shard: 0, shards: 1, expected: "000"},
+		// 1
+		{shard: 12, shards: 100, expected: "012"},
+		// 2
+		{shard: 999, shards: 1000, expected: "999"},
+		// 3
+		{shard: 7, shards: 1001, expected: "0007"},
+		// 4
+		{shard: 1000, shards: 1001, expected: "1000"},
+	}
+	for i, test := range testCases {
+		if actual := shardNumber(test.shard, test.shards); actual != test.expected {
+			t.Errorf("expected '%s' on %d, but was '%s'", test.expected, i, actual)
+		}
+	}
+}
+
+func TestInstanceOptionsMapsDir(t *testing.T) {
+	tempdir := t.TempDir()
+	notDir := filepath.Join(tempdir, "file")
+	if err := os.WriteFile(notDir, []byte{}, 0644); err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	readOnly := filepath.Join(tempdir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("error creating dir: %v", err)
+	}
+	testCases := []struct {
+		mapsDir  string
+		fs       template.Filesystem
+		skip     bool
+		expError string
+	}{
+		// 0
+		{
+			mapsDir: "",
+		},
+		// 1
+		{
+			mapsDir: filepath.Join(tempdir, "maps"),
+		},
+		// 2
+		{
+			mapsDir: filepath.Join(tempdir, "new", "maps"),
+		},
+		// 3
+		{
+			mapsDir:  filepath.Join(notDir, "maps"),
+			expError: "invalid maps dir: cannot create dir '" + filepath.Join(notDir, "maps") + "': mkdir " + notDir + ": not a directory",
+		},
+		// 4
+		{
+			mapsDir:  readOnly,
+			skip:     os.Geteuid() == 0,
+			expError: "invalid maps dir: dir '" + readOnly + "' is not writable: open " + readOnly + "/.check-",
+		},
+		// 5
+		{
+			mapsDir: filepath.Join(notDir, "maps"),
+			fs:      template.NewMemFilesystem(),
+		},
+	}
+	for i, test := range testCases {
+		if test.skip {
+			continue
+		}
+		options := InstanceOptions{HAProxyMapsDir: test.mapsDir, Filesystem: test.fs}
+		var errStr string
+		if err := options.Validate(); err != nil {
+			errStr = err.Error()
+		}
+		if !strings.HasPrefix(errStr, test.expError) || (test.expError == "" && errStr != "") {
+			t.Errorf("%d: expected error starting with '%s', but was '%s'", i, test.expError, errStr)
+		}
+		if test.expError == "" && test.fs == nil && test.mapsDir != "" {
+			if entries, err := os.ReadDir(test.mapsDir); err != nil || len(entries) > 0 {
+				t.Errorf("%d: expected an empty maps dir, but was %v, err: %v", i, entries, err)
+			}
+		}
+	}
+}
+
+func TestInstanceReloadQueueDepth(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	queue := utils.NewQueue(func(item interface{}) {})
+	defer queue.ShutDown()
+	c.instance.options.ReloadQueue = queue
+	c.instance.options.ReloadQueueWarnThreshold = 2
+
+	for _, app := range []string{"app1", "app2", "app3"} {
+		b := c.config.Backends().AcquireBackend("d1", app, "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS1}
+		c.config.Hosts().AcquireHost(app+".local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+	}
+	if c.instance.reloadPending != 3 {
+		t.Errorf("expected 3 pending updates, but was %d", c.instance.reloadPending)
+	}
+	c.logger.CompareLogging(`
+INFO-V(2) haproxy reload enqueued, reason: first run
+INFO-V(2) added host 'app2.local'
+INFO-V(2) added backend 'd1_app2_8080'
+INFO-V(2) need to reload due to config changes: [hosts backends]
+INFO-V(2) backend(s) not dynamically updated: d1_app2_8080 (added backend)
+INFO-V(2) haproxy reload enqueued, reason: first run
+INFO-V(2) added host 'app3.local'
+INFO-V(2) added backend 'd1_app3_8080'
+INFO-V(2) need to reload due to config changes: [hosts backends]
+INFO-V(2) backend(s) not dynamically updated: d1_app3_8080 (added backend)
+INFO-V(2) haproxy reload enqueued, reason: first run
+WARN 3 configuration updates are waiting for the enqueued haproxy reload, threshold is 2`)
+
+	c.instance.reloadQueued(nil)
+	if c.instance.reloadPending != 0 {
+		t.Errorf("expected no pending updates after reload, but was %d", c.instance.reloadPending)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceMissingSourceIPs(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.SourceIPs = []net.IP{net.ParseIP("192.168.0.2")}
+	for j := 1; j <= 12; j++ {
+		b.AcquireEndpoint(fmt.Sprintf("fd00::%d", j), 8080, "")
+	}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) missing source IP of the same address family, using the default source of endpoint(s): d1_app_8080/fd00::10:8080, d1_app_8080/fd00::11:8080, d1_app_8080/fd00::12:8080, d1_app_8080/fd00::1:8080, d1_app_8080/fd00::2:8080, d1_app_8080/fd00::3:8080, d1_app_8080/fd00::4:8080, d1_app_8080/fd00::5:8080, d1_app_8080/fd00::6:8080, d1_app_8080/fd00::7:8080 and 2 more` + defaultLogging)
+}
+
+func TestInstanceConfigSizeWarn(t *testing.T) {
+	testCases := []struct {
+		threshold int
+		shards    int
+		logging   string
+	}{
+		// 0
+		{
+			logging: defaultLogging,
+		},
+		// 1
+		{
+			threshold: 1024 * 1024,
+			logging:   defaultLogging,
+		},
+		// 2
+		{
+			threshold: 100,
+			logging: `
+WARN haproxy config file has <n> bytes, threshold is 100, consider configuring backend shards` + defaultLogging,
+		},
+		// 3
+		{
+			threshold: 100,
+			shards:    2,
+			logging: `
+WARN haproxy config file has <n> bytes, threshold is 100, consider increasing the number of backend shards` + defaultLogging,
+		},
+	}
+	for i, test := range testCases {
+		c := setupOptions(testOptions{t: t, shardCount: test.shards})
+		c.instance.options.ConfigSizeWarnThreshold = test.threshold
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS1}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+		cfg, err := os.ReadFile(filepath.Join(c.tempdir, "haproxy.cfg"))
+		if err != nil {
+			t.Fatalf("%d: error reading config file: %v", i, err)
+		}
+		metrics := c.instance.metrics.(*helper_test.MetricsMock)
+		if metrics.ConfigBytes != len(cfg) {
+			t.Errorf("%d: expected %d config bytes, but was %d", i, len(cfg), metrics.ConfigBytes)
+		}
+		var logging []string
+		for _, log := range c.logger.Logging {
+			if !strings.HasPrefix(log, "INFO-V(2) updated main cfg") {
+				logging = append(logging, regexp.MustCompile(`has [0-9]+ bytes`).ReplaceAllString(log, "has <n> bytes"))
+			}
+		}
+		c.logger.Logging = logging
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceConfigSizeWarnOnce(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.options.ConfigSizeWarnThreshold = 100
+
+	c.instance.checkConfigSize(200)
+	c.instance.checkConfigSize(300)
+	c.logger.CompareLogging(`
+WARN haproxy config file has 200 bytes, threshold is 100, consider configuring backend shards`)
+
+	// warns again after going back below the threshold
+	c.instance.checkConfigSize(50)
+	c.instance.checkConfigSize(150)
+	c.logger.CompareLogging(`
+WARN haproxy config file has 150 bytes, threshold is 100, consider configuring backend shards`)
+}
+
+func TestInstanceReloadQueueReason(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	queue := utils.NewQueue(func(item interface{}) {})
+	defer queue.ShutDown()
+	c.instance.options.ReloadQueue = queue
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) haproxy reload enqueued, reason: first run`)
+
+	c.instance.reloadQueued(nil)
+	if reason := c.instance.LastReload().Reason; reason != ReloadReasonFirstRun {
+		t.Errorf("expected last reload reason '%s', but was '%s'", ReloadReasonFirstRun, reason)
+	}
+	logging := c.logger.Logging
+	finish := "INFO finish enqueued haproxy reload, reason: first run: "
+	if len(logging) != 3 || !strings.HasPrefix(logging[2], finish) {
+		t.Errorf("expected reload reason in the finish message, but logging was: %v", logging)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceInitialConfig(t *testing.T) {
+	backend := func(cfg Config, ip string) {
+		cfg.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := cfg.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.Dynamic.MinFreeSlots = 1
+		b.AcquireEndpoint(ip, 8080, "")
+		cfg.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	}
+	var calls int
+	c := setupOptions(testOptions{
+		t: t,
+		initialConfig: func(cfg Config) {
+			calls++
+			backend(cfg, "172.17.0.11")
+		},
+	})
+	defer c.teardown()
+
+	c.instance.Config()
+	if calls != 1 {
+		t.Errorf("expected initial config called once, but was called %d times", calls)
+	}
+
+	c.Update()
+	if result := c.instance.LastUpdate(); result != UpdateReload {
+		t.Errorf("expected '%s' update, but was '%s'", UpdateReload, result)
+	}
+	c.checkConfig(`
+<<global>>
+<<defaults>>
+backend d1_app_8080
+    mode http
+    server srv001 172.17.0.11:8080 weight 1
+    server srv002 127.0.0.1:1023 disabled weight 1
+<<backends-default>>
+<<frontends-default>>
+<<support>>
+`)
+	c.logger.Logging = []string{}
+
+	c.instance.conns.dynUpdate = &clientMock{}
+	backend(c.config, "172.17.0.12")
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) updated endpoint '172.17.0.12:8080' weight '1' state 'ready' on backend/server 'd1_app_8080/srv001'
+INFO haproxy updated without needing to reload. Commands sent: 3 command_count=3`)
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' update, but was '%s'", UpdateDynamic, result)
+	}
+}
+
+func TestInstanceRenderedConfig(t *testing.T) {
+	for _, shardCount := range []int{0, 2} {
+		c := setupOptions(testOptions{t: t, shardCount: shardCount})
+		for _, app := range []string{"app1", "app2", "app3"} {
+			b := c.config.Backends().AcquireBackend("d1", app, "8080")
+			b.AcquireEndpoint("172.17.0.11", 8080, "")
+			c.config.Hosts().AcquireHost(app+".local").AddPath(b, "/", hatypes.MatchBegin)
+		}
+		c.Update()
+		expected := c.readRawConfig(filepath.Join(c.tempdir, "haproxy.cfg"))
+		for j := 0; j < shardCount; j++ {
+			shardFile := filepath.Join(c.tempdir, fmt.Sprintf("haproxy5-backend%03d.cfg", j))
+			if _, err := os.Stat(shardFile); err == nil {
+				expected += c.readRawConfig(shardFile)
+			}
+		}
+		actual, err := c.instance.RenderedConfig()
+		if err != nil {
+			t.Errorf("error rendering config with %d shards: %v", shardCount, err)
+		}
+		if string(actual) != expected {
+			t.Errorf("rendered config with %d shards differs:\n%s", shardCount, diff.Diff(expected, string(actual)))
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func TestInstanceAcmeStorages(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	storages := c.config.AcmeData().Storages()
+	storages.Acquire("cert1").AddDomains([]string{"d1b.local", "d1a.local"})
+	c.Update()
+	storages.Acquire("cert2").AddDomains([]string{"d2.local"})
+	expected := []hatypes.AcmeStorage{
+		{Name: "cert1", Domains: []string{"d1a.local", "d1b.local"}},
+	}
+	actual := c.instance.AcmeStorages()
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("acme storages differ - expected: %+v, actual: %+v", expected, actual)
+	}
+	if !storages.Updated() {
+		t.Errorf("expected pending acme storage changes to be preserved")
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceSnapshot(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	if _, err := c.instance.RenderedConfig(); err == nil {
+		t.Errorf("expected an error rendering the config before the first update")
+	}
+	if _, err := c.instance.ExportDataplane(); err == nil {
+		t.Errorf("expected an error exporting the config before the first update")
+	}
+
+	apps := []string{"app1", "app2", "app3"}
+	apply := func(app string) {
+		b := c.config.Backends().AcquireBackend("d1", app, "8080")
+		b.AcquireEndpoint("172.17.0.11", 8080, "")
+		c.config.Hosts().AcquireHost(app+".local").AddPath(b, "/", hatypes.MatchBegin)
+		c.config.AcmeData().Storages().Acquire("cert-" + app).AddDomains([]string{app + ".local"})
+		c.Update()
+	}
+	apply(apps[0])
+
+	// readers must not race with the converter and the update
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = c.instance.RenderedConfig()
+			_, _ = c.instance.ExportDataplane()
+			_ = c.instance.AcmeStorages()
+			_ = c.instance.ConfigStats()
+		}
+	}()
+	for _, app := range apps[1:] {
+		apply(app)
+	}
+	close(stop)
+	<-done
+
+	stats := c.instance.ConfigStats()
+	if stats.Hosts != 3 || stats.Endpoints != 3 {
+		t.Errorf("expected 3 hosts and 3 endpoints, but was %+v", stats)
+	}
+	if storages := c.instance.AcmeStorages(); len(storages) != 3 {
+		t.Errorf("expected 3 acme storages, but was %+v", storages)
+	}
+
+	// updates without changes keep the last snapshot
+	snapshot := c.instance.snapshot.Load()
+	c.Update()
+	if c.instance.snapshot.Load() != snapshot {
+		t.Errorf("expected the snapshot to be reused on a noop update")
+	}
+
+	// uncommitted changes aren't visible to readers
+	c.config.Hosts().AcquireHost("app4.local")
+	if actual := c.instance.ConfigStats(); actual != stats {
+		t.Errorf("expected stats of the last update %+v, but was %+v", stats, actual)
+	}
+	c.Update()
+	if c.instance.snapshot.Load() == snapshot {
+		t.Errorf("expected a new snapshot after a config change")
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceCheckFiles(t *testing.T) {
+	c := setupOptions(testOptions{t: t, shardCount: 10})
+	defer c.teardown()
+	c.instance.options.ValidateChangedFiles = true
+
+	def := c.config.Backends().AcquireBackend("default", "default-backend", "8080")
+	def.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Backends().DefaultBackend = def
+	b1 := c.config.Backends().AcquireBackend("d1", "app1", "8080")
+	b1.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b1, "/", hatypes.MatchBegin)
+	c.Update()
+
+	files, err := c.instance.checkFiles()
+	if err != nil {
+		t.Errorf("unexpected error on first run: %v", err)
+	}
+	if files != nil {
+		t.Errorf("expected full dir validation on first run, but was: %v", files)
+	}
+
+	// simulates a successful validation
+	c.instance.checkShards = map[int]bool{}
+	b2 := c.config.Backends().AcquireBackend("d2", "app2", "8080")
+	b2.Endpoints = []*hatypes.Endpoint{endpointS21}
+	c.config.Hosts().AcquireHost("d2.local").AddPath(b2, "/", hatypes.MatchBegin)
+	c.Update()
+
+	shards := map[int]bool{}
+	for _, id := range []string{def.ID, b2.ID} {
+		j, _ := c.config.Backends().BackendShard(id)
+		shards[j] = true
+	}
+	expected := []string{filepath.Join(c.tempdir, "haproxy.cfg")}
+	for j := 0; j < 10; j++ {
+		if shards[j] {
+			expected = append(expected, filepath.Join(c.tempdir, fmt.Sprintf("haproxy5-backend%03d.cfg", j)))
+		}
+	}
+	files, err = c.instance.checkFiles()
+	if err != nil {
+		t.Errorf("unexpected error on changed shards: %v", err)
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("files to validate differ - expected: %v, actual: %v", expected, files)
+	}
+
+	c.instance.options.ValidateChangedFiles = false
+	if files, _ := c.instance.checkFiles(); files != nil {
+		t.Errorf("expected full dir validation with option disabled, but was: %v", files)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceStatsSocket(t *testing.T) {
+	testCases := []struct {
+		statsSocket string
+		expected    string
+	}{
+		// 0
+		{
+			expected: `
+    stats socket /var/run/haproxy.sock level admin expose-fd listeners mode 600
+    maxconn 2000`,
+		},
+		// 1
+		{
+			statsSocket: "/var/run/stats.sock",
+			expected: `
+    stats socket /var/run/haproxy.sock level admin expose-fd listeners mode 600
+    stats socket /var/run/stats.sock level operator mode 600
+    maxconn 2000`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.config.Global().StatsSocket = test.statsSocket
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS1}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+		config := c.readRawConfig(filepath.Join(c.tempdir, "haproxy.cfg"))
+		if !strings.Contains(config, test.expected) {
+			t.Errorf("stats socket differs on %d - expected:%s\nactual:\n%s", i, test.expected, config)
+		}
+		c.logger.CompareLogging(defaultLogging)
+		c.teardown()
+	}
+}
+
+type signerMock struct {
+	hasAccount bool
+}
+
+func (s *signerMock) AcmeAccount(endpoint, emails string, termsAgreed bool) {}
+func (s *signerMock) AcmeAccountStore(path string)                          {}
+func (s *signerMock) AcmeConfig(expiring time.Duration)                     {}
+func (s *signerMock) AcmeTransport(transport acme.TransportConfig)          {}
+func (s *signerMock) HasAccount() bool                                      { return s.hasAccount }
+func (s *signerMock) Notify(item interface{}) error                         { return nil }
+
+type leaderMock struct {
+	mutex  sync.Mutex
+	leader bool
+}
+
+func (l *leaderMock) setLeader(leader bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.leader = leader
+}
+
+func (l *leaderMock) IsLeader() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.leader
+}
+
+func (l *leaderMock) LeaderName() string         { return "ingress-1" }
+func (l *leaderMock) Run(stopCh <-chan struct{}) {}
+
+func TestInstanceAcmeCheckErrors(t *testing.T) {
+	testCases := []struct {
+		started  bool
+		queue    bool
+		leader   bool
+		expErr   error
+		expError string
+		logging  string
+	}{
+		// 0
+		{
+			expErr:   ErrNotStarted,
+			expError: "controller wasn't started yet",
+		},
+		// 1
+		{
+			started:  true,
+			expErr:   ErrAcmeNotConfigured,
+			expError: "Acme queue wasn't configured",
+		},
+		// 2
+		{
+			started:  true,
+			queue:    true,
+			expErr:   ErrNotLeader,
+			expError: "controller instance is not the acme leader, leader is ingress-1",
+			logging:  `INFO skipping acme periodic check, leader is ingress-1`,
+		},
+		// 3
+		{
+			started: true,
+			queue:   true,
+			leader:  true,
+			logging: `
+INFO starting certificate check (test)
+INFO certificate list is empty`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.up = test.started
+		if test.queue {
+			c.instance.options.AcmeQueue = utils.NewQueue(func(item interface{}) {})
+		}
+		c.instance.options.AcmeSigner = &signerMock{hasAccount: true}
+		c.instance.options.LeaderElector = &leaderMock{leader: test.leader}
+		c.instance.Config()
+		_, err := c.instance.AcmeCheck("test")
+		if !errors.Is(err, test.expErr) {
+			t.Errorf("expected error '%v' on %d, but was '%v'", test.expErr, i, err)
+		}
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("expected error message '%s' on %d, but was '%s'", test.expError, i, errMsg)
+		}
+		c.logger.CompareLogging(test.logging)
+		if test.queue {
+			c.instance.options.AcmeQueue.ShutDown()
+		}
+		c.teardown()
+	}
+}
+
+type queueMock struct {
+	mutex    sync.Mutex
+	added    []interface{}
+	removed  []interface{}
+	notified int
+}
+
+func (q *queueMock) Add(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.added = append(q.added, item)
+}
+
+func (q *queueMock) Notify() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.notified++
+}
+
+func (q *queueMock) Clear()                  {}
+func (q *queueMock) Remove(item interface{}) { q.removed = append(q.removed, item) }
+func (q *queueMock) Run()                    {}
+func (q *queueMock) ShuttingDown() bool      { return false }
+func (q *queueMock) ShutDown()               {}
+
+func (q *queueMock) notifiedCount() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.notified
+}
+
+func (q *queueMock) addedItems() []interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.added
+}
+
+func TestInstanceAcmeCheckJitter(t *testing.T) {
+	testCases := []struct {
+		source   string
+		jitter   time.Duration
+		lose     bool
+		stop     bool
+		expDelay bool
+		logging  string
+	}{
+		// 0
+		{
+			source: AcmeCheckPeriodic,
+			logging: `
+INFO starting certificate check (periodic check)
+INFO-V(3) enqueue certificate for processing: storage=cert1 domain(s)=d1.local preferred-chain=
+INFO finish adding 1 certificate(s) to the work queue`,
+		},
+		// 1
+		{
+			source: "started leading",
+			jitter: 2 * time.Minute,
+			logging: `
+INFO starting certificate check (started leading)
+INFO-V(3) enqueue certificate for processing: storage=cert1 domain(s)=d1.local preferred-chain=
+INFO finish adding 1 certificate(s) to the work queue`,
+		},
+		// 2
+		{
+			source:   AcmeCheckPeriodic,
+			jitter:   2 * time.Minute,
+			expDelay: true,
+			logging: `
+INFO starting certificate check (periodic check)
+INFO delaying 1 certificate(s) by 1m30s before adding to the work queue
+INFO-V(3) enqueue certificate for processing: storage=cert1 domain(s)=d1.local preferred-chain=
+INFO finish adding 1 certificate(s) to the work queue`,
+		},
+		// 3
+		{
+			source:   AcmeCheckPeriodic,
+			jitter:   2 * time.Minute,
+			lose:     true,
+			expDelay: true,
+			logging: `
+INFO starting certificate check (periodic check)
+INFO delaying 1 certificate(s) by 1m30s before adding to the work queue
+INFO skipping delayed certificate check, leader is ingress-1`,
+		},
+		// 4
+		{
+			source:   AcmeCheckPeriodic,
+			jitter:   2 * time.Minute,
+			stop:     true,
+			expDelay: true,
+			logging: `
+INFO starting certificate check (periodic check)
+INFO delaying 1 certificate(s) by 1m30s before adding to the work queue`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		clock := helper_test.NewClockMock(time.Now())
+		queue := &queueMock{}
+		c.instance.up = true
+		c.instance.options.Clock = clock
+		c.instance.options.AcmeQueue = queue
+		c.instance.options.AcmeCheckJitter = test.jitter
+		c.instance.options.AcmeSigner = &signerMock{hasAccount: true}
+		le := &leaderMock{leader: true}
+		c.instance.options.LeaderElector = le
+		stopCh := make(chan struct{})
+		c.instance.options.StopCh = stopCh
+		c.instance.acmeJitter = func(max time.Duration) time.Duration {
+			return max * 3 / 4
+		}
+		c.config.AcmeData().Storages().Acquire("cert1").AddDomains([]string{"d1.local"})
+		count, err := c.instance.AcmeCheck(test.source)
+		if err != nil || count != 1 {
+			t.Errorf("%d: expected 1 certificate without error, but was %d: %v", i, count, err)
+		}
+		if added := len(queue.addedItems()); added != 0 == test.expDelay {
+			t.Errorf("%d: expected delayed '%t', but %d item(s) were added", i, test.expDelay, added)
+		}
+		if test.expDelay {
+			// channels of the clock mock are fired by Add() itself, so nothing
+			// can be added before the jitter is reached
+			clock.Add(time.Minute)
+			if added := len(queue.addedItems()); added != 0 {
+				t.Errorf("%d: expected items added only after the jitter, but %d item(s) were added", i, added)
+			}
+			if test.lose {
+				le.setLeader(false)
+			}
+			if test.stop {
+				close(stopCh)
+			} else {
+				clock.Add(30 * time.Second)
+			}
+			c.instance.acmeDelayed.Wait()
+			expAdded := 1
+			if test.lose || test.stop {
+				expAdded = 0
+			}
+			if added := len(queue.addedItems()); added != expAdded {
+				t.Errorf("%d: expected %d item(s) added after the jitter, but %d item(s) were added", i, expAdded, added)
+			}
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceAcmeOrderBy(t *testing.T) {
+	testCases := []struct {
+		orderBy  string
+		expItems []interface{}
+	}{
+		// 0
+		{
+			orderBy:  "",
+			expItems: []interface{}{"cert-a,,d1.local,d4.local", "cert-b,,d2.local", "cert-c,,d3.local"},
+		},
+		// 1
+		{
+			orderBy:  AcmeOrderByName,
+			expItems: []interface{}{"cert-a,,d1.local,d4.local", "cert-b,,d2.local", "cert-c,,d3.local"},
+		},
+		// 2
+		{
+			orderBy:  AcmeOrderByExpiry,
+			expItems: []interface{}{"cert-c,,d3.local", "cert-a,,d1.local,d4.local", "cert-b,,d2.local"},
+		},
+	}
+	now := time.Now()
+	for i, test := range testCases {
+		c := setup(t)
+		queue := &queueMock{}
+		c.instance.up = true
+		c.instance.options.AcmeQueue = queue
+		c.instance.options.AcmeOrderBy = test.orderBy
+		c.instance.options.AcmeSigner = &signerMock{hasAccount: true}
+		c.instance.options.LeaderElector = &leaderMock{leader: true}
+		for domain, days := range map[string]int{"d1.local": 30, "d2.local": 5, "d4.local": 3} {
+			h := c.config.Hosts().AcquireHost(domain)
+			h.TLS.TLSNotAfter = now.AddDate(0, 0, days)
+		}
+		storages := c.config.AcmeData().Storages()
+		storages.Acquire("cert-b").AddDomains([]string{"d2.local"})
+		storages.Acquire("cert-c").AddDomains([]string{"d3.local"})
+		storages.Acquire("cert-a").AddDomains([]string{"d1.local", "d4.local"})
+		if _, err := c.instance.AcmeCheck("test"); err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+		}
+		if items := queue.addedItems(); !reflect.DeepEqual(items, test.expItems) {
+			t.Errorf("%d: expected items %v, but was %v", i, test.expItems, items)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func TestInstanceRemoveAcmeStorage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		leader   bool
+		expErr   error
+		expItems []interface{}
+		logging  string
+	}{
+		// 0
+		{
+			name:   "cert1",
+			expErr: ErrNotLeader,
+		},
+		// 1
+		{
+			name:   "cert2",
+			leader: true,
+			expErr: ErrAcmeStorageNotFound,
+		},
+		// 2
+		{
+			name:     "cert1",
+			leader:   true,
+			expItems: []interface{}{"cert1,,d1a.local,d1b.local"},
+			logging:  `INFO removing certificate from the work queue: storage=cert1`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		queue := &queueMock{}
+		c.instance.up = true
+		c.instance.options.AcmeQueue = queue
+		c.instance.options.LeaderElector = &leaderMock{leader: test.leader}
+		storages := c.config.AcmeData().Storages()
+		storages.Acquire("cert1").AddDomains([]string{"d1b.local", "d1a.local"})
+		storages.Commit()
+		err := c.instance.RemoveAcmeStorage(test.name)
+		if !errors.Is(err, test.expErr) {
+			t.Errorf("expected error '%v' on %d, but was '%v'", test.expErr, i, err)
+		}
+		if !reflect.DeepEqual(queue.removed, test.expItems) {
+			t.Errorf("removed items differ on %d - expected: %v, actual: %v", i, test.expItems, queue.removed)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceRemoveAcmeStorageSkipNextCheck(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	queue := &queueMock{}
+	c.instance.up = true
+	c.instance.options.AcmeQueue = queue
+	c.instance.options.AcmeSigner = &signerMock{hasAccount: true}
+	c.instance.options.LeaderElector = &leaderMock{leader: true}
+	storages := c.config.AcmeData().Storages()
+	storages.Acquire("cert1").AddDomains([]string{"d1.local"})
+	storages.Acquire("cert2").AddDomains([]string{"d2.local"})
+	storages.Commit()
+
+	if err := c.instance.RemoveAcmeStorage("cert1"); err != nil {
+		t.Fatalf("error removing storage: %v", err)
+	}
+	check := func(step string, expAdded []interface{}, logging string) {
+		queue.added = nil
+		if _, err := c.instance.AcmeCheck("test"); err != nil {
+			t.Errorf("%s: error checking certificates: %v", step, err)
+		}
+		if !reflect.DeepEqual(queue.added, expAdded) {
+			t.Errorf("%s: added items differ - expected: %v, actual: %v", step, expAdded, queue.added)
+		}
+		c.logger.CompareLoggingID(step, logging)
+	}
+
+	check("removed", []interface{}{"cert2,,d2.local"}, `
+INFO removing certificate from the work queue: storage=cert1
+INFO starting certificate check (test)
+INFO skipping certificate removed from the work queue: storage=cert1
+INFO-V(3) enqueue certificate for processing: storage=cert2 domain(s)=d2.local preferred-chain=
+INFO finish adding 1 certificate(s) to the work queue`)
+
+	check("next", []interface{}{"cert1,,d1.local", "cert2,,d2.local"}, `
+INFO starting certificate check (test)
+INFO-V(3) enqueue certificate for processing: storage=cert1 domain(s)=d1.local preferred-chain=
+INFO-V(3) enqueue certificate for processing: storage=cert2 domain(s)=d2.local preferred-chain=
+INFO finish adding 2 certificate(s) to the work queue`)
+}
+
+func TestInstanceAcmeNonLeaderWarn(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	clock := helper_test.NewClockMock(time.Now())
+	le := &leaderMock{}
+	metrics := c.instance.metrics.(*helper_test.MetricsMock)
+	c.instance.options.Clock = clock
+	c.instance.options.AcmeQueue = &queueMock{}
+	c.instance.options.AcmeSigner = &signerMock{hasAccount: true}
+	c.instance.options.LeaderElector = le
+	c.instance.options.AcmeNonLeaderWarnTimeout = time.Minute
+	storages := c.config.AcmeData().Storages()
+	var n int
+	update := func(step string, expLeader bool, logging string) {
+		n++
+		storages.Acquire(fmt.Sprintf("cert%d", n)).AddDomains([]string{fmt.Sprintf("d%d.local", n)})
+		c.instance.acmeUpdate()
+		storages.Commit()
+		if metrics.AcmeLeader != expLeader {
+			t.Errorf("expected acme leader status '%t' on %s, but was '%t'", expLeader, step, metrics.AcmeLeader)
+		}
+		c.logger.CompareLoggingID(step, logging)
+	}
+
+	update("first skip", false, `
+INFO-V(2) skipping acme update check, leader is ingress-1`)
+
+	clock.Add(30 * time.Second)
+	update("skip before timeout", false, `
+INFO-V(2) skipping acme update check, leader is ingress-1`)
+
+	clock.Add(time.Minute)
+	update("skip after timeout", false, `
+WARN skipping acme update check for 1m30s, leader is ingress-1; check the leader election if certificates are not being signed`)
+
+	le.setLeader(true)
+	update("leader", true, `
+INFO-V(3) enqueue certificate for processing: storage=cert4 domain(s)=d4.local preferred-chain=`)
+
+	le.setLeader(false)
+	clock.Add(time.Minute)
+	update("skip after leading", false, `
+INFO-V(2) skipping acme update check, leader is ingress-1`)
+}
+
+type eventRecorderMock struct {
+	events []string
+}
+
+func (r *eventRecorderMock) Event(eventtype, reason, message string) {
+	r.events = append(r.events, eventtype+" "+reason+": "+message)
+}
+
+func TestInstanceDynamicOnly(t *testing.T) {
+	instance := CreateInstance(&helper_test.LoggerMock{T: t}, InstanceOptions{fake: true, DynamicOnly: true})
+	if healthy, reason := instance.Healthy(); !healthy {
+		t.Errorf("expected healthy in dynamic only mode, but was: %s", reason)
+	}
+
+	// maps dir cannot be created, any attempt to write on it fails
+	tempdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempdir, "readonly"), nil, 0o400); err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	mapsDir := filepath.Join(tempdir, "readonly", "maps")
+	options := InstanceOptions{HAProxyMapsDir: mapsDir}
+	if err := options.Validate(); err == nil {
+		t.Errorf("expected invalid maps dir without dynamic only mode")
+	}
+	options.DynamicOnly = true
+	if err := options.Validate(); err != nil {
+		t.Errorf("expected valid options in dynamic only mode, but was: %v", err)
+	}
+
+	c := setupOptions(testOptions{t: t, mapsDir: mapsDir, dynamicOnly: true})
+	defer c.teardown()
+	cli := &clientMock{}
+	c.instance.conns.dynUpdate = cli
+
+	apply := func(ip string) {
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.Dynamic.MinFreeSlots = 1
+		b.AcquireEndpoint(ip, 8080, "")
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		cli.cmd = ""
+		c.Update()
+	}
+
+	apply("172.17.0.11")
+	c.logger.CompareLogging(`
+INFO dynamic only mode, assuming haproxy is running the current configuration`)
+	if result := c.instance.LastUpdate(); result != UpdateNoop {
+		t.Errorf("expected '%s' update, but was '%s'", UpdateNoop, result)
+	}
+
+	apply("172.17.0.12")
+	c.logger.CompareLogging(`
+INFO-V(2) updated endpoint '172.17.0.12:8080' weight '1' state 'ready' on backend/server 'd1_app_8080/srv001'
+INFO haproxy updated without needing to reload. Commands sent: 3 command_count=3`)
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' update, but was '%s'", UpdateDynamic, result)
+	}
+
+	// a change that needs a reload is kept pending, and not committed
+	c.config.Hosts().AcquireHost("d2.local")
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) added host 'd2.local'
+INFO-V(2) need to reload due to config changes: [hosts]
+WARN skipping haproxy reload, changes that cannot be dynamically applied are kept pending in dynamic only mode`)
+	if !c.config.PendingChanges() {
+		t.Errorf("expected changes not applied to be kept pending")
+	}
+	c.Update()
+	c.logger.CompareLogging(`
+INFO-V(2) added host 'd2.local'
+INFO-V(2) need to reload due to config changes: [hosts]
+WARN skipping haproxy reload, changes that cannot be dynamically applied are kept pending in dynamic only mode`)
+
+	c.instance.ForceReload(nil)
+	c.instance.Reload(nil)
+	c.logger.CompareLogging(`
+WARN skipping haproxy reload, instance is in dynamic only mode
+WARN skipping haproxy reload, instance is in dynamic only mode`)
+
+	if files, _ := os.ReadDir(c.tempdir); len(files) > 1 {
+		// errorfiles dir is created by setup()
+		t.Errorf("expected no file written in dynamic only mode, but found %d files", len(files))
+	}
+}
+
+func TestInstanceReloadEvents(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	recorder := &eventRecorderMock{}
+	c.instance.options.EventRecorder = recorder
+
+	b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.Update()
+
+	if len(recorder.events) != 1 {
+		t.Fatalf("expected one event, but was %v", recorder.events)
+	}
+	event := recorder.events[0]
+	prefix := "Normal Reloaded: haproxy reloaded (embedded daemon) in "
+	suffix := ", reason: first run"
+	if !strings.HasPrefix(event, prefix) || !strings.HasSuffix(event, suffix) {
+		t.Errorf("unexpected reload event: %s", event)
+	}
+	if len(c.instance.events) > 0 {
+		t.Errorf("expected no pending events, but was %v", c.instance.events)
+	}
+	c.logger.Logging = []string{}
+
+	// failing validation and reload run the real commands
+	haproxy := filepath.Join(c.tempdir, "haproxy")
+	if err := os.WriteFile(haproxy, []byte("#!/bin/sh\necho \"[ALERT] parsing error\"\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("error writing script: %v", err)
+	}
+	reload := filepath.Join(c.tempdir, "reload.sh")
+	if err := os.WriteFile(reload, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("error writing script: %v", err)
+	}
+	c.instance.options.fake = false
+	c.instance.options.HAProxyBinary = haproxy
+	c.instance.options.ReloadScript = reload
+
+	recorder.events = nil
+	c.instance.options.ValidateBeforeReload = true
+	c.config.Hosts().AcquireHost("d2.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	expected := []string{"Warning ValidationFailed: error validating config file, skipping haproxy reload:\n[ALERT] parsing error\n"}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("expected validation event %q, but was %q", expected, recorder.events)
+	}
+	c.logger.Logging = []string{}
+
+	recorder.events = nil
+	c.instance.options.ValidateBeforeReload = false
+	c.Update()
+	expected = []string{"Warning ReloadFailed: error reloading haproxy (embedded daemon): exit status 1"}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("expected reload event %q, but was %q", expected, recorder.events)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceValidateConfig(t *testing.T) {
+	testCases := []struct {
+		cfg           string
+		expError      string
+		expValidation bool
+	}{
+		// 0
+		{
+			cfg: "global\n",
+		},
+		// 1
+		{
+			cfg:           "global\n  invalid keyword\n",
+			expError:      "[ALERT] parsing error\n",
+			expValidation: true,
+		},
+		// 2
+		{
+			cfg:      "fail silently\n",
+			expError: "exit status 2",
+		},
+		// 3
+		{
+			cfg:      "hang\n",
+			expError: "config validation timed out after 100ms",
+		},
+	}
+	defer func(timeout time.Duration) { validateConfigTimeout = timeout }(validateConfigTimeout)
+	validateConfigTimeout = 100 * time.Millisecond
+	for i, test := range testCases {
+		c := setup(t)
+		checked := filepath.Join(c.tempdir, "checked")
+		script := filepath.Join(c.tempdir, "haproxy")
+		err := os.WriteFile(script, []byte(`#!/bin/sh
+[ "$1" = "-c" ] && [ "$2" = "-f" ] || exit 3
+echo "$3" >`+checked+`
+grep -q "fail silently" "$3" && exit 2
+grep -q hang "$3" && exec sleep 10
+grep -q invalid "$3" && { echo "[ALERT] parsing error"; exit 1; }
+exit 0
+`), 0755)
+		if err != nil {
+			t.Fatalf("%d: error writing script: %v", i, err)
+		}
+		c.instance.options.HAProxyBinary = script
+		err = c.instance.ValidateConfig([]byte(test.cfg))
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("%d: expected error '%s' but was '%s'", i, test.expError, errMsg)
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) != test.expValidation {
+			t.Errorf("%d: expected validation error '%t' but was '%t'", i, test.expValidation, !test.expValidation)
+		}
+		cfgFile, err := os.ReadFile(checked)
+		if err != nil {
+			t.Errorf("%d: config file wasn't checked: %v", i, err)
+		} else if _, err := os.Stat(strings.TrimSpace(string(cfgFile))); !os.IsNotExist(err) {
+			t.Errorf("%d: expected temporary config file to be removed, but stat returned: %v", i, err)
+		}
+		c.logger.CompareLogging("")
+		c.teardown()
+	}
+}
+
+func TestInstanceDetectHAProxyVersion(t *testing.T) {
+	testCases := []struct {
+		output     string
+		expVersion string
+		logging    string
+	}{
+		// 0
+		{
+			output:     "HAProxy version 2.6.12-1 2023/04/01 - https://haproxy.org/",
+			expVersion: "2.6.12-1",
+			logging:    "INFO-V(2) haproxy version: 2.6.12-1",
+		},
+		// 1
+		{
+			output:     "HA-Proxy version 2.0.33 2023/06/23 - https://haproxy.org/\nStatus: long-term supported branch",
+			expVersion: "2.0.33",
+			logging:    "INFO-V(2) haproxy version: 2.0.33",
+		},
+		// 2
+		{
+			output:  "unknown output",
+			logging: "WARN cannot detect the haproxy version, version dependent features are enabled: cannot find the version in the haproxy -v output: unknown output",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		script := filepath.Join(c.tempdir, "haproxy")
+		if err := os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = \"-v\" ] || exit 3\nprintf '"+test.output+"\\n'\n"), 0755); err != nil {
+			t.Fatalf("%d: error writing script: %v", i, err)
+		}
+		c.instance.options.HAProxyBinary = script
+		c.instance.detectHAProxyVersion()
+		if version := c.instance.HAProxyVersion(); version != test.expVersion {
+			t.Errorf("%d: expected version '%s' but was '%s'", i, test.expVersion, version)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+// masterProcs builds the show proc output of a master without workers
+func masterProcs(version string) string {
+	return "#<PID>          <type>          <reloads>       <uptime>        <version>\n" +
+		"1               master          1 [failed: 0]   0d00h00m28s     " + version + "\n" +
+		"# workers\n# old workers\n# programs\n"
+}
+
+func TestInstanceCheckExternal(t *testing.T) {
+	testCases := []struct {
+		extVersion    string
+		localVersion  string
+		invalid       bool
+		expChecked    bool
+		expError      string
+		expSupported  bool
+		expValidation bool
+		logging       string
+	}{
+		// 0
+		{
+			extVersion:   "2.6.1",
+			localVersion: "2.6.12",
+			expChecked:   true,
+			expSupported: true,
+			logging:      "INFO-V(2) haproxy version: 2.6.1",
+		},
+		// 1
+		{
+			extVersion:    "2.6.1",
+			localVersion:  "2.6.12",
+			invalid:       true,
+			expChecked:    true,
+			expError:      "[ALERT] parsing error\n",
+			expSupported:  true,
+			expValidation: true,
+			logging:       "INFO-V(2) haproxy version: 2.6.1",
+		},
+		// 2
+		{
+			extVersion:   "2.5.3",
+			localVersion: "2.6.12",
+			expError:     "config validation is not supported: external haproxy version '2.5.3' does not match the local version '2.6.12'",
+			logging:      "INFO-V(2) haproxy version: 2.5.3",
+		},
+		// 3
+		{
+			localVersion: "2.6.12",
+			expError:     "config validation is not supported: external haproxy version is unknown",
+			logging:      "WARN cannot detect the haproxy version, version dependent features are enabled: external haproxy master did not report its version",
+		},
+		// 4
+		{
+			extVersion: "2.6.1",
+			expError:   "config validation is not supported: cannot find the version in the haproxy -v output: unknown",
+			logging:    "INFO-V(2) haproxy version: 2.6.1",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		checked := filepath.Join(c.tempdir, "checked")
+		script := filepath.Join(c.tempdir, "haproxy")
+		version := "unknown"
+		if test.localVersion != "" {
+			version = "HAProxy version " + test.localVersion + " 2023/04/01 - https://haproxy.org/"
+		}
+		exit := "exit 0"
+		if test.invalid {
+			exit = `echo "[ALERT] parsing error"; exit 1`
+		}
+		err := os.WriteFile(script, []byte(`#!/bin/sh
+[ "$1" = "-v" ] && { echo "`+version+`"; exit 0; }
+[ "$1" = "-c" ] || exit 3
+touch `+checked+`
+`+exit+`
+`), 0755)
+		if err != nil {
+			t.Fatalf("%d: error writing script: %v", i, err)
+		}
+		c.instance.options.fake = false
+		c.instance.options.IsExternal = true
+		c.instance.options.HAProxyBinary = script
+		var masterOut string
+		if test.extVersion != "" {
+			masterOut = masterProcs(test.extVersion)
+		}
+		c.instance.conns.master = &procsMock{outputs: []string{masterOut}}
+		err = c.instance.check()
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("%d: expected error '%s' but was '%s'", i, test.expError, errMsg)
+		}
+		if supported := !errors.Is(err, errValidationNotSupported); supported != test.expSupported {
+			t.Errorf("%d: expected supported validation '%t' but was '%t'", i, test.expSupported, supported)
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) != test.expValidation {
+			t.Errorf("%d: expected validation error '%t' but was '%t'", i, test.expValidation, !test.expValidation)
+		}
+		if _, err := os.Stat(checked); (err == nil) != test.expChecked {
+			t.Errorf("%d: expected config checked '%t' but stat returned: %v", i, test.expChecked, err)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceRefreshExternalVersion(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.options.IsExternal = true
+	c.instance.conns.master = &procsMock{outputs: []string{masterProcs("2.5.3"), masterProcs("2.5.3"), masterProcs("2.6.1"), ""}}
+	for _, expVersion := range []string{"2.5.3", "2.5.3", "2.6.1", "2.6.1"} {
+		c.instance.detectHAProxyVersion()
+		if version := c.instance.HAProxyVersion(); version != expVersion {
+			t.Errorf("expected version '%s' but was '%s'", expVersion, version)
+		}
+	}
+	c.logger.CompareLogging(`
+INFO-V(2) haproxy version: 2.5.3
+INFO-V(2) haproxy version: 2.6.1
+WARN cannot refresh the haproxy version, using 2.6.1: external haproxy master did not report its version`)
+}
+
+func TestSameMajorMinor(t *testing.T) {
+	testCases := []struct {
+		v1, v2   string
+		expected bool
+	}{
+		// 0
+		{v1: "2.6.12", v2: "2.6.1", expected: true},
+		// 1
+		{v1: "2.6.12-1", v2: "2.6", expected: true},
+		// 2
+		{v1: "2.6.12", v2: "2.5.12", expected: false},
+		// 3
+		{v1: "2.6.12", v2: "", expected: false},
+		// 4
+		{v1: "", v2: "", expected: false},
+	}
+	for i, test := range testCases {
+		if actual := sameMajorMinor(test.v1, test.v2); actual != test.expected {
+			t.Errorf("%d: expected '%t' comparing '%s' and '%s', but was '%t'", i, test.expected, test.v1, test.v2, actual)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	testCases := []struct {
+		version  string
+		major    int
+		minor    int
+		expected bool
+	}{
+		// 0
+		{version: "2.2.0", major: 2, minor: 2, expected: true},
+		// 1
+		{version: "2.6.12-1", major: 2, minor: 2, expected: true},
+		// 2
+		{version: "2.1.12", major: 2, minor: 2, expected: false},
+		// 3
+		{version: "3.0.1", major: 2, minor: 8, expected: true},
+		// 4
+		{version: "1.9", major: 2, minor: 0, expected: false},
+		// 5
+		{version: "2.10.1", major: 2, minor: 9, expected: true},
+		// 6
+		{version: "dev", major: 2, minor: 0, expected: false},
+	}
+	for i, test := range testCases {
+		if actual := versionAtLeast(test.version, test.major, test.minor); actual != test.expected {
+			t.Errorf("%d: expected %t for %s >= %d.%d, but was %t", i, test.expected, test.version, test.major, test.minor, actual)
+		}
+	}
+}
+
+func TestInstancePreReload(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	testCases := []struct {
+		hook     func() error
+		timeout  time.Duration
+		expError string
+		logging  string
+	}{
+		// 0
+		{
+			logging: `
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="requested"`,
+		},
+		// 1
+		{
+			hook: func() error { return nil },
+			logging: `
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="requested"`,
+		},
+		// 2
+		{
+			hook:     func() error { return fmt.Errorf("backup failed") },
+			expError: "backup failed",
+			logging: `
+ERROR error calling the pre reload hook, skipping haproxy reload: backup failed`,
+		},
+		// 3
+		{
+			hook:     func() error { panic("invalid backup dir") },
+			expError: "panic calling the pre reload hook: invalid backup dir",
+			logging: `
+ERROR error calling the pre reload hook, skipping haproxy reload: panic calling the pre reload hook: invalid backup dir`,
+		},
+		// 4
+		{
+			hook:     func() error { <-block; return nil },
+			timeout:  50 * time.Millisecond,
+			expError: "pre reload hook timed out after 50ms",
+			logging: `
+ERROR error calling the pre reload hook, skipping haproxy reload: pre reload hook timed out after 50ms`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+		c.instance.options.Clock = clock
+		c.instance.options.OnPreReload = test.hook
+		c.instance.options.PreReloadTimeout = test.timeout
+		// a blocked hook only times out when the clock moves forward
+		run := func(f func()) {
+			done := make(chan struct{})
+			go func() {
+				f()
+				close(done)
+			}()
+			if test.timeout > 0 {
+				for clock.Waiters() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				clock.Add(test.timeout)
+			}
+			<-done
+		}
+		var err error
+		run(func() { err = c.instance.preReload() })
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("%d: expected error '%s' but was '%s'", i, test.expError, errMsg)
+		}
+		run(func() { c.instance.reload(utils.NewTimer(nil)) })
+		if c.instance.forceReload != (test.expError != "") {
+			t.Errorf("%d: expected force reload %t but was %t", i, test.expError != "", c.instance.forceReload)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceReloadEmbeddedTimeout(t *testing.T) {
+	testCases := []struct {
+		script   string
+		timeout  time.Duration
+		drain    time.Duration
+		fallback []string
+		stop     bool
+		expError string
+		logging  string
+	}{
+		// 0
+		{
+			script: "echo reloaded",
+			logging: `
+INFO output from haproxy:
+reloaded`,
+		},
+		// 1
+		{
+			script:   "sleep 10",
+			timeout:  100 * time.Millisecond,
+			expError: "reload script timed out after 100ms",
+		},
+		// 2
+		{
+			script:   "sleep 10",
+			stop:     true,
+			expError: "reload script cancelled, controller is stopping",
+		},
+		// 3
+		{
+			script: "echo '[WARNING]  (1) : config : missing timeouts'",
+			logging: `
+WARN output from haproxy:
+[WARNING]  (1) : config : missing timeouts`,
+		},
+		// 4
+		{
+			script:   "echo '[ALERT]    (1) : config : parsing error'; exit 1",
+			expError: "exit status 1",
+			logging: `
+ERROR output from haproxy:
+[ALERT]    (1) : config : parsing error`,
+		},
+		// 5
+		{
+			script:   "exit 1",
+			expError: "exit status 1",
+		},
+		// 6
+		{
+			script: `echo "drain $5"`,
+			logging: `
+INFO output from haproxy:
+drain 0`,
+		},
+		// 7
+		{
+			script: `echo "drain $5"`,
+			drain:  1500 * time.Millisecond,
+			logging: `
+INFO output from haproxy:
+drain 2`,
+		},
+		// 8
+		{
+			script:   `[ "$1" = "native" ] && echo "reloaded $1" || exit 1`,
+			fallback: []string{"native"},
+			logging: `
+WARN haproxy reload failed using the reusesocket reload strategy, falling back to native: exit status 1
+INFO output from haproxy:
+reloaded native`,
+		},
+		// 9
+		{
+			script:   "exit 1",
+			fallback: []string{"reusesocket", "native"},
+			expError: "exit status 1",
+			logging: `
+WARN haproxy reload failed using the reusesocket reload strategy, falling back to native: exit status 1`,
+		},
+		// 10
+		{
+			script:   `[ "$1" = "native" ] && echo "reloaded $1" || sleep 10`,
+			timeout:  100 * time.Millisecond,
+			fallback: []string{"native"},
+			logging: `
+WARN haproxy reload failed using the reusesocket reload strategy, falling back to native: reload script timed out after 100ms
+INFO output from haproxy:
+reloaded native`,
+		},
+		// 11
+		{
+			script:   "sleep 10",
+			stop:     true,
+			fallback: []string{"native"},
+			expError: "reload script cancelled, controller is stopping",
+		},
+		// 12
+		{
+			script: `echo "[WARNING]  (12) : Failed to connect to the old process socket '/var/run/haproxy.sock'"`,
+			logging: `
+WARN output from haproxy:
+[WARNING]  (12) : Failed to connect to the old process socket '/var/run/haproxy.sock'
+
+WARN new haproxy worker did not reuse the listening sockets, connections might be dropped on reloads: [WARNING]  (12) : Failed to connect to the old process socket '/var/run/haproxy.sock'`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		script := filepath.Join(c.tempdir, "reload.sh")
+		if err := os.WriteFile(script, []byte("#!/bin/sh\n"+test.script+"\n"), 0755); err != nil {
+			t.Fatalf("error writing script: %v", err)
+		}
+		c.instance.options.ReloadScript = script
+		c.instance.options.ReloadTimeout = test.timeout
+		c.instance.options.WorkerDrainTimeout = test.drain
+		c.instance.options.ReloadStrategy = "reusesocket"
+		c.instance.options.ReloadStrategyFallback = test.fallback
+		stopCh := make(chan struct{})
+		c.instance.options.StopCh = stopCh
+		if test.stop {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				close(stopCh)
+			}()
+		}
+		var errMsg string
+		if err := c.instance.reloadEmbeddedDaemon(); err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("expected error '%s' on %d, but was '%s'", test.expError, i, errMsg)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceCheckSocketReuse(t *testing.T) {
+	testCases := []struct {
+		output  string
+		expNot  int
+		logging string
+	}{
+		// 0
+		{
+			output: "",
+		},
+		// 1
+		{
+			output: `[NOTICE]   (1) : New worker (12) forked
+[NOTICE]   (1) : Loading success.`,
+		},
+		// 2
+		{
+			output: `[WARNING]  (12) : Failed to get the number of sockets to be transferred !
+[ALERT]    (12) : Failed to get the sockets from the old process!
+[NOTICE]   (1) : Loading success.`,
+			expNot: 1,
+			logging: `
+WARN new haproxy worker did not reuse the listening sockets, connections might be dropped on reloads: [WARNING]  (12) : Failed to get the number of sockets to be transferred !`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.checkSocketReuse(test.output)
+		metrics := c.instance.metrics.(*helper_test.MetricsMock)
+		if metrics.ReloadSocketsNotReused != test.expNot {
+			t.Errorf("%d: expected %d sockets not reused, but was %d", i, test.expNot, metrics.ReloadSocketsNotReused)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceConfirmNewWorker(t *testing.T) {
+	procs := func(workers ...int) string {
+		out := `#<PID>          <type>          <reloads>       <uptime>        <version>
+1               master          1 [failed: 0]   0d00h00m28s     2.5.3-abf078b
+# workers
+`
+		for _, pid := range workers {
+			out += fmt.Sprintf("%-16dworker          0               0d00h00m00s     2.5.3-abf078b\n", pid)
+		}
+		return out + "# old workers\n# programs\n"
+	}
+	testCases := []struct {
+		outputs  []string
+		expError string
+	}{
+		// 0
+		{
+			outputs: []string{procs(2, 3)},
+		},
+		// 1
+		{
+			outputs: []string{procs(2), procs(2), procs(3)},
+		},
+		// 2
+		{
+			outputs:  []string{procs(2)},
+			expError: "new haproxy worker was not confirmed after 50ms",
+		},
+		// 3
+		{
+			outputs:  []string{procs()},
+			expError: "new haproxy worker was not confirmed after 50ms",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+		c.instance.options.Clock = clock
+		c.instance.options.ExternalReloadConfirmTimeout = 50 * time.Millisecond
+		c.instance.options.ExternalPollInterval = 10 * time.Millisecond
+		masterSock := &procsMock{outputs: test.outputs}
+		errCh := make(chan error)
+		go func() {
+			errCh <- c.instance.confirmNewWorker(masterSock, map[int]bool{2: true})
+		}()
+		var err error
+	wait:
+		for {
+			select {
+			case err = <-errCh:
+				break wait
+			case <-time.After(time.Millisecond):
+				if clock.Waiters() > 0 {
+					clock.Add(c.instance.options.ExternalPollInterval)
+				}
+			}
+		}
+		var errStr string
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.expError {
+			t.Errorf("%d: expected error '%s', but was '%s'", i, test.expError, errStr)
+		}
+		c.teardown()
+	}
+}
+
+// procsMock responds the show proc command with the configured outputs,
+// repeating the last one when all of them were consumed.
+type procsMock struct {
+	clientMock
+	outputs []string
+}
+
+func (p *procsMock) Send(observer func(duration time.Duration), command ...string) ([]string, error) {
+	out := p.outputs[0]
+	if len(p.outputs) > 1 {
+		p.outputs = p.outputs[1:]
+	}
+	return []string{out}, nil
+}
+
+func TestInstanceLastUpdate(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.conns.dynUpdate = &clientMock{cmdOutput: []string{""}}
+
+	if result := c.instance.LastUpdate(); result != "" {
+		t.Errorf("expected empty result before the first update, but was '%s'", result)
+	}
+
+	apply := func(weight int) {
+		c.config.Hosts().RemoveAll([]string{"d1.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.AcquireEndpoint("172.17.0.11", 8080, "").Weight = weight
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+	}
+
+	apply(1)
+	if result := c.instance.LastUpdate(); result != UpdateReload {
+		t.Errorf("expected '%s' on the first update, but was '%s'", UpdateReload, result)
+	}
+
+	apply(1)
+	if result := c.instance.LastUpdate(); result != UpdateNoop {
+		t.Errorf("expected '%s' without changes, but was '%s'", UpdateNoop, result)
+	}
+
+	apply(50)
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' after a weight change, but was '%s'", UpdateDynamic, result)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceDrainExpiry(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	cli := &clientMock{cmdOutput: []string{""}}
+	c.instance.conns.dynUpdate = cli
+	clock := helper_test.NewClockMock(time.Now())
+	queue := &queueMock{}
+	c.instance.options.Clock = clock
+	c.instance.options.UpdateQueue = queue
+	c.instance.options.EndpointDrainPeriod = time.Minute
+
+	apply := func(targets ...string) {
+		c.config.Hosts().RemoveAll([]string{"d1.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		for _, target := range targets {
+			b.AcquireEndpoint(target, 8080, "")
+		}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+	}
+
+	apply("172.17.0.11", "172.17.0.12")
+	apply("172.17.0.11")
+	c.logger.Logging = []string{}
+	if len(c.instance.draining) != 1 {
+		t.Errorf("expected one draining endpoint, but was %v", c.instance.draining)
+	}
+	for i := 0; clock.Waiters() == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := clock.Waiters(); n != 1 {
+		t.Errorf("expected an update scheduled to the drain expiry, but was %d", n)
+	}
+
+	// drain expires without any further config change
+	cli.cmd = ""
+	clock.Add(time.Minute)
+	for i := 0; queue.notifiedCount() == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := queue.notifiedCount(); n != 1 {
+		t.Fatalf("expected the update queue notified once, but was %d", n)
+	}
+	c.Update()
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' after the drain expired, but was '%s'", UpdateDynamic, result)
+	}
+	c.compareText("cmd", cli.cmd, `
+set server d1_app_8080/srv002 state maint
+set server d1_app_8080/srv002 addr 127.0.0.1 port 1023
+set server d1_app_8080/srv002 weight 0
+`)
+	if len(c.instance.draining) != 0 {
+		t.Errorf("expected no draining endpoint, but was %v", c.instance.draining)
+	}
+	b := c.config.Backends().FindBackend("d1", "app", "8080")
+	if ep := b.Endpoints[1]; ep.Name != "srv002" || !ep.IsEmpty() {
+		t.Errorf("expected srv002 as an empty slot, but was %+v", ep)
+	}
+	c.logger.CompareLogging(`
+INFO-V(2) endpoint drain period expired, requesting an update
+INFO-V(2) disabled endpoint '172.17.0.12:8080' on backend/server 'd1_app_8080/srv002'
+INFO haproxy updated without needing to reload. Commands sent: 3 command_count=3`)
+}
+
+func TestInstanceDynamicWeights(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	cli := &clientMock{cmdOutput: []string{""}}
+	c.instance.conns.dynUpdate = cli
+
+	apply := func(weights ...int) {
+		c.config.Hosts().RemoveAll([]string{"d1.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		for i, weight := range weights {
+			b.AcquireEndpoint(fmt.Sprintf("172.17.0.%d", 11+i), 8080, "").Weight = weight
+		}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+	}
+
+	apply(90, 10)
+	if result := c.instance.LastUpdate(); result != UpdateReload {
+		t.Errorf("expected '%s' on the first update, but was '%s'", UpdateReload, result)
+	}
+	c.logger.Logging = []string{}
+	cli.cmd = ""
+
+	apply(50, 50)
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' after weight changes, but was '%s'", UpdateDynamic, result)
+	}
+	c.compareText("cmd", cli.cmd, `
+set server d1_app_8080/srv001 addr 172.17.0.11 port 8080
+set server d1_app_8080/srv001 state ready
+set server d1_app_8080/srv001 weight 50
+set server d1_app_8080/srv002 addr 172.17.0.12 port 8080
+set server d1_app_8080/srv002 state ready
+set server d1_app_8080/srv002 weight 50
+`)
+	c.logger.CompareLogging(`
+INFO-V(2) updated endpoint '172.17.0.11:8080' weight '50' state 'ready' on backend/server 'd1_app_8080/srv001'
+INFO-V(2) updated endpoint '172.17.0.12:8080' weight '50' state 'ready' on backend/server 'd1_app_8080/srv002'
+INFO haproxy updated without needing to reload. Commands sent: 6 command_count=6`)
+}
+
+func TestInstancePause(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	cli := &clientMock{cmdOutput: []string{""}}
+	c.instance.conns.dynUpdate = cli
+
+	apply := func(weight int) {
+		c.config.Hosts().RemoveAll([]string{"d1.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.AcquireEndpoint("172.17.0.11", 8080, "").Weight = weight
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+	}
+
+	apply(1)
+	c.logger.Logging = []string{}
+
+	c.instance.Pause()
+	c.instance.Pause()
+	if !c.instance.Paused() {
+		t.Errorf("expected paused instance")
+	}
+	apply(10)
+	apply(50)
+	c.instance.ForceReload(utils.NewTimer(nil))
+	if cli.cmd != "" {
+		t.Errorf("expected no dynamic update while paused, but was: %s", cli.cmd)
+	}
+	c.logger.CompareLogging(`
+INFO haproxy updates paused
+INFO skipping haproxy update, updates are paused
+INFO skipping haproxy update, updates are paused
+WARN skipping haproxy reload, updates are paused`)
+
+	c.instance.Resume(utils.NewTimer(nil))
+	if c.instance.Paused() {
+		t.Errorf("expected resumed instance")
+	}
+	if result := c.instance.LastUpdate(); result != UpdateDynamic {
+		t.Errorf("expected '%s' after resume, but was '%s'", UpdateDynamic, result)
+	}
+	if !strings.HasSuffix(cli.cmd, "set server d1_app_8080/srv001 weight 50\n") {
+		t.Errorf("expected the last weight dynamically updated after resume, but was: %s", cli.cmd)
+	}
+	c.logger.CompareLogging(`
+INFO haproxy updates resumed, applying the changes made while paused
+INFO-V(2) updated endpoint '172.17.0.11:8080' weight '50' state 'ready' on backend/server 'd1_app_8080/srv001'
+INFO haproxy updated without needing to reload. Commands sent: 3 command_count=3`)
+
+	c.instance.Pause()
+	c.instance.Resume(utils.NewTimer(nil))
+	c.instance.Resume(utils.NewTimer(nil))
+	c.logger.CompareLogging(`
+INFO haproxy updates paused
+INFO haproxy updates resumed, no update was requested while paused`)
+}
+
+func TestInstanceDynamicMapUpdates(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.options.DynamicMapUpdates = true
+	c.config.maps = newMapTracker(true)
+	cli := &clientMock{}
+	c.instance.conns.dynUpdate = cli
+
+	apply := func(hostnames ...string) {
+		c.config.Hosts().RemoveAll([]string{"d1.local", "d2.local"})
+		c.config.Backends().RemoveAll([]string{"d1_app_8080"})
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Dynamic.DynUpdate = true
+		b.AcquireEndpoint("172.17.0.11", 8080, "")
+		for _, hostname := range hostnames {
+			c.config.Hosts().AcquireHost(hostname).AddPath(b, "/", hatypes.MatchExact)
+		}
+		cli.cmd = ""
+		c.Update()
+	}
+
+	testCases := []struct {
+		hostnames []string
+		result    UpdateResult
+		cmd       string
+	}{
+		// 0
+		{
+			hostnames: []string{"d1.local"},
+			result:    UpdateReload,
+		},
+		// 1
+		{
+			hostnames: []string{"d1.local", "d2.local"},
+			result:    UpdateDynamic,
+			cmd: `
+add map /etc/haproxy/maps/_front_http_host__exact.map d2.local#/ d1_app_8080
+add map /etc/haproxy/maps/_front_https_host__exact.map d2.local#/ d1_app_8080
+`,
+		},
+		// 2
+		{
+			hostnames: []string{"d2.local"},
+			result:    UpdateDynamic,
+			cmd: `
+del map /etc/haproxy/maps/_front_http_host__exact.map d1.local#/
+del map /etc/haproxy/maps/_front_https_host__exact.map d1.local#/
+`,
+		},
+		// 3
+		{
+			hostnames: []string{},
+			result:    UpdateReload,
+		},
+	}
+	for i, test := range testCases {
+		apply(test.hostnames...)
+		if result := c.instance.LastUpdate(); result != test.result {
+			t.Errorf("expected '%s' on %d, but was '%s'", test.result, i, result)
+		}
+		cmd := strings.TrimSpace(strings.ReplaceAll(cli.cmd, c.tempdir, "/etc/haproxy/maps"))
+		if expected := strings.TrimSpace(test.cmd); cmd != expected {
+			t.Errorf("cmd differs on %d:\n%s", i, diff.Diff(expected, cmd))
+		}
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceReloadWorkerPersistStateFailure(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	missingSock := filepath.Join(c.tempdir, "missing.sock")
+	c.instance.conns = newConnections(missingSock, missingSock, "", 0)
+	c.config.Global().LoadServerState = true
+
+	if err := c.instance.reloadWorker(); err == nil {
+		t.Errorf("expected reload failure on a missing master socket")
+	}
+	if len(c.logger.Logging) != 1 {
+		t.Fatalf("expected one log line, but was: %v", c.logger.Logging)
+	}
+	msg := c.logger.Logging[0]
+	prefix := "WARN failed to persist servers state before worker reload: failed to retrieve servers state from external haproxy; "
+	if !strings.HasPrefix(msg, prefix) || !strings.Contains(msg, missingSock) || strings.Contains(msg, "%!") {
+		t.Errorf("expected the underlying error rendered in the warning, but was: %s", msg)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstancePersistServersStateMode(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("cannot lookup the current user: %v", err)
+	}
+	state := "1\n# be_id be_name srv_id srv_name srv_addr srv_op_state srv_check_status srv_check_result srv_check_health srv_check_state srv_agent_state\n"
+	testCases := []struct {
+		mode     os.FileMode
+		chown    bool
+		username string
+		expMode  os.FileMode
+		logging  string
+	}{
+		// 0
+		{
+			expMode: 0o644,
+		},
+		// 1
+		{
+			mode:    0o640,
+			expMode: 0o640,
+		},
+		// 2
+		{
+			mode:     0o600,
+			chown:    true,
+			username: current.Username,
+			expMode:  0o600,
+		},
+		// 3
+		{
+			mode:     0o640,
+			chown:    true,
+			username: "non-existent-haproxy-user",
+			expMode:  0o640,
+			logging:  `WARN cannot change the owner of the servers state file: user: unknown user non-existent-haproxy-user`,
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		stateDir := filepath.Join(c.tempdir, "var/lib/haproxy")
+		if err := os.MkdirAll(stateDir, 0o755); err != nil {
+			t.Fatalf("error creating state dir: %v", err)
+		}
+		// an existing file should also have its mode changed
+		stateFile := filepath.Join(stateDir, "state-global")
+		if err := os.WriteFile(stateFile, nil, 0o666); err != nil {
+			t.Fatalf("error creating state file: %v", err)
+		}
+		if test.mode != 0 {
+			c.instance.options.ServerStateFileMode = test.mode
+		}
+		c.instance.options.ServerStateFileChown = test.chown
+		c.instance.conns.admin = &clientMock{cmdOutput: []string{state}}
+		global := c.config.Global()
+		global.LocalFSPrefix = c.tempdir
+		global.Security.Username = test.username
+		if err := c.instance.persistServersState(); err != nil {
+			t.Errorf("unexpected error on %d: %v", i, err)
+		}
+		info, err := os.Stat(stateFile)
+		if err != nil {
+			t.Fatalf("error reading state file on %d: %v", i, err)
+		}
+		if mode := info.Mode().Perm(); mode != test.expMode {
+			t.Errorf("expected mode %#o on %d, but was %#o", test.expMode, i, mode)
+		}
+		if content, _ := os.ReadFile(stateFile); string(content) != state {
+			t.Errorf("unexpected state file content on %d: %s", i, content)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+type failingSocketMock struct {
+	clientMock
+	fails int
+	err   error
+}
+
+func (s *failingSocketMock) Send(observer func(duration time.Duration), command ...string) ([]string, error) {
+	out, _ := s.clientMock.Send(observer, command...)
+	if s.fails > 0 {
+		s.fails--
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, &socket.NotSentError{Err: fmt.Errorf("connection refused")}
+	}
+	return out, nil
+}
+
+func TestInstanceReloadWorkerRetries(t *testing.T) {
+	testCases := []struct {
+		retries  int
+		fails    int
+		err      error
+		stop     bool
+		expCmd   int
+		expError string
+		logging  string
+	}{
+		// 0
+		{
+			fails:    1,
+			expCmd:   1,
+			expError: "error sending reload to master socket: connection refused",
+		},
+		// 1
+		{
+			retries: 3,
+			fails:   2,
+			expCmd:  3,
+			logging: `
+WARN error sending reload to master socket, retrying in 100ms (1/3): connection refused
+WARN error sending reload to master socket, retrying in 200ms (2/3): connection refused`,
+		},
+		// 2
+		{
+			retries:  2,
+			fails:    5,
+			expCmd:   3,
+			expError: "error sending reload to master socket: connection refused",
+			logging: `
+WARN error sending reload to master socket, retrying in 100ms (1/2): connection refused
+WARN error sending reload to master socket, retrying in 200ms (2/2): connection refused`,
+		},
+		// 3
+		{
+			retries:  2,
+			fails:    5,
+			stop:     true,
+			expCmd:   1,
+			expError: "error sending reload to master socket, retry cancelled: connection refused",
+			logging: `
+WARN error sending reload to master socket, retrying in 100ms (1/2): connection refused`,
+		},
+		// 4
+		{
+			retries:  2,
+			fails:    1,
+			err:      fmt.Errorf("error reading response from /var/run/master.sock: i/o timeout"),
+			expCmd:   1,
+			expError: "error sending reload to master socket: error reading response from /var/run/master.sock: i/o timeout",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+		c.instance.options.Clock = clock
+		c.instance.options.ExternalReloadRetries = test.retries
+		c.instance.options.StopCh = make(chan struct{})
+		master := &failingSocketMock{fails: test.fails, err: test.err}
+		c.instance.conns.master = master
+		if test.stop {
+			close(c.instance.options.StopCh)
+		}
+		errCh := make(chan error)
+		go func() {
+			errCh <- c.instance.reloadWorker()
+		}()
+		var err error
+	wait:
+		for {
+			select {
+			case err = <-errCh:
+				break wait
+			case <-time.After(time.Millisecond):
+				if !test.stop {
+					clock.Add(externalReloadMaxBackoff)
+				}
+			}
+		}
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("%d: expected error '%s' but was '%s'", i, test.expError, errMsg)
+		}
+		if cmd := strings.Count(master.cmd, "reload\n"); cmd != test.expCmd {
+			t.Errorf("%d: expected %d reload commands, but was %d", i, test.expCmd, cmd)
+		}
+		c.logger.CompareLogging(test.logging)
+		c.teardown()
+	}
+}
+
+func TestInstanceNoopMetrics(t *testing.T) {
+	instance := CreateInstance(&helper_test.LoggerMock{T: t}, InstanceOptions{fake: true}).(*instance)
+	if instance.metrics != utils.NoopMetrics {
+		t.Errorf("expected no-op metrics if metrics is not configured")
+	}
+	instance.updateSuccessful(false)
+}
+
+func TestInstanceHealthyClock(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	now := time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC)
+	clock := helper_test.NewClockMock(now)
+	c.instance.options.Clock = clock
+	c.instance.up = true
+
+	c.instance.updateSuccessful(false)
+	clock.Add(90 * time.Second)
+	c.instance.updateSuccessful(false)
+	clock.Add(5 * time.Second)
+	expected := "haproxy failing to reload for 1m35s, since 2022-03-04 10:20:30 +0000 UTC"
+	if healthy, reason := c.instance.Healthy(); healthy || reason != expected {
+		t.Errorf("expected not healthy with reason '%s', but was healthy=%t reason='%s'", expected, healthy, reason)
+	}
+
+	c.instance.updateSuccessful(true)
+	if healthy, reason := c.instance.Healthy(); !healthy || reason != "" {
+		t.Errorf("expected healthy after a successful update, but was healthy=%t reason='%s'", healthy, reason)
+	}
+}
+
+func TestInstanceReloadFailingSeconds(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+	c.instance.options.Clock = clock
+	metrics := c.instance.metrics.(*helper_test.MetricsMock)
+	c.Update()
+
+	c.instance.updateSuccessful(false)
+	if metrics.ReloadFailingSeconds != 0 {
+		t.Errorf("expected 0s failing on the first failure, but was %v", metrics.ReloadFailingSeconds)
+	}
+	clock.Add(90 * time.Second)
+	c.instance.updateSuccessful(false)
+	if metrics.ReloadFailingSeconds != 90 {
+		t.Errorf("expected 90s failing, but was %v", metrics.ReloadFailingSeconds)
+	}
+
+	// every update refreshes the failing time
+	clock.Add(30 * time.Second)
+	c.Update()
+	if metrics.ReloadFailingSeconds != 120 {
+		t.Errorf("expected 120s failing after an update, but was %v", metrics.ReloadFailingSeconds)
+	}
+
+	c.instance.updateSuccessful(true)
+	if metrics.ReloadFailingSeconds != 0 {
+		t.Errorf("expected 0s failing after a successful reload, but was %v", metrics.ReloadFailingSeconds)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceLastSuccessfulApply(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	now := time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC)
+	clock := helper_test.NewClockMock(now)
+	c.instance.options.Clock = clock
+	metrics := c.instance.metrics.(*helper_test.MetricsMock)
+
+	c.Update()
+	if !metrics.LastSuccessfulApply.Equal(now) {
+		t.Errorf("expected last successful apply at %s after a reload, but was %s", now, metrics.LastSuccessfulApply)
+	}
+
+	// failing to write the maps does not apply the changes
+	clock.Add(time.Minute)
+	mapsDir := c.config.options.mapsDir
+	c.config.options.mapsDir = filepath.Join(c.tempdir, "missing")
+	b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+	h := c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+	c.logger.Logging = []string{}
+	c.Update()
+	if len(c.logger.Logging) == 0 || !strings.HasPrefix(c.logger.Logging[0], "ERROR error building") {
+		t.Errorf("expected a map building failure, but was: %v", c.logger.Logging)
+	}
+	if !metrics.LastSuccessfulApply.Equal(now) {
+		t.Errorf("expected last successful apply unchanged after a failure, but was %s", metrics.LastSuccessfulApply)
+	}
+
+	clock.Add(time.Minute)
+	c.config.options.mapsDir = mapsDir
+	c.instance.forceReload = true
+	c.Update()
+	if expected := now.Add(2 * time.Minute); !metrics.LastSuccessfulApply.Equal(expected) {
+		t.Errorf("expected last successful apply at %s after a fixed update, but was %s", expected, metrics.LastSuccessfulApply)
+	}
+
+	// matching configs don't apply anything after a failed reload
+	clock.Add(time.Minute)
+	c.instance.updateSuccessful(false)
+	c.Update()
+	if expected := now.Add(2 * time.Minute); !metrics.LastSuccessfulApply.Equal(expected) {
+		t.Errorf("expected last successful apply unchanged after a failed reload, but was %s", metrics.LastSuccessfulApply)
+	}
+	c.instance.updateSuccessful(true)
+
+	// matching configs don't apply anything while a reload is enqueued
+	clock.Add(time.Minute)
+	c.instance.reloadPending = 1
+	c.Update()
+	if expected := now.Add(2 * time.Minute); !metrics.LastSuccessfulApply.Equal(expected) {
+		t.Errorf("expected last successful apply unchanged while a reload is enqueued, but was %s", metrics.LastSuccessfulApply)
+	}
+	c.instance.reloadPending = 0
+
+	clock.Add(time.Minute)
+	c.Update()
+	if expected := now.Add(5 * time.Minute); !metrics.LastSuccessfulApply.Equal(expected) {
+		t.Errorf("expected last successful apply at %s after matching configs, but was %s", expected, metrics.LastSuccessfulApply)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceReloadMetrics(t *testing.T) {
+	testCases := []struct {
+		external bool
+		strategy string
+		expected string
+	}{
+		// 0
+		{
+			strategy: "native",
+			expected: "mode=embedded strategy=native success=true",
+		},
+		// 1
+		{
+			strategy: "reusesocket",
+			expected: "mode=embedded strategy=reusesocket success=true",
+		},
+		// 2
+		{
+			external: true,
+			strategy: "reusesocket",
+			expected: "mode=external strategy=reusesocket success=true",
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.options.IsExternal = test.external
+		c.instance.options.ReloadStrategy = test.strategy
+		metrics := c.instance.metrics.(*helper_test.MetricsMock)
+		c.Update()
+		if expected := []string{test.expected}; !reflect.DeepEqual(metrics.Reloads, expected) {
+			t.Errorf("expected reload metrics %v on %d, but was %v", expected, i, metrics.Reloads)
+		}
+		c.logger.Logging = []string{}
+		c.teardown()
+	}
+}
+
+func TestInstanceCertExpiring(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	now := time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC)
+	day := 24 * time.Hour
+	clock := helper_test.NewClockMock(now)
+	c.instance.options.Clock = clock
+	c.instance.options.CertExpiringThreshold = 10 * day
+	var calls []string
+	c.instance.options.OnCertExpiring = func(host, commonName string, notAfter time.Time) {
+		calls = append(calls, fmt.Sprintf("%s/%s/%s", host, commonName, notAfter.Sub(now)))
+	}
+	b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	setCert := func(hostname, cn string, notAfter time.Time) {
+		c.config.Hosts().RemoveAll([]string{hostname})
+		h := c.config.Hosts().AcquireHost(hostname)
+		h.AddPath(b, "/", hatypes.MatchBegin)
+		h.TLS.TLSFilename = "/var/haproxy/ssl/certs/" + cn + ".pem"
+		h.TLS.TLSHash = cn
+		h.TLS.TLSCommonName = cn
+		h.TLS.TLSNotAfter = notAfter
+	}
+	expectCalls := func(step string, expected []string) {
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("expected hook calls %v on %s, but was %v", expected, step, calls)
+		}
+		calls = nil
+	}
 
-	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
-	h = c.config.Hosts().AcquireHost("d1.local")
-	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
-	h.TLS.TLSHash = "0"
-	h.AddPath(b, "/", hatypes.MatchBegin)
-	h = c.config.Hosts().AcquireHost("*.app.d1.local")
-	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
-	h.TLS.TLSHash = "0"
-	h.AddPath(b, "/", hatypes.MatchBegin)
-	h = c.config.Hosts().AcquireHost("*.sub.d1.local")
-	h.TLS.TLSFilename = "/var/haproxy/ssl/certs/default.pem"
-	h.TLS.TLSHash = "0"
-	h.AddPath(b, "/", hatypes.MatchBegin)
-	h.TLS.CAFilename = "/var/haproxy/ssl/ca/d1.local.pem"
-	h.TLS.CAHash = "1"
-	h.TLS.CAVerifyOptional = true
-	h.TLS.CAErrorPage = "http://sub.d1.local/error.html"
-	for _, path := range b.Paths {
-		path.SSLRedirect = true
+	setCert("d1.local", "cn1", now.Add(5*day))
+	setCert("d2.local", "cn2", now.Add(20*day))
+	setCert("d3.local", "cn3", now.Add(8*day))
+	c.Update()
+	expectCalls("first update", []string{"d1.local/cn1/120h0m0s", "d3.local/cn3/192h0m0s"})
+
+	// already notified certificates are not notified again
+	c.config.Hosts().AcquireHost("d4.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	expectCalls("unchanged certs", nil)
+
+	// d2 crosses the threshold, d1 is renewed
+	clock.Add(15 * day)
+	setCert("d1.local", "cn1", now.Add(60*day))
+	c.Update()
+	expectCalls("d2 crossing", []string{"d2.local/cn2/480h0m0s"})
+
+	// the renewed d1 crosses the threshold again
+	clock.Add(40 * day)
+	c.config.Hosts().AcquireHost("d5.local").AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	expectCalls("d1 crossing again", []string{"d1.local/cn1/1440h0m0s"})
+
+	// a panic in the hook is logged
+	c.instance.options.OnCertExpiring = func(host, commonName string, notAfter time.Time) {
+		panic("oops")
 	}
+	setCert("d1.local", "cn1", now.Add(56*day))
+	c.logger.Logging = []string{}
+	c.Update()
+	c.logger.CompareLogging(`
+INFO old and new configurations match
+ERROR panic calling the cert expiring hook: oops`)
+}
+
+func TestInstanceCertsSummary(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	now := time.Now().Truncate(time.Second)
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
 	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	addHost := func(hostname, hash string, notAfter time.Time) {
+		h := c.config.Hosts().AcquireHost(hostname)
+		h.AddPath(b, "/", hatypes.MatchBegin)
+		h.TLS.TLSFilename = "/var/haproxy/ssl/certs/" + hash + ".pem"
+		h.TLS.TLSHash = hash
+		h.TLS.TLSNotAfter = notAfter
+	}
+	addHost("d1.local", "1", now.Add(240*time.Hour))
+	addHost("d2.local", "1", now.Add(240*time.Hour))
+	addHost("d3.local", "2", now.Add(120*time.Hour))
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+	count, nextExpiry := c.instance.certsSummary()
+	if count != 2 || !nextExpiry.Equal(now.Add(120*time.Hour)) {
+		t.Errorf("expected 2 certs expiring in 120h, but was %d certs expiring in %s", count, nextExpiry.Sub(now))
+	}
 
-	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
-	h = c.config.Hosts().AcquireHost("*.d2.local")
-	h.AddPath(b, "/", hatypes.MatchBegin)
-	h.RootRedirect = "/app"
-	b.Endpoints = []*hatypes.Endpoint{endpointS21}
+	c.config.Hosts().RemoveAll([]string{"d3.local"})
+	c.Update()
+	c.logger.Logging = []string{}
+	count, nextExpiry = c.instance.certsSummary()
+	if count != 1 || !nextExpiry.Equal(now.Add(240*time.Hour)) {
+		t.Errorf("expected 1 cert expiring in 240h, but was %d certs expiring in %s", count, nextExpiry.Sub(now))
+	}
+}
+
+func TestInstanceSortEndpoints(t *testing.T) {
+	testCases := []struct {
+		sortBy   string
+		expected []string
+	}{
+		// 0
+		{
+			sortBy:   "name",
+			expected: []string{"s1", "s21", "s22"},
+		},
+		// 1
+		{
+			sortBy:   "none",
+			expected: []string{"s22", "s1", "s21"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		c.instance.options.SortEndpointsBy = test.sortBy
+		var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS22, endpointS1, endpointS21}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+		c.logger.CompareLogging(defaultLogging)
+		var names []string
+		for _, ep := range b.Endpoints {
+			names = append(names, ep.Name)
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("test %d expected endpoints %v, but was %v", i, test.expected, names)
+		}
+		c.teardown()
+	}
+}
 
+func TestInstanceMemFilesystem(t *testing.T) {
+	fs := template.NewMemFilesystem()
+	c := setupOptions(testOptions{t: t, fs: fs})
+	defer c.teardown()
+
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
 	c.Update()
 	c.checkConfig(`
 <<global>>
 <<defaults>>
 backend d1_app_8080
     mode http
-    acl https-request ssl_fc
-    acl local-offload ssl_fc
-    http-request redirect scheme https if !https-request
-    http-request set-header X-SSL-Client-CN   %{+Q}[ssl_c_s_dn(cn)]
-    http-request set-header X-SSL-Client-DN   %{+Q}[ssl_c_s_dn]
-    http-request set-header X-SSL-Client-SHA1 %{+Q}[ssl_c_sha1,hex]
     server s1 172.17.0.11:8080 weight 100
-backend d2_app_8080
-    mode http
-    server s21 172.17.0.121:8080 weight 100
 <<backends-default>>
-frontend _front_http
-    mode http
-    bind :80
-    <<set-req-base>>
-    http-request set-var(req.rootredir) var(req.host),map_reg(/etc/haproxy/maps/_front_redir_fromroot__regex.map)
-    http-request redirect location %[var(req.rootredir)] if { path / } { var(req.rootredir) -m found }
-    <<http-headers>>
-    http-request set-var(req.backend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_http_host__begin.map)
-    http-request set-var(req.backend) var(req.base),map_reg(/etc/haproxy/maps/_front_http_host__regex.map) if !{ var(req.backend) -m found }
-    use_backend %[var(req.backend)] if { var(req.backend) -m found }
-    default_backend _error404
-frontend _front_https
-    mode http
-    bind :443 ssl alpn h2,http/1.1 crt-list /etc/haproxy/maps/_front_bind_crt.list ca-ignore-err all crt-ignore-err all
-    <<set-req-base>>
-    http-request set-var(req.hostbackend) var(req.base),lower,map_beg(/etc/haproxy/maps/_front_https_host__begin.map)
-    http-request set-var(req.hostbackend) var(req.base),map_reg(/etc/haproxy/maps/_front_https_host__regex.map) if !{ var(req.hostbackend) -m found }
-    http-request set-var(req.rootredir) var(req.host),map_reg(/etc/haproxy/maps/_front_redir_fromroot__regex.map)
-    http-request redirect location %[var(req.rootredir)] if { path / } { var(req.rootredir) -m found }
-    <<https-headers>>
-    acl tls-has-crt ssl_c_used
-    acl tls-has-invalid-crt ssl_c_verify gt 0
-    acl tls-check-crt ssl_fc_sni -i -m reg -f /etc/haproxy/maps/_front_tls_auth__regex.list
-    http-request set-var(req.snibase) ssl_fc_sni,lower,concat(\#,req.path)
-    http-request set-var(req.snibackend) var(req.snibase),map_reg(/etc/haproxy/maps/_front_https_sni__regex.map)
-    http-request set-var(req.snibackend) var(req.base),map_reg(/etc/haproxy/maps/_front_https_sni__regex.map) if !{ var(req.snibackend) -m found } !tls-has-crt
-    http-request set-var(req.tls_invalidcrt_redir) ssl_fc_sni,lower,map_reg(/etc/haproxy/maps/_front_tls_invalidcrt_pages__regex.map,_internal) if tls-has-invalid-crt tls-check-crt
-    http-request redirect location %[var(req.tls_invalidcrt_redir)] code 303 if { var(req.tls_invalidcrt_redir) -m found } !{ var(req.tls_invalidcrt_redir) -m str _internal }
-    http-request use-service lua.send-421 if tls-has-crt { ssl_fc_has_sni } !{ ssl_fc_sni,strcmp(req.host) eq 0 }
-    http-request use-service lua.send-495 if { var(req.tls_invalidcrt_redir) -m str _internal }
-    use_backend %[var(req.hostbackend)] if { var(req.hostbackend) -m found }
-    use_backend %[var(req.snibackend)] if { var(req.snibackend) -m found }
-    default_backend _error404
+<<frontends-default>>
 <<support>>
 `)
-
 	c.checkMap("_front_http_host__begin.map", `
-d1.local#/ d1_app_8080
-`)
-	c.checkMap("_front_http_host__regex.map", `
-^[^.]+\.app\.d1\.local#/ d1_app_8080
-^[^.]+\.sub\.d1\.local#/ d1_app_8080
-^[^.]+\.d2\.local#/ d2_app_8080
-`)
-	c.checkMap("_front_redir_fromroot__regex.map", `
-^[^.]+\.d2\.local$ /app
-`)
-	c.checkMap("_front_https_host__begin.map", `
-d1.local#/ d1_app_8080
-`)
-	c.checkMap("_front_https_host__regex.map", `
-^[^.]+\.app\.d1\.local#/ d1_app_8080
-^[^.]+\.d2\.local#/ d2_app_8080
-`)
-	c.checkMap("_front_redir_fromroot__regex.map", `
-^[^.]+\.d2\.local$ /app
-`)
-	c.checkMap("_front_https_sni__regex.map", `
-^[^.]+\.sub\.d1\.local#/ d1_app_8080
-`)
-	c.checkMap("_front_tls_auth__regex.list", `
-^[^.]+\.sub\.d1\.local$
-`)
-	c.checkMap("_front_tls_invalidcrt_pages__regex.map", `
-^[^.]+\.sub\.d1\.local$ http://sub.d1.local/error.html
-`)
-
+d1.local#/ d1_app_8080`)
 	c.logger.CompareLogging(defaultLogging)
+
+	if _, err := os.Stat(filepath.Join(c.tempdir, "haproxy.cfg")); !os.IsNotExist(err) {
+		t.Errorf("expected haproxy.cfg not written in the disk, but was err=%v", err)
+	}
+	files := map[string]bool{}
+	for _, file := range fs.Files() {
+		files[file] = true
+	}
+	for _, file := range []string{"haproxy.cfg", "responses.lua", "spoe-modsecurity.conf"} {
+		if !files[filepath.Join(c.tempdir, file)] {
+			t.Errorf("expected %s written in the memory filesystem, files are %v", file, fs.Files())
+		}
+	}
 }
 
-func TestShards(t *testing.T) {
-	c := setupOptions(testOptions{
-		t:          t,
-		shardCount: 3,
-	})
+func TestInstanceLogChanged(t *testing.T) {
+	c := setup(t)
 	defer c.teardown()
 
-	var h *hatypes.Host
+	c.config.Hosts().AcquireHost("h2.local")
+	c.config.Hosts().AcquireHost("h1.local")
+	c.config.Backends().AcquireBackend("default", "app", "8080")
+	c.instance.logChanged()
+	c.logger.CompareLogging(`
+INFO-V(2) updating 2 host(s): [h1.local h2.local] host_count=2
+INFO-V(2) updating 1 backend(s): [default_app_8080] backend_count=1`)
+
+	c.instance.options.LogChangesJSON = true
+	c.instance.logChanged()
+	c.logger.CompareLogging(`
+INFO-V(2) update summary: {"hosts":{"added":2,"removed":0,"changed":0,"names":["h1.local","h2.local"],"truncated":false},"backends":{"added":1,"removed":0,"changed":0,"names":["default_app_8080"],"truncated":false}}`)
+
+	for i := 0; i < 120; i++ {
+		c.config.Hosts().AcquireHost(fmt.Sprintf("h%03d.local", i))
+	}
+	c.instance.logChanged()
+	summary := c.logger.Logging[0]
+	if !strings.Contains(summary, `"added":122,"removed":0,"changed":0,`) || !strings.Contains(summary, `"truncated":true},"backends"`) {
+		t.Errorf("expected 122 added hosts with truncated names, but was: %s", summary)
+	}
+	c.logger.Logging = []string{}
+
+	c.instance.options.LogChangesJSON = false
+	c.instance.logChanged()
+	c.logger.CompareLogging(`
+INFO-V(2) updating 122 hosts host_count=122
+INFO-V(2) updating 1 backend(s): [default_app_8080] backend_count=1`)
+
+	c.instance.options.LogItemListThreshold = 1
+	c.instance.logChanged()
+	c.logger.CompareLogging(`
+INFO-V(2) updating 122 hosts host_count=122
+INFO-V(2) updating 1 backends backend_count=1`)
 
+	c.instance.options.LogItemListThreshold = 200
+	c.instance.logChanged()
+	if hosts := c.logger.Logging[0]; !strings.HasPrefix(hosts, "INFO-V(2) updating 122 host(s): [h000.local h001.local ") {
+		t.Errorf("expected the list of 122 hosts, but was: %s", hosts)
+	}
+	c.logger.Logging = []string{}
+}
+
+func TestInstanceForceReload(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	now := time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC)
+	c.instance.options.Clock = helper_test.NewClockMock(now)
+
+	var h *hatypes.Host
 	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
 	b.Endpoints = []*hatypes.Endpoint{endpointS1}
 	h = c.config.Hosts().AcquireHost("d1.local")
 	h.AddPath(b, "/", hatypes.MatchBegin)
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
 
-	b = c.config.Backends().AcquireBackend("d2", "app", "8080")
-	b.Endpoints = []*hatypes.Endpoint{endpointS21}
-	h = c.config.Hosts().AcquireHost("d2.local")
-	h.AddPath(b, "/", hatypes.MatchBegin)
+	if reason := c.instance.LastReload().Reason; reason != ReloadReasonFirstRun {
+		t.Errorf("expected reload reason '%s', but was '%s'", ReloadReasonFirstRun, reason)
+	}
 
-	b = c.config.Backends().AcquireBackend("d3", "app", "8080")
-	b.Endpoints = []*hatypes.Endpoint{endpointS31}
-	h = c.config.Hosts().AcquireHost("d3.local")
-	h.AddPath(b, "/", hatypes.MatchBegin)
+	c.instance.ForceReload(utils.NewTimer(nil))
+	c.logger.CompareLogging(`
+INFO-V(2) need to reload, a full reload was requested
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="forced"`)
+	lastReload := c.instance.LastReload()
+	if !lastReload.Success || lastReload.Reason != ReloadReasonForced {
+		t.Errorf("expected successful reload due to '%s', but was %+v", ReloadReasonForced, lastReload)
+	}
+	if !lastReload.Timestamp.Equal(now) {
+		t.Errorf("expected reload timestamp from the instance clock '%s', but was '%s'", now, lastReload.Timestamp)
+	}
 
 	c.Update()
-	c.checkConfig(`
-<<global>>
-<<defaults>>
-<<backends-default>>
-<<frontends-default>>
-<<support>>
-`)
+	c.logger.CompareLogging(`
+INFO old and new configurations match`)
+	if c.instance.LastReload() != lastReload {
+		t.Errorf("expected last reload not being changed without a reload")
+	}
 
-	c.checkConfigFile(`
-backend d2_app_8080
-    mode http
-    server s21 172.17.0.121:8080 weight 100
-`, "haproxy5-backend000.cfg")
+	c.instance.Reload(utils.NewTimer(nil))
+	c.logger.CompareLogging(`
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="requested"`)
+	if reason := c.instance.LastReload().Reason; reason != ReloadReasonRequested {
+		t.Errorf("expected reload reason '%s', but was '%s'", ReloadReasonRequested, reason)
+	}
+}
 
-	c.checkConfigFile(`
-backend d1_app_8080
-    mode http
-    server s1 172.17.0.11:8080 weight 100
-backend d3_app_8080
-    mode http
-    server s31 172.17.0.131:8080 weight 100
-`, "haproxy5-backend002.cfg")
+func TestInstanceMinReloadInterval(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+	c.instance.options.Clock = clock
+	c.instance.options.MinReloadInterval = time.Minute
+
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
+
+	clock.Add(20 * time.Second)
+	done := make(chan struct{})
+	go func() {
+		c.instance.Reload(utils.NewTimer(nil))
+		close(done)
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Add(30 * time.Second)
+	select {
+	case <-done:
+		t.Errorf("expected reload waiting the min reload interval")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Add(10 * time.Second)
+	<-done
+	c.logger.CompareLogging(`
+INFO-V(2) waiting 40s before reloading haproxy due to the min reload interval
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="requested"`)
+
+	// the interval has already elapsed since the last reload
+	clock.Add(time.Minute)
+	c.instance.Reload(utils.NewTimer(nil))
+	c.logger.CompareLogging(`
+INFO (test) reload was skipped
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="requested"`)
+}
+
+func TestInstanceShutdown(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+
+	var h *hatypes.Host
+	var b = c.config.Backends().AcquireBackend("d1", "app", "8080")
+	b.Endpoints = []*hatypes.Endpoint{endpointS1}
+	h = c.config.Hosts().AcquireHost("d1.local")
+	h.AddPath(b, "/", hatypes.MatchBegin)
+
+	c.Update()
+	c.logger.CompareLogging(defaultLogging)
 
+	if err := c.instance.Shutdown(context.Background()); err != nil {
+		t.Errorf("error shutting down: %v", err)
+	}
+	c.Update()
 	c.logger.CompareLogging(`
-INFO-V(2) updated main cfg and 2 backend file(s): [000 002]` + defaultLogging)
+INFO (test) shutdown was skipped
+WARN skipping haproxy update, instance is shutting down`)
 }
 
 /* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * *
@@ -5148,11 +8574,17 @@ type testConfig struct {
 	instance *instance
 	config   *config
 	tempdir  string
+	fs       *template.MemFilesystem
 }
 
 type testOptions struct {
-	t          *testing.T
-	shardCount int
+	t             *testing.T
+	shardCount    int
+	fs            *template.MemFilesystem
+	initialConfig func(cfg Config)
+	postProcessor func([]byte) ([]byte, error)
+	mapsDir       string
+	dynamicOnly   bool
 }
 
 func setup(t *testing.T) *testConfig {
@@ -5170,11 +8602,24 @@ func setupOptions(options testOptions) *testConfig {
 	if err != nil {
 		t.Errorf("error creating temp subdir: %v", err)
 	}
+	var fs template.Filesystem
+	if options.fs != nil {
+		fs = options.fs
+	}
+	mapsDir := options.mapsDir
+	if mapsDir == "" {
+		mapsDir = tempdir
+	}
 	instance := CreateInstance(logger, InstanceOptions{
 		HAProxyCfgDir:  tempdir,
-		HAProxyMapsDir: tempdir,
+		HAProxyMapsDir: mapsDir,
+		DynamicOnly:    options.dynamicOnly,
 		Metrics:        helper_test.NewMetricsMock(),
 		BackendShards:  options.shardCount,
+		Filesystem:     fs,
+		InitialConfig:  options.initialConfig,
+		//
+		ConfigPostProcessor: options.postProcessor,
 		//
 		fake: true,
 	}).(*instance)
@@ -5231,6 +8676,7 @@ func setupOptions(options testOptions) *testConfig {
 		instance: instance,
 		config:   config,
 		tempdir:  tempdir,
+		fs:       options.fs,
 	}
 	c.configGlobal(c.config.Global())
 	return c
@@ -5341,7 +8787,7 @@ var endpointS41h = &hatypes.Endpoint{
 
 var defaultLogging = `
 INFO (test) reload was skipped
-INFO haproxy successfully reloaded (embedded daemon)`
+INFO haproxy successfully reloaded (embedded daemon) reload_reason="first run"`
 
 func _yamlMarshal(in interface{}) string {
 	out, _ := yaml.Marshal(in)
@@ -5507,7 +8953,11 @@ func (c *testConfig) readConfig(fileName string) string {
 }
 
 func (c *testConfig) readRawConfig(fileName string) string {
-	config, err := os.ReadFile(fileName)
+	readFile := os.ReadFile
+	if c.fs != nil {
+		readFile = c.fs.ReadFile
+	}
+	config, err := readFile(fileName)
 	if err != nil {
 		c.t.Errorf("error reading config file: %v", err)
 		return ""
@@ -0,0 +1,106 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// Subsystems with a configurable log verbosity, see InstanceOptions.LogLevels
+const (
+	LogSubsystemAcme   = "acme"
+	LogSubsystemReload = "reload"
+	LogSubsystemUpdate = "update"
+)
+
+var logSubsystems = []string{LogSubsystemAcme, LogSubsystemReload, LogSubsystemUpdate}
+
+// ParseLogLevels parses a comma separated list of subsystem=level pairs,
+// e.g. `acme=3,reload=0`, into a map of log verbosity per subsystem.
+func ParseLogLevels(levels string) (map[string]int, error) {
+	logLevels := map[string]int{}
+	for _, item := range strings.Split(levels, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		subsystem, value, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("missing log level of subsystem '%s', expected format is subsystem=level", item)
+		}
+		level, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level of subsystem '%s': %s", subsystem, value)
+		}
+		logLevels[subsystem] = level
+	}
+	if err := validateLogLevels(logLevels); err != nil {
+		return nil, err
+	}
+	return logLevels, nil
+}
+
+func validateLogLevels(logLevels map[string]int) error {
+	for subsystem, level := range logLevels {
+		if !validLogSubsystem(subsystem) {
+			return fmt.Errorf("unsupported log subsystem '%s', should be one of: %s", subsystem, strings.Join(logSubsystems, ", "))
+		}
+		if level < 0 {
+			return fmt.Errorf("invalid log level of subsystem '%s': %d, should not be negative", subsystem, level)
+		}
+	}
+	return nil
+}
+
+func validLogSubsystem(subsystem string) bool {
+	for _, s := range logSubsystems {
+		if s == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// subsystemLogger overrides the global verbosity of InfoV() messages:
+// messages are logged if their verbosity does not exceed level.
+type subsystemLogger struct {
+	types.Logger
+	level int
+}
+
+func (l *subsystemLogger) InfoV(v int, msg string, args ...interface{}) {
+	if v <= l.level {
+		l.Logger.Info(msg, args...)
+	}
+}
+
+func (l *subsystemLogger) WithFields(fields map[string]interface{}) types.Logger {
+	return &subsystemLogger{Logger: l.Logger.WithFields(fields), level: l.level}
+}
+
+// loggerFor returns the logger of a subsystem. The instance logger, which
+// follows the global verbosity, is used if subsystem has no configured level.
+func (i *instance) loggerFor(subsystem string) types.Logger {
+	if level, found := i.options.LogLevels[subsystem]; found {
+		return &subsystemLogger{Logger: i.logger, level: level}
+	}
+	return i.logger
+}
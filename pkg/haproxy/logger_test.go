@@ -0,0 +1,138 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"reflect"
+	"testing"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+func TestParseLogLevels(t *testing.T) {
+	testCases := []struct {
+		levels   string
+		expected map[string]int
+		expError string
+	}{
+		// 0
+		{
+			levels:   "",
+			expected: map[string]int{},
+		},
+		// 1
+		{
+			levels:   "acme=3, reload=0,",
+			expected: map[string]int{"acme": 3, "reload": 0},
+		},
+		// 2
+		{
+			levels:   "update=2,acme=1",
+			expected: map[string]int{"update": 2, "acme": 1},
+		},
+		// 3
+		{
+			levels:   "acme",
+			expError: "missing log level of subsystem 'acme', expected format is subsystem=level",
+		},
+		// 4
+		{
+			levels:   "acme=high",
+			expError: "invalid log level of subsystem 'acme': high",
+		},
+		// 5
+		{
+			levels:   "acme=-1",
+			expError: "invalid log level of subsystem 'acme': -1, should not be negative",
+		},
+		// 6
+		{
+			levels:   "converters=2",
+			expError: "unsupported log subsystem 'converters', should be one of: acme, reload, update",
+		},
+	}
+	for i, test := range testCases {
+		levels, err := ParseLogLevels(test.levels)
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if errMsg != test.expError {
+			t.Errorf("error differs on %d - expected: %s, actual: %s", i, test.expError, errMsg)
+		}
+		if !reflect.DeepEqual(levels, test.expected) {
+			t.Errorf("log levels differ on %d - expected: %v, actual: %v", i, test.expected, levels)
+		}
+	}
+}
+
+func TestInstanceLogLevels(t *testing.T) {
+	testCases := []struct {
+		levels  map[string]int
+		logging string
+	}{
+		// 0
+		{
+			logging: `
+INFO-V(2) haproxy reload enqueued, reason: first run`,
+		},
+		// 1
+		{
+			levels: map[string]int{"reload": 2},
+			logging: `
+INFO haproxy reload enqueued, reason: first run`,
+		},
+		// 2
+		{
+			levels:  map[string]int{"reload": 1},
+			logging: ``,
+		},
+		// 3
+		{
+			levels: map[string]int{"acme": 0},
+			logging: `
+INFO-V(2) haproxy reload enqueued, reason: first run`,
+		},
+	}
+	for _, test := range testCases {
+		c := setup(t)
+		queue := utils.NewQueue(func(item interface{}) {})
+		c.instance.options.ReloadQueue = queue
+		c.instance.options.LogLevels = test.levels
+		b := c.config.Backends().AcquireBackend("d1", "app", "8080")
+		b.Endpoints = []*hatypes.Endpoint{endpointS1}
+		c.config.Hosts().AcquireHost("d1.local").AddPath(b, "/", hatypes.MatchBegin)
+		c.Update()
+		c.logger.CompareLogging(test.logging)
+		queue.ShutDown()
+		c.teardown()
+	}
+}
+
+func TestSubsystemLoggerWithFields(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.instance.options.LogLevels = map[string]int{"update": 1}
+	logger := c.instance.loggerFor(LogSubsystemUpdate).WithFields(map[string]interface{}{"host_count": 2})
+	logger.InfoV(1, "updating %d hosts", 2)
+	logger.InfoV(2, "not logged")
+	logger.WithFields(map[string]interface{}{"backend_count": 1}).InfoV(1, "updating hosts and backends")
+	c.logger.CompareLogging(`
+INFO updating 2 hosts host_count=2
+INFO updating hosts and backends backend_count=1 host_count=2`)
+}
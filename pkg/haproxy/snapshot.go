@@ -0,0 +1,97 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"sort"
+
+	hatypes "github.com/jcmoraisjr/haproxy-ingress/pkg/haproxy/types"
+)
+
+// configSnapshot is an immutable view of the committed configuration. The
+// config is changed in place by the converters and the update, so read only
+// APIs use the snapshot published at the end of the updates that change it,
+// instead of waiting for, or racing with, the update that builds the next
+// config.
+type configSnapshot struct {
+	rendered     []byte
+	dataplane    *dataplaneConfig
+	acmeStorages []hatypes.AcmeStorage
+	stats        ConfigStats
+}
+
+// renderedConfig tracks the content of the haproxy config files written by
+// writeConfig. Unchanged shards aren't rewritten, so their last content is
+// preserved between updates.
+type renderedConfig struct {
+	main   []byte
+	shards map[int][]byte
+}
+
+func (r *renderedConfig) setShard(shard int, content []byte) {
+	if r.shards == nil {
+		r.shards = map[int][]byte{}
+	}
+	if content == nil {
+		delete(r.shards, shard)
+	} else {
+		r.shards[shard] = content
+	}
+}
+
+// build concatenates the main cfg and the shards, in the same order
+// haproxy reads them.
+func (r *renderedConfig) build() []byte {
+	if r.main == nil {
+		return nil
+	}
+	shards := make([]int, 0, len(r.shards))
+	size := len(r.main)
+	for shard, content := range r.shards {
+		shards = append(shards, shard)
+		size += len(content)
+	}
+	sort.Ints(shards)
+	out := make([]byte, 0, size)
+	out = append(out, r.main...)
+	for _, shard := range shards {
+		out = append(out, r.shards[shard]...)
+	}
+	return out
+}
+
+// publishSnapshot builds a new snapshot from the committed config, and
+// atomically replaces the one used by the readers. Should be called by the
+// update, just after the commit, if the config or the rendered files changed.
+func (i *instance) publishSnapshot() {
+	i.snapshotStale = false
+	i.snapshot.Store(&configSnapshot{
+		rendered:     i.rendered.build(),
+		dataplane:    buildDataplaneConfig(i.config),
+		acmeStorages: i.config.AcmeData().Storages().BuildCommittedStorages(),
+		stats:        i.config.Stats(),
+	})
+}
+
+// ConfigStats returns the number of configuration items of the last update.
+// A zero ConfigStats is returned if haproxy wasn't updated yet.
+func (i *instance) ConfigStats() ConfigStats {
+	if snapshot := i.snapshot.Load(); snapshot != nil {
+		return snapshot.stats
+	}
+	return ConfigStats{}
+}
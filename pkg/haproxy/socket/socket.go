@@ -32,24 +32,31 @@ import (
 	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
+// DefaultTimeout is the time a command has to be sent and its response read
+// if a timeout isn't configured in NewSocket() or NewSocketConcurrent().
+const DefaultTimeout = 5 * time.Second
+
 // NewSocket ...
-func NewSocket(address string, keepalive bool) HAProxySocket {
-	return newSocket(address, keepalive)
+func NewSocket(address string, keepalive bool, timeout time.Duration) HAProxySocket {
+	return newSocket(address, keepalive, timeout)
 }
 
 // NewSocketConcurrent ...
-func NewSocketConcurrent(address string, keepalive bool) HAProxySocket {
-	s := newSocket(address, keepalive)
+func NewSocketConcurrent(address string, keepalive bool, timeout time.Duration) HAProxySocket {
+	s := newSocket(address, keepalive, timeout)
 	s.mutex = &sync.Mutex{}
 	return s
 }
 
-func newSocket(address string, keepalive bool) *sock {
+func newSocket(address string, keepalive bool, timeout time.Duration) *sock {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
 	return &sock{
 		address:   address,
 		listening: true,
 		keepalive: keepalive,
-		timeout:   5 * time.Second,
+		timeout:   timeout,
 	}
 }
 
@@ -62,6 +69,21 @@ type HAProxySocket interface {
 	Close() error
 }
 
+// NotSentError is returned by Send() when a command fails before being
+// written to the socket, e.g. a connection failure. The command didn't
+// reach haproxy, so it is safe to be sent again.
+type NotSentError struct {
+	Err error
+}
+
+func (e *NotSentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NotSentError) Unwrap() error {
+	return e.Err
+}
+
 type sock struct {
 	mutex     *sync.Mutex
 	address   string
@@ -149,7 +171,7 @@ func (s *sock) close() error {
 func (s *sock) send(cmd string) (string, error) {
 	c, err := s.acquireConn()
 	if err != nil {
-		return "", fmt.Errorf("error connecting to %s: %w", s.address, err)
+		return "", &NotSentError{Err: fmt.Errorf("error connecting to %s: %w", s.address, err)}
 	}
 	if !strings.HasSuffix(cmd, "\n") {
 		// haproxy starts the command after receiving a line break
@@ -161,11 +183,15 @@ func (s *sock) send(cmd string) (string, error) {
 			// is still alive but current connection is broken, try a new connection
 			c, err = s.newConn()
 			if err == nil {
-				_, err = c.Write([]byte(cmd))
+				n, err = c.Write([]byte(cmd))
 			}
 		}
 		if err != nil {
-			return "", fmt.Errorf("error writing to %s: %w", s.address, err)
+			err = fmt.Errorf("error writing to %s: %w", s.address, err)
+			if n == 0 {
+				return "", &NotSentError{Err: err}
+			}
+			return "", err
 		}
 	}
 	var response string
@@ -272,6 +298,20 @@ func HAProxyProcs(masterSocket HAProxySocket) (*ProcTable, error) {
 	}
 }
 
+// ReadHAProxyProcs reads and converts `show proc` from the master CLI to a
+// ProcTable instance. Differently from HAProxyProcs, an error is returned
+// right away if the master CLI cannot be reached.
+func ReadHAProxyProcs(masterSocket HAProxySocket) (*ProcTable, error) {
+	out, err := masterSocket.Send(nil, "show proc")
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return &ProcTable{}, nil
+	}
+	return buildProcTable(out[0]), nil
+}
+
 func waitHAProxy(sock HAProxySocket, err error) bool {
 	if err == nil {
 		// connection succeeded, no need to wait (wait = FALSE)
@@ -17,9 +17,14 @@ limitations under the License.
 package socket
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -132,9 +137,9 @@ func testSocket(t *testing.T, keepalive bool) {
 	clientSocketPos := make([]HAProxySocket, len(testCases))
 	masterSocket := make([]HAProxySocket, len(testCases))
 	for i, test := range testCases {
-		clientSocket[i] = NewSocket(clisock, keepalive)
-		clientSocketPos[i] = NewSocket(clisock, false)
-		masterSocket[i] = NewSocket(mastersock, keepalive)
+		clientSocket[i] = NewSocket(clisock, keepalive, 0)
+		clientSocketPos[i] = NewSocket(clisock, false, 0)
+		masterSocket[i] = NewSocket(mastersock, keepalive, 0)
 		time.Sleep(test.waitBefore)
 		var sock, sockPos HAProxySocket
 		if test.master {
@@ -215,6 +220,49 @@ P7eOp7uHMV8pq7r+FX+VTUELmYpZBvDKi0pPHRDMsUKJlOCiDQaC+7u4hJh27fjM
 -----END PRIVATE KEY-----
 `
 
+func TestSocketTimeout(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "h.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatalf("error listening on %s: %v", address, err)
+	}
+	defer listener.Close()
+	go func() {
+		// accepts but never answers, simulating a stuck haproxy
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	sock := NewSocket(address, false, 50*time.Millisecond)
+	start := time.Now()
+	_, err = sock.Send(nil, "show info")
+	if duration := time.Since(start); duration > 500*time.Millisecond {
+		t.Errorf("expected command failing after the timeout, but took %s", duration)
+	}
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("expected a timeout error, but was: %v", err)
+	}
+	var notSent *NotSentError
+	if errors.As(err, &notSent) {
+		t.Errorf("expected a sent command on a read timeout, but was not sent")
+	}
+}
+
+func TestSocketNotSent(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "h.sock")
+	sock := NewSocket(address, false, 50*time.Millisecond)
+	_, err := sock.Send(nil, "show info")
+	var notSent *NotSentError
+	if !errors.As(err, &notSent) {
+		t.Errorf("expected a command not sent on a connection failure, but was: %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the connection error being wrapped, but was: %v", err)
+	}
+}
+
 func TestHAProxyProcs(t *testing.T) {
 	testCases := []struct {
 		cmdOutput []string
@@ -469,6 +517,59 @@ func TestHAProxyProcsLoop(t *testing.T) {
 	}
 }
 
+func TestReadHAProxyProcs(t *testing.T) {
+	testCases := []struct {
+		cmdOutput []string
+		cmdError  error
+		expOutput *ProcTable
+		expError  bool
+	}{
+		// 0
+		{
+			expOutput: &ProcTable{},
+		},
+		// 1
+		{
+			cmdError: syscall.ECONNREFUSED,
+			expError: true,
+		},
+		// 2
+		{
+			cmdOutput: []string{`#<PID>          <type>          <reloads>       <uptime>        <version>
+1               master          1 [failed: 0]   0d00h00m08s     2.5.3-abf078b
+# workers
+3               worker          0               0d00h00m03s     2.5.3-abf078b
+# old workers
+2               worker          1               0d00h00m08s     2.5.3-abf078b
+# programs
+`},
+			expOutput: &ProcTable{
+				Master:     Proc{Type: "master", PID: 1, Reloads: 1, Uptime: "0d00h00m08s", Version: "2.5.3-abf078b"},
+				Workers:    []Proc{{Type: "worker", PID: 3, Uptime: "0d00h00m03s", Version: "2.5.3-abf078b"}},
+				OldWorkers: []Proc{{Type: "worker", PID: 2, Reloads: 1, Uptime: "0d00h00m08s", Version: "2.5.3-abf078b"}},
+			},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		cli := &clientMock{
+			cmdOutput: test.cmdOutput,
+			cmdError:  test.cmdError,
+		}
+		out, err := ReadHAProxyProcs(cli)
+		if !reflect.DeepEqual(out, test.expOutput) {
+			t.Errorf("output differs on %d - expected: %+v, actual: %+v", i, test.expOutput, out)
+		}
+		if (err != nil) != test.expError {
+			t.Errorf("error differs on %d - expected: %v, actual: %v", i, test.expError, err)
+		}
+		if cli.callCnt != 1 {
+			t.Errorf("callCnt in %d should be 1 but was %d", i, cli.callCnt)
+		}
+		c.tearDown()
+	}
+}
+
 type testConfig struct {
 	t *testing.T
 }
@@ -0,0 +1,220 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package template
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
+)
+
+// Filesystem has the filesystem operations used to write the output of the
+// templates. OSFilesystem, the default one, writes into the OS filesystem.
+type Filesystem interface {
+	OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error)
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (os.FileInfo, error)
+	Link(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// OSFilesystem ...
+var OSFilesystem Filesystem = osFilesystem{}
+
+type osFilesystem struct{}
+
+func (osFilesystem) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFilesystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFilesystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFilesystem) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFilesystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFilesystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// NewMemFilesystem creates an in-memory filesystem, used to check the output
+// of the templates without touching the disk. Directories aren't tracked,
+// files can be created in any path.
+func NewMemFilesystem() *MemFilesystem {
+	return &MemFilesystem{
+		files: map[string]*memFile{},
+		clock: utils.RealClock,
+	}
+}
+
+// MemFilesystem ...
+type MemFilesystem struct {
+	mutex sync.Mutex
+	files map[string]*memFile
+	clock types.Clock
+}
+
+// SetClock configures the clock used as the modification time of the files.
+func (m *MemFilesystem) SetClock(clock types.Clock) {
+	m.clock = clock
+}
+
+type memFile struct {
+	content []byte
+	modTime time.Time
+}
+
+// ReadFile returns the content of a file, or an error if it doesn't exist.
+func (m *MemFilesystem) ReadFile(name string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	f, found := m.files[filepath.Clean(name)]
+	if !found {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return f.content, nil
+}
+
+// Files returns the sorted name of all the files.
+func (m *MemFilesystem) Files() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenFile ...
+func (m *MemFilesystem) OpenFile(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	f, found := m.files[name]
+	if !found {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		f = &memFile{}
+	}
+	w := &memWriter{fs: m, name: name}
+	if flag&os.O_TRUNC == 0 {
+		w.buf.Write(f.content)
+	}
+	return w, nil
+}
+
+// Stat ...
+func (m *MemFilesystem) Stat(name string) (os.FileInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	f, found := m.files[name]
+	if !found {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFileInfo{name: filepath.Base(name), file: f}, nil
+}
+
+// Link ...
+func (m *MemFilesystem) Link(oldname, newname string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	f, found := m.files[filepath.Clean(oldname)]
+	if !found {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	m.files[filepath.Clean(newname)] = f
+	return nil
+}
+
+// Rename ...
+func (m *MemFilesystem) Rename(oldpath, newpath string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	oldpath = filepath.Clean(oldpath)
+	f, found := m.files[oldpath]
+	if !found {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[filepath.Clean(newpath)] = f
+	return nil
+}
+
+// Remove ...
+func (m *MemFilesystem) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	if _, found := m.files[name]; !found {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// memWriter buffers the content, which is stored in the filesystem on Close().
+// A new memFile is created, so hard links made before keep the old content.
+type memWriter struct {
+	fs   *MemFilesystem
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	w.fs.mutex.Lock()
+	defer w.fs.mutex.Unlock()
+	w.fs.files[w.name] = &memFile{content: w.buf.Bytes(), modTime: w.fs.clock.Now()}
+	return nil
+}
+
+type memFileInfo struct {
+	name string
+	file *memFile
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return int64(len(i.file.content)) }
+func (i *memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i *memFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i *memFileInfo) IsDir() bool        { return false }
+func (i *memFileInfo) Sys() interface{}   { return nil }
@@ -18,19 +18,42 @@ package template
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	gotemplate "text/template"
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
 // CreateConfig ...
 func CreateConfig() *Config {
-	return &Config{}
+	return &Config{
+		fs:    OSFilesystem,
+		clock: utils.RealClock,
+	}
 }
 
 // Config ...
 type Config struct {
-	templates []*template
+	fs               Filesystem
+	clock            types.Clock
+	templates        []*template
+	lastStats        WriteStats
+	lastRotateErrors []error
+	postProcessor    func([]byte) ([]byte, error)
+}
+
+// WriteStats ...
+type WriteStats struct {
+	Files int
+	Bytes int
+	// Changed is the number of files whose content differs from the
+	// last content written to the same output.
+	Changed int
 }
 
 // ClearTemplates ...
@@ -38,6 +61,46 @@ func (c *Config) ClearTemplates() {
 	c.templates = nil
 }
 
+// ReplaceTemplates replaces the templates of this config with the templates
+// of another one. The list of rotated config files is preserved if both
+// templates share the same output, and the output buffer starts with the
+// capacity of the last rendering if both templates share the same name.
+func (c *Config) ReplaceTemplates(from *Config) {
+	for _, t := range from.templates {
+		for _, old := range c.templates {
+			if t.output != "" && t.output == old.output {
+				t.configFiles = old.configFiles
+			}
+			if t.tmpl.Name() == old.tmpl.Name() && old.rawConfig.Cap() > t.rawConfig.Cap() {
+				// the buffer has grown to the size of the last rendered
+				// output, reusing it avoids reallocations on the next write
+				t.rawConfig = bytes.NewBuffer(make([]byte, 0, old.rawConfig.Cap()))
+			}
+		}
+	}
+	c.templates = from.templates
+}
+
+// Clone creates a copy of this config which shares the parsed templates but
+// has its own buffers, so distinct copies can be executed concurrently.
+// Rotation and changes of output files aren't tracked by the copy.
+func (c *Config) Clone() *Config {
+	clone := &Config{
+		fs:            c.fs,
+		clock:         c.clock,
+		templates:     make([]*template, len(c.templates)),
+		postProcessor: c.postProcessor,
+	}
+	for i, t := range c.templates {
+		clone.templates[i] = &template{
+			tmpl:      t.tmpl,
+			output:    t.output,
+			rawConfig: bytes.NewBuffer(make([]byte, 0, t.rawConfig.Cap())),
+		}
+	}
+	return clone
+}
+
 // NewTemplate ...
 func (c *Config) NewTemplate(name, file, output string, rotate, startingBufferSize int) error {
 	tmpl, err := gotemplate.New(name).Funcs(funcMap).ParseFiles(file)
@@ -53,23 +116,116 @@ func (c *Config) NewTemplate(name, file, output string, rotate, startingBufferSi
 	return nil
 }
 
+// SetFilesystem configures the filesystem where the output files are written.
+func (c *Config) SetFilesystem(fs Filesystem) {
+	c.fs = fs
+}
+
+// SetClock configures the clock used to track the age of the rotated config
+// files, see SetRotateMaxAge().
+func (c *Config) SetClock(clock types.Clock) {
+	c.clock = clock
+}
+
+// SetRotateMaxAge configures the max age of the rotated config files of all
+// the templates of this config. Old files are removed when they exceed either
+// the max age or the max count configured in NewTemplate(). Zero disables the
+// age limit.
+func (c *Config) SetRotateMaxAge(maxAge time.Duration) {
+	for _, t := range c.templates {
+		t.maxAge = maxAge
+	}
+}
+
+// SetRotateCompress configures if the rotated config files of all the
+// templates of this config should be gzip compressed. The current output
+// file is always written uncompressed.
+func (c *Config) SetRotateCompress(compress bool) {
+	for _, t := range c.templates {
+		t.compress = compress
+	}
+}
+
+// SetPostProcessor configures a func that changes the rendered content of
+// every template of this config before it is written. Outputs aren't
+// written if the func fails. A nil func disables the post processing.
+func (c *Config) SetPostProcessor(postProcessor func([]byte) ([]byte, error)) {
+	c.postProcessor = postProcessor
+}
+
+// ForgetOutputs stops tracking the changes of the outputs, e.g. outputs that
+// aren't written anymore, so their tracking doesn't grow forever.
+func (c *Config) ForgetOutputs(outputs ...string) {
+	for _, t := range c.templates {
+		for _, output := range outputs {
+			delete(t.sums, output)
+		}
+	}
+}
+
 // Write ...
 func (c *Config) Write(data interface{}) error {
 	return c.WriteOutput(data, "")
 }
 
+// LastOutput returns a copy of the content rendered by the last call to
+// Write() or WriteOutput(), concatenated in the order of the templates.
+func (c *Config) LastOutput() []byte {
+	size := 0
+	for _, t := range c.templates {
+		size += t.rawConfig.Len()
+	}
+	out := make([]byte, 0, size)
+	for _, t := range c.templates {
+		out = append(out, t.rawConfig.Bytes()...)
+	}
+	return out
+}
+
+// LastWriteStats returns the number of files and bytes written by the last
+// call to Write() or WriteOutput().
+func (c *Config) LastWriteStats() WriteStats {
+	return c.lastStats
+}
+
+// LastRotateErrors returns the errors found rotating the old output files by
+// the last call to Write() or WriteOutput(). Rotation failures don't prevent
+// the new content from being written, so they are only reported here.
+func (c *Config) LastRotateErrors() []error {
+	return c.lastRotateErrors
+}
+
 // WriteOutput ...
 func (c *Config) WriteOutput(data interface{}, output string) error {
+	c.lastStats = WriteStats{}
+	c.lastRotateErrors = nil
 	for _, t := range c.templates {
 		t.rawConfig.Reset()
 		if err := t.tmpl.Execute(t.rawConfig, data); err != nil {
 			return err
 		}
+		if c.postProcessor != nil {
+			out, err := c.postProcessor(t.rawConfig.Bytes())
+			if err != nil {
+				return fmt.Errorf("error post processing %s: %w", t.tmpl.Name(), err)
+			}
+			t.rawConfig.Reset()
+			t.rawConfig.Write(out)
+		}
 	}
+	now := c.clock.Now()
 	for _, t := range c.templates {
-		if err := t.writeToDisk(output); err != nil {
+		if t.trackChange(output) {
+			c.lastStats.Changed++
+		}
+		if err := t.rotateOutput(c.fs, output, now); err != nil {
+			c.lastRotateErrors = append(c.lastRotateErrors, err)
+		}
+		if err := t.writeToDisk(c.fs, output); err != nil {
 			return err
 		}
+		c.lastStats.Files++
+		c.lastStats.Bytes += t.rawConfig.Len()
 	}
 	return nil
 }
@@ -78,43 +234,136 @@ type template struct {
 	tmpl        *gotemplate.Template
 	output      string
 	rotate      int
+	maxAge      time.Duration
+	compress    bool
 	rawConfig   *bytes.Buffer
-	configFiles []string
+	configFiles []configFile
+	sums        map[string][sha256.Size]byte
+}
+
+type configFile struct {
+	name      string
+	rotatedAt time.Time
 }
 
-func (t *template) writeToDisk(output string) error {
+// trackChange returns true if the rendered content differs from the last
+// content rendered to the same output.
+func (t *template) trackChange(output string) bool {
 	if output == "" {
 		output = t.output
 	}
+	sum := sha256.Sum256(t.rawConfig.Bytes())
+	if t.sums == nil {
+		t.sums = map[string][sha256.Size]byte{}
+	}
+	old, found := t.sums[output]
+	t.sums[output] = sum
+	return !found || old != sum
+}
+
+// rotateOutput keeps a copy of the current content of the output, and removes
+// the old copies. Rotated files are only used for troubleshooting, so callers
+// should report a failure and write the new content despite of it.
+func (t *template) rotateOutput(fs Filesystem, output string, now time.Time) error {
 	if output == "" {
-		return fmt.Errorf("output file is empty, configure on NewTemplate() or use WriteOutput()")
+		output = t.output
 	}
-	if t.rotate > 0 {
-		// Include timestamp in rotated config file names to aid troubleshooting.
-		// When using a single, ever-changing config file it was difficult
-		// to know what config was loaded by any given haproxy process
-		//
-		// rename current config file, if exists
-		if f, err := os.Stat(output); f != nil {
-			rotateTo := output + "." + f.ModTime().Format("20060102-150405.000")
-			if err := os.Rename(output, rotateTo); err != nil {
-				return fmt.Errorf("cannot rotate %s: %v", output, err)
-			}
-			t.configFiles = append(t.configFiles, rotateTo)
-		} else if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("cannot rotate %s: %v", output, err)
+	if output == "" || (t.rotate == 0 && t.maxAge == 0) {
+		return nil
+	}
+	// Include timestamp in rotated config file names to aid troubleshooting.
+	// When using a single, ever-changing config file it was difficult
+	// to know what config was loaded by any given haproxy process
+	//
+	// hard link current config file, if exists, so the output
+	// isn't missing while the new content is being written.
+	// A compressed copy is created instead if compress is enabled.
+	var rotateErr error
+	if f, err := fs.Stat(output); f != nil {
+		rotateTo := output + "." + f.ModTime().Format("20060102-150405.000")
+		if t.compress {
+			rotateTo += ".gz"
+			err = compressFile(fs, output, rotateTo)
+		} else {
+			err = fs.Link(output, rotateTo)
 		}
-		// remove old config files
-		for len(t.configFiles) > t.rotate {
-			name := t.configFiles[0]
-			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
-				return fmt.Errorf("cannot remove old config file %s: %v", name, err)
+		if err != nil {
+			rotateErr = fmt.Errorf("cannot rotate %s: %v", output, err)
+		} else {
+			t.configFiles = append(t.configFiles, configFile{name: rotateTo, rotatedAt: now})
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		rotateErr = fmt.Errorf("cannot rotate %s: %v", output, err)
+	}
+	// remove old config files, either exceeding the max count or the max age.
+	// A file that cannot be removed is kept in the list, so it is removed on
+	// the next rotation.
+	for len(t.configFiles) > 0 {
+		exceeded := t.rotate > 0 && len(t.configFiles) > t.rotate
+		expired := t.maxAge > 0 && now.Sub(t.configFiles[0].rotatedAt) > t.maxAge
+		if !exceeded && !expired {
+			break
+		}
+		name := t.configFiles[0].name
+		if err := fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			if rotateErr == nil {
+				rotateErr = fmt.Errorf("cannot remove old config file %s: %v", name, err)
 			}
-			t.configFiles = t.configFiles[1:]
+			break
 		}
+		t.configFiles = t.configFiles[1:]
 	}
-	if err := os.WriteFile(output, t.rawConfig.Bytes(), 0644); err != nil {
+	return rotateErr
+}
+
+func (t *template) writeToDisk(fs Filesystem, output string) error {
+	if output == "" {
+		output = t.output
+	}
+	if output == "" {
+		return fmt.Errorf("output file is empty, configure on NewTemplate() or use WriteOutput()")
+	}
+	if err := writeFileAtomic(fs, output, t.rawConfig.Bytes()); err != nil {
 		return fmt.Errorf("cannot write %s: %v", output, err)
 	}
 	return nil
 }
+
+// compressFile writes a gzip compressed copy of src into dst.
+func compressFile(fs Filesystem, src, dst string) error {
+	data, err := fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(fs, dst, out.Bytes())
+}
+
+// writeFileAtomic writes data into a temporary file in the same directory
+// of output, renaming it afterwards. haproxy either reads the old or the
+// new content, never a partially written file.
+func writeFileAtomic(fs Filesystem, output string, data []byte) error {
+	tmp := output + ".tmp"
+	f, err := fs.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = fs.Rename(tmp, output)
+	}
+	if err != nil {
+		fs.Remove(tmp)
+	}
+	return err
+}
@@ -17,9 +17,13 @@ limitations under the License.
 package template
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -188,7 +192,7 @@ func TestWrite(t *testing.T) {
 				{
 					content: "{{ .Name }}",
 					outputs: []string{""},
-					logging: `ERROR from writer: cannot write /tmp/haproxy-ingress/cannot/stat/here/h1.cfg: open /tmp/haproxy-ingress/cannot/stat/here/h1.cfg: no such file or directory`,
+					logging: `ERROR from writer: cannot write /tmp/haproxy-ingress/cannot/stat/here/h1.cfg: open /tmp/haproxy-ingress/cannot/stat/here/h1.cfg.tmp: no such file or directory`,
 				},
 			},
 			datas: []interface{}{
@@ -274,6 +278,318 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestLastOutput(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	fs := NewMemFilesystem()
+	c.templateConfig.SetFilesystem(fs)
+	c.newTemplate("{{ . }}", 0)
+	c.newTemplate("-{{ . }}", 0)
+	if err := c.templateConfig.Write("abc"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	out := c.templateConfig.LastOutput()
+	if err := c.templateConfig.Write("xyz"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	if string(out) != "abc-abc" {
+		t.Errorf("expected 'abc-abc' preserved after the next write, but was '%s'", string(out))
+	}
+	if out := c.templateConfig.LastOutput(); string(out) != "xyz-xyz" {
+		t.Errorf("expected 'xyz-xyz', but was '%s'", string(out))
+	}
+}
+
+func TestReplaceTemplatesBufferSize(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	fs := NewMemFilesystem()
+	c.templateConfig.SetFilesystem(fs)
+	c.newTemplate("{{ . }}", 0)
+	content := strings.Repeat("x", 4096)
+	if err := c.templateConfig.Write(content); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	bufSize := c.templateConfig.templates[0].rawConfig.Cap()
+	if bufSize < len(content) {
+		t.Errorf("expected buffer size of at least %d, but was %d", len(content), bufSize)
+	}
+
+	tmplPath := filepath.Join(c.tempdir, "h1.tmpl")
+	from := CreateConfig()
+	if err := from.NewTemplate("h1.tmpl", tmplPath, filepath.Join(c.tempdir, "h1.cfg"), 0, 1024); err != nil {
+		t.Errorf("error parsing h1.tmpl: %v", err)
+	}
+	c.templateConfig.ReplaceTemplates(from)
+	if actual := c.templateConfig.templates[0].rawConfig.Cap(); actual != bufSize {
+		t.Errorf("expected buffer size %d after replacing templates, but was %d", bufSize, actual)
+	}
+
+	from = CreateConfig()
+	if err := from.NewTemplate("h2.tmpl", tmplPath, filepath.Join(c.tempdir, "h2.cfg"), 0, 1024); err != nil {
+		t.Errorf("error parsing h2.tmpl: %v", err)
+	}
+	c.templateConfig.ReplaceTemplates(from)
+	if actual := c.templateConfig.templates[0].rawConfig.Cap(); actual != 1024 {
+		t.Errorf("expected buffer size 1024 of a distinct template, but was %d", actual)
+	}
+}
+
+func TestLastWriteStats(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	c.newTemplate("{{ . }}", 0)
+	c.newTemplate("{{ . }}-{{ . }}", 0)
+	if err := c.templateConfig.Write("abc"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	expected := WriteStats{Files: 2, Bytes: 10, Changed: 2}
+	if stats := c.templateConfig.LastWriteStats(); stats != expected {
+		t.Errorf("expected %+v, but was %+v", expected, stats)
+	}
+	if err := c.templateConfig.Write("abc"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	expected = WriteStats{Files: 2, Bytes: 10, Changed: 0}
+	if stats := c.templateConfig.LastWriteStats(); stats != expected {
+		t.Errorf("expected %+v, but was %+v", expected, stats)
+	}
+	if err := c.templateConfig.Write("a"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	expected = WriteStats{Files: 2, Bytes: 4, Changed: 2}
+	if stats := c.templateConfig.LastWriteStats(); stats != expected {
+		t.Errorf("expected %+v, but was %+v", expected, stats)
+	}
+	// a forgotten output is tracked as a new one
+	c.templateConfig.ForgetOutputs(filepath.Join(c.tempdirOutput, "h1.cfg"))
+	if err := c.templateConfig.Write("a"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	expected = WriteStats{Files: 2, Bytes: 4, Changed: 1}
+	if stats := c.templateConfig.LastWriteStats(); stats != expected {
+		t.Errorf("expected %+v, but was %+v", expected, stats)
+	}
+}
+
+func TestWritePostProcessor(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	fs := NewMemFilesystem()
+	c.templateConfig.SetFilesystem(fs)
+	c.newTemplate("{{ . }}", 0)
+	output := filepath.Join(c.tempdirOutput, "h1.cfg")
+	var fail bool
+	c.templateConfig.SetPostProcessor(func(in []byte) ([]byte, error) {
+		if fail {
+			return nil, fmt.Errorf("invalid content")
+		}
+		return append([]byte("# processed\n"), in...), nil
+	})
+
+	if err := c.templateConfig.Write("abc"); err != nil {
+		t.Errorf("error writing templates: %v", err)
+	}
+	if content, _ := fs.ReadFile(output); string(content) != "# processed\nabc" {
+		t.Errorf("expected processed content, but was '%s'", string(content))
+	}
+	if stats := c.templateConfig.LastWriteStats(); stats.Bytes != 15 {
+		t.Errorf("expected 15 bytes written, but was %d", stats.Bytes)
+	}
+
+	fail = true
+	err := c.templateConfig.Write("xyz")
+	if err == nil || err.Error() != "error post processing h1.tmpl: invalid content" {
+		t.Errorf("expected post processing error, but was '%v'", err)
+	}
+	if content, _ := fs.ReadFile(output); string(content) != "# processed\nabc" {
+		t.Errorf("expected former content preserved, but was '%s'", string(content))
+	}
+}
+
+func TestWriteMemFilesystem(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+	fs := NewMemFilesystem()
+	fs.SetClock(clock)
+	c.templateConfig.SetFilesystem(fs)
+	c.newTemplate("{{ . }}", 1)
+	for _, data := range []string{"joe1", "joe2", "joe3"} {
+		if err := c.templateConfig.Write(data); err != nil {
+			t.Errorf("error writing %s: %v", data, err)
+		}
+		clock.Add(10 * time.Millisecond)
+	}
+	if outputs := c.outputs(0); len(outputs) != 1 || outputs[0] != "" {
+		t.Errorf("expected nothing written in the disk, but was %v", outputs)
+	}
+	files := fs.Files()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files in the memory filesystem, but was %v", files)
+	}
+	var contents []string
+	for _, file := range files {
+		content, _ := fs.ReadFile(file)
+		contents = append(contents, string(content))
+	}
+	output := filepath.Join(c.tempdirOutput, "h1.cfg")
+	if files[0] != output || fmt.Sprint(contents) != "[joe3 joe2]" {
+		t.Errorf("expected current joe3 and rotated joe2, but was %v: %v", files, contents)
+	}
+}
+
+func TestWriteCompress(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+	fs := NewMemFilesystem()
+	fs.SetClock(clock)
+	c.templateConfig.SetFilesystem(fs)
+	c.newTemplate("{{ . }}", 2)
+	c.templateConfig.SetRotateCompress(true)
+	for _, data := range []string{"joe1", "joe2", "joe3", "joe4"} {
+		if err := c.templateConfig.Write(data); err != nil {
+			t.Errorf("error writing %s: %v", data, err)
+		}
+		clock.Add(10 * time.Millisecond)
+	}
+	files := fs.Files()
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files in the memory filesystem, but was %v", files)
+	}
+	var contents []string
+	for i, file := range files {
+		content, _ := fs.ReadFile(file)
+		if i > 0 {
+			if !strings.HasSuffix(file, ".gz") {
+				t.Errorf("expected rotated file %s with .gz suffix", file)
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("error reading compressed %s: %v", file, err)
+			}
+			content, err = io.ReadAll(gz)
+			if err != nil {
+				t.Fatalf("error decompressing %s: %v", file, err)
+			}
+		}
+		contents = append(contents, string(content))
+	}
+	output := filepath.Join(c.tempdirOutput, "h1.cfg")
+	if files[0] != output || fmt.Sprint(contents) != "[joe4 joe2 joe3]" {
+		t.Errorf("expected current joe4 and compressed joe2 and joe3, but was %v: %v", files, contents)
+	}
+}
+
+// failingLinkFilesystem fails to create hard links, which breaks the
+// rotation of the old config files.
+type failingLinkFilesystem struct {
+	*MemFilesystem
+}
+
+func (failingLinkFilesystem) Link(oldname, newname string) error {
+	return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrPermission}
+}
+
+func TestWriteRotateError(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+	fs := failingLinkFilesystem{NewMemFilesystem()}
+	fs.SetClock(clock)
+	c.templateConfig.SetFilesystem(fs)
+	c.templateConfig.SetClock(clock)
+	c.newTemplate("{{ . }}", 2)
+	output := filepath.Join(c.tempdirOutput, "h1.cfg")
+
+	if err := c.templateConfig.Write("joe1"); err != nil {
+		t.Errorf("error writing joe1: %v", err)
+	}
+	if errs := c.templateConfig.LastRotateErrors(); len(errs) > 0 {
+		t.Errorf("expected no rotate error without a former config, but was %v", errs)
+	}
+
+	clock.Add(10 * time.Millisecond)
+	if err := c.templateConfig.Write("joe2"); err != nil {
+		t.Errorf("expected joe2 written despite of the rotate error, but was: %v", err)
+	}
+	errs := c.templateConfig.LastRotateErrors()
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "cannot rotate "+output+": ") {
+		t.Errorf("expected one rotate error, but was %v", errs)
+	}
+	if content, _ := fs.ReadFile(output); string(content) != "joe2" {
+		t.Errorf("expected joe2 as the current config, but was '%s'", string(content))
+	}
+	if files := fs.Files(); len(files) != 1 {
+		t.Errorf("expected only the current config, but was %v", files)
+	}
+}
+
+func TestWriteMaxAge(t *testing.T) {
+	type data struct {
+		Name string
+	}
+	testCases := []struct {
+		rotate  int
+		outputs []string
+	}{
+		// 0
+		{
+			rotate:  0,
+			outputs: []string{"joe3", "joe4"},
+		},
+		// 1
+		{
+			rotate:  3,
+			outputs: []string{"joe3", "joe4"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		clock := helper_test.NewClockMock(time.Date(2022, 3, 4, 10, 20, 30, 0, time.UTC))
+		fs := NewMemFilesystem()
+		fs.SetClock(clock)
+		c.templateConfig.SetFilesystem(fs)
+		c.templateConfig.SetClock(clock)
+		c.newTemplate("{{ .Name }}", test.rotate)
+		c.templateConfig.SetRotateMaxAge(100 * time.Millisecond)
+		write := func(name string) {
+			if err := c.templateConfig.Write(data{Name: name}); err != nil {
+				t.Errorf("test %d: error writing %s: %v", i, name, err)
+			}
+			clock.Add(10 * time.Millisecond)
+		}
+		readOutputs := func() []string {
+			// rotated configs first, the actual config in the end
+			output := filepath.Join(c.tempdirOutput, "h1.cfg")
+			var contents []string
+			for _, file := range fs.Files() {
+				if file != output {
+					content, _ := fs.ReadFile(file)
+					contents = append(contents, string(content))
+				}
+			}
+			content, _ := fs.ReadFile(output)
+			return append(contents, string(content))
+		}
+		write("joe1")
+		write("joe2")
+		write("joe3")
+		if outputs := readOutputs(); len(outputs) != 3 {
+			t.Errorf("test %d expected 3 rotated+actual configs before expiring, but was %v", i, outputs)
+		}
+		// joe1 and joe2 expire, joe3 is rotated now and should be preserved
+		clock.Add(150 * time.Millisecond)
+		write("joe4")
+		outputs := readOutputs()
+		if fmt.Sprint(outputs) != fmt.Sprint(test.outputs) {
+			t.Errorf("test %d expected %v, but was %v", i, test.outputs, outputs)
+		}
+		c.teardown()
+	}
+}
+
 func (c *testConfig) newTemplate(content string, rotate int) {
 	cnt := len(c.templateConfig.templates) + 1
 	templateFileName := fmt.Sprintf("h%d.tmpl", cnt)
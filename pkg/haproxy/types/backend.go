@@ -18,7 +18,9 @@ package types
 
 import (
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
@@ -94,30 +96,121 @@ func (b *Backend) addEndpoint(ip string, port int, targetRef string) *Endpoint {
 	return endpoint
 }
 
-func (b *Backend) fillSourceIPs() {
-	l := len(b.SourceIPs)
-	if l > 0 {
-		i := int(b.hash64 % uint64(l))
-		for _, ep := range b.Endpoints {
-			ep.SourceIP = b.SourceIPs[i].String()
-			i = (i + 1) % l
+// fillSourceIPs assigns source IPs of the same address family of the
+// endpoints, and returns the targets without a matching source IP.
+func (b *Backend) fillSourceIPs() (missing []string) {
+	if len(b.SourceIPs) == 0 {
+		return nil
+	}
+	var sourceIPv4, sourceIPv6 []net.IP
+	for _, ip := range b.SourceIPs {
+		if ip.To4() != nil {
+			sourceIPv4 = append(sourceIPv4, ip)
+		} else {
+			sourceIPv6 = append(sourceIPv6, ip)
+		}
+	}
+	// empty slots don't have an address family, they follow the
+	// family of the first endpoint, or the one with source IPs
+	emptyIsIPv6 := len(sourceIPv4) == 0
+	for _, ep := range b.Endpoints {
+		if !ep.IsEmpty() {
+			emptyIsIPv6 = isIPv6(ep.IP)
+			break
+		}
+	}
+	var i4, i6 int
+	if l := len(sourceIPv4); l > 0 {
+		i4 = int(b.hash64 % uint64(l))
+	}
+	if l := len(sourceIPv6); l > 0 {
+		i6 = int(b.hash64 % uint64(l))
+	}
+	for _, ep := range b.Endpoints {
+		ipv6 := isIPv6(ep.IP)
+		if ep.IsEmpty() {
+			ipv6 = emptyIsIPv6
+		}
+		sourceIPs, i := sourceIPv4, &i4
+		if ipv6 {
+			sourceIPs, i = sourceIPv6, &i6
+		}
+		if len(sourceIPs) == 0 {
+			ep.SourceIP = ""
+			if !ep.IsEmpty() {
+				missing = append(missing, ep.Target)
+			}
+			continue
 		}
+		ep.SourceIP = sourceIPs[*i].String()
+		*i = (*i + 1) % len(sourceIPs)
 	}
+	return missing
+}
+
+func isIPv6(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && addr.To4() == nil
 }
 
 func (b *Backend) sortEndpoints(sortBy string) {
 	ep := b.Endpoints
 	switch sortBy {
 	// ignoring "ep"/"endpoint" (use the k8s order) and "random" (shuffleEndpoints implements)
-	case "name":
+	case SortEndpointsByName:
 		sort.Slice(ep, func(i, j int) bool {
 			return ep[i].Name < ep[j].Name
 		})
-	case "ip":
+	case SortEndpointsByIP:
 		sort.Slice(ep, func(i, j int) bool {
 			return ep[i].IP < ep[j].IP
 		})
+	case SortEndpointsByStable:
+		// the hash of backend and target, instead of the target itself, avoids that
+		// all the backends start their balance on the endpoints of the lower IPs,
+		// and leads to the same order on all the controller instances and reloads
+		hash := make(map[*Endpoint]uint32, len(ep))
+		for _, e := range ep {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(b.ID + "/" + e.Target))
+			hash[e] = h.Sum32()
+		}
+		sort.SliceStable(ep, func(i, j int) bool {
+			if hash[ep[i]] == hash[ep[j]] {
+				return ep[i].Name < ep[j].Name
+			}
+			return hash[ep[i]] < hash[ep[j]]
+		})
+	}
+}
+
+// preserveEndpointsOrder keeps the endpoints found in the old backend in the
+// same order they were, and moves new endpoints after them, followed by the
+// empty slots. New endpoints keep the order they were added.
+func (b *Backend) preserveEndpointsOrder(old *Backend) {
+	if old == nil {
+		return
+	}
+	oldPos := make(map[string]int, len(old.Endpoints))
+	for i, e := range old.Endpoints {
+		if !e.IsEmpty() {
+			oldPos[e.Target] = i
+		}
+	}
+	ep := b.Endpoints
+	pos := make(map[*Endpoint]int, len(ep))
+	for _, e := range ep {
+		if e.IsEmpty() {
+			pos[e] = len(old.Endpoints) + 1
+		} else if i, found := oldPos[e.Target]; found {
+			pos[e] = i
+		} else {
+			pos[e] = len(old.Endpoints)
+		}
 	}
+	sort.SliceStable(ep, func(i, j int) bool {
+		return pos[ep[i]] < pos[ep[j]]
+	})
 }
 
 func (b *Backend) shuffleEndpoints() {
@@ -260,6 +353,15 @@ func (b *Backend) NeedACL() bool {
 	return false
 }
 
+// CopyPathsFrom replaces the paths of the backend, and the state built
+// from them, with the ones of other backend.
+func (b *Backend) CopyPathsFrom(other *Backend) {
+	b.Paths = other.Paths
+	b.PathsMap = other.PathsMap
+	b.PathsDefaultHostMap = other.PathsDefaultHostMap
+	b.pathConfig = other.pathConfig
+}
+
 func (b *Backend) ensurePathConfig(attr string) {
 	if b.pathConfig == nil {
 		b.pathConfig = b.createPathConfig()
@@ -87,12 +87,156 @@ func TestAddBackendPath(t *testing.T) {
 	}
 }
 
+func TestSortEndpoints(t *testing.T) {
+	eps := []string{"10.0.0.4", "10.0.0.2", "10.0.0.3"}
+	testCases := []struct {
+		sortBy string
+		exp    []string
+	}{
+		// 0
+		{
+			sortBy: SortEndpointsByEndpoint,
+			exp:    []string{"10.0.0.4", "10.0.0.2", "10.0.0.3"},
+		},
+		// 1
+		{
+			sortBy: SortEndpointsByIP,
+			exp:    []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		// 2
+		{
+			sortBy: SortEndpointsByName,
+			exp:    []string{"10.0.0.4", "10.0.0.2", "10.0.0.3"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		b := createBackend(0, "default", "echoserver", "8080")
+		for _, e := range eps {
+			b.AcquireEndpoint(e, 8080, "")
+		}
+		b.sortEndpoints(test.sortBy)
+		var ips []string
+		for _, ep := range b.Endpoints {
+			ips = append(ips, ep.IP)
+		}
+		c.compareObjects("endpoints", i, ips, test.exp)
+		c.teardown()
+	}
+}
+
+func TestSortEndpointsStable(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	var order []string
+	for _, eps := range [][]string{
+		{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"},
+		{"10.0.0.5", "10.0.0.4", "10.0.0.3", "10.0.0.2"},
+		{"10.0.0.4", "10.0.0.2", "10.0.0.5", "10.0.0.3"},
+	} {
+		b := createBackend(0, "default", "echoserver", "8080")
+		for _, e := range eps {
+			b.AcquireEndpoint(e, 8080, "")
+		}
+		b.sortEndpoints(SortEndpointsByStable)
+		var ips []string
+		for _, ep := range b.Endpoints {
+			ips = append(ips, ep.IP)
+		}
+		if order == nil {
+			order = ips
+		} else if !reflect.DeepEqual(order, ips) {
+			t.Errorf("stable sort should not depend on the input order, expected %v but was %v", order, ips)
+		}
+	}
+}
+
+func TestSortEndpointsPreserve(t *testing.T) {
+	testCases := []struct {
+		old   []string
+		cur   []string
+		empty int
+		exp   []string
+	}{
+		// 0
+		{
+			cur: []string{"10.0.0.3", "10.0.0.2"},
+			exp: []string{"10.0.0.3", "10.0.0.2"},
+		},
+		// 1
+		{
+			old: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			cur: []string{"10.0.0.4", "10.0.0.3", "10.0.0.2"},
+			exp: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		},
+		// 2
+		{
+			old: []string{"10.0.0.4", "10.0.0.2"},
+			cur: []string{"10.0.0.6", "10.0.0.2", "10.0.0.5", "10.0.0.4"},
+			exp: []string{"10.0.0.4", "10.0.0.2", "10.0.0.6", "10.0.0.5"},
+		},
+		// 3
+		{
+			old: []string{"10.0.0.4", "10.0.0.3", "10.0.0.2"},
+			cur: []string{"10.0.0.2", "10.0.0.5", "10.0.0.4"},
+			exp: []string{"10.0.0.4", "10.0.0.2", "10.0.0.5"},
+		},
+		// 4
+		{
+			old:   []string{"10.0.0.3", "10.0.0.2"},
+			cur:   []string{"10.0.0.2", "10.0.0.4", "10.0.0.3"},
+			empty: 2,
+			exp:   []string{"10.0.0.3", "10.0.0.2", "10.0.0.4", "127.0.0.1", "127.0.0.1"},
+		},
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		backends := CreateBackends(0)
+		if test.old != nil {
+			old := backends.AcquireBackend("default", "echoserver", "8080")
+			for _, e := range test.old {
+				old.AcquireEndpoint(e, 8080, "")
+			}
+			backends.Commit()
+			backends.RemoveAll([]string{old.ID})
+		}
+		b := backends.AcquireBackend("default", "echoserver", "8080")
+		for _, e := range test.cur {
+			b.AcquireEndpoint(e, 8080, "")
+		}
+		for j := 0; j < test.empty; j++ {
+			b.AddEmptyEndpoint()
+		}
+		backends.SortChangedEndpoints(SortEndpointsByPreserve)
+		var ips []string
+		for _, ep := range b.Endpoints {
+			ips = append(ips, ep.IP)
+		}
+		c.compareObjects("endpoints", i, ips, test.exp)
+		c.teardown()
+	}
+}
+
+func TestValidateSortEndpointsBy(t *testing.T) {
+	for _, sortBy := range []string{"endpoint", "ep", "name", "ip", "stable", "preserve", "random", "none"} {
+		if err := ValidateSortEndpointsBy(sortBy); err != nil {
+			t.Errorf("expected '%s' being valid, but was: %v", sortBy, err)
+		}
+	}
+	for _, sortBy := range []string{"", "IP", "weight"} {
+		if err := ValidateSortEndpointsBy(sortBy); err == nil {
+			t.Errorf("expected '%s' being invalid", sortBy)
+		}
+	}
+}
+
 func TestFillSourceIPs(t *testing.T) {
 	testCases := []struct {
 		name string
 		ep   []string
 		src  []string
 		exp  []string
+		miss []string
 	}{
 		// 0
 		{
@@ -135,6 +279,28 @@ func TestFillSourceIPs(t *testing.T) {
 			src:  []string{"10.0.0.102", "10.0.0.103", "10.0.0.104"},
 			exp:  []string{"10.0.0.104", "10.0.0.102"},
 		},
+		// 6
+		{
+			name: "echoserver",
+			ep:   []string{"10.0.0.2", "fd00::2", "10.0.0.3", "fd00::3"},
+			src:  []string{"10.0.0.102", "fd00::102", "fd00::103"},
+			exp:  []string{"10.0.0.102", "fd00::103", "10.0.0.102", "fd00::102"},
+		},
+		// 7
+		{
+			name: "echoserver",
+			ep:   []string{"fd00::2", "10.0.0.2", ""},
+			src:  []string{"fd00::102"},
+			exp:  []string{"fd00::102", "", "fd00::102"},
+			miss: []string{"10.0.0.2:8080"},
+		},
+		// 8
+		{
+			name: "echoserver",
+			ep:   []string{"", "fd00::2"},
+			src:  []string{"10.0.0.102", "fd00::102"},
+			exp:  []string{"fd00::102", "fd00::102"},
+		},
 	}
 	for i, test := range testCases {
 		c := setup(t)
@@ -149,12 +315,13 @@ func TestFillSourceIPs(t *testing.T) {
 		for _, s := range test.src {
 			b.SourceIPs = append(b.SourceIPs, net.ParseIP(s))
 		}
-		b.fillSourceIPs()
+		miss := b.fillSourceIPs()
 		var src []string
 		for _, ep := range b.Endpoints {
 			src = append(src, ep.SourceIP)
 		}
 		c.compareObjects("ip", i, src, test.exp)
+		c.compareObjects("missing", i, miss, test.miss)
 		c.teardown()
 	}
 }
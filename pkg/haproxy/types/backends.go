@@ -156,19 +156,56 @@ func (b *Backends) ChangedShards() []int {
 }
 
 // FillSourceIPs ...
-func (b *Backends) FillSourceIPs() {
+func (b *Backends) FillSourceIPs() (missing []string) {
 	for _, backend := range b.itemsAdd {
-		backend.fillSourceIPs()
+		for _, target := range backend.fillSourceIPs() {
+			missing = append(missing, backend.ID+"/"+target)
+		}
 	}
+	sort.Strings(missing)
+	return missing
 }
 
 // SortChangedEndpoints ...
 func (b *Backends) SortChangedEndpoints(sortBy string) {
 	for _, backend := range b.itemsAdd {
-		backend.sortEndpoints(sortBy)
+		if sortBy == SortEndpointsByPreserve {
+			// the removed backend is the committed one, which has the order to preserve
+			backend.preserveEndpointsOrder(b.itemsDel[backend.ID])
+		} else {
+			backend.sortEndpoints(sortBy)
+		}
 	}
 }
 
+// SetShardBy configures the key used to distribute the backends among the
+// backend shards: ShardByBackend, the default one, distributes every backend
+// by its own ID, and ShardByNamespace groups the backends of the same
+// namespace into the same shard. Should be called before the first backend
+// is acquired, backends already acquired are not moved to another shard.
+func (b *Backends) SetShardBy(shardBy string) {
+	b.shardBy = shardBy
+}
+
+// ValidateShardBy returns an error if shardBy isn't a valid backend shard key
+func ValidateShardBy(shardBy string) error {
+	switch shardBy {
+	case ShardByBackend, ShardByNamespace:
+		return nil
+	}
+	return fmt.Errorf("unsupported backend shard key: %s", shardBy)
+}
+
+// ValidateSortEndpointsBy returns an error if sortBy isn't a valid endpoint sorting mode
+func ValidateSortEndpointsBy(sortBy string) error {
+	switch sortBy {
+	case SortEndpointsByEndpoint, SortEndpointsByEp, SortEndpointsByName,
+		SortEndpointsByIP, SortEndpointsByStable, SortEndpointsByPreserve, SortEndpointsByRandom, SortEndpointsByNone:
+		return nil
+	}
+	return fmt.Errorf("unsupported endpoint sorting mode: %s", sortBy)
+}
+
 // ShuffleAllEndpoints ...
 func (b *Backends) ShuffleAllEndpoints() {
 	for _, backend := range b.items {
@@ -187,7 +224,9 @@ func (b *Backends) BuildSortedItems() []*Backend {
 	return nil
 }
 
-// BuildSortedShard ...
+// BuildSortedShard returns the backends of a shard sorted by their unique
+// ID, so the same backends always build byte-identical shard files,
+// regardless of the order they were acquired.
 func (b *Backends) BuildSortedShard(shardRef int) []*Backend {
 	return b.buildSortedItems(b.shards[shardRef])
 }
@@ -229,6 +268,9 @@ func (b *Backends) AcquireBackend(namespace, name, port string) *Backend {
 	b.items[backend.ID] = backend
 	b.itemsAdd[backend.ID] = backend
 	if shardCount > 0 {
+		if b.shardBy == ShardByNamespace {
+			backend.shard = int(hashKey(namespace) % uint64(shardCount))
+		}
 		b.shards[backend.shard][backend.ID] = backend
 	}
 	b.BackendChanged(backend)
@@ -259,6 +301,16 @@ func (b *Backends) FindBackend(namespace, name, port string) *Backend {
 	return b.items[buildID(namespace, name, port)]
 }
 
+// BackendShard returns the shard number of a backend, found is false if
+// backendID does not exist.
+func (b *Backends) BackendShard(backendID string) (shard int, found bool) {
+	backend, found := b.items[backendID]
+	if !found {
+		return 0, false
+	}
+	return backend.shard, true
+}
+
 // FindBackendID ...
 func (b *Backends) FindBackendID(backendID BackendID) *Backend {
 	return b.items[backendID.String()]
@@ -272,7 +324,10 @@ func (b *Backends) RemoveAll(backendID []string) {
 				delete(b.shards[item.shard], id)
 			}
 			b.BackendChanged(item)
-			b.itemsDel[id] = item
+			// keeps the committed item if removed again before a commit
+			if _, found := b.itemsDel[id]; !found {
+				b.itemsDel[id] = item
+			}
 			if item == b.DefaultBackend {
 				b.DefaultBackend = nil
 			}
@@ -295,7 +350,24 @@ func (b BackendID) String() string {
 
 func createBackend(shards int, namespace, name, port string) *Backend {
 	id := buildID(namespace, name, port)
-	hash := md5.Sum([]byte(id))
+	hash64 := hashKey(id)
+	var shard int
+	if shards > 0 {
+		shard = int(hash64 % uint64(shards))
+	}
+	return &Backend{
+		hash64:    hash64,
+		shard:     shard,
+		ID:        id,
+		Namespace: namespace,
+		Name:      name,
+		Port:      port,
+		Server:    ServerConfig{InitialWeight: 1},
+	}
+}
+
+func hashKey(key string) uint64 {
+	hash := md5.Sum([]byte(key))
 	part0 := uint64(hash[0])<<56 |
 		uint64(hash[1])<<48 |
 		uint64(hash[2])<<40 |
@@ -312,20 +384,7 @@ func createBackend(shards int, namespace, name, port string) *Backend {
 		uint64(hash[13])<<16 |
 		uint64(hash[14])<<8 |
 		uint64(hash[15])
-	hash64 := part0 ^ part1
-	var shard int
-	if shards > 0 {
-		shard = int(hash64 % uint64(shards))
-	}
-	return &Backend{
-		hash64:    hash64,
-		shard:     shard,
-		ID:        id,
-		Namespace: namespace,
-		Name:      name,
-		Port:      port,
-		Server:    ServerConfig{InitialWeight: 1},
-	}
+	return part0 ^ part1
 }
 
 func buildID(namespace, name, port string) string {
@@ -128,6 +128,103 @@ func TestBackendCrud(t *testing.T) {
 	}
 }
 
+func TestBuildSortedShard(t *testing.T) {
+	testCases := []struct {
+		shardBy   string
+		add       []string
+		expShards [][]string
+	}{
+		// 0
+		{
+			add: []string{"default_app1_8080", "default_app2_8080", "default_app3_8080", "default_app4_8080"},
+			expShards: [][]string{
+				{"default_app2_8080"},
+				{"default_app1_8080", "default_app4_8080"},
+				{"default_app3_8080"},
+			},
+		},
+		// 1
+		{
+			add: []string{"default_app4_8080", "default_app3_8080", "default_app2_8080", "default_app1_8080"},
+			expShards: [][]string{
+				{"default_app2_8080"},
+				{"default_app1_8080", "default_app4_8080"},
+				{"default_app3_8080"},
+			},
+		},
+		// 2
+		{
+			add: []string{"ns2_app_8080", "default_app_8080", "ns1_app_8080", "default_app_8443", "ns1_app_80"},
+			expShards: [][]string{
+				{"default_app_8080", "ns1_app_8080"},
+				{},
+				{"default_app_8443", "ns1_app_80", "ns2_app_8080"},
+			},
+		},
+		// 3
+		{
+			shardBy: ShardByBackend,
+			add:     []string{"ns2_app_8080", "default_app_8080", "ns1_app_8080", "default_app_8443", "ns1_app_80"},
+			expShards: [][]string{
+				{"default_app_8080", "ns1_app_8080"},
+				{},
+				{"default_app_8443", "ns1_app_80", "ns2_app_8080"},
+			},
+		},
+		// 4
+		{
+			shardBy: ShardByNamespace,
+			add:     []string{"ns2_app_8080", "default_app_8080", "ns1_app_8080", "default_app_8443", "ns1_app_80"},
+			expShards: [][]string{
+				{},
+				{"default_app_8080", "default_app_8443", "ns2_app_8080"},
+				{"ns1_app_80", "ns1_app_8080"},
+			},
+		},
+	}
+	toarray := func(items []*Backend) []string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.ID)
+		}
+		return result
+	}
+	for i, test := range testCases {
+		c := setup(t)
+		backends := CreateBackends(len(test.expShards))
+		backends.SetShardBy(test.shardBy)
+		for _, add := range test.add {
+			p := strings.Split(add, "_")
+			backends.AcquireBackend(p[0], p[1], p[2])
+		}
+		var shards [][]string
+		for j := range test.expShards {
+			shard := toarray(backends.BuildSortedShard(j))
+			c.compareObjects("idempotent shard", i, toarray(backends.BuildSortedShard(j)), shard)
+			shards = append(shards, shard)
+		}
+		c.compareObjects("shards", i, shards, test.expShards)
+		c.teardown()
+	}
+}
+
+func TestChangedShardsByNamespace(t *testing.T) {
+	c := setup(t)
+	defer c.teardown()
+	backends := CreateBackends(3)
+	backends.SetShardBy(ShardByNamespace)
+	for _, ns := range []string{"default", "ns1", "ns2"} {
+		backends.AcquireBackend(ns, "app1", "8080")
+		backends.AcquireBackend(ns, "app2", "8080")
+	}
+	backends.Commit()
+	backends.RemoveAll([]string{"ns1_app1_8080", "ns1_app2_8080"})
+	backends.AcquireBackend("ns1", "app1", "8080")
+	backends.AcquireBackend("ns1", "app2", "8080").Server.InitialWeight = 2
+	backends.AcquireBackend("ns1", "app3", "8080")
+	c.compareObjects("changed shards", 0, backends.ChangedShards(), []int{2})
+}
+
 func TestAcquireAuthBackend(t *testing.T) {
 	type bk struct {
 		iplist   []string
@@ -54,7 +54,8 @@ func (c *AcmeStorages) Updated() bool {
 	return len(c.itemsAdd) > 0 || len(c.itemsDel) > 0
 }
 
-// BuildAcmeStorages ...
+// BuildAcmeStorages lists the storages of the current configuration, sorted
+// by name, in the format used by the acme queue.
 func (c *AcmeStorages) BuildAcmeStorages() []string {
 	return buildAcmeStorages(c.items)
 }
@@ -71,24 +72,78 @@ func (c *AcmeStorages) BuildAcmeStoragesDel() []string {
 	return buildAcmeStorages(c.itemsDel)
 }
 
+// BuildAcmeStorageList lists the storages of the current configuration,
+// sorted by name.
+func (c *AcmeStorages) BuildAcmeStorageList() []AcmeStorage {
+	return buildAcmeStorageList(c.items)
+}
+
 func buildAcmeStorages(items map[string]*AcmeCerts) []string {
-	storages := make([]string, len(items))
-	i := 0
+	list := buildAcmeStorageList(items)
+	storages := make([]string, len(list))
+	for i, storage := range list {
+		storages[i] = storage.String()
+	}
+	return storages
+}
+
+func buildAcmeStorageList(items map[string]*AcmeCerts) []AcmeStorage {
+	names := make([]string, 0, len(items))
 	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	storages := make([]AcmeStorage, len(names))
+	for i, name := range names {
 		item := items[name]
-		certs := make([]string, len(item.certs))
-		j := 0
+		certs := make([]string, 0, len(item.certs))
 		for cert := range item.certs {
-			certs[j] = cert
-			j++
+			certs = append(certs, cert)
 		}
 		sort.Strings(certs)
-		storages[i] = name + "," + item.preferredChain + "," + strings.Join(certs, ",")
-		i++
+		storages[i] = AcmeStorage{Name: name, Domains: certs, PreferredChain: item.preferredChain}
+	}
+	return storages
+}
+
+// BuildCommittedStorages lists the storages of the last committed
+// configuration, sorted by name. Changes made since the last commit
+// are ignored and the tracking of added and removed items is preserved.
+func (c *AcmeStorages) BuildCommittedStorages() []AcmeStorage {
+	items := make(map[string]*AcmeCerts, len(c.items))
+	for name, item := range c.items {
+		if _, found := c.itemsAdd[name]; !found {
+			items[name] = item
+		}
+	}
+	for name, item := range c.itemsDel {
+		items[name] = item
+	}
+	storages := make([]AcmeStorage, 0, len(items))
+	for name, item := range items {
+		domains := make([]string, 0, len(item.certs))
+		for domain := range item.certs {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		storages = append(storages, AcmeStorage{
+			Name:           name,
+			Domains:        domains,
+			PreferredChain: item.preferredChain,
+		})
 	}
+	sort.Slice(storages, func(i, j int) bool {
+		return storages[i].Name < storages[j].Name
+	})
 	return storages
 }
 
+// String builds the representation of the storage used in the acme queue,
+// see BuildAcmeStorages().
+func (s AcmeStorage) String() string {
+	return s.Name + "," + s.PreferredChain + "," + strings.Join(s.Domains, ",")
+}
+
 func (c *AcmeStorages) shrink() {
 	for item, del := range c.itemsDel {
 		if add, found := c.itemsAdd[item]; found && reflect.DeepEqual(add, del) {
@@ -130,6 +185,16 @@ func (c *AcmeCerts) AssignPreferredChain(preferredChain string) error {
 	return nil
 }
 
+// FindGroup ...
+func (m *ModSecurityConfig) FindGroup(name string) *ModSecurityGroup {
+	for _, group := range m.Groups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
 func (dns *DNSConfig) String() string {
 	return fmt.Sprintf("%+v", *dns)
 }
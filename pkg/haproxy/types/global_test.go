@@ -18,7 +18,6 @@ package types
 
 import (
 	"reflect"
-	"sort"
 	"testing"
 )
 
@@ -81,6 +80,21 @@ func TestBuildAcmeStorages(t *testing.T) {
 				"preferred chain already assigned to 'New Root CA'",
 			},
 		},
+		// 5
+		{
+			certs: [][]string{
+				{"cert2", "", "d2.local"},
+				{"cert10", "", "d10.local"},
+				{"cert1+", "", "d3.local"},
+				{"cert1", "", "d1.local"},
+			},
+			expected: []string{
+				"cert1,,d1.local",
+				"cert1+,,d3.local",
+				"cert10,,d10.local",
+				"cert2,,d2.local",
+			},
+		},
 	}
 	for i, test := range testCases {
 		acme := AcmeData{}
@@ -93,7 +107,6 @@ func TestBuildAcmeStorages(t *testing.T) {
 			storage.AddDomains(cert[2:])
 		}
 		storages := acme.Storages().BuildAcmeStorages()
-		sort.Strings(storages)
 		if !reflect.DeepEqual(storages, test.expected) {
 			t.Errorf("acme certs differs on %d - expected: %+v, actual: %+v", i, test.expected, storages)
 		}
@@ -179,6 +192,78 @@ func TestShrink(t *testing.T) {
 	}
 }
 
+func TestBuildCommittedStorages(t *testing.T) {
+	testCases := []struct {
+		committed [][]string
+		changes   func(storages *AcmeStorages)
+		expected  []AcmeStorage
+	}{
+		// 0
+		{
+			expected: []AcmeStorage{},
+		},
+		// 1
+		{
+			committed: [][]string{
+				{"cert2", "", "d2.local"},
+				{"cert1", "Root CA", "d1b.local", "d1a.local"},
+			},
+			expected: []AcmeStorage{
+				{Name: "cert1", Domains: []string{"d1a.local", "d1b.local"}, PreferredChain: "Root CA"},
+				{Name: "cert2", Domains: []string{"d2.local"}},
+			},
+		},
+		// 2
+		{
+			committed: [][]string{
+				{"cert1", "", "d1.local"},
+			},
+			changes: func(storages *AcmeStorages) {
+				storages.Acquire("cert2").AddDomains([]string{"d2.local"})
+			},
+			expected: []AcmeStorage{
+				{Name: "cert1", Domains: []string{"d1.local"}},
+			},
+		},
+		// 3
+		{
+			committed: [][]string{
+				{"cert1", "", "d1.local"},
+				{"cert2", "", "d2.local"},
+			},
+			changes: func(storages *AcmeStorages) {
+				storages.RemoveAll([]string{"cert1", "cert2"})
+				storages.Acquire("cert1").AddDomains([]string{"d1.local", "d3.local"})
+			},
+			expected: []AcmeStorage{
+				{Name: "cert1", Domains: []string{"d1.local"}},
+				{Name: "cert2", Domains: []string{"d2.local"}},
+			},
+		},
+	}
+	for i, test := range testCases {
+		acme := AcmeData{}
+		storages := acme.Storages()
+		for _, cert := range test.committed {
+			storage := storages.Acquire(cert[0])
+			_ = storage.AssignPreferredChain(cert[1])
+			storage.AddDomains(cert[2:])
+		}
+		storages.Commit()
+		if test.changes != nil {
+			test.changes(storages)
+		}
+		updated := storages.Updated()
+		actual := storages.BuildCommittedStorages()
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("committed storages differ on %d - expected: %+v, actual: %+v", i, test.expected, actual)
+		}
+		if storages.Updated() != updated {
+			t.Errorf("updated state changed on %d", i)
+		}
+	}
+}
+
 type testConfig struct {
 	t *testing.T
 }
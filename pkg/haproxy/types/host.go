@@ -68,7 +68,10 @@ func (h *Hosts) RemoveAll(hostnames []string) {
 	for _, hostname := range hostnames {
 		if item, found := h.items[hostname]; found {
 			h.releaseHost(item)
-			h.itemsDel[hostname] = item
+			// keeps the committed item if removed again before a commit
+			if _, found := h.itemsDel[hostname]; !found {
+				h.itemsDel[hostname] = item
+			}
 			delete(h.items, hostname)
 		}
 	}
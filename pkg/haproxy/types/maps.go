@@ -282,6 +282,7 @@ func (hm *HostsMap) rebuildMatchFiles() (matchFiles []*MatchFile) {
 			suffix = fmt.Sprintf("__%s", matchFile.match)
 		}
 		matchFile.sort()
+		matchFile.dedup()
 		matchFiles = append(matchFiles, &MatchFile{
 			matchFile: matchFile,
 			filename:  strings.Replace(hm.basename, ".", suffix+".", 1),
@@ -348,6 +349,31 @@ func findMatchFile(order *list.List, e1 *HostsMapEntry) (matchFile *hostsMapMatc
 	return nil, nil
 }
 
+// Len returns the number of entries added to the map.
+func (hm *HostsMap) Len() int {
+	if hm == nil {
+		return 0
+	}
+	var count int
+	for _, entries := range hm.rawhosts {
+		count += len(entries)
+	}
+	return count
+}
+
+// Items lists all the frontend maps, including the ones without entries.
+func (fm *FrontendMaps) Items() []*HostsMap {
+	if fm == nil {
+		return nil
+	}
+	return []*HostsMap{
+		fm.HTTPHostMap, fm.HTTPSHostMap, fm.HTTPSSNIMap,
+		fm.RedirFromRootMap, fm.RedirFromMap, fm.RedirToMap, fm.SSLPassthroughMap, fm.VarNamespaceMap,
+		fm.TLSAuthList, fm.TLSNeedCrtList, fm.TLSInvalidCrtPagesMap, fm.TLSMissingCrtPagesMap,
+		fm.DefaultHostMap,
+	}
+}
+
 // HasHost ...
 func (hm *HostsMap) HasHost() bool {
 	for _, matchFile := range hm.rawfiles {
@@ -411,6 +437,25 @@ func (mf *hostsMapMatchFile) sort() {
 	}
 }
 
+// dedup removes entries whose key was already added, keeping the first one.
+// haproxy uses the first entry that matches, so entries with a duplicated key
+// would never be used. Should be called after sort(), which moves entries with
+// the same key together, ordered by their precedence.
+func (mf *hostsMapMatchFile) dedup() {
+	e := mf.entries
+	if len(e) < 2 {
+		return
+	}
+	l := 1
+	for i := 1; i < len(e); i++ {
+		if e[i].Key != e[l-1].Key {
+			e[l] = e[i]
+			l++
+		}
+	}
+	mf.entries = e[:l]
+}
+
 func (mf *hostsMapMatchFile) lower() bool {
 	return mf.match == MatchBegin
 }
@@ -665,6 +665,22 @@ local1.tld /a0 prefix
 
 hosts__prefix_02.map first:false,lower:false,method:dir headers=['x-user':'myname2',regex:false]
 local1.tld /a2 prefix
+`,
+		},
+		// 18
+		{
+			data: []data{
+				{hostname: "local1.tld", path: "/a", match: MatchBegin, target: "backend1"},
+				{hostname: "local1.tld", path: "/A", match: MatchBegin, target: "backend2"},
+				{hostname: "local1.tld", path: "/b", match: MatchExact, target: "backend1"},
+				{hostname: "local1.tld", path: "/b", match: MatchExact, target: "backend2"},
+			},
+			expected: `
+hosts__exact.map first:true,lower:false,method:str
+local1.tld /b exact
+
+hosts__begin.map first:false,lower:true,method:beg
+local1.tld /a begin
 `,
 		},
 	}
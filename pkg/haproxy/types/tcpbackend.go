@@ -68,6 +68,21 @@ func (b *TCPBackends) BuildSortedItems() []*TCPBackend {
 	return items
 }
 
+// Len ...
+func (b *TCPBackends) Len() int {
+	return len(b.items)
+}
+
+// ItemsAdd ...
+func (b *TCPBackends) ItemsAdd() map[int]*TCPBackend {
+	return b.itemsAdd
+}
+
+// ItemsDel ...
+func (b *TCPBackends) ItemsDel() map[int]*TCPBackend {
+	return b.itemsDel
+}
+
 // Changed ...
 func (b *TCPBackends) Changed() bool {
 	return !reflect.DeepEqual(b.itemsAdd, b.itemsDel)
@@ -36,6 +36,13 @@ type AcmeStorages struct {
 	items, itemsAdd, itemsDel map[string]*AcmeCerts
 }
 
+// AcmeStorage is a read only view of an acme storage and its domains.
+type AcmeStorage struct {
+	Name           string
+	Domains        []string
+	PreferredChain string
+}
+
 // AcmeCerts ...
 type AcmeCerts struct {
 	certs          map[string]struct{}
@@ -66,6 +73,7 @@ type Global struct {
 	ForwardFor              string
 	LoadServerState         bool
 	AdminSocket             string
+	StatsSocket             string
 	LocalFSPrefix           string
 	External                ExternalConfig
 	Healthz                 HealthzConfig
@@ -181,10 +189,18 @@ type DNSNameserver struct {
 // ModSecurityConfig ...
 type ModSecurityConfig struct {
 	Endpoints []string
+	Groups    []*ModSecurityGroup
 	Timeout   ModSecurityTimeoutConfig
 	Args      []string
 }
 
+// ModSecurityGroup is a named set of ModSecurity agents, rendered in its
+// own SPOE config file and used by backends whose WAFGroup match its name.
+type ModSecurityGroup struct {
+	Name      string
+	Endpoints []string
+}
+
 // CookieConfig ...
 type CookieConfig struct {
 	Key string
@@ -556,6 +572,7 @@ type HostRedirectConfig struct {
 type HostTLSConfig struct {
 	TLSConfig
 	CAErrorPage   string
+	Labels        map[string]string
 	UseDefaultCrt bool
 }
 
@@ -569,6 +586,25 @@ const (
 	EpTargetRef
 )
 
+// Keys used to distribute the backends among the backend shards, see
+// Backends.SetShardBy()
+const (
+	ShardByBackend   = "backend"
+	ShardByNamespace = "namespace"
+)
+
+// Endpoint sorting modes, see Backends.SortChangedEndpoints()
+const (
+	SortEndpointsByEndpoint = "endpoint"
+	SortEndpointsByEp       = "ep"
+	SortEndpointsByName     = "name"
+	SortEndpointsByIP       = "ip"
+	SortEndpointsByStable   = "stable"
+	SortEndpointsByPreserve = "preserve"
+	SortEndpointsByRandom   = "random"
+	SortEndpointsByNone     = "none"
+)
+
 // EndpointCookieStrategy ...
 type EndpointCookieStrategy int
 
@@ -584,6 +620,7 @@ type Backends struct {
 	//
 	authBackends   map[string]*Backend
 	shards         []map[string]*Backend
+	shardBy        string
 	changedShards  map[int]bool
 	DefaultBackend *Backend
 }
@@ -640,6 +677,7 @@ type Backend struct {
 	Server           ServerConfig
 	Timeout          BackendTimeoutConfig
 	TLS              BackendTLSConfig
+	WAFGroup         string
 }
 
 // Endpoint ...
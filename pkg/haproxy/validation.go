@@ -0,0 +1,116 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is an alert issued by haproxy while validating a configuration.
+// File and Line are empty if the alert does not refer to a configuration line.
+type ConfigError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e ConfigError) String() string {
+	if e.File == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// ValidationError is the error returned when haproxy fails to validate a
+// configuration. Output has the raw output of the haproxy check, and Errors
+// has the alerts that could be parsed from it.
+type ValidationError struct {
+	Output string
+	Errors []ConfigError
+}
+
+func newValidationError(out string) *ValidationError {
+	return &ValidationError{
+		Output: out,
+		Errors: parseConfigErrors(out),
+	}
+}
+
+func (e *ValidationError) Error() string {
+	return e.Output
+}
+
+// Summary lists the parsed alerts, one per line, falling back to the raw
+// output if no alert could be parsed.
+func (e *ValidationError) Summary() string {
+	if len(e.Errors) == 0 {
+		return e.Output
+	}
+	lines := make([]string, len(e.Errors))
+	for i, cfgErr := range e.Errors {
+		lines[i] = cfgErr.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validationSummary returns the summary of a ValidationError, or the
+// message of any other error.
+func validationSummary(err error) string {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Summary()
+	}
+	return err.Error()
+}
+
+var (
+	// `[ALERT] 123/102030 (1234) : message` up to haproxy 2.3, and
+	// `[ALERT]    (1234) : config : message` since 2.4
+	configAlertRegex = regexp.MustCompile(`^\[ALERT\][^:]*:\s*(?:config\s*:\s*)?(.*)$`)
+	// `parsing [/etc/haproxy/haproxy.cfg:12] : message` or `[/etc/haproxy/haproxy.cfg:12] : message`
+	configLocationRegex = regexp.MustCompile(`\[([^\]\s]+):([0-9]+)\](?:\s*:\s*(.*))?`)
+	// generic alerts that only summarize the ones already reported
+	configSummaryRegex = regexp.MustCompile(`^(Error\(s\) found in configuration file|Fatal errors found in configuration)`)
+)
+
+func parseConfigErrors(out string) []ConfigError {
+	var cfgErrs []ConfigError
+	for _, line := range strings.Split(out, "\n") {
+		match := configAlertRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		msg := strings.TrimSpace(match[1])
+		if msg == "" || configSummaryRegex.MatchString(msg) {
+			continue
+		}
+		cfgErr := ConfigError{Message: msg}
+		if loc := configLocationRegex.FindStringSubmatch(msg); loc != nil {
+			cfgErr.File = loc[1]
+			cfgErr.Line, _ = strconv.Atoi(loc[2])
+			if loc[3] != "" {
+				cfgErr.Message = strings.TrimSpace(loc[3])
+			}
+		}
+		cfgErrs = append(cfgErrs, cfgErr)
+	}
+	return cfgErrs
+}
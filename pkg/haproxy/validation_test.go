@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package haproxy
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfigErrors(t *testing.T) {
+	testCases := []struct {
+		out        string
+		expErrors  []ConfigError
+		expSummary string
+	}{
+		// 0
+		{
+			out:        "",
+			expSummary: "",
+		},
+		// 1
+		{
+			out: `[ALERT] 123/102030 (1234) : parsing [/etc/haproxy/haproxy.cfg:12] : unknown keyword 'invalid' in 'global' section
+[ALERT] 123/102030 (1234) : Error(s) found in configuration file : /etc/haproxy/haproxy.cfg
+[ALERT] 123/102030 (1234) : Fatal errors found in configuration.
+`,
+			expErrors: []ConfigError{
+				{File: "/etc/haproxy/haproxy.cfg", Line: 12, Message: "unknown keyword 'invalid' in 'global' section"},
+			},
+			expSummary: "/etc/haproxy/haproxy.cfg:12: unknown keyword 'invalid' in 'global' section",
+		},
+		// 2
+		{
+			out: `[NOTICE]   (1) : haproxy version is 2.6.0
+[ALERT]    (1) : config : parsing [/etc/haproxy/haproxy.cfg:12] : unknown keyword 'invalid' in 'global' section
+[ALERT]    (1) : config : [/etc/haproxy/haproxy5-backend001.cfg:40] : 'server d1_app_8080/s1' : could not resolve address 'app'.
+[ALERT]    (1) : config : Proxy 'd1_app_8080': unable to find required use_backend: 'missing'.
+[ALERT]    (1) : config : Fatal errors found in configuration.
+`,
+			expErrors: []ConfigError{
+				{File: "/etc/haproxy/haproxy.cfg", Line: 12, Message: "unknown keyword 'invalid' in 'global' section"},
+				{File: "/etc/haproxy/haproxy5-backend001.cfg", Line: 40, Message: "'server d1_app_8080/s1' : could not resolve address 'app'."},
+				{Message: "Proxy 'd1_app_8080': unable to find required use_backend: 'missing'."},
+			},
+			expSummary: `/etc/haproxy/haproxy.cfg:12: unknown keyword 'invalid' in 'global' section
+/etc/haproxy/haproxy5-backend001.cfg:40: 'server d1_app_8080/s1' : could not resolve address 'app'.
+Proxy 'd1_app_8080': unable to find required use_backend: 'missing'.`,
+		},
+		// 3
+		{
+			out:        "unexpected output\n",
+			expSummary: "unexpected output\n",
+		},
+	}
+	for i, test := range testCases {
+		err := newValidationError(test.out)
+		if !reflect.DeepEqual(err.Errors, test.expErrors) {
+			t.Errorf("%d: expected errors %+v but was %+v", i, test.expErrors, err.Errors)
+		}
+		if err.Error() != test.out {
+			t.Errorf("%d: expected raw output '%s' but was '%s'", i, test.out, err.Error())
+		}
+		if summary := validationSummary(fmt.Errorf("wrapped: %w", err)); summary != test.expSummary {
+			t.Errorf("%d: expected summary '%s' but was '%s'", i, test.expSummary, summary)
+		}
+	}
+}
@@ -30,6 +30,7 @@ func main() {
 	hc := controller.NewHAProxyController()
 	errCh := make(chan error)
 	go handleSignal(hc, errCh)
+	go handleReloadSignal(hc)
 	hc.Start()
 	code := 0
 	err := <-errCh
@@ -47,3 +48,17 @@ func handleSignal(hc *controller.HAProxyController, err chan error) {
 	klog.Infof("Shutting down with signal %v", <-sig)
 	err <- hc.Stop()
 }
+
+func handleReloadSignal(hc *controller.HAProxyController) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	// signals received during the startup are handled once the controller is
+	// started, instead of racing with its initialization
+	<-hc.Started()
+	for range sig {
+		klog.Infof("Reloading templates with signal SIGHUP")
+		if err := hc.ReloadTemplates(); err != nil {
+			klog.Errorf("Error reloading templates, keeping the current ones: %v", err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// EventRecorder records events of the controller, e.g. haproxy reloads.
+// Implementations should not block the caller.
+type EventRecorder interface {
+	Event(eventtype, reason, message string)
+}
+
+// Types of the recorded events, see EventRecorder
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
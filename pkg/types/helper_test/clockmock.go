@@ -0,0 +1,80 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper_test
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockMock is a types.Clock whose time only changes via Add(). Channels
+// returned by After() receive the time once Add() reaches their deadline.
+type ClockMock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []clockWaiter
+}
+
+type clockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewClockMock ...
+func NewClockMock(now time.Time) *ClockMock {
+	return &ClockMock{now: now}
+}
+
+// Now ...
+func (c *ClockMock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After ...
+func (c *ClockMock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, clockWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Waiters returns the number of After() channels not fired yet.
+func (c *ClockMock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// Add moves the clock forward, firing the After() channels whose deadline
+// was reached.
+func (c *ClockMock) Add(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	var waiters []clockWaiter
+	for _, w := range c.waiters {
+		if c.now.Before(w.deadline) {
+			waiters = append(waiters, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiters
+}
@@ -22,6 +22,9 @@ import (
 	"testing"
 
 	"github.com/kylelemons/godebug/diff"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/utils"
 )
 
 // LoggerMock ...
@@ -30,6 +33,13 @@ type LoggerMock struct {
 	T       *testing.T
 }
 
+// loggerMockFields shares the Logging of its parent LoggerMock, adding
+// fields to the messages.
+type loggerMockFields struct {
+	parent *LoggerMock
+	fields map[string]interface{}
+}
+
 // NewLoggerMock ...
 func NewLoggerMock(t *testing.T) *LoggerMock {
 	return &LoggerMock{
@@ -63,10 +73,43 @@ func (l *LoggerMock) Fatal(msg string, args ...interface{}) {
 	l.log("FATAL", msg, args...)
 }
 
+// WithFields ...
+func (l *LoggerMock) WithFields(fields map[string]interface{}) types.Logger {
+	return &loggerMockFields{parent: l, fields: fields}
+}
+
 func (l *LoggerMock) log(level, msg string, args ...interface{}) {
 	l.Logging = append(l.Logging, fmt.Sprintf(level+" "+msg, args...))
 }
 
+func (l *loggerMockFields) Info(msg string, args ...interface{}) {
+	l.log("INFO", msg, args...)
+}
+
+func (l *loggerMockFields) InfoV(v int, msg string, args ...interface{}) {
+	l.log(fmt.Sprintf("INFO-V(%d)", v), msg, args...)
+}
+
+func (l *loggerMockFields) Warn(msg string, args ...interface{}) {
+	l.log("WARN", msg, args...)
+}
+
+func (l *loggerMockFields) Error(msg string, args ...interface{}) {
+	l.log("ERROR", msg, args...)
+}
+
+func (l *loggerMockFields) Fatal(msg string, args ...interface{}) {
+	l.log("FATAL", msg, args...)
+}
+
+func (l *loggerMockFields) WithFields(fields map[string]interface{}) types.Logger {
+	return &loggerMockFields{parent: l.parent, fields: utils.MergeLogFields(l.fields, fields)}
+}
+
+func (l *loggerMockFields) log(level, msg string, args ...interface{}) {
+	l.parent.Logging = append(l.parent.Logging, level+" "+fmt.Sprintf(msg, args...)+utils.FormatLogFields(l.fields))
+}
+
 // CompareLogging ...
 func (l *LoggerMock) CompareLogging(expected string) {
 	l.compareText(strings.Join(l.Logging, "\n"), expected)
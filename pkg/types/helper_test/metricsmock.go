@@ -17,14 +17,26 @@ limitations under the License.
 package helper_test
 
 import (
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
 )
 
 // MetricsMock ...
 type MetricsMock struct {
-	Logging []string
-	T       *testing.T
+	Logging                []string
+	T                      *testing.T
+	ReloadFailingSeconds   float64
+	ReloadSocketsNotReused int
+	ReloadBlocked          int
+	LastSuccessfulApply    time.Time
+	ConfigBytes            int
+	ConfigRotateErrors     int
+	MapsBytes              int
+	Reloads                []string
+	AcmeLeader             bool
 }
 
 // NewMetricsMock ...
@@ -44,11 +56,20 @@ func (m *MetricsMock) HAProxySetServerResponseTime(duration time.Duration) {
 func (m *MetricsMock) HAProxySetSSLCertResponseTime(duration time.Duration) {
 }
 
+// HAProxySetMapResponseTime ...
+func (m *MetricsMock) HAProxySetMapResponseTime(duration time.Duration) {
+}
+
 // ControllerProcTime ...
 func (m *MetricsMock) ControllerProcTime(task string, duration time.Duration) {
 
 }
 
+// ObservePhase ...
+func (m *MetricsMock) ObservePhase(name string, duration time.Duration) {
+
+}
+
 // AddIdleFactor ...
 func (m *MetricsMock) AddIdleFactor(idle int) {
 }
@@ -65,16 +86,111 @@ func (m *MetricsMock) IncUpdateDynamic() {
 func (m *MetricsMock) IncUpdateFull() {
 }
 
+// IncUpdateDynamicLimited ...
+func (m *MetricsMock) IncUpdateDynamicLimited() {
+
+}
+
+// IncUpdateReloadBlocked ...
+func (m *MetricsMock) IncUpdateReloadBlocked() {
+	m.ReloadBlocked++
+}
+
 // UpdateSuccessful ...
 func (m *MetricsMock) UpdateSuccessful(success bool) {
 }
 
+// AddChangedShards ...
+func (m *MetricsMock) AddChangedShards(n int) {
+}
+
+// AddConfigFilesWritten ...
+func (m *MetricsMock) AddConfigFilesWritten(files, bytes int) {
+}
+
+// IncConfigRotateError ...
+func (m *MetricsMock) IncConfigRotateError() {
+	m.ConfigRotateErrors++
+}
+
+// SetConfigBytes ...
+func (m *MetricsMock) SetConfigBytes(bytes int) {
+	m.ConfigBytes = bytes
+}
+
+// SetMapsBytes ...
+func (m *MetricsMock) SetMapsBytes(bytes int) {
+	m.MapsBytes = bytes
+}
+
+// SetOldWorkers ...
+func (m *MetricsMock) SetOldWorkers(n int) {
+
+}
+
+// SetReloadQueueDepth ...
+func (m *MetricsMock) SetReloadQueueDepth(n int) {
+}
+
+// SetReloadFailingSeconds ...
+func (m *MetricsMock) SetReloadFailingSeconds(seconds float64) {
+	m.ReloadFailingSeconds = seconds
+}
+
+// SetLastSuccessfulApply ...
+func (m *MetricsMock) SetLastSuccessfulApply(t time.Time) {
+	m.LastSuccessfulApply = t
+}
+
+// IncServerStatePersistSuccess ...
+func (m *MetricsMock) IncServerStatePersistSuccess() {
+}
+
+// IncServerStatePersistError ...
+func (m *MetricsMock) IncServerStatePersistError() {
+}
+
+// IncReloadScriptWarning ...
+func (m *MetricsMock) IncReloadScriptWarning() {
+}
+
+// IncReloadScriptError ...
+func (m *MetricsMock) IncReloadScriptError() {
+}
+
+// IncReloadStrategyFallback ...
+func (m *MetricsMock) IncReloadStrategyFallback(strategy string) {
+}
+
+// IncReloadSocketsNotReused ...
+func (m *MetricsMock) IncReloadSocketsNotReused() {
+	m.ReloadSocketsNotReused++
+}
+
+// ObserveReload ...
+func (m *MetricsMock) ObserveReload(mode, strategy string, success bool, duration time.Duration) {
+	m.Reloads = append(m.Reloads, fmt.Sprintf("mode=%s strategy=%s success=%t", mode, strategy, success))
+}
+
 // SetCertExpireDate ...
-func (m *MetricsMock) SetCertExpireDate(domain, cn string, notAfter *time.Time) {
+func (m *MetricsMock) SetCertExpireDate(domain, cn string, labels map[string]string, notAfter *time.Time) {
+}
+
+// ReplaceCertExpire ...
+func (m *MetricsMock) ReplaceCertExpire(certs []types.CertExpire) {
+}
+
+// SetManagedCertCount ...
+func (m *MetricsMock) SetManagedCertCount(n int) {
+}
+
+// SetNextCertExpiry ...
+func (m *MetricsMock) SetNextCertExpiry(notAfter time.Time) {
 }
 
-// ClearCertExpire ...
-func (m *MetricsMock) ClearCertExpire() {
+// SetAcmeLeaderStatus ...
+func (m *MetricsMock) SetAcmeLeaderStatus(leader bool) {
+	m.AcmeLeader = leader
 }
 
 // IncCertSigningMissing ...
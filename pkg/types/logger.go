@@ -23,4 +23,5 @@ type Logger interface {
 	Warn(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
 	Fatal(msg string, args ...interface{})
+	WithFields(fields map[string]interface{}) Logger
 }
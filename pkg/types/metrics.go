@@ -25,15 +25,57 @@ type Metrics interface {
 	HAProxyShowInfoResponseTime(duration time.Duration)
 	HAProxySetServerResponseTime(duration time.Duration)
 	HAProxySetSSLCertResponseTime(duration time.Duration)
+	HAProxySetMapResponseTime(duration time.Duration)
 	ControllerProcTime(task string, duration time.Duration)
+	ObservePhase(name string, duration time.Duration)
 	AddIdleFactor(idle int)
 	IncUpdateNoop()
 	IncUpdateDynamic()
 	IncUpdateFull()
+	IncUpdateDynamicLimited()
+	IncUpdateReloadBlocked()
 	UpdateSuccessful(success bool)
-	SetCertExpireDate(domain, cn string, notAfter *time.Time)
-	ClearCertExpire()
+	AddChangedShards(n int)
+	AddConfigFilesWritten(files, bytes int)
+	IncConfigRotateError()
+	SetConfigBytes(bytes int)
+	SetMapsBytes(bytes int)
+	SetOldWorkers(n int)
+	SetReloadQueueDepth(n int)
+	SetReloadFailingSeconds(seconds float64)
+	SetLastSuccessfulApply(t time.Time)
+	IncServerStatePersistSuccess()
+	IncServerStatePersistError()
+	IncReloadScriptWarning()
+	IncReloadScriptError()
+	IncReloadStrategyFallback(strategy string)
+	IncReloadSocketsNotReused()
+	ObserveReload(mode, strategy string, success bool, duration time.Duration)
+	SetCertExpireDate(domain, cn string, labels map[string]string, notAfter *time.Time)
+	ReplaceCertExpire(certs []CertExpire)
+	SetManagedCertCount(n int)
+	SetNextCertExpiry(notAfter time.Time)
+	SetAcmeLeaderStatus(leader bool)
 	IncCertSigningMissing(domains string, success bool)
 	IncCertSigningExpiring(domains string, success bool)
 	IncCertSigningOutdated(domains string, success bool)
 }
+
+// CertExpire ...
+type CertExpire struct {
+	Domain   string
+	CN       string
+	Labels   map[string]string
+	NotAfter time.Time
+}
+
+// Optional labels of the certificate expiration metric. Labels are
+// exported with an empty value if missing, and unknown labels are ignored.
+const (
+	CertExpireLabelNamespace = "namespace"
+	CertExpireLabelIngress   = "ingress"
+)
+
+// CertExpireLabels lists, in order, the optional labels of the certificate
+// expiration metric.
+var CertExpireLabels = []string{CertExpireLabelNamespace, CertExpireLabelIngress}
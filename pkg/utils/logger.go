@@ -0,0 +1,64 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MergeLogFields returns a new map with the fields of both maps. Fields of
+// the second map override the ones of the first map with the same name.
+func MergeLogFields(fields, other map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(fields)+len(other))
+	for key, value := range fields {
+		merged[key] = value
+	}
+	for key, value := range other {
+		merged[key] = value
+	}
+	return merged
+}
+
+// FormatLogFields formats the fields as a list of key=value pairs, sorted by
+// key, which is appended to the human readable message of a log entry.
+// Numbers and booleans are used as is, everything else is quoted.
+func FormatLogFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var out strings.Builder
+	for _, key := range keys {
+		out.WriteString(" ")
+		out.WriteString(key)
+		out.WriteString("=")
+		switch value := fields[key].(type) {
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			out.WriteString(fmt.Sprint(value))
+		default:
+			out.WriteString(strconv.Quote(fmt.Sprint(value)))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatLogFields(t *testing.T) {
+	testCases := []struct {
+		fields   map[string]interface{}
+		expected string
+	}{
+		// 0
+		{
+			expected: "",
+		},
+		// 1
+		{
+			fields:   map[string]interface{}{"host_count": 2},
+			expected: " host_count=2",
+		},
+		// 2
+		{
+			fields:   map[string]interface{}{"reload_reason": "config changed", "success": true, "backend_count": 1},
+			expected: ` backend_count=1 reload_reason="config changed" success=true`,
+		},
+		// 3
+		{
+			fields:   map[string]interface{}{"hosts": []string{"h1", "h2"}, "duration": 1500 * time.Millisecond},
+			expected: ` duration="1.5s" hosts="[h1 h2]"`,
+		},
+	}
+	for i, test := range testCases {
+		if actual := FormatLogFields(test.fields); actual != test.expected {
+			t.Errorf("expected '%s' on %d, but was '%s'", test.expected, i, actual)
+		}
+	}
+}
+
+func TestMergeLogFields(t *testing.T) {
+	fields := map[string]interface{}{"a": 1, "b": 2}
+	merged := MergeLogFields(fields, map[string]interface{}{"b": 3, "c": 4})
+	if actual, expected := FormatLogFields(merged), " a=1 b=3 c=4"; actual != expected {
+		t.Errorf("expected '%s', but was '%s'", expected, actual)
+	}
+	if actual, expected := FormatLogFields(fields), " a=1 b=2"; actual != expected {
+		t.Errorf("expected original fields '%s', but was '%s'", expected, actual)
+	}
+}
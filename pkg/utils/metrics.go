@@ -0,0 +1,69 @@
+/*
+Copyright 2026 The HAProxy Ingress Controller Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"time"
+
+	"github.com/jcmoraisjr/haproxy-ingress/pkg/types"
+)
+
+// NoopMetrics is an implementation of types.Metrics which discards all the
+// observations, used when metrics aren't collected.
+var NoopMetrics types.Metrics = noopMetrics{}
+
+type noopMetrics struct{}
+
+func (noopMetrics) HAProxyShowInfoResponseTime(duration time.Duration)     {}
+func (noopMetrics) HAProxySetServerResponseTime(duration time.Duration)    {}
+func (noopMetrics) HAProxySetSSLCertResponseTime(duration time.Duration)   {}
+func (noopMetrics) HAProxySetMapResponseTime(duration time.Duration)       {}
+func (noopMetrics) ControllerProcTime(task string, duration time.Duration) {}
+func (noopMetrics) ObservePhase(name string, duration time.Duration)       {}
+func (noopMetrics) AddIdleFactor(idle int)                                 {}
+func (noopMetrics) IncUpdateNoop()                                         {}
+func (noopMetrics) IncUpdateDynamic()                                      {}
+func (noopMetrics) IncUpdateFull()                                         {}
+func (noopMetrics) IncUpdateDynamicLimited()                               {}
+func (noopMetrics) IncUpdateReloadBlocked()                                {}
+func (noopMetrics) UpdateSuccessful(success bool)                          {}
+func (noopMetrics) AddChangedShards(n int)                                 {}
+func (noopMetrics) AddConfigFilesWritten(files, bytes int)                 {}
+func (noopMetrics) IncConfigRotateError()                                  {}
+func (noopMetrics) SetConfigBytes(bytes int)                               {}
+func (noopMetrics) SetMapsBytes(bytes int)                                 {}
+func (noopMetrics) SetOldWorkers(n int)                                    {}
+func (noopMetrics) SetReloadQueueDepth(n int)                              {}
+func (noopMetrics) SetReloadFailingSeconds(seconds float64)                {}
+func (noopMetrics) SetLastSuccessfulApply(t time.Time)                     {}
+func (noopMetrics) IncServerStatePersistSuccess()                          {}
+func (noopMetrics) IncServerStatePersistError()                            {}
+func (noopMetrics) IncReloadScriptWarning()                                {}
+func (noopMetrics) IncReloadScriptError()                                  {}
+func (noopMetrics) IncReloadStrategyFallback(strategy string)              {}
+func (noopMetrics) IncReloadSocketsNotReused()                             {}
+func (noopMetrics) ObserveReload(mode, strategy string, success bool, duration time.Duration) {
+}
+func (noopMetrics) SetCertExpireDate(domain, cn string, labels map[string]string, notAfter *time.Time) {
+}
+func (noopMetrics) ReplaceCertExpire(certs []types.CertExpire)          {}
+func (noopMetrics) SetManagedCertCount(n int)                           {}
+func (noopMetrics) SetNextCertExpiry(notAfter time.Time)                {}
+func (noopMetrics) SetAcmeLeaderStatus(leader bool)                     {}
+func (noopMetrics) IncCertSigningMissing(domains string, success bool)  {}
+func (noopMetrics) IncCertSigningExpiring(domains string, success bool) {}
+func (noopMetrics) IncCertSigningOutdated(domains string, success bool) {}
@@ -43,22 +43,23 @@ func NewTimer(observer func(task string, duration time.Duration)) *Timer {
 	}
 }
 
-// Tick ...
-func (t *Timer) Tick(eventLabel string) {
+// Tick registers a new event and returns the elapsed time since the
+// former event, or since the timer start if this is the first one.
+func (t *Timer) Tick(eventLabel string) time.Duration {
 	now := time.Now()
+	last := t.Start
+	if len(t.Ticks) > 0 {
+		last = t.Ticks[len(t.Ticks)-1].When
+	}
+	duration := now.Sub(last)
 	if t.observer != nil {
-		var last time.Time
-		if len(t.Ticks) > 0 {
-			last = t.Ticks[len(t.Ticks)-1].When
-		} else {
-			last = t.Start
-		}
-		t.observer(eventLabel, now.Sub(last))
+		t.observer(eventLabel, duration)
 	}
 	t.Ticks = append(t.Ticks, &Tick{
 		Event: eventLabel,
 		When:  now,
 	})
+	return duration
 }
 
 // AsString ...
@@ -17,7 +17,7 @@
 #
 # A script to help with haproxy reloads. Needs sudo if haproxy uses :80 / :443.
 #
-# ./haproxy-reload.sh <strategy> <cfg> [<need-state>]
+# ./haproxy-reload.sh <strategy> <cfg> <local-fs-prefix> [<need-state> [<drain-timeout>]]
 #
 # <strategy>: `native`
 #    Uses native HAProxy soft restart. Running it for the first time starts
@@ -30,6 +30,10 @@
 #
 # <need-state>: optional, defaults to `false`, anything != 0 means `true`
 #
+# <drain-timeout>: optional, defaults to `0`, time in seconds old processes
+#    have to finish handling requests before being terminated. `0` means
+#    wait for them, limited by `hard-stop-after` of their own configuration.
+#
 # HAProxy options:
 #  -f config file
 #  -p pid file
@@ -45,13 +49,15 @@ PARAM_STRATEGY="$1"
 PARAM_CFG="$2"
 PARAM_LOCAL_FS_PREFIX="$3"
 PARAM_STATE="${4:-0}"
+PARAM_DRAIN="${5:-0}"
 
 HAPROXY_SOCKET="${PARAM_LOCAL_FS_PREFIX}/var/run/haproxy/admin.sock"
 HAPROXY_STATE="${PARAM_LOCAL_FS_PREFIX}/var/lib/haproxy/state-global"
 HAPROXY_PID="${PARAM_LOCAL_FS_PREFIX}/var/run/haproxy/haproxy.pid"
 OLD_PID=$(cat "$HAPROXY_PID" 2>/dev/null || :)
 
-# Only create the state file if the configuration need it
+# Only create the state file if the configuration need it. The whole output
+# is persisted, including the operational and health check state of the servers
 if [ "$PARAM_STATE" != "0" ]; then
     if [ -S "$HAPROXY_SOCKET" ]; then
         echo "show servers state" | socat "$HAPROXY_SOCKET" - > /tmp/state && mv /tmp/state "$HAPROXY_STATE"
@@ -61,6 +67,20 @@ if [ "$PARAM_STATE" != "0" ]; then
     fi
 fi
 
+# Start time of a process, used to identify it regardless of pid reuse
+proc_start() {
+    cut -d' ' -f22 "/proc/$1/stat" 2>/dev/null || :
+}
+
+# Old processes and their start time, read before the reload since they
+# might finish and have their pids reused while draining connections
+OLD_PROCS=""
+if [ "$PARAM_DRAIN" != "0" ]; then
+    for pid in $OLD_PID; do
+        OLD_PROCS="$OLD_PROCS $pid:$(proc_start "$pid")"
+    done
+fi
+
 # Any strategy != `native` means `reusesocket` or `multibinder`
 # If there isn't a unix socket (eg first start) fallback to native
 if [ "$PARAM_STRATEGY" != "native" ] && [ -S "$HAPROXY_SOCKET" ]; then
@@ -68,3 +88,20 @@ if [ "$PARAM_STRATEGY" != "native" ] && [ -S "$HAPROXY_SOCKET" ]; then
 else
     haproxy -f "$PARAM_CFG" -p "$HAPROXY_PID" -D -sf $OLD_PID
 fi
+
+# Terminate old processes that are still draining connections after
+# <drain-timeout>. A pid is only terminated if its start time didn't change,
+# so a process that reused the pid of a finished one is left untouched.
+# Output is detached so the reload doesn't wait for it.
+if [ -n "$OLD_PROCS" ]; then
+    (
+        sleep "$PARAM_DRAIN"
+        for proc in $OLD_PROCS; do
+            pid="${proc%%:*}"
+            start="${proc#*:}"
+            if [ -n "$start" ] && [ "$(proc_start "$pid")" = "$start" ]; then
+                kill -TERM "$pid" 2>/dev/null || :
+            fi
+        done
+    ) >/dev/null 2>&1 &
+fi